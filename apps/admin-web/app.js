@@ -7,6 +7,7 @@ const statusEl = document.getElementById("status");
 const sessionHint = document.getElementById("sessionHint");
 
 const branchName = document.getElementById("branchName");
+const branchTimezone = document.getElementById("branchTimezone");
 const branchList = document.getElementById("branchList");
 const areaBranchId = document.getElementById("areaBranchId");
 const areaName = document.getElementById("areaName");
@@ -240,7 +241,7 @@ async function loadBranches() {
   }
   const data = await api(`/api/admin/branches?tenant_id=${tenantId}`);
   renderList(branchList, data, (branch) =>
-    itemCard(branch.name, branch.branch_id, "Delete", () => deleteBranch(branch.branch_id))
+    itemCard(branch.name, `${branch.branch_id} · ${branch.timezone}`, "Delete", () => deleteBranch(branch.branch_id))
   );
 }
 
@@ -262,12 +263,13 @@ async function onCreateBranch() {
     setHint("Tenant ID and branch name are required.");
     return;
   }
-  const payload = { tenant_id: tenantId, name: branchName.value.trim() };
+  const payload = { tenant_id: tenantId, name: branchName.value.trim(), timezone: branchTimezone.value.trim() };
   const created = await api("/api/admin/branches", {
     method: "POST",
     body: JSON.stringify(payload),
   });
   branchName.value = "";
+  branchTimezone.value = "";
   if (created?.status === "pending") {
     setHint("Branch pending approval.");
   }
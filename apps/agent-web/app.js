@@ -11,6 +11,7 @@ const state = {
   branchId: "",
   serviceId: "",
   supervisor: false,
+  lastClosed: null,
 };
 
 const authBaseInput = document.getElementById("authBase");
@@ -31,24 +32,35 @@ const savePresenceBtn = document.getElementById("savePresence");
 const supervisorToggle = document.getElementById("supervisorToggle");
 const supervisorPanel = document.getElementById("supervisorPanel");
 const counterList = document.getElementById("counterList");
+const searchNumber = document.getElementById("searchNumber");
+const searchPhone = document.getElementById("searchPhone");
+const searchDate = document.getElementById("searchDate");
+const searchBtn = document.getElementById("searchBtn");
+const searchResults = document.getElementById("searchResults");
+const searchMoreBtn = document.getElementById("searchMoreBtn");
 const serviceSelect = document.getElementById("serviceSelect");
 const refreshBtn = document.getElementById("refreshBtn");
 const ticketList = document.getElementById("ticketList");
 const status = document.getElementById("status");
 const activeTicket = document.getElementById("activeTicket");
+const activeList = document.getElementById("activeList");
 const callNextBtn = document.getElementById("callNextBtn");
 const recallBtn = document.getElementById("recallBtn");
 const startBtn = document.getElementById("startBtn");
 const completeBtn = document.getElementById("completeBtn");
 const holdBtn = document.getElementById("holdBtn");
 const unholdBtn = document.getElementById("unholdBtn");
+const holdReasonInput = document.getElementById("holdReason");
+const heldList = document.getElementById("heldList");
 const noShowBtn = document.getElementById("noShowBtn");
 const cancelBtn = document.getElementById("cancelBtn");
+const reopenBtn = document.getElementById("reopenBtn");
 const transferBtn = document.getElementById("transferBtn");
 const transferSelect = document.getElementById("transferService");
 const alertBox = document.getElementById("alert");
 const logoutBtn = document.getElementById("logoutBtn");
 let socket = null;
+let resumeSeq = 0;
 let reconnectDelay = 1000;
 let reconnectTimer = null;
 let availableCounters = [];
@@ -171,6 +183,7 @@ function setRoleGate(role) {
     el.disabled = !allowed;
   });
   supervisorToggle.disabled = role !== "supervisor";
+  reopenBtn.hidden = role !== "supervisor";
 }
 
 function uuidv4() {
@@ -208,7 +221,8 @@ function updateServiceSelect(services) {
     const option = document.createElement("option");
     option.value = service.service_id;
     option.textContent = `${service.name} (${service.code})`;
-    option.dataset.sla = service.sla_minutes;
+    option.dataset.sla = service.duration_minutes || service.sla_minutes;
+    option.dataset.parallel = service.parallel_capacity || 1;
     serviceSelect.appendChild(option);
 
     const transferOption = document.createElement("option");
@@ -302,11 +316,18 @@ async function loadCounters() {
   setPresenceFromSelection();
 }
 
-function estimateEta(position, slaMinutes) {
+// ETA is weighted by people rather than tickets: a party of three ahead
+// takes roughly three service slots. Rooms and chairs serve in parallel, so
+// slots are spread over the service's total capacity.
+function estimateEta(peopleAhead, slaMinutes, parallel = 1) {
   if (!slaMinutes || Number.isNaN(slaMinutes)) {
     return "ETA: n/a";
   }
-  return `ETA ~${position * slaMinutes}m`;
+  return `ETA ~${Math.ceil(peopleAhead / Math.max(parallel, 1)) * slaMinutes}m`;
+}
+
+function partyLabel(ticket) {
+  return ticket.party_size > 1 ? ` · Party of ${ticket.party_size}` : "";
 }
 
 async function refreshQueue() {
@@ -325,6 +346,7 @@ async function refreshQueue() {
   }
   const tickets = await response.json();
   const sla = Number(serviceSelect.selectedOptions[0]?.dataset?.sla || 0);
+  const parallel = Number(serviceSelect.selectedOptions[0]?.dataset?.parallel || 1);
 
   ticketList.innerHTML = "";
   if (tickets.length === 0) {
@@ -332,16 +354,29 @@ async function refreshQueue() {
     return;
   }
 
-  tickets.forEach((ticket, index) => {
+  let people = 0;
+  tickets.forEach((ticket) => {
+    const remote = ticket.status === "remote";
+    if (!remote) {
+      people += ticket.party_size || 1;
+    }
     const card = document.createElement("div");
     card.className = "ticket";
     card.innerHTML = `
       <div>
         <strong>${ticket.ticket_number}</strong>
-        <div><span>Status: ${ticket.status}</span></div>
+        <div><span>Status: ${ticket.status}${partyLabel(ticket)}</span></div>
       </div>
-      <span>${estimateEta(index + 1, sla)}</span>
+      <span>${remote ? formatRemoteExpiry(ticket.remote_expires_at) : estimateEta(people, sla, parallel)}</span>
     `;
+    if (remote) {
+      const button = document.createElement("button");
+      button.textContent = "Confirm Arrival";
+      button.addEventListener("click", () => {
+        performAction("confirm-arrival", ticket.ticket_id).catch(() => setStatus("Confirm arrival failed"));
+      });
+      card.appendChild(button);
+    }
     ticketList.appendChild(card);
   });
   setStatus(`Loaded ${tickets.length} tickets`);
@@ -368,11 +403,25 @@ function connectRealtime() {
       branch_id: branchSelect.value || "",
       service_id: serviceSelect.value || "",
     };
+    // After a reconnect, ask for the events missed in between.
+    if (resumeSeq) {
+      msg.resume_from = resumeSeq;
+    }
     socket.send(JSON.stringify(msg));
   };
   socket.onmessage = (event) => {
     try {
       const parsed = JSON.parse(event.data);
+      if (parsed.type === "resync_required") {
+        resumeSeq = 0;
+        refreshQueue().catch(() => setStatus("Failed to load queue"));
+        loadActiveTicket().catch(() => setStatus("Failed to load active ticket"));
+        loadHeldTickets().catch(() => setStatus("Failed to load held tickets"));
+        return;
+      }
+      if (parsed.seq) {
+        resumeSeq = parsed.seq;
+      }
       handleRealtimeEvent(parsed);
     } catch (err) {
       return;
@@ -418,6 +467,7 @@ function handleRealtimeEvent(event) {
   }
   refreshQueue().catch(() => setStatus("Failed to load queue"));
   loadActiveTicket().catch(() => setStatus("Failed to load active ticket"));
+  loadHeldTickets().catch(() => setStatus("Failed to load held tickets"));
 }
 
 function renderActive(ticket) {
@@ -440,9 +490,9 @@ function renderActive(ticket) {
   activeTicket.innerHTML = `
     <div>
       <strong>${ticket.ticket_number}</strong>
-      <div><span>Status: ${ticket.status}</span></div>
+      <div><span>Status: ${ticket.status}${partyLabel(ticket)}</span></div>
     </div>
-    <span>${ticket.called_at ? "Called" : "Active"}</span>
+    <span>${ticket.called_at ? "Called" : "Active"}${ticket.recall_count ? ` · Recalled ${ticket.recall_count}x` : ""}</span>
   `;
 
   recallBtn.disabled = ticket.status !== "called";
@@ -463,34 +513,52 @@ async function loadActiveTicket() {
     return;
   }
   state.branchId = branchId;
-  const response = await fetch(`${state.queueBase}/api/tickets/active?tenant_id=${state.tenantId}&branch_id=${branchId}&counter_id=${counterId}`, {
+  const response = await fetch(`${state.queueBase}/api/tickets/active?tenant_id=${state.tenantId}&branch_id=${branchId}&counter_id=${counterId}&all=true`, {
     headers: authHeaders(),
   });
-  if (response.status === 204) {
-    renderActive(null);
-    return;
-  }
   if (!response.ok) {
     setStatus("Failed to load active ticket");
     setAlert("Failed to load active ticket. Try refresh.");
     return;
   }
-  const ticket = await response.json();
-  renderActive(ticket);
+  const tickets = (await response.json()) || [];
+  const selectedId = activeTicket.dataset.ticketId;
+  const selected = tickets.find((ticket) => ticket.ticket_id === selectedId) || tickets[tickets.length - 1] || null;
+  renderActive(selected);
+  renderActiveList(tickets);
+}
+
+// Counters with several chairs hold more than one active ticket; list them
+// so the agent can pick which one the action buttons apply to.
+function renderActiveList(tickets) {
+  activeList.innerHTML = "";
+  if (tickets.length < 2) {
+    return;
+  }
+  tickets.forEach((ticket) => {
+    const item = document.createElement("button");
+    item.type = "button";
+    item.textContent = `${ticket.ticket_number} · ${ticket.status}`;
+    item.addEventListener("click", () => renderActive(ticket));
+    activeList.appendChild(item);
+  });
 }
 
-async function performAction(action) {
+async function performAction(action, targetTicketId, extra = {}) {
   const branchId = branchSelect.value;
   const counterId = counterSelect.value;
   if (!branchId || !counterId) {
     setStatus("Branch and counter required");
     return;
   }
-  const current = activeTicket.querySelector("strong");
-  if (!current) {
-    return;
+  let ticketId = targetTicketId;
+  if (!ticketId) {
+    const current = activeTicket.querySelector("strong");
+    if (!current) {
+      return;
+    }
+    ticketId = activeTicket.dataset.ticketId;
   }
-  const ticketId = activeTicket.dataset.ticketId;
   if (!ticketId) {
     return;
   }
@@ -499,6 +567,7 @@ async function performAction(action) {
     tenant_id: state.tenantId,
     branch_id: branchId,
     counter_id: counterId,
+    ...extra,
   };
   const response = await trackAction(action, { counterId, ticketId }, () => fetch(`${state.queueBase}/api/tickets/${ticketId}/actions/${action}`, {
     method: "POST",
@@ -512,8 +581,72 @@ async function performAction(action) {
   }
   setStatus(`Action ok: ${action}`);
   setAlert("");
+  if (action === "complete" || action === "cancel") {
+    state.lastClosed = { ticketId, number: activeTicket.querySelector("strong")?.textContent || "" };
+    reopenBtn.textContent = `Reopen ${state.lastClosed.number}`;
+  } else if (action === "reopen") {
+    state.lastClosed = null;
+    reopenBtn.textContent = "Reopen Last";
+  }
   await loadActiveTicket();
   await refreshQueue();
+  await loadHeldTickets();
+}
+
+function formatHoldExpiry(value) {
+  if (!value) {
+    return "No expiry";
+  }
+  const minutes = Math.max(0, Math.round((new Date(value).getTime() - Date.now()) / 60000));
+  return `Expires in ${minutes}m`;
+}
+
+function formatRemoteExpiry(value) {
+  if (!value) {
+    return "Awaiting arrival";
+  }
+  const minutes = Math.max(0, Math.round((new Date(value).getTime() - Date.now()) / 60000));
+  return `Arrival due in ${minutes}m`;
+}
+
+async function loadHeldTickets() {
+  const branchId = branchSelect.value;
+  const counterId = counterSelect.value;
+  if (!branchId || !counterId) {
+    heldList.innerHTML = "<p class=\"hint\">Pick a counter to see held tickets.</p>";
+    return;
+  }
+  const response = await fetch(`${state.queueBase}/api/tickets/held?tenant_id=${state.tenantId}&branch_id=${branchId}&counter_id=${counterId}`, {
+    headers: authHeaders(),
+  });
+  if (!response.ok) {
+    setStatus("Failed to load held tickets");
+    return;
+  }
+  const tickets = (await response.json()) || [];
+  heldList.innerHTML = "";
+  if (tickets.length === 0) {
+    heldList.innerHTML = "<p class=\"hint\">No held tickets.</p>";
+    return;
+  }
+  tickets.forEach((ticket) => {
+    const card = document.createElement("div");
+    card.className = "ticket";
+    card.innerHTML = `
+      <div>
+        <strong>${ticket.ticket_number}</strong>
+        <div><span>${ticket.hold_reason || "No reason"}</span></div>
+        <div><span>${formatHoldExpiry(ticket.hold_expires_at)}</span></div>
+      </div>
+    `;
+    const button = document.createElement("button");
+    button.textContent = "Unhold";
+    button.addEventListener("click", () => {
+      performAction("unhold", ticket.ticket_id).catch(() => setStatus("Unhold failed"));
+    });
+    card.appendChild(button);
+    heldList.appendChild(card);
+  });
 }
 
 async function transferTicket() {
@@ -678,6 +811,9 @@ async function loadSupervisorPanel() {
       const ticket = await response.json();
       activeLabel = `${ticket.ticket_number} · ${ticket.status}`;
     }
+    if (counter.capacity > 1) {
+      activeLabel = `${activeLabel} · ${counter.in_use}/${counter.capacity} in use`;
+    }
     const card = document.createElement("div");
     card.className = "ticket";
     card.innerHTML = `
@@ -698,6 +834,59 @@ async function loadSupervisorPanel() {
   }
 }
 
+async function searchTickets(cursor = "") {
+  const branchId = branchSelect.value;
+  if (!branchId) {
+    setStatus("Select branch to search");
+    return;
+  }
+  // POST keeps the phone number out of the URL and access logs.
+  const filters = { tenant_id: state.tenantId, branch_id: branchId, limit: 20 };
+  if (searchNumber.value.trim()) {
+    filters.ticket_number = searchNumber.value.trim();
+  }
+  if (searchPhone.value.trim()) {
+    filters.phone = searchPhone.value.trim();
+  }
+  if (searchDate.value) {
+    filters.from = searchDate.value;
+    filters.to = searchDate.value;
+  }
+  if (cursor) {
+    filters.cursor = cursor;
+  }
+  const response = await fetch(`${state.queueBase}/api/tickets/search`, {
+    method: "POST",
+    headers: authHeaders({ "Content-Type": "application/json" }),
+    body: JSON.stringify(filters),
+  });
+  if (!response.ok) {
+    setStatus("Search failed");
+    return;
+  }
+  const page = await response.json();
+  if (!cursor) {
+    searchResults.innerHTML = "";
+  }
+  if (!cursor && page.tickets.length === 0) {
+    searchResults.innerHTML = "<p class=\"hint\">No tickets found.</p>";
+  }
+  page.tickets.forEach((ticket) => {
+    const card = document.createElement("div");
+    card.className = "ticket";
+    card.innerHTML = `
+      <div>
+        <strong>${ticket.ticket_number}</strong>
+        <div><span>${ticket.status} · ${ticket.channel || "-"}</span></div>
+      </div>
+      <span>${new Date(ticket.created_at).toLocaleString()}</span>
+    `;
+    searchResults.appendChild(card);
+  });
+  searchMoreBtn.hidden = !page.next_cursor;
+  searchMoreBtn.dataset.cursor = page.next_cursor || "";
+}
+
 function logout() {
   state.sessionId = null;
   state.branches = [];
@@ -756,6 +945,7 @@ refreshBtn.addEventListener("click", () => {
 counterSelect.addEventListener("change", () => {
   setPresenceFromSelection();
   loadActiveTicket().catch(() => setStatus("Failed to load active ticket"));
+  loadHeldTickets().catch(() => setStatus("Failed to load held tickets"));
 });
 
 addCounterBtn.addEventListener("click", () => {
@@ -788,7 +978,11 @@ completeBtn.addEventListener("click", () => {
 });
 
 holdBtn.addEventListener("click", () => {
-  performAction("hold").catch(() => setStatus("Hold failed"));
+  performAction("hold", null, { reason: holdReasonInput.value.trim() })
+    .then(() => {
+      holdReasonInput.value = "";
+    })
+    .catch(() => setStatus("Hold failed"));
 });
 
 unholdBtn.addEventListener("click", () => {
@@ -803,6 +997,26 @@ cancelBtn.addEventListener("click", () => {
   performAction("cancel").catch(() => setStatus("Cancel failed"));
 });
 
+searchBtn.addEventListener("click", () => {
+  searchTickets().catch(() => setStatus("Search failed"));
+});
+
+searchMoreBtn.addEventListener("click", () => {
+  searchTickets(searchMoreBtn.dataset.cursor).catch(() => setStatus("Search failed"));
+});
+
+reopenBtn.addEventListener("click", () => {
+  if (!state.lastClosed) {
+    setStatus("Nothing to reopen");
+    return;
+  }
+  const reason = window.prompt(`Reason for reopening ${state.lastClosed.number}`);
+  if (!reason) {
+    return;
+  }
+  performAction("reopen", state.lastClosed.ticketId, { reason }).catch(() => setStatus("Reopen failed"));
+});
+
 transferBtn.addEventListener("click", () => {
   transferTicket().catch(() => setStatus("Transfer failed"));
 });
@@ -817,6 +1031,7 @@ setInterval(() => {
   }
   if (state.branchId && counterSelect.value) {
     loadActiveTicket().catch(() => setStatus("Failed to load active ticket"));
+    loadHeldTickets().catch(() => setStatus("Failed to load held tickets"));
   }
   if (state.supervisor) {
     loadSupervisorPanel().catch(() => setStatus("Failed to load supervisor panel"));
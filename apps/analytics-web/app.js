@@ -13,11 +13,14 @@ const exportBtn = document.getElementById("exportBtn");
 
 const avgWait = document.getElementById("avgWait");
 const avgService = document.getElementById("avgService");
+const ticketsServed = document.getElementById("ticketsServed");
+const peopleServed = document.getElementById("peopleServed");
 const totalCount = document.getElementById("totalCount");
 const queueLength = document.getElementById("queueLength");
 const servingCount = document.getElementById("servingCount");
 const activeCounters = document.getElementById("activeCounters");
 const busyCounters = document.getElementById("busyCounters");
+const utilisation = document.getElementById("utilisation");
 
 const reportCron = document.getElementById("reportCron");
 const reportChannel = document.getElementById("reportChannel");
@@ -129,6 +132,8 @@ async function refreshKPIs() {
   avgWait.textContent = formatSeconds(data.avg_wait_seconds);
   avgService.textContent = formatSeconds(data.avg_service_seconds);
   totalCount.textContent = data.count ?? "-";
+  ticketsServed.textContent = data.tickets_served ?? "-";
+  peopleServed.textContent = data.people_served ?? "-";
 }
 
 async function refreshRealtime() {
@@ -143,6 +148,9 @@ async function refreshRealtime() {
   servingCount.textContent = data.serving ?? "-";
   activeCounters.textContent = data.active_counters ?? "-";
   busyCounters.textContent = data.busy_counters ?? "-";
+  utilisation.textContent = data.capacity
+    ? `${Math.round((data.utilisation || 0) * 100)}% (${data.in_service}/${data.capacity})`
+    : "-";
 }
 
 async function refreshReports() {
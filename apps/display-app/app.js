@@ -2,21 +2,25 @@ const state = {
   queueBase: "http://localhost:8080",
   realtimeBase: "http://localhost:8085",
   sessionId: "",
+  deviceToken: "",
   tenantId: "",
   branchId: "",
   areaId: "",
   serviceId: "",
   serviceIds: [],
-  lastAfter: "",
+  lastSeq: 0,
+  resumeSeq: 0,
   audioEnabled: true,
   language: "id",
   calls: [],
+  board: null,
   poller: null,
 };
 
 const queueBaseInput = document.getElementById("queueBase");
 const realtimeBaseInput = document.getElementById("realtimeBase");
 const sessionIdInput = document.getElementById("sessionId");
+const deviceTokenInput = document.getElementById("deviceToken");
 const tenantInput = document.getElementById("tenantId");
 const branchInput = document.getElementById("branchId");
 const deviceInput = document.getElementById("deviceId");
@@ -38,6 +42,8 @@ const nowTime = document.getElementById("nowTime");
 const fullscreenBtn = document.getElementById("fullscreenBtn");
 const connState = document.getElementById("connState");
 const callCount = document.getElementById("callCount");
+const nextList = document.getElementById("nextList");
+const waitingCount = document.getElementById("waitingCount");
 const alertBox = document.getElementById("alert");
 
 const maxCalls = 5;
@@ -81,7 +87,8 @@ function renderCalls() {
     row.innerHTML = `
       <div>
         <strong>${call.ticket_number}</strong>
-        <div><span>Counter: ${call.counter_id || "-"} · ${call.service_id || "-"}</span></div>
+        <div><span>Counter: ${call.counter_name || call.counter_id || "-"} · ${call.service_name || call.service_id || "-"}${call.party_size > 1 ? ` · Party of ${call.party_size}` : ""}</span></div>
+        ${call.recall_count > 0 ? `<div><span class="recall">Recall ${call.recall_count}</span></div>` : ""}
       </div>
       <span>${new Date(call.called_at || call.created_at).toLocaleTimeString()}</span>
     `;
@@ -90,6 +97,75 @@ function renderCalls() {
   callCount.value = String(state.calls.length);
 }
 
+function renderBoard() {
+  nextList.innerHTML = "";
+  if (!state.board) {
+    waitingCount.value = "-";
+    return;
+  }
+  const board = state.board.state;
+  waitingCount.value = String(board.waiting_count);
+  if (board.next_up.length === 0) {
+    nextList.innerHTML = "<p class=\"hint\">No one waiting.</p>";
+    return;
+  }
+  board.next_up.forEach((item) => {
+    const row = document.createElement("div");
+    row.className = "call";
+    row.innerHTML = `
+      <div>
+        <strong>${item.ticket_number}</strong>
+        <div><span>${item.service_name || item.service_id || "-"}</span></div>
+      </div>
+      <span>~${Math.ceil(item.eta_seconds / 60)} min</span>
+    `;
+    nextList.appendChild(row);
+  });
+}
+
+// handleBoard keeps the board projection current. A diff that does not
+// start from the version we hold means one was missed, so subscribe again
+// for a fresh snapshot.
+function handleBoard(socket, message) {
+  if (message.type === "board.snapshot") {
+    state.board = { version: message.version, state: message.state };
+    renderBoard();
+    return;
+  }
+  if (!state.board || message.from !== state.board.version) {
+    state.board = null;
+    socket.send(JSON.stringify(subscribeMessage()));
+    return;
+  }
+  const board = state.board.state;
+  const changes = message.changes;
+  Object.entries(changes.now_calling || {}).forEach(([counterId, call]) => {
+    if (call) {
+      board.now_calling[counterId] = call;
+    } else {
+      delete board.now_calling[counterId];
+    }
+  });
+  Object.entries(changes.services || {}).forEach(([serviceId, queue]) => {
+    if (queue) {
+      board.services[serviceId] = queue;
+    } else {
+      delete board.services[serviceId];
+    }
+  });
+  if (changes.recent) {
+    board.recent = changes.recent;
+  }
+  if (changes.next_up) {
+    board.next_up = changes.next_up;
+  }
+  if (changes.waiting_count !== undefined) {
+    board.waiting_count = changes.waiting_count;
+  }
+  state.board.version = message.version;
+  renderBoard();
+}
+
 function renderNow(call) {
   if (!call) {
     nowNumber.textContent = "-";
@@ -98,7 +174,7 @@ function renderNow(call) {
     return;
   }
   nowNumber.textContent = call.ticket_number;
-  nowCounter.textContent = `Counter ${call.counter_id || "-"}`;
+  nowCounter.textContent = `Counter ${call.counter_name || call.counter_id || "-"}`;
   nowTime.textContent = new Date(call.called_at || call.created_at).toLocaleTimeString();
 }
 
@@ -123,9 +199,15 @@ function playAudioQueue() {
   }
   const call = audioQueue.shift();
   const number = call.ticket_number;
-  const counter = call.counter_id || "";
+  const counter = call.counter_name || call.counter_id || "";
   let text = "";
-  if (state.language === "id") {
+  if (call.recall_count > 0) {
+    if (state.language === "id") {
+      text = `Panggilan ulang ke-${call.recall_count}, nomor ${number} segera menuju loket ${counter}`;
+    } else {
+      text = `Recall ${call.recall_count}, ticket ${number} please go to counter ${counter} now`;
+    }
+  } else if (state.language === "id") {
     text = `Nomor ${number} menuju loket ${counter}`;
   } else {
     text = `Ticket ${number} please go to counter ${counter}`;
@@ -157,8 +239,14 @@ function isQuietHours() {
   }
   return now >= startTime && now <= endTime;
 }
+// callKey identifies a call; display-shaped realtime payloads carry the
+// ticket number but no ticket id.
+function callKey(call) {
+  return call.ticket_id || call.ticket_number;
+}
+
 function addCall(call) {
-  state.calls = [call, ...state.calls.filter((item) => item.ticket_id !== call.ticket_id)].slice(0, maxCalls);
+  state.calls = [call, ...state.calls.filter((item) => callKey(item) !== callKey(call))].slice(0, maxCalls);
   renderNow(state.calls[0]);
   renderCalls();
   sayCall(call);
@@ -210,18 +298,44 @@ async function loadSnapshot() {
       ticket_id: ticket.ticket_id,
       ticket_number: ticket.ticket_number,
       counter_id: ticket.counter_id,
+      counter_name: ticket.counter_name,
       called_at: ticket.called_at || ticket.created_at,
       service_id: ticket.service_id,
+      service_name: ticket.service_name,
       area_id: ticket.area_id,
     }));
   }
 }
 
+// applySnapshot replaces the calls with the called and serving tickets of
+// a subscribe snapshot, latest first, without announcing them again.
+// applySnapshot takes the realtime snapshot, which the server has already
+// scoped to the subscriptions, so it is not filtered again.
+function applySnapshot(tickets) {
+  state.calls = tickets
+    .filter((ticket) => ticket.status === "called" || ticket.status === "serving")
+    .sort((a, b) => new Date(b.called_at || b.created_at) - new Date(a.called_at || a.created_at))
+    .slice(0, maxCalls)
+    .map((ticket) => ({
+      ticket_id: ticket.ticket_id,
+      ticket_number: ticket.ticket_number,
+      counter_id: ticket.counter_id,
+      counter_name: ticket.counter_name,
+      called_at: ticket.called_at || ticket.created_at,
+      service_id: ticket.service_id,
+      service_name: ticket.service_name,
+      area_id: ticket.area_id,
+      recall_count: ticket.recall_count,
+    }));
+  renderNow(state.calls[0]);
+  renderCalls();
+}
+
 async function pollEvents() {
   if (!state.tenantId) {
     return;
   }
-  const afterParam = state.lastAfter ? `&after=${encodeURIComponent(state.lastAfter)}` : "";
+  const afterParam = state.lastSeq ? `&after_seq=${state.lastSeq}` : "";
   const response = await fetch(`${state.queueBase}/api/events?tenant_id=${state.tenantId}${afterParam}&limit=50`, {
     headers: authHeaders(),
   });
@@ -231,7 +345,10 @@ async function pollEvents() {
     return;
   }
   const events = await response.json();
-  events.forEach(handleEvent);
+  events.forEach((event) => {
+    state.lastSeq = event.seq || state.lastSeq;
+    handleEvent(event);
+  });
   setStatus("Live");
   connState.value = "Live";
   setAlert("");
@@ -242,6 +359,7 @@ function connect() {
   state.queueBase = queueBaseInput.value.trim();
   state.realtimeBase = realtimeBaseInput.value.trim();
   state.sessionId = sessionIdInput.value.trim();
+  state.deviceToken = deviceTokenInput.value.trim();
   state.tenantId = tenantInput.value.trim();
   state.branchId = branchInput.value.trim();
   state.areaId = areaInput.value.trim();
@@ -258,10 +376,16 @@ function connect() {
   }
 
   state.calls = [];
-  state.lastAfter = "";
+  state.board = null;
+  state.lastSeq = 0;
+  state.resumeSeq = 0;
   renderCalls();
+  renderBoard();
   renderNow(null);
-  loadSnapshot().catch(() => setStatus("Snapshot failed"));
+  // With realtime the subscribe snapshot fills the calls instead.
+  if (!state.sessionId && !state.deviceToken) {
+    loadSnapshot().catch(() => setStatus("Snapshot failed"));
+  }
 
   connectSockJS();
 }
@@ -273,8 +397,8 @@ function connectSockJS() {
   }
   sockets.forEach((item) => item.close());
   sockets = [];
-  if (!state.sessionId) {
-    setAlert("Session required for realtime. Using polling.");
+  if (!state.sessionId && !state.deviceToken) {
+    setAlert("Session or device token required for realtime. Using polling.");
     if (pollInterval) {
       clearInterval(pollInterval);
     }
@@ -283,45 +407,97 @@ function connectSockJS() {
     }, 5000);
     return;
   }
-  const sessionParam = encodeURIComponent(state.sessionId);
-  const endpoint = `${state.realtimeBase}/realtime?session_id=${sessionParam}`;
+  // A device token does not expire with a user session, and the server
+  // pins its subscriptions to the device's branch and area.
+  const authParam = state.deviceToken
+    ? `device_token=${encodeURIComponent(state.deviceToken)}`
+    : `session_id=${encodeURIComponent(state.sessionId)}`;
+  const endpoint = `${state.realtimeBase}/realtime?${authParam}`;
   if (state.serviceIds.length === 0) {
     return;
   }
-  state.serviceIds.forEach((serviceId) => {
-    const socket = new SockJS(endpoint);
-    sockets.push(socket);
-    socket.onopen = () => {
-      setStatus("Live");
-      connState.value = "Live";
-      setAlert("");
-      sendDeviceStatus("online");
-      reconnectDelay = 1000;
-      const msg = {
-        action: "subscribe",
-        tenant_id: state.tenantId,
-        branch_id: state.branchId,
-        service_id: serviceId,
-      };
-      socket.send(JSON.stringify(msg));
-    };
-    socket.onmessage = (event) => {
-      try {
-        const parsed = JSON.parse(event.data);
-        handleEvent(parsed);
-      } catch (err) {
+  // One connection carries a subscription per service.
+  const socket = new SockJS(endpoint);
+  sockets.push(socket);
+  socket.onopen = () => {
+    setStatus("Live");
+    connState.value = "Live";
+    setAlert("");
+    sendDeviceStatus("online");
+    reconnectDelay = 1000;
+    socket.send(JSON.stringify(subscribeMessage()));
+  };
+  socket.onmessage = (event) => {
+    try {
+      const parsed = JSON.parse(event.data);
+      if (parsed.type === "board.snapshot" || parsed.type === "board.diff") {
+        handleBoard(socket, parsed);
+        return;
+      }
+      if (parsed.type === "resync_required") {
+        // Subscribing again without resume_from sends a fresh snapshot.
+        state.resumeSeq = 0;
+        socket.send(JSON.stringify(subscribeMessage()));
+        return;
+      }
+      if (parsed.type === "snapshot") {
+        state.resumeSeq = parsed.seq;
+        applySnapshot(parsed.tickets);
         return;
       }
-    };
-    socket.onclose = () => {
-      setStatus("Disconnected");
-      connState.value = "Disconnected";
-      setAlert("Connection lost. Using fallback polling.");
+      if (parsed.seq) {
+        state.resumeSeq = parsed.seq;
+      }
+      handleEvent(parsed, true);
+    } catch (err) {
+      return;
+    }
+  };
+  socket.onclose = (event) => {
+    if (event && [4006, 4007, 4009].includes(event.code)) {
+      // The session or access was withdrawn; reconnecting would not help.
+      setStatus("Signed out");
+      connState.value = "Signed out";
+      setAlert(`Realtime access ended (${event.reason}). Sign in again.`);
       sendDeviceStatus("offline");
-      startPollingFallback();
-      scheduleReconnect();
-    };
-  });
+      return;
+    }
+    setStatus("Disconnected");
+    connState.value = "Disconnected";
+    setAlert("Connection lost. Using fallback polling.");
+    sendDeviceStatus("offline");
+    startPollingFallback();
+    scheduleReconnect();
+  };
+}
+
+// subscribeMessage asks for the call events of each service, plus the
+// board of the branch and area (narrowed to the service when there is one).
+function subscribeMessage() {
+  const msg = {
+    action: "subscribe",
+    subscriptions: state.serviceIds.map((serviceId) => ({
+      id: serviceId,
+      branch_id: state.branchId,
+      service_id: serviceId,
+      area_id: state.areaId,
+      types: ["ticket.called", "ticket.recalled"],
+    })),
+  };
+  if (state.branchId) {
+    msg.subscriptions.push({
+      id: "board",
+      board: true,
+      branch_id: state.branchId,
+      area_id: state.areaId,
+      service_id: state.serviceIds.length === 1 ? state.serviceIds[0] : "",
+    });
+  }
+  // After a reconnect, ask for the events missed in between.
+  if (state.resumeSeq) {
+    msg.resume_from = state.resumeSeq;
+  }
+  return msg;
 }
 
 function scheduleReconnect() {
@@ -354,12 +530,14 @@ function startPollingFallback() {
   }, 1000);
 }
 
-function handleEvent(event) {
+// handleEvent shows call events. Realtime events are already scoped by the
+// subscriptions and may be display-shaped, without the ids matchFilter reads.
+function handleEvent(event, scoped = false) {
   if (!event || (!event.type && !event.payload)) {
     return;
   }
   const payload = event.payload || {};
-  if (!matchFilter(payload)) {
+  if (!scoped && !matchFilter(payload)) {
     return;
   }
   if (event.type !== "ticket.called" && event.type !== "ticket.recalled") {
@@ -369,9 +547,13 @@ function handleEvent(event) {
     ticket_id: payload.ticket_id,
     ticket_number: payload.ticket_number,
     counter_id: payload.counter_id,
+    counter_name: payload.counter_name,
     called_at: payload.called_at || event.created_at,
     created_at: event.created_at,
     service_id: payload.service_id,
+    service_name: payload.service_name,
+    recall_count: event.type === "ticket.recalled" ? payload.recall_count || 1 : 0,
+    party_size: payload.party_size || 1,
   });
 }
 
@@ -491,6 +673,7 @@ audioToggle.addEventListener("change", () => {
 });
 
 renderCalls();
+renderBoard();
 updatePlaylist();
 renderNow(null);
 connState.value = "Connecting...";
@@ -11,6 +11,7 @@ const tenantInput = document.getElementById("tenantId");
 const branchInput = document.getElementById("branchId");
 const deviceInput = document.getElementById("deviceId");
 const serviceSelect = document.getElementById("serviceSelect");
+const partySizeInput = document.getElementById("partySizeInput");
 const loadBtn = document.getElementById("loadBtn");
 const issueBtn = document.getElementById("issueBtn");
 const printBtn = document.getElementById("printBtn");
@@ -21,10 +22,14 @@ const langSelect = document.getElementById("langSelect");
 const phoneToggle = document.getElementById("phoneToggle");
 const phoneLabel = document.getElementById("phoneLabel");
 const phoneInput = document.getElementById("phoneInput");
+const customerRefType = document.getElementById("customerRefType");
+const customerRefInput = document.getElementById("customerRefInput");
 const contrastBtn = document.getElementById("contrastBtn");
 const fontBtn = document.getElementById("fontBtn");
 const appointmentInput = document.getElementById("appointmentInput");
 const checkinBtn = document.getElementById("checkinBtn");
+const arrivalInput = document.getElementById("arrivalInput");
+const arrivalBtn = document.getElementById("arrivalBtn");
 const connState = document.getElementById("connState");
 const offlineCount = document.getElementById("offlineCount");
 const configVersionEl = document.getElementById("configVersion");
@@ -49,6 +54,8 @@ const translations = {
     syncOk: "Sinkron berhasil",
     syncFail: "Sinkron gagal",
     checkinFail: "Check-in gagal",
+    arrivalFail: "Konfirmasi kedatangan gagal",
+    arrivalExpired: "Batas waktu kedatangan habis",
   },
   en: {
     ready: "Ready",
@@ -64,6 +71,8 @@ const translations = {
     syncOk: "Sync complete",
     syncFail: "Sync failed",
     checkinFail: "Check-in failed",
+    arrivalFail: "Arrival confirmation failed",
+    arrivalExpired: "Arrival window expired",
   },
 };
 
@@ -118,6 +127,21 @@ function parseAppointmentValue(value) {
   return match ? match[0] : trimmed;
 }
 
+function parseArrivalValue(value) {
+  const trimmed = value.trim();
+  if (!trimmed) {
+    return null;
+  }
+  const query = trimmed.includes("?") ? trimmed.slice(trimmed.indexOf("?") + 1) : trimmed;
+  const params = new URLSearchParams(query);
+  const ticketId = params.get("ticket_id");
+  const token = params.get("token");
+  if (!ticketId || !token) {
+    return null;
+  }
+  return { ticketId, token };
+}
+
 function updateServiceSelect(services) {
   serviceSelect.innerHTML = "";
   const empty = document.createElement("option");
@@ -163,6 +187,7 @@ function renderTicket(ticket) {
   ticketPanel.innerHTML = `
     <h3>${ticket.ticket_number}</h3>
     <p>Status: ${ticket.status}</p>
+    ${ticket.party_size > 1 ? `<p>Party: ${ticket.party_size}</p>` : ""}
     <div class="qr">QR: ${qrValue}</div>
   `;
   printBtn.disabled = false;
@@ -181,7 +206,14 @@ async function issueTicket() {
     service_id: state.serviceId,
     channel: "kiosk",
     phone: phoneToggle.value === "on" ? phoneInput.value.trim() : "",
+    party_size: Math.max(1, parseInt(partySizeInput.value, 10) || 1),
   };
+  const customerRef = customerRefInput.value.trim();
+  if (customerRef) {
+    payload.customer_ref = customerRef;
+    payload.customer_ref_type = customerRefType.value;
+  }
+  customerRefInput.value = "";
   try {
     const response = await fetch(`${state.queueBase}/api/tickets`, {
       method: "POST",
@@ -239,6 +271,42 @@ async function checkInAppointment() {
   }
 }
 
+async function confirmArrival() {
+  const arrival = parseArrivalValue(arrivalInput.value);
+  if (!arrival) {
+    setStatus("Ticket QR required");
+    return;
+  }
+  const payload = {
+    request_id: uuidv4(),
+    tenant_id: state.tenantId,
+    branch_id: state.branchId,
+    token: arrival.token,
+    method: "qr",
+  };
+  try {
+    const response = await fetch(`${state.queueBase}/api/tickets/${arrival.ticketId}/arrival`, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify(payload),
+    });
+    if (response.status === 409) {
+      setStatus(t("arrivalExpired"));
+      return;
+    }
+    if (!response.ok) {
+      throw new Error("arrival failed");
+    }
+    const ticket = await response.json();
+    state.lastTicket = ticket;
+    renderTicket(ticket);
+    arrivalInput.value = "";
+    setStatus(`Arrived ${ticket.ticket_number}`);
+  } catch (err) {
+    setStatus(t("arrivalFail"));
+  }
+}
+
 function queueOfflineTicket(payload) {
   const stored = JSON.parse(localStorage.getItem("offlineTickets") || "[]");
   stored.push(payload);
@@ -372,6 +440,10 @@ checkinBtn.addEventListener("click", () => {
   checkInAppointment().catch(() => setStatus("Check-in failed"));
 });
 
+arrivalBtn.addEventListener("click", () => {
+  confirmArrival().catch(() => setStatus(t("arrivalFail")));
+});
+
 printBtn.addEventListener("click", () => {
   try {
     window.print();
@@ -7,6 +7,7 @@ const serviceSelect = document.getElementById("serviceSelect");
 const loadServicesBtn = document.getElementById("loadServices");
 const joinQueueBtn = document.getElementById("joinQueue");
 const phoneInput = document.getElementById("phoneInput");
+const remoteInput = document.getElementById("remoteInput");
 const ticketCard = document.getElementById("ticketCard");
 const statusEl = document.getElementById("status");
 const setupHint = document.getElementById("setupHint");
@@ -24,7 +25,10 @@ const state = {
   serviceId: "",
   ticketId: "",
   ticketNumber: "",
-  lastAfter: "",
+  ticketStatus: "",
+  trackingToken: "",
+  remoteExpiresAt: "",
+  lastSeq: 0,
   events: [],
   seenEvents: new Set(),
   poller: null,
@@ -90,11 +94,125 @@ function renderTicket() {
     ticketCard.innerHTML = `<p class="hint">No active ticket yet.</p>`;
     return;
   }
+  let remote = "";
+  if (state.ticketStatus === "remote") {
+    const expires = state.remoteExpiresAt ? new Date(state.remoteExpiresAt).toLocaleTimeString() : "-";
+    remote = `
+    <p>Confirm arrival before ${expires}</p>
+    <p><small>Arrival link: ${arrivalLink()}</small></p>
+    <button id="confirmArrival">I have arrived</button>
+  `;
+  }
+  let selfService = "";
+  if (state.trackingToken && (state.ticketStatus === "waiting" || state.ticketStatus === "remote")) {
+    const postpone = state.ticketStatus === "waiting" ? `
+      <input id="postponeValue" type="number" min="1" value="10" />
+      <select id="postponeUnit">
+        <option value="minutes">minutes</option>
+        <option value="places">places</option>
+      </select>
+      <button id="postponeTicket">Postpone</button>
+    ` : "";
+    selfService = `
+    <div class="self-service">
+      ${postpone}
+      <button id="cancelTicket">Cancel ticket</button>
+    </div>
+  `;
+  }
   ticketCard.innerHTML = `
     <h3>${state.ticketNumber}</h3>
     <p>Ticket ID: ${state.ticketId}</p>
     <p id="positionInfo">Position: checking...</p>
+    ${remote}
+    ${selfService}
   `;
+  const confirmBtn = document.getElementById("confirmArrival");
+  if (confirmBtn) {
+    confirmBtn.addEventListener("click", () => {
+      confirmArrival().catch(() => setStatus("Request failed"));
+    });
+  }
+  const postponeBtn = document.getElementById("postponeTicket");
+  if (postponeBtn) {
+    postponeBtn.addEventListener("click", () => {
+      const value = Number(document.getElementById("postponeValue").value || 0);
+      const unit = document.getElementById("postponeUnit").value;
+      selfServiceAction("postpone", { [unit]: value }).catch(() => setStatus("Request failed"));
+    });
+  }
+  const cancelBtn = document.getElementById("cancelTicket");
+  if (cancelBtn) {
+    cancelBtn.addEventListener("click", () => {
+      if (!window.confirm(`Cancel ticket ${state.ticketNumber}?`)) {
+        return;
+      }
+      selfServiceAction("cancel").catch(() => setStatus("Request failed"));
+    });
+  }
+}
+
+async function selfServiceAction(action, extra = {}) {
+  const response = await fetch(`${state.queueBase}/api/tickets/${state.ticketId}/self/${action}`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({
+      request_id: uuidv4(),
+      tenant_id: state.tenantId,
+      branch_id: state.branchId,
+      token: state.trackingToken,
+      ...extra,
+    }),
+  });
+  if (!response.ok) {
+    setStatus(`${action} failed`);
+    setHint(response.status === 409 ? "This ticket can no longer be changed." : `Unable to ${action} ticket.`);
+    return;
+  }
+  const ticket = await response.json();
+  state.ticketStatus = ticket.status;
+  renderTicket();
+  setHint("");
+  setStatus(action === "cancel" ? `Ticket ${state.ticketNumber} cancelled` : `Ticket ${state.ticketNumber} postponed`);
+  updatePosition().catch(() => {});
+}
+
+function arrivalLink() {
+  const params = new URLSearchParams({
+    ticket_id: state.ticketId,
+    tenant_id: state.tenantId,
+    branch_id: state.branchId,
+    token: state.trackingToken,
+  });
+  return `${location.origin}${location.pathname}?${params.toString()}`;
+}
+
+async function confirmArrival() {
+  if (!state.ticketId || !state.trackingToken) {
+    setHint("Tracking token missing for this ticket.");
+    return;
+  }
+  const response = await fetch(`${state.queueBase}/api/tickets/${state.ticketId}/arrival`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({
+      request_id: uuidv4(),
+      tenant_id: state.tenantId,
+      branch_id: state.branchId,
+      token: state.trackingToken,
+      method: "link",
+    }),
+  });
+  if (!response.ok) {
+    setStatus("Arrival failed");
+    setHint(response.status === 409 ? "Arrival window expired. Please take a new ticket." : "Unable to confirm arrival.");
+    return;
+  }
+  const ticket = await response.json();
+  state.ticketStatus = ticket.status;
+  renderTicket();
+  setStatus(`Ticket ${state.ticketNumber} arrived`);
+  updatePosition().catch(() => {});
 }
 
 function authHeaders(extra = {}) {
@@ -129,7 +247,12 @@ async function updatePosition() {
     positionInfo.textContent = "Position: called or completed";
     return;
   }
-  positionInfo.textContent = `Position: ${index + 1} in queue`;
+  if (tickets[index].status === "remote") {
+    positionInfo.textContent = "Position: waiting for arrival";
+    return;
+  }
+  const ahead = tickets.slice(0, index).filter((ticket) => ticket.status === "waiting").length;
+  positionInfo.textContent = `Position: ${ahead + 1} in queue`;
 }
 
 function renderTimeline(events) {
@@ -174,7 +297,7 @@ async function pollEvents() {
     setHint("Session required to track updates.");
     return;
   }
-  const afterParam = state.lastAfter ? `&after=${encodeURIComponent(state.lastAfter)}` : "";
+  const afterParam = state.lastSeq ? `&after_seq=${state.lastSeq}` : "";
   const response = await fetch(`${state.queueBase}/api/events?tenant_id=${state.tenantId}${afterParam}&limit=100`, {
     headers: authHeaders(),
   });
@@ -185,7 +308,7 @@ async function pollEvents() {
   const events = await response.json();
   const updates = [];
   for (const event of events) {
-    state.lastAfter = event.created_at || state.lastAfter;
+    state.lastSeq = event.seq || state.lastSeq;
     if (state.seenEvents.has(event.event_id)) {
       continue;
     }
@@ -307,6 +430,7 @@ async function joinQueue() {
     channel: "web",
     priority_class: "regular",
     phone: phoneInput.value.trim(),
+    remote: remoteInput.checked,
   };
   const response = await fetch(`${state.queueBase}/api/tickets`, {
     method: "POST",
@@ -321,10 +445,13 @@ async function joinQueue() {
   const ticket = await response.json();
   state.ticketId = ticket.ticket_id;
   state.ticketNumber = ticket.ticket_number;
+  state.ticketStatus = ticket.status;
+  state.trackingToken = ticket.tracking_token || "";
+  state.remoteExpiresAt = ticket.remote_expires_at || "";
   renderTicket();
   trackTicketId.value = ticket.ticket_id;
   setStatus(`Ticket ${ticket.ticket_number}`);
-  state.lastAfter = "";
+  state.lastSeq = 0;
   state.seenEvents.clear();
   state.events = [];
   renderTimeline(state.events);
@@ -346,7 +473,7 @@ function trackTicket() {
     return;
   }
   state.ticketId = id;
-  state.lastAfter = "";
+  state.lastSeq = 0;
   state.seenEvents.clear();
   state.events = [];
   renderTimeline(state.events);
@@ -367,4 +494,24 @@ trackBtn.addEventListener("click", () => {
   trackTicket();
 });
 
+function loadArrivalLink() {
+  const params = new URLSearchParams(location.search);
+  const ticketId = params.get("ticket_id");
+  const token = params.get("token");
+  if (!ticketId || !token) {
+    return;
+  }
+  state.ticketId = ticketId;
+  state.trackingToken = token;
+  state.ticketStatus = "remote";
+  state.tenantId = params.get("tenant_id") || "";
+  state.branchId = params.get("branch_id") || "";
+  tenantIdInput.value = state.tenantId;
+  branchIdInput.value = state.branchId;
+  trackTicketId.value = ticketId;
+  state.queueBase = queueBaseInput.value.trim();
+  renderTicket();
+}
+
+loadArrivalLink();
 setStatus("Ready");
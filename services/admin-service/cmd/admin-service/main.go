@@ -8,6 +8,9 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+	// Branch time zones are loaded by name and the runtime image has no
+	// zoneinfo.
+	_ "time/tzdata"
 
 	"qms/admin-service/internal/config"
 	"qms/admin-service/internal/httpapi"
@@ -3,7 +3,9 @@ package httpapi
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"expvar"
@@ -11,6 +13,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"qms/admin-service/internal/models"
 	"qms/admin-service/internal/store"
@@ -63,6 +66,7 @@ func (h *Handler) Routes() http.Handler {
 	mux.HandleFunc("/api/admin/holidays", h.handleHolidays)
 	mux.HandleFunc("/api/admin/approvals", h.handleApprovals)
 	mux.HandleFunc("/api/admin/approvals/prefs", h.handleApprovalPrefs)
+	mux.HandleFunc("/api/admin/privacy/prefs", h.handlePrivacyPrefs)
 	mux.HandleFunc("/api/admin/approvals/", h.handleApprovalAction)
 	return AuthMiddleware(h.store, mux)
 }
@@ -107,6 +111,9 @@ func (h *Handler) handleBranches(w http.ResponseWriter, r *http.Request) {
 			writeError(w, r, http.StatusBadRequest, "invalid_request", "tenant_id and name are required")
 			return
 		}
+		if !normalizeBranchTimezone(w, r, &branch) {
+			return
+		}
 		if h.maybeCreateApproval(w, r, branch.TenantID, "branch.create", branch) {
 			return
 		}
@@ -122,6 +129,20 @@ func (h *Handler) handleBranches(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// normalizeBranchTimezone defaults the branch's zone to UTC and rejects
+// names the runtime cannot load.
+func normalizeBranchTimezone(w http.ResponseWriter, r *http.Request, branch *models.Branch) bool {
+	branch.Timezone = strings.TrimSpace(branch.Timezone)
+	if branch.Timezone == "" {
+		branch.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(branch.Timezone); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_request", "timezone must be an IANA time zone name")
+		return false
+	}
+	return true
+}
+
 func (h *Handler) handleBranch(w http.ResponseWriter, r *http.Request) {
 	if !requirePermission(w, r, permissionConfigWrite) {
 		return
@@ -140,6 +161,9 @@ func (h *Handler) handleBranch(w http.ResponseWriter, r *http.Request) {
 			writeError(w, r, http.StatusBadRequest, "invalid_request", "tenant_id and name are required")
 			return
 		}
+		if !normalizeBranchTimezone(w, r, &branch) {
+			return
+		}
 		branch.BranchID = branchID
 		if h.maybeCreateApproval(w, r, branch.TenantID, "branch.update", branch) {
 			return
@@ -257,6 +281,9 @@ func (h *Handler) handleServices(w http.ResponseWriter, r *http.Request) {
 		if svc.SLAMinutes <= 0 {
 			svc.SLAMinutes = 5
 		}
+		if svc.DurationMinutes < 0 {
+			svc.DurationMinutes = 0
+		}
 		if svc.PriorityPolicy == "" {
 			svc.PriorityPolicy = "fifo"
 		}
@@ -303,6 +330,9 @@ func (h *Handler) handleService(w http.ResponseWriter, r *http.Request) {
 	if svc.SLAMinutes <= 0 {
 		svc.SLAMinutes = 5
 	}
+	if svc.DurationMinutes < 0 {
+		svc.DurationMinutes = 0
+	}
 	if svc.PriorityPolicy == "" {
 		svc.PriorityPolicy = "fifo"
 	}
@@ -373,7 +403,7 @@ func (h *Handler) handleCounters(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) handleCounterServices(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/api/admin/counters/")
 	parts := strings.Split(strings.Trim(path, "/"), "/")
-	if len(parts) != 2 || parts[1] != "services" {
+	if len(parts) != 2 || (parts[1] != "services" && parts[1] != "resources") {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
@@ -382,6 +412,10 @@ func (h *Handler) handleCounterServices(w http.ResponseWriter, r *http.Request)
 		writeError(w, r, http.StatusBadRequest, "invalid_request", "counter_id must be a UUID")
 		return
 	}
+	if parts[1] == "resources" {
+		h.handleCounterResources(w, r, counterID)
+		return
+	}
 	switch r.Method {
 	case http.MethodGet:
 		if !requirePermission(w, r, permissionConfigRead) {
@@ -444,6 +478,63 @@ func (h *Handler) handleCounterServices(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+func (h *Handler) handleCounterResources(w http.ResponseWriter, r *http.Request, counterID string) {
+	switch r.Method {
+	case http.MethodGet:
+		if !requirePermission(w, r, permissionConfigRead) {
+			return
+		}
+		resources, err := h.store.ListResources(r.Context(), counterID)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "internal_error", "internal server error")
+			return
+		}
+		writeJSON(w, http.StatusOK, resources)
+	case http.MethodPost:
+		if !requirePermission(w, r, permissionConfigWrite) {
+			return
+		}
+		var resource models.Resource
+		if !decodeRequest(w, r, &resource) {
+			return
+		}
+		resource.CounterID = counterID
+		resource.Name = strings.TrimSpace(resource.Name)
+		resource.Kind = strings.ToLower(strings.TrimSpace(resource.Kind))
+		if resource.Name == "" {
+			writeError(w, r, http.StatusBadRequest, "invalid_request", "name is required")
+			return
+		}
+		if resource.Kind == "" {
+			resource.Kind = "chair"
+		}
+		if resource.Kind != "room" && resource.Kind != "chair" {
+			writeError(w, r, http.StatusBadRequest, "invalid_request", "kind must be room or chair")
+			return
+		}
+		if resource.Capacity <= 0 {
+			resource.Capacity = 1
+		}
+		resource.Active = true
+		if h.maybeCreateApproval(w, r, "", "counter.add_resource", resource) {
+			return
+		}
+		created, err := h.store.CreateResource(r.Context(), resource)
+		if err != nil {
+			if errors.Is(err, store.ErrCounterNotFound) {
+				writeError(w, r, http.StatusNotFound, "not_found", "counter not found")
+				return
+			}
+			writeError(w, r, http.StatusInternalServerError, "internal_error", "internal server error")
+			return
+		}
+		h.recordAudit(r, "", "counter.add_resource", "counter", counterID)
+		writeJSON(w, http.StatusOK, created)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
 func (h *Handler) handleServicePolicy(w http.ResponseWriter, r *http.Request) {
 	if !requirePermission(w, r, permissionConfigWrite) && r.Method != http.MethodGet {
 		return
@@ -495,6 +586,46 @@ func (h *Handler) handleServicePolicy(w http.ResponseWriter, r *http.Request) {
 		if policy.AppointmentBoostMinutes < 0 {
 			policy.AppointmentBoostMinutes = 0
 		}
+		// Zero and empty hold settings leave the service to queue-service's
+		// HOLD_DEFAULT_SECONDS and HOLD_EXPIRY_ACTION.
+		if policy.HoldMaxSeconds < 0 {
+			policy.HoldMaxSeconds = 0
+		}
+		policy.HoldExpiryAction = strings.ToLower(strings.TrimSpace(policy.HoldExpiryAction))
+		if policy.HoldExpiryAction != "" && policy.HoldExpiryAction != "return" && policy.HoldExpiryAction != "cancel" {
+			writeError(w, r, http.StatusBadRequest, "invalid_request", "hold_expiry_action must be return or cancel")
+			return
+		}
+		if policy.MaxRecalls <= 0 {
+			policy.MaxRecalls = 3
+		}
+		if policy.MinRecallIntervalSeconds < 0 {
+			policy.MinRecallIntervalSeconds = 0
+		}
+		if policy.MaxPartySize <= 0 {
+			policy.MaxPartySize = 10
+		}
+		if policy.MaxWaitingPeople < 0 {
+			writeError(w, r, http.StatusBadRequest, "invalid_request", "max_waiting_people must be >= 0")
+			return
+		}
+		if policy.RemoteConfirmSeconds <= 0 {
+			policy.RemoteConfirmSeconds = 7200
+		}
+		if policy.RemoteKeepPlaceSeconds < 0 {
+			writeError(w, r, http.StatusBadRequest, "invalid_request", "remote_keep_place_seconds must be >= 0")
+			return
+		}
+		if policy.MaxPostpones < 0 {
+			writeError(w, r, http.StatusBadRequest, "invalid_request", "max_postpones must be >= 0")
+			return
+		}
+		if policy.MaxPostponePlaces <= 0 {
+			policy.MaxPostponePlaces = 5
+		}
+		if policy.MaxPostponeMinutes <= 0 {
+			policy.MaxPostponeMinutes = 30
+		}
 		if h.maybeCreateApproval(w, r, policy.TenantID, "policy.update", policy) {
 			return
 		}
@@ -566,7 +697,7 @@ func (h *Handler) handleDeviceStatus(w http.ResponseWriter, r *http.Request) {
 	}
 	path := strings.TrimPrefix(r.URL.Path, "/api/admin/devices/")
 	parts := strings.Split(strings.Trim(path, "/"), "/")
-	if len(parts) != 2 || parts[1] != "status" {
+	if len(parts) != 2 || (parts[1] != "status" && parts[1] != "token") {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
@@ -575,6 +706,10 @@ func (h *Handler) handleDeviceStatus(w http.ResponseWriter, r *http.Request) {
 		writeError(w, r, http.StatusBadRequest, "invalid_request", "device_id must be a UUID")
 		return
 	}
+	if parts[1] == "token" {
+		h.handleDeviceToken(w, r, deviceID)
+		return
+	}
 	if r.Method != http.MethodPut {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
@@ -597,6 +732,41 @@ func (h *Handler) handleDeviceStatus(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// handleDeviceToken issues the token a device uses to connect to
+// realtime-service, revoking the previous one. Only its hash is stored, so
+// this response is the only place the token appears.
+func (h *Handler) handleDeviceToken(w http.ResponseWriter, r *http.Request, deviceID string) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := authFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "missing session")
+		return
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal_error", "internal server error")
+		return
+	}
+	secret := base64.RawURLEncoding.EncodeToString(buf)
+	sum := sha256.Sum256([]byte(secret))
+	if err := h.store.SetDeviceTokenHash(r.Context(), session.TenantID, deviceID, hex.EncodeToString(sum[:])); err != nil {
+		if errors.Is(err, store.ErrDeviceNotFound) {
+			writeError(w, r, http.StatusNotFound, "not_found", "device not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "internal_error", "internal server error")
+		return
+	}
+	h.recordAudit(r, session.TenantID, "device.token", "device", deviceID)
+	writeJSON(w, http.StatusOK, map[string]string{
+		"device_id":    deviceID,
+		"device_token": deviceID + "." + secret,
+	})
+}
+
 func (h *Handler) handleDeviceConfigs(w http.ResponseWriter, r *http.Request) {
 	if !requirePermission(w, r, permissionConfigWrite) {
 		return
@@ -1258,6 +1428,68 @@ func (h *Handler) handleApprovalPrefs(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (h *Handler) handlePrivacyPrefs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if !requirePermission(w, r, permissionConfigRead) {
+			return
+		}
+		tenantID := strings.TrimSpace(r.URL.Query().Get("tenant_id"))
+		if !isValidUUID(tenantID) {
+			writeError(w, r, http.StatusBadRequest, "invalid_request", "tenant_id is required")
+			return
+		}
+		if !requireTenant(w, r, tenantID) {
+			return
+		}
+		prefs, err := h.store.GetPrivacyPrefs(r.Context(), tenantID)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "internal_error", "internal server error")
+			return
+		}
+		writeJSON(w, http.StatusOK, prefs)
+	case http.MethodPost:
+		if !requirePermission(w, r, permissionConfigWrite) {
+			return
+		}
+		var payload models.PrivacyPrefs
+		if !decodeRequest(w, r, &payload) {
+			return
+		}
+		if !isValidUUID(payload.TenantID) {
+			writeError(w, r, http.StatusBadRequest, "invalid_request", "tenant_id is required")
+			return
+		}
+		if !requireTenant(w, r, payload.TenantID) {
+			return
+		}
+		payload.CustomerRefMode = strings.ToLower(strings.TrimSpace(payload.CustomerRefMode))
+		if payload.CustomerRefMode == "" {
+			payload.CustomerRefMode = "off"
+		}
+		if payload.CustomerRefMode != "off" && payload.CustomerRefMode != "optional" && payload.CustomerRefMode != "required" {
+			writeError(w, r, http.StatusBadRequest, "invalid_request", "customer_ref_mode must be off, optional, or required")
+			return
+		}
+		if payload.CustomerRefRetentionDays < 0 {
+			writeError(w, r, http.StatusBadRequest, "invalid_request", "customer_ref_retention_days must be >= 0")
+			return
+		}
+		if payload.CustomerRefMode != "off" && payload.CustomerRefRetentionDays == 0 {
+			writeError(w, r, http.StatusBadRequest, "invalid_request", "customer_ref_retention_days is required when customer references are collected")
+			return
+		}
+		if err := h.store.SetPrivacyPrefs(r.Context(), payload); err != nil {
+			writeError(w, r, http.StatusInternalServerError, "internal_error", "internal server error")
+			return
+		}
+		h.recordAudit(r, payload.TenantID, "privacy.prefs_update", "tenant", payload.TenantID)
+		writeJSON(w, http.StatusOK, payload)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
 func (h *Handler) handleApprovalAction(w http.ResponseWriter, r *http.Request) {
 	if !requirePermission(w, r, permissionApprovalManage) {
 		return
@@ -1489,6 +1721,13 @@ func (h *Handler) applyApproval(ctx context.Context, approvalID string) error {
 			return err
 		}
 		return h.store.MapCounterService(ctx, payload["counter_id"], payload["service_id"])
+	case "counter.add_resource":
+		var resource models.Resource
+		if err := json.Unmarshal([]byte(approval.Payload), &resource); err != nil {
+			return err
+		}
+		_, err = h.store.CreateResource(ctx, resource)
+		return err
 	case "policy.update":
 		var policy models.ServicePolicy
 		if err := json.Unmarshal([]byte(approval.Payload), &policy); err != nil {
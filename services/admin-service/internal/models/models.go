@@ -4,6 +4,8 @@ type Branch struct {
 	BranchID string `json:"branch_id"`
 	TenantID string `json:"tenant_id"`
 	Name     string `json:"name"`
+	// Timezone is an IANA zone name; dates at the branch are local days.
+	Timezone string `json:"timezone"`
 }
 
 type Area struct {
@@ -13,14 +15,15 @@ type Area struct {
 }
 
 type Service struct {
-	ServiceID      string `json:"service_id"`
-	BranchID       string `json:"branch_id"`
-	Name           string `json:"name"`
-	Code           string `json:"code"`
-	SLAMinutes     int    `json:"sla_minutes"`
-	Active         bool   `json:"active"`
-	PriorityPolicy string `json:"priority_policy"`
-	HoursJSON      string `json:"hours_json"`
+	ServiceID       string `json:"service_id"`
+	BranchID        string `json:"branch_id"`
+	Name            string `json:"name"`
+	Code            string `json:"code"`
+	SLAMinutes      int    `json:"sla_minutes"`
+	DurationMinutes int    `json:"duration_minutes"`
+	Active          bool   `json:"active"`
+	PriorityPolicy  string `json:"priority_policy"`
+	HoursJSON       string `json:"hours_json"`
 }
 
 type Counter struct {
@@ -31,6 +34,18 @@ type Counter struct {
 	Status    string `json:"status"`
 }
 
+// Resource is a room or chair attached to a counter. The counter can serve
+// as many tickets in parallel as the summed capacity of its active resources.
+type Resource struct {
+	ResourceID string `json:"resource_id"`
+	BranchID   string `json:"branch_id"`
+	CounterID  string `json:"counter_id"`
+	Name       string `json:"name"`
+	Kind       string `json:"kind"`
+	Capacity   int    `json:"capacity"`
+	Active     bool   `json:"active"`
+}
+
 type AuditLog struct {
 	AuditID     string `json:"audit_id"`
 	TenantID    string `json:"tenant_id"`
@@ -38,6 +53,7 @@ type AuditLog struct {
 	ActionType  string `json:"action_type"`
 	TargetType  string `json:"target_type"`
 	TargetID    string `json:"target_id"`
+	Detail      string `json:"detail,omitempty"`
 	CreatedAt   string `json:"created_at"`
 	IP          string `json:"ip"`
 	UserAgent   string `json:"user_agent"`
@@ -61,14 +77,25 @@ type DeviceConfig struct {
 }
 
 type ServicePolicy struct {
-	TenantID                string `json:"tenant_id"`
-	BranchID                string `json:"branch_id"`
-	ServiceID               string `json:"service_id"`
-	NoShowGraceSeconds      int    `json:"no_show_grace_seconds"`
-	ReturnToQueue           bool   `json:"return_to_queue"`
-	AppointmentRatioPercent int    `json:"appointment_ratio_percent"`
-	AppointmentWindowSize   int    `json:"appointment_window_size"`
-	AppointmentBoostMinutes int    `json:"appointment_boost_minutes"`
+	TenantID                 string `json:"tenant_id"`
+	BranchID                 string `json:"branch_id"`
+	ServiceID                string `json:"service_id"`
+	NoShowGraceSeconds       int    `json:"no_show_grace_seconds"`
+	ReturnToQueue            bool   `json:"return_to_queue"`
+	AppointmentRatioPercent  int    `json:"appointment_ratio_percent"`
+	AppointmentWindowSize    int    `json:"appointment_window_size"`
+	AppointmentBoostMinutes  int    `json:"appointment_boost_minutes"`
+	HoldMaxSeconds           int    `json:"hold_max_seconds"`
+	HoldExpiryAction         string `json:"hold_expiry_action"`
+	MaxRecalls               int    `json:"max_recalls"`
+	MinRecallIntervalSeconds int    `json:"min_recall_interval_seconds"`
+	MaxPartySize             int    `json:"max_party_size"`
+	MaxWaitingPeople         int    `json:"max_waiting_people"`
+	RemoteConfirmSeconds     int    `json:"remote_confirm_seconds"`
+	RemoteKeepPlaceSeconds   int    `json:"remote_keep_place_seconds"`
+	MaxPostpones             int    `json:"max_postpones"`
+	MaxPostponePlaces        int    `json:"max_postpone_places"`
+	MaxPostponeMinutes       int    `json:"max_postpone_minutes"`
 }
 
 type Role struct {
@@ -114,3 +141,9 @@ type ApprovalRequest struct {
 	CreatedBy   string `json:"created_by"`
 	ApprovedBy  string `json:"approved_by"`
 }
+
+type PrivacyPrefs struct {
+	TenantID                 string `json:"tenant_id"`
+	CustomerRefMode          string `json:"customer_ref_mode"`
+	CustomerRefRetentionDays int    `json:"customer_ref_retention_days"`
+}
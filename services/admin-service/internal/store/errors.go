@@ -8,4 +8,6 @@ var (
 	ErrApprovalNotPending = errors.New("approval request not pending")
 	ErrAccessDenied      = errors.New("access denied")
 	ErrSessionNotFound   = errors.New("session not found")
+	ErrCounterNotFound   = errors.New("counter not found")
+	ErrDeviceNotFound    = errors.New("device not found")
 )
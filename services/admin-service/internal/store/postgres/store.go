@@ -27,9 +27,9 @@ func (s *Store) CreateBranch(ctx context.Context, branch models.Branch) (models.
 		branch.BranchID = uuid.NewString()
 	}
 	_, err := s.pool.Exec(ctx, `
-		INSERT INTO branches (branch_id, tenant_id, name)
-		VALUES ($1, $2, $3)
-	`, branch.BranchID, branch.TenantID, branch.Name)
+		INSERT INTO branches (branch_id, tenant_id, name, timezone)
+		VALUES ($1, $2, $3, $4)
+	`, branch.BranchID, branch.TenantID, branch.Name, branch.Timezone)
 	if err != nil {
 		return models.Branch{}, err
 	}
@@ -39,9 +39,9 @@ func (s *Store) CreateBranch(ctx context.Context, branch models.Branch) (models.
 func (s *Store) UpdateBranch(ctx context.Context, branch models.Branch) (models.Branch, error) {
 	_, err := s.pool.Exec(ctx, `
 		UPDATE branches
-		SET name = $1
+		SET name = $1, timezone = $4
 		WHERE branch_id = $2 AND tenant_id = $3
-	`, branch.Name, branch.BranchID, branch.TenantID)
+	`, branch.Name, branch.BranchID, branch.TenantID, branch.Timezone)
 	if err != nil {
 		return models.Branch{}, err
 	}
@@ -70,7 +70,7 @@ func (s *Store) DeleteBranch(ctx context.Context, tenantID, branchID string) err
 
 func (s *Store) ListBranches(ctx context.Context, tenantID string) ([]models.Branch, error) {
 	rows, err := s.pool.Query(ctx, `
-		SELECT branch_id, tenant_id, name
+		SELECT branch_id, tenant_id, name, timezone
 		FROM branches
 		WHERE tenant_id = $1
 		ORDER BY name ASC
@@ -83,7 +83,7 @@ func (s *Store) ListBranches(ctx context.Context, tenantID string) ([]models.Bra
 	var branches []models.Branch
 	for rows.Next() {
 		var branch models.Branch
-		if err := rows.Scan(&branch.BranchID, &branch.TenantID, &branch.Name); err != nil {
+		if err := rows.Scan(&branch.BranchID, &branch.TenantID, &branch.Name, &branch.Timezone); err != nil {
 			return nil, err
 		}
 		branches = append(branches, branch)
@@ -139,9 +139,9 @@ func (s *Store) CreateService(ctx context.Context, service models.Service) (mode
 		service.ServiceID = uuid.NewString()
 	}
 	_, err := s.pool.Exec(ctx, `
-		INSERT INTO services (service_id, branch_id, name, code, sla_minutes, active, priority_policy, hours_json)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-	`, service.ServiceID, service.BranchID, service.Name, service.Code, service.SLAMinutes, service.Active, service.PriorityPolicy, nullIfEmpty(service.HoursJSON))
+		INSERT INTO services (service_id, branch_id, name, code, sla_minutes, active, priority_policy, hours_json, duration_minutes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, service.ServiceID, service.BranchID, service.Name, service.Code, service.SLAMinutes, service.Active, service.PriorityPolicy, nullIfEmpty(service.HoursJSON), service.DurationMinutes)
 	if err != nil {
 		return models.Service{}, err
 	}
@@ -151,9 +151,9 @@ func (s *Store) CreateService(ctx context.Context, service models.Service) (mode
 func (s *Store) UpdateService(ctx context.Context, service models.Service) (models.Service, error) {
 	_, err := s.pool.Exec(ctx, `
 		UPDATE services
-		SET name = $1, code = $2, sla_minutes = $3, active = $4, priority_policy = $5, hours_json = $6
+		SET name = $1, code = $2, sla_minutes = $3, active = $4, priority_policy = $5, hours_json = $6, duration_minutes = $9
 		WHERE service_id = $7 AND branch_id = $8
-	`, service.Name, service.Code, service.SLAMinutes, service.Active, service.PriorityPolicy, nullIfEmpty(service.HoursJSON), service.ServiceID, service.BranchID)
+	`, service.Name, service.Code, service.SLAMinutes, service.Active, service.PriorityPolicy, nullIfEmpty(service.HoursJSON), service.ServiceID, service.BranchID, service.DurationMinutes)
 	if err != nil {
 		return models.Service{}, err
 	}
@@ -162,7 +162,7 @@ func (s *Store) UpdateService(ctx context.Context, service models.Service) (mode
 
 func (s *Store) ListServices(ctx context.Context, branchID string) ([]models.Service, error) {
 	rows, err := s.pool.Query(ctx, `
-		SELECT service_id, branch_id, name, code, sla_minutes, active, priority_policy, COALESCE(hours_json::text, '')
+		SELECT service_id, branch_id, name, code, sla_minutes, active, priority_policy, COALESCE(hours_json::text, ''), duration_minutes
 		FROM services
 		WHERE branch_id = $1
 		ORDER BY name ASC
@@ -175,7 +175,7 @@ func (s *Store) ListServices(ctx context.Context, branchID string) ([]models.Ser
 	var services []models.Service
 	for rows.Next() {
 		var svc models.Service
-		if err := rows.Scan(&svc.ServiceID, &svc.BranchID, &svc.Name, &svc.Code, &svc.SLAMinutes, &svc.Active, &svc.PriorityPolicy, &svc.HoursJSON); err != nil {
+		if err := rows.Scan(&svc.ServiceID, &svc.BranchID, &svc.Name, &svc.Code, &svc.SLAMinutes, &svc.Active, &svc.PriorityPolicy, &svc.HoursJSON, &svc.DurationMinutes); err != nil {
 			return nil, err
 		}
 		services = append(services, svc)
@@ -235,9 +235,55 @@ func (s *Store) MapCounterService(ctx context.Context, counterID, serviceID stri
 	return err
 }
 
+func (s *Store) CreateResource(ctx context.Context, resource models.Resource) (models.Resource, error) {
+	if resource.ResourceID == "" {
+		resource.ResourceID = uuid.NewString()
+	}
+	row := s.pool.QueryRow(ctx, `
+		INSERT INTO resources (resource_id, branch_id, counter_id, name, kind, capacity, active)
+		SELECT $1, c.branch_id, c.counter_id, $3, $4, $5, $6
+		FROM counters c
+		WHERE c.counter_id = $2
+		RETURNING branch_id
+	`, resource.ResourceID, resource.CounterID, resource.Name, resource.Kind, resource.Capacity, resource.Active)
+	if err := row.Scan(&resource.BranchID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Resource{}, store.ErrCounterNotFound
+		}
+		return models.Resource{}, err
+	}
+	return resource, nil
+}
+
+func (s *Store) ListResources(ctx context.Context, counterID string) ([]models.Resource, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT resource_id, branch_id, counter_id, name, kind, capacity, active
+		FROM resources
+		WHERE counter_id = $1
+		ORDER BY name ASC
+	`, counterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var resources []models.Resource
+	for rows.Next() {
+		var resource models.Resource
+		if err := rows.Scan(&resource.ResourceID, &resource.BranchID, &resource.CounterID, &resource.Name, &resource.Kind, &resource.Capacity, &resource.Active); err != nil {
+			return nil, err
+		}
+		resources = append(resources, resource)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return resources, nil
+}
+
 func (s *Store) ListCounterServices(ctx context.Context, counterID string) ([]models.Service, error) {
 	rows, err := s.pool.Query(ctx, `
-		SELECT s.service_id, s.branch_id, s.name, s.code, s.sla_minutes, s.active, s.priority_policy, COALESCE(s.hours_json::text, '')
+		SELECT s.service_id, s.branch_id, s.name, s.code, s.sla_minutes, s.active, s.priority_policy, COALESCE(s.hours_json::text, ''), s.duration_minutes
 		FROM counter_services cs
 		JOIN services s ON s.service_id = cs.service_id
 		WHERE cs.counter_id = $1
@@ -251,7 +297,7 @@ func (s *Store) ListCounterServices(ctx context.Context, counterID string) ([]mo
 	var services []models.Service
 	for rows.Next() {
 		var svc models.Service
-		if err := rows.Scan(&svc.ServiceID, &svc.BranchID, &svc.Name, &svc.Code, &svc.SLAMinutes, &svc.Active, &svc.PriorityPolicy, &svc.HoursJSON); err != nil {
+		if err := rows.Scan(&svc.ServiceID, &svc.BranchID, &svc.Name, &svc.Code, &svc.SLAMinutes, &svc.Active, &svc.PriorityPolicy, &svc.HoursJSON, &svc.DurationMinutes); err != nil {
 			return nil, err
 		}
 		services = append(services, svc)
@@ -283,7 +329,7 @@ func (s *Store) InsertAudit(ctx context.Context, audit models.AuditLog) error {
 
 func (s *Store) ListAudit(ctx context.Context, tenantID, actionType, userID string) ([]models.AuditLog, error) {
 	query := `
-		SELECT audit_id, tenant_id, actor_user_id, action_type, target_type, target_id, created_at, ip, user_agent
+		SELECT audit_id, tenant_id, actor_user_id, action_type, target_type, target_id, COALESCE(detail, ''), created_at, ip, user_agent
 		FROM audit_logs
 		WHERE tenant_id = $1
 	`
@@ -308,7 +354,7 @@ func (s *Store) ListAudit(ctx context.Context, tenantID, actionType, userID stri
 	var logs []models.AuditLog
 	for rows.Next() {
 		var logEntry models.AuditLog
-		if err := rows.Scan(&logEntry.AuditID, &logEntry.TenantID, &logEntry.ActorUserID, &logEntry.ActionType, &logEntry.TargetType, &logEntry.TargetID, &logEntry.CreatedAt, &logEntry.IP, &logEntry.UserAgent); err != nil {
+		if err := rows.Scan(&logEntry.AuditID, &logEntry.TenantID, &logEntry.ActorUserID, &logEntry.ActionType, &logEntry.TargetType, &logEntry.TargetID, &logEntry.Detail, &logEntry.CreatedAt, &logEntry.IP, &logEntry.UserAgent); err != nil {
 			return nil, err
 		}
 		logs = append(logs, logEntry)
@@ -369,6 +415,21 @@ func (s *Store) UpdateDeviceStatus(ctx context.Context, deviceID, status string)
 	return err
 }
 
+func (s *Store) SetDeviceTokenHash(ctx context.Context, tenantID, deviceID, tokenHash string) error {
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE devices
+		SET token_hash = $1, token_issued_at = NOW()
+		WHERE device_id = $2 AND tenant_id = $3
+	`, tokenHash, deviceID, tenantID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return store.ErrDeviceNotFound
+	}
+	return nil
+}
+
 func (s *Store) CreateDeviceConfig(ctx context.Context, deviceID string, version int, payload string) error {
 	_, err := s.pool.Exec(ctx, `
 		INSERT INTO device_configs (config_id, device_id, version, payload)
@@ -454,15 +515,26 @@ func (s *Store) RollbackDeviceConfig(ctx context.Context, deviceID string, versi
 
 func (s *Store) UpsertServicePolicy(ctx context.Context, policy models.ServicePolicy) (models.ServicePolicy, error) {
 	_, err := s.pool.Exec(ctx, `
-		INSERT INTO service_policies (tenant_id, branch_id, service_id, no_show_grace_seconds, return_to_queue, appointment_ratio_percent, appointment_window_size, appointment_boost_minutes)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO service_policies (tenant_id, branch_id, service_id, no_show_grace_seconds, return_to_queue, appointment_ratio_percent, appointment_window_size, appointment_boost_minutes, hold_max_seconds, hold_expiry_action, max_recalls, min_recall_interval_seconds, max_party_size, max_waiting_people, remote_confirm_seconds, remote_keep_place_seconds, max_postpones, max_postpone_places, max_postpone_minutes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, 0), NULLIF($10, ''), $11, $12, $13, $14, $15, $16, $17, $18, $19)
 		ON CONFLICT (tenant_id, branch_id, service_id)
 		DO UPDATE SET no_show_grace_seconds = EXCLUDED.no_show_grace_seconds,
 			return_to_queue = EXCLUDED.return_to_queue,
 			appointment_ratio_percent = EXCLUDED.appointment_ratio_percent,
 			appointment_window_size = EXCLUDED.appointment_window_size,
-			appointment_boost_minutes = EXCLUDED.appointment_boost_minutes
-	`, policy.TenantID, policy.BranchID, policy.ServiceID, policy.NoShowGraceSeconds, policy.ReturnToQueue, policy.AppointmentRatioPercent, policy.AppointmentWindowSize, policy.AppointmentBoostMinutes)
+			appointment_boost_minutes = EXCLUDED.appointment_boost_minutes,
+			hold_max_seconds = EXCLUDED.hold_max_seconds,
+			hold_expiry_action = EXCLUDED.hold_expiry_action,
+			max_recalls = EXCLUDED.max_recalls,
+			min_recall_interval_seconds = EXCLUDED.min_recall_interval_seconds,
+			max_party_size = EXCLUDED.max_party_size,
+			max_waiting_people = EXCLUDED.max_waiting_people,
+			remote_confirm_seconds = EXCLUDED.remote_confirm_seconds,
+			remote_keep_place_seconds = EXCLUDED.remote_keep_place_seconds,
+			max_postpones = EXCLUDED.max_postpones,
+			max_postpone_places = EXCLUDED.max_postpone_places,
+			max_postpone_minutes = EXCLUDED.max_postpone_minutes
+	`, policy.TenantID, policy.BranchID, policy.ServiceID, policy.NoShowGraceSeconds, policy.ReturnToQueue, policy.AppointmentRatioPercent, policy.AppointmentWindowSize, policy.AppointmentBoostMinutes, policy.HoldMaxSeconds, policy.HoldExpiryAction, policy.MaxRecalls, policy.MinRecallIntervalSeconds, policy.MaxPartySize, policy.MaxWaitingPeople, policy.RemoteConfirmSeconds, policy.RemoteKeepPlaceSeconds, policy.MaxPostpones, policy.MaxPostponePlaces, policy.MaxPostponeMinutes)
 	if err != nil {
 		return models.ServicePolicy{}, err
 	}
@@ -472,11 +544,11 @@ func (s *Store) UpsertServicePolicy(ctx context.Context, policy models.ServicePo
 func (s *Store) GetServicePolicy(ctx context.Context, tenantID, branchID, serviceID string) (models.ServicePolicy, bool, error) {
 	var policy models.ServicePolicy
 	row := s.pool.QueryRow(ctx, `
-		SELECT tenant_id, branch_id, service_id, no_show_grace_seconds, return_to_queue, appointment_ratio_percent, appointment_window_size, appointment_boost_minutes
+		SELECT tenant_id, branch_id, service_id, no_show_grace_seconds, return_to_queue, appointment_ratio_percent, appointment_window_size, appointment_boost_minutes, COALESCE(hold_max_seconds, 0), COALESCE(hold_expiry_action, ''), max_recalls, min_recall_interval_seconds, max_party_size, max_waiting_people, remote_confirm_seconds, remote_keep_place_seconds, max_postpones, max_postpone_places, max_postpone_minutes
 		FROM service_policies
 		WHERE tenant_id = $1 AND branch_id = $2 AND service_id = $3
 	`, tenantID, branchID, serviceID)
-	if err := row.Scan(&policy.TenantID, &policy.BranchID, &policy.ServiceID, &policy.NoShowGraceSeconds, &policy.ReturnToQueue, &policy.AppointmentRatioPercent, &policy.AppointmentWindowSize, &policy.AppointmentBoostMinutes); err != nil {
+	if err := row.Scan(&policy.TenantID, &policy.BranchID, &policy.ServiceID, &policy.NoShowGraceSeconds, &policy.ReturnToQueue, &policy.AppointmentRatioPercent, &policy.AppointmentWindowSize, &policy.AppointmentBoostMinutes, &policy.HoldMaxSeconds, &policy.HoldExpiryAction, &policy.MaxRecalls, &policy.MinRecallIntervalSeconds, &policy.MaxPartySize, &policy.MaxWaitingPeople, &policy.RemoteConfirmSeconds, &policy.RemoteKeepPlaceSeconds, &policy.MaxPostpones, &policy.MaxPostponePlaces, &policy.MaxPostponeMinutes); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return models.ServicePolicy{}, false, nil
 		}
@@ -918,6 +990,33 @@ func (s *Store) SetApprovalPrefs(ctx context.Context, tenantID string, enabled b
 	return err
 }
 
+func (s *Store) GetPrivacyPrefs(ctx context.Context, tenantID string) (models.PrivacyPrefs, error) {
+	prefs := models.PrivacyPrefs{TenantID: tenantID, CustomerRefMode: "off"}
+	row := s.pool.QueryRow(ctx, `
+		SELECT customer_ref_mode, customer_ref_retention_days
+		FROM tenant_privacy_prefs
+		WHERE tenant_id = $1
+	`, tenantID)
+	if err := row.Scan(&prefs.CustomerRefMode, &prefs.CustomerRefRetentionDays); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return prefs, nil
+		}
+		return models.PrivacyPrefs{}, err
+	}
+	return prefs, nil
+}
+
+func (s *Store) SetPrivacyPrefs(ctx context.Context, prefs models.PrivacyPrefs) error {
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO tenant_privacy_prefs (tenant_id, customer_ref_mode, customer_ref_retention_days)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (tenant_id) DO UPDATE SET
+			customer_ref_mode = EXCLUDED.customer_ref_mode,
+			customer_ref_retention_days = EXCLUDED.customer_ref_retention_days
+	`, prefs.TenantID, prefs.CustomerRefMode, prefs.CustomerRefRetentionDays)
+	return err
+}
+
 func (s *Store) GetSession(ctx context.Context, sessionID string) (store.Session, error) {
 	var session store.Session
 	row := s.pool.QueryRow(ctx, `
@@ -25,6 +25,8 @@ type Store interface {
 	MapCounterService(ctx context.Context, counterID, serviceID string) error
 	ListCounterServices(ctx context.Context, counterID string) ([]models.Service, error)
 	RemoveCounterService(ctx context.Context, counterID, serviceID string) error
+	CreateResource(ctx context.Context, resource models.Resource) (models.Resource, error)
+	ListResources(ctx context.Context, counterID string) ([]models.Resource, error)
 
 	InsertAudit(ctx context.Context, audit models.AuditLog) error
 	ListAudit(ctx context.Context, tenantID, actionType, userID string) ([]models.AuditLog, error)
@@ -32,6 +34,7 @@ type Store interface {
 	RegisterDevice(ctx context.Context, device models.Device) (models.Device, error)
 	ListDevices(ctx context.Context, tenantID string) ([]models.Device, error)
 	UpdateDeviceStatus(ctx context.Context, deviceID, status string) error
+	SetDeviceTokenHash(ctx context.Context, tenantID, deviceID, tokenHash string) error
 	CreateDeviceConfig(ctx context.Context, deviceID string, version int, payload string) error
 	GetLatestDeviceConfig(ctx context.Context, deviceID string) (int, string, error)
 	ListDeviceConfigs(ctx context.Context, deviceID string, limit int) ([]models.DeviceConfig, error)
@@ -66,6 +69,8 @@ type Store interface {
 	ApprovalsEnabled(ctx context.Context, tenantID string) (bool, error)
 	GetApprovalPrefs(ctx context.Context, tenantID string) (bool, error)
 	SetApprovalPrefs(ctx context.Context, tenantID string, enabled bool) error
+	GetPrivacyPrefs(ctx context.Context, tenantID string) (models.PrivacyPrefs, error)
+	SetPrivacyPrefs(ctx context.Context, prefs models.PrivacyPrefs) error
 	GetSession(ctx context.Context, sessionID string) (Session, error)
 }
 
@@ -12,12 +12,14 @@ import (
 	"net/smtp"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"qms/analytics-service/internal/config"
 	"qms/analytics-service/internal/httpapi"
+	"qms/analytics-service/internal/jobs"
 	"qms/analytics-service/internal/store"
 	"qms/analytics-service/internal/store/postgres"
 	"qms/analytics-service/internal/telemetry"
@@ -42,7 +44,8 @@ func main() {
 	defer pool.Close()
 
 	repo := postgres.NewStore(pool)
-	handler := httpapi.NewHandler(repo, httpapi.Options{BIAPIToken: cfg.BIAPIToken})
+	runner := jobs.NewRunner(repo, jobs.Options{Lease: "analytics-service", TTL: time.Duration(cfg.JobLeaseSeconds) * time.Second})
+	handler := httpapi.NewHandler(repo, httpapi.Options{BIAPIToken: cfg.BIAPIToken, Jobs: runner})
 	limiter := httpapi.NewRateLimiter(httpapi.RateLimitConfig{
 		IPPerMinute:     cfg.RateLimitPerMinute,
 		IPBurst:         cfg.RateLimitBurst,
@@ -66,54 +69,18 @@ func main() {
 		}
 	}()
 
-	go func() {
-		if cfg.AnomalyIntervalSeconds <= 0 {
-			return
-		}
-		ticker := time.NewTicker(time.Duration(cfg.AnomalyIntervalSeconds) * time.Second)
-		defer ticker.Stop()
-		for range ticker.C {
-			services, err := repo.ListServices(context.Background())
-			if err != nil {
-				log.Printf("anomaly list services error: %v", err)
-				continue
-			}
-			windowEnd := time.Now().UTC()
-			windowStart := windowEnd.Add(-1 * time.Hour)
-			for _, svc := range services {
-				kpi, err := repo.GetKPIs(context.Background(), svc.TenantID, svc.BranchID, svc.ServiceID, windowStart, windowEnd)
-				if err != nil {
-					continue
-				}
-				if kpi.AvgWaitSeconds > cfg.AnomalyThresholdSeconds {
-					_ = repo.InsertAnomaly(context.Background(), store.Anomaly{
-						TenantID:  svc.TenantID,
-						BranchID:  svc.BranchID,
-						ServiceID: svc.ServiceID,
-						Type:      "wait_time",
-						Value:     kpi.AvgWaitSeconds,
-						Threshold: cfg.AnomalyThresholdSeconds,
-					})
-				}
-			}
+	// Both jobs write per-run rows or send reports, so they run on the
+	// leader only; other replicas serve HTTP.
+	runner.Add(jobs.Job{Name: "anomaly_scan", Mode: jobs.Singleton, Interval: time.Duration(cfg.AnomalyIntervalSeconds) * time.Second, Timeout: time.Minute, Run: func(ctx context.Context) error {
+		return runAnomalyScan(ctx, repo, cfg)
+	}})
+	runner.Add(jobs.Job{Name: "scheduled_reports", Mode: jobs.Singleton, Interval: time.Duration(cfg.ReportIntervalSeconds) * time.Second, Timeout: 5 * time.Minute, Run: func(ctx context.Context) error {
+		if cfg.ReportWebhookURL == "" {
+			return nil
 		}
-	}()
-
-	go func() {
-		if cfg.ReportIntervalSeconds <= 0 {
-			return
-		}
-		ticker := time.NewTicker(time.Duration(cfg.ReportIntervalSeconds) * time.Second)
-		defer ticker.Stop()
-		for range ticker.C {
-			if cfg.ReportWebhookURL == "" {
-				continue
-			}
-			if err := runScheduledReports(context.Background(), repo, cfg); err != nil {
-				log.Printf("report worker error: %v", err)
-			}
-		}
-	}()
+		return runScheduledReports(ctx, repo, cfg)
+	}})
+	runner.Start(context.Background())
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
@@ -124,6 +91,33 @@ func main() {
 	if err := server.Shutdown(ctx); err != nil {
 		log.Printf("shutdown error: %v", err)
 	}
+	runner.Stop(ctx)
+}
+
+func runAnomalyScan(ctx context.Context, repo store.Store, cfg config.Config) error {
+	services, err := repo.ListServices(ctx)
+	if err != nil {
+		return fmt.Errorf("anomaly list services: %w", err)
+	}
+	windowEnd := time.Now().UTC()
+	windowStart := windowEnd.Add(-1 * time.Hour)
+	for _, svc := range services {
+		kpi, err := repo.GetKPIs(ctx, svc.TenantID, svc.BranchID, svc.ServiceID, windowStart, windowEnd)
+		if err != nil {
+			continue
+		}
+		if kpi.AvgWaitSeconds > cfg.AnomalyThresholdSeconds {
+			_ = repo.InsertAnomaly(ctx, store.Anomaly{
+				TenantID:  svc.TenantID,
+				BranchID:  svc.BranchID,
+				ServiceID: svc.ServiceID,
+				Type:      "wait_time",
+				Value:     kpi.AvgWaitSeconds,
+				Threshold: cfg.AnomalyThresholdSeconds,
+			})
+		}
+	}
+	return nil
 }
 
 func runScheduledReports(ctx context.Context, repo store.Store, cfg config.Config) error {
@@ -183,7 +177,7 @@ func parseReportInterval(cron string) (time.Duration, error) {
 func buildCSV(rows []store.TicketRow) ([]byte, error) {
 	buf := &strings.Builder{}
 	writer := csv.NewWriter(buf)
-	_ = writer.Write([]string{"ticket_id", "ticket_number", "status", "created_at", "called_at", "served_at", "completed_at"})
+	_ = writer.Write([]string{"ticket_id", "ticket_number", "status", "created_at", "called_at", "served_at", "completed_at", "party_size"})
 	for _, row := range rows {
 		_ = writer.Write([]string{
 			row.TicketID,
@@ -193,6 +187,7 @@ func buildCSV(rows []store.TicketRow) ([]byte, error) {
 			formatTime(row.CalledAt),
 			formatTime(row.ServedAt),
 			formatTime(row.CompletedAt),
+			strconv.Itoa(row.PartySize),
 		})
 	}
 	writer.Flush()
@@ -24,6 +24,7 @@ type Config struct {
 	ReportEmailFrom          string
 	ReportEmailSubject       string
 	BIAPIToken               string
+	JobLeaseSeconds          int
 }
 
 func Load() Config {
@@ -51,6 +52,7 @@ func Load() Config {
 		ReportEmailFrom:          os.Getenv("ANALYTICS_REPORT_EMAIL_FROM"),
 		ReportEmailSubject:       os.Getenv("ANALYTICS_REPORT_EMAIL_SUBJECT"),
 		BIAPIToken:               os.Getenv("ANALYTICS_BI_API_TOKEN"),
+		JobLeaseSeconds:          readInt("JOB_LEASE_SECONDS", 30),
 	}
 }
 
@@ -21,6 +21,8 @@ type Handler struct {
 
 type Options struct {
 	BIAPIToken string
+	// Jobs, when set, serves background job status at /jobs.
+	Jobs http.Handler
 }
 
 type errorResponse struct {
@@ -37,10 +39,23 @@ func NewHandler(store store.Store, opts Options) *Handler {
 	return &Handler{store: store, opts: opts}
 }
 
+// handleJobs exposes the job runner status to admins only.
+func (h *Handler) handleJobs(w http.ResponseWriter, r *http.Request) {
+	session, ok := authFromContext(r.Context())
+	if !ok || !strings.EqualFold(session.Role, "admin") {
+		writeError(w, r, http.StatusForbidden, "access_denied", "role not permitted")
+		return
+	}
+	h.opts.Jobs.ServeHTTP(w, r)
+}
+
 func (h *Handler) Routes() http.Handler {
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", expvar.Handler())
 	mux.HandleFunc("/healthz", h.handleHealth)
+	if h.opts.Jobs != nil {
+		mux.HandleFunc("/jobs", h.handleJobs)
+	}
 	mux.HandleFunc("/api/analytics/kpis", h.handleKPIs)
 	mux.HandleFunc("/api/analytics/realtime", h.handleRealtime)
 	mux.HandleFunc("/api/analytics/export", h.handleExport)
@@ -114,7 +129,7 @@ func (h *Handler) handleExport(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/csv")
 	w.Header().Set("Content-Disposition", "attachment; filename=report.csv")
 	writer := csv.NewWriter(w)
-	_ = writer.Write([]string{"ticket_id", "ticket_number", "status", "created_at", "called_at", "served_at", "completed_at"})
+	_ = writer.Write([]string{"ticket_id", "ticket_number", "status", "created_at", "called_at", "served_at", "completed_at", "party_size"})
 	for _, row := range rows {
 		_ = writer.Write([]string{
 			row.TicketID,
@@ -124,6 +139,7 @@ func (h *Handler) handleExport(w http.ResponseWriter, r *http.Request) {
 			formatTime(row.CalledAt),
 			formatTime(row.ServedAt),
 			formatTime(row.CompletedAt),
+			strconv.Itoa(row.PartySize),
 		})
 	}
 	writer.Flush()
@@ -26,12 +26,14 @@ func (s *Store) GetKPIs(ctx context.Context, tenantID, branchID, serviceID strin
 		SELECT
 			AVG(EXTRACT(EPOCH FROM (called_at - created_at))) AS avg_wait,
 			AVG(EXTRACT(EPOCH FROM (completed_at - served_at))) AS avg_service,
-			COUNT(*)
+			COUNT(*),
+			COUNT(*) FILTER (WHERE status = 'done') AS tickets_served,
+			COALESCE(SUM(party_size) FILTER (WHERE status = 'done'), 0) AS people_served
 		FROM tickets
 		WHERE tenant_id = $1 AND branch_id = $2 AND service_id = $3
 			AND created_at >= $4 AND created_at <= $5
 	`, tenantID, branchID, serviceID, from, to)
-	if err := row.Scan(&result.AvgWaitSeconds, &result.AvgServiceSeconds, &result.Count); err != nil {
+	if err := row.Scan(&result.AvgWaitSeconds, &result.AvgServiceSeconds, &result.Count, &result.TicketsServed, &result.PeopleServed); err != nil {
 		return store.KPIResult{}, err
 	}
 	return result, nil
@@ -61,12 +63,29 @@ func (s *Store) GetRealtime(ctx context.Context, tenantID, branchID, serviceID s
 	if err := row.Scan(&result.ActiveCounters, &result.BusyCounters); err != nil {
 		return store.RealtimeResult{}, err
 	}
+
+	// Counters backed by rooms or chairs serve in parallel, so utilisation is
+	// measured against summed resource capacity rather than counter count.
+	row = s.pool.QueryRow(ctx, `
+		SELECT
+			COALESCE(SUM(GREATEST(COALESCE((SELECT SUM(r.capacity) FROM resources r WHERE r.counter_id = c.counter_id AND r.active = TRUE), 0), 1)), 0),
+			(SELECT COUNT(*) FROM tickets t WHERE t.tenant_id = $1 AND t.branch_id = $2 AND t.status IN ('called', 'serving'))
+		FROM counters c
+		JOIN branches b ON b.branch_id = c.branch_id
+		WHERE b.tenant_id = $1 AND c.branch_id = $2 AND c.status IN ('active', 'available', 'busy')
+	`, tenantID, branchID)
+	if err := row.Scan(&result.Capacity, &result.InService); err != nil {
+		return store.RealtimeResult{}, err
+	}
+	if result.Capacity > 0 {
+		result.Utilisation = float64(result.InService) / float64(result.Capacity)
+	}
 	return result, nil
 }
 
 func (s *Store) ListTickets(ctx context.Context, tenantID, branchID, serviceID string, from, to time.Time) ([]store.TicketRow, error) {
 	rows, err := s.pool.Query(ctx, `
-		SELECT ticket_id, ticket_number, status, created_at, called_at, served_at, completed_at
+		SELECT ticket_id, ticket_number, status, created_at, called_at, served_at, completed_at, party_size
 		FROM tickets
 		WHERE tenant_id = $1 AND branch_id = $2 AND service_id = $3
 			AND created_at >= $4 AND created_at <= $5
@@ -80,7 +99,7 @@ func (s *Store) ListTickets(ctx context.Context, tenantID, branchID, serviceID s
 	var tickets []store.TicketRow
 	for rows.Next() {
 		var row store.TicketRow
-		if err := rows.Scan(&row.TicketID, &row.Number, &row.Status, &row.CreatedAt, &row.CalledAt, &row.ServedAt, &row.CompletedAt); err != nil {
+		if err := rows.Scan(&row.TicketID, &row.Number, &row.Status, &row.CreatedAt, &row.CalledAt, &row.ServedAt, &row.CompletedAt, &row.PartySize); err != nil {
 			return nil, err
 		}
 		tickets = append(tickets, row)
@@ -216,3 +235,34 @@ func (s *Store) GetSession(ctx context.Context, sessionID string) (store.Session
 	}
 	return session, nil
 }
+
+// AcquireLease takes or renews the named lease for holder. It fails while
+// another holder's lease is unexpired.
+func (s *Store) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	var current string
+	err := s.pool.QueryRow(ctx, `
+		INSERT INTO job_leases (name, holder, acquired_at, expires_at)
+		VALUES ($1, $2, NOW(), NOW() + make_interval(secs => $3))
+		ON CONFLICT (name) DO UPDATE
+		SET holder = EXCLUDED.holder,
+			acquired_at = CASE WHEN job_leases.holder = EXCLUDED.holder THEN job_leases.acquired_at ELSE NOW() END,
+			expires_at = EXCLUDED.expires_at
+		WHERE job_leases.holder = EXCLUDED.holder OR job_leases.expires_at < NOW()
+		RETURNING holder
+	`, name, holder, ttl.Seconds()).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *Store) ReleaseLease(ctx context.Context, name, holder string) error {
+	_, err := s.pool.Exec(ctx, `
+		DELETE FROM job_leases
+		WHERE name = $1 AND holder = $2
+	`, name, holder)
+	return err
+}
@@ -9,13 +9,18 @@ type KPIResult struct {
 	AvgWaitSeconds    float64 `json:"avg_wait_seconds"`
 	AvgServiceSeconds float64 `json:"avg_service_seconds"`
 	Count             int     `json:"count"`
+	TicketsServed     int     `json:"tickets_served"`
+	PeopleServed      int     `json:"people_served"`
 }
 
 type RealtimeResult struct {
-	QueueLength    int `json:"queue_length"`
-	Serving        int `json:"serving"`
-	ActiveCounters int `json:"active_counters"`
-	BusyCounters   int `json:"busy_counters"`
+	QueueLength    int     `json:"queue_length"`
+	Serving        int     `json:"serving"`
+	ActiveCounters int     `json:"active_counters"`
+	BusyCounters   int     `json:"busy_counters"`
+	Capacity       int     `json:"capacity"`
+	InService      int     `json:"in_service"`
+	Utilisation    float64 `json:"utilisation"`
 }
 
 type TicketRow struct {
@@ -26,6 +31,7 @@ type TicketRow struct {
 	CalledAt    *time.Time
 	ServedAt    *time.Time
 	CompletedAt *time.Time
+	PartySize   int
 }
 
 type Store interface {
@@ -73,6 +73,7 @@ func (h *Handler) Routes() http.Handler {
 	mux.HandleFunc("/api/auth/sso/jwt", h.handleJWTSSO)
 	mux.HandleFunc("/api/auth/sso/saml", h.handleSAMLSSO)
 	mux.HandleFunc("/api/auth/me", h.handleMe)
+	mux.HandleFunc("/api/auth/logout", h.handleLogout)
 	return mux
 }
 
@@ -369,6 +370,32 @@ func (h *Handler) handleMe(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, resp)
 }
 
+// handleLogout ends the caller's session. Realtime sockets opened with it
+// are closed as well.
+func (h *Handler) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessionID := strings.TrimSpace(bearerToken(r.Header.Get("Authorization")))
+	if sessionID == "" {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "missing session token")
+		return
+	}
+
+	if err := h.store.DeleteSession(r.Context(), sessionID); err != nil {
+		if errors.Is(err, store.ErrSessionNotFound) {
+			writeError(w, r, http.StatusUnauthorized, "unauthorized", "invalid session")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "internal_error", "internal server error")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func bearerToken(header string) string {
 	if header == "" {
 		return ""
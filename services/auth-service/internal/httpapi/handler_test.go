@@ -18,6 +18,7 @@ type fakeStore struct {
 	sessionFn func(ctx context.Context, sessionID string) (models.Session, models.User, error)
 	accessFn  func(ctx context.Context, userID string) ([]string, []string, error)
 	ssoFn     func(ctx context.Context, tenantID, provider, subject, email string) (store.LoginResult, error)
+	deleteFn  func(ctx context.Context, sessionID string) error
 }
 
 func (f fakeStore) Login(ctx context.Context, input store.LoginInput) (store.LoginResult, error) {
@@ -45,6 +46,13 @@ func (f fakeStore) CreateSession(ctx context.Context, userID string, expiresAt t
 	return models.Session{}, nil
 }
 
+func (f fakeStore) DeleteSession(ctx context.Context, sessionID string) error {
+	if f.deleteFn == nil {
+		return store.ErrSessionNotFound
+	}
+	return f.deleteFn(ctx, sessionID)
+}
+
 func (f fakeStore) SSOLogin(ctx context.Context, tenantID, provider, subject, email string) (store.LoginResult, error) {
 	if f.ssoFn == nil {
 		return store.LoginResult{}, nil
@@ -109,3 +117,32 @@ func TestMeUnauthorized(t *testing.T) {
 		t.Fatalf("expected status 401, got %d", resp.Code)
 	}
 }
+
+func TestLogoutDeletesSession(t *testing.T) {
+	var deleted string
+	st := fakeStore{
+		deleteFn: func(ctx context.Context, sessionID string) error {
+			deleted = sessionID
+			return nil
+		},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/logout", nil)
+	req.Header.Set("Authorization", "Bearer sess-1")
+	resp := httptest.NewRecorder()
+
+	NewHandler(st).Routes().ServeHTTP(resp, req)
+	if resp.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d", resp.Code)
+	}
+	if deleted != "sess-1" {
+		t.Fatalf("expected sess-1 to be deleted, got %q", deleted)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/auth/logout", nil)
+	req.Header.Set("Authorization", "Bearer sess-1")
+	resp = httptest.NewRecorder()
+	NewHandler(fakeStore{}).Routes().ServeHTTP(resp, req)
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 for an unknown session, got %d", resp.Code)
+	}
+}
@@ -154,6 +154,27 @@ func (s *Store) CreateSession(ctx context.Context, userID string, expiresAt time
 	return models.Session{SessionID: sessionID, UserID: userID, ExpiresAt: expiresAt}, nil
 }
 
+func (s *Store) DeleteSession(ctx context.Context, sessionID string) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `DELETE FROM sessions WHERE session_id = $1`, sessionID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return store.ErrSessionNotFound
+	}
+	// Delivered on commit; realtime-service listens for it.
+	if _, err := tx.Exec(ctx, `SELECT pg_notify('session_revoked', $1)`, sessionID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
 func (s *Store) SSOLogin(ctx context.Context, tenantID, provider, subject, email string) (store.LoginResult, error) {
 	var user models.User
 	row := s.pool.QueryRow(ctx, `
@@ -26,5 +26,8 @@ type Store interface {
 	GetSession(ctx context.Context, sessionID string) (models.Session, models.User, error)
 	GetAccess(ctx context.Context, userID string) ([]string, []string, error)
 	CreateSession(ctx context.Context, userID string, expiresAt time.Time) (models.Session, error)
+	// DeleteSession ends a session and tells realtime-service to close its
+	// open sockets.
+	DeleteSession(ctx context.Context, sessionID string) error
 	SSOLogin(ctx context.Context, tenantID, provider, subject, email string) (LoginResult, error)
 }
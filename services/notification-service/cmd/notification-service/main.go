@@ -3,12 +3,15 @@ package main
 import (
 	"context"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"qms/notification-service/internal/config"
+	"qms/notification-service/internal/jobs"
+	"qms/notification-service/internal/pgnotify"
 	"qms/notification-service/internal/store/postgres"
 	"qms/notification-service/internal/worker"
 
@@ -34,12 +37,70 @@ func main() {
 		PushProvider:      cfg.PushProvider,
 		ReminderThreshold: cfg.ReminderThreshold,
 		PrefsPath:         cfg.PrefsPath,
+		ConsumerName:      cfg.ConsumerName,
 	})
+	if err := w.Register(context.Background()); err != nil {
+		log.Fatalf("register outbox consumer: %v", err)
+	}
+
+	// NOTIFY from queue-service wakes the worker as soon as an event
+	// commits; NOTIF_POLL_SECONDS is the fallback.
+	var wake <-chan struct{}
+	if cfg.Listen {
+		listener := pgnotify.New(pool, pgnotify.OutboxChannel)
+		go listener.Run(context.Background())
+		wake = listener.C()
+	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	// All replicas share one consumer offset, so only the leader reads the
+	// outbox; the others stand by.
+	runner := jobs.NewRunner(store, jobs.Options{Lease: "notification-service", TTL: cfg.JobLeaseTTL})
+	runner.Add(jobs.Job{Name: "outbox_worker", Mode: jobs.Singleton, Interval: cfg.PollInterval, Timeout: 5 * time.Minute, Wake: wake, Run: w.Run})
+	runner.Start(context.Background())
 
-	go worker.Start(ctx, cfg.PollInterval, w)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	server := &http.Server{
+		Addr:         ":" + cfg.Port,
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+	go func() {
+		log.Printf("notification-service listening on %s", server.Addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("server error: %v", err)
+		}
+	}()
+
+	// There are no sessions here to check, so /jobs is kept off the public
+	// port and served on NOTIF_JOBS_ADDR, loopback by default. An empty
+	// address turns it off.
+	var jobsServer *http.Server
+	if cfg.JobsAddr != "" {
+		jobsMux := http.NewServeMux()
+		jobsMux.Handle("/jobs", runner)
+		jobsServer = &http.Server{
+			Addr:         cfg.JobsAddr,
+			Handler:      jobsMux,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+			IdleTimeout:  60 * time.Second,
+		}
+		go func() {
+			log.Printf("notification-service jobs listening on %s", jobsServer.Addr)
+			if err := jobsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("jobs server error: %v", err)
+			}
+		}()
+	}
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
@@ -47,5 +108,13 @@ func main() {
 
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer shutdownCancel()
-	<-shutdownCtx.Done()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("shutdown error: %v", err)
+	}
+	if jobsServer != nil {
+		if err := jobsServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("jobs shutdown error: %v", err)
+		}
+	}
+	runner.Stop(shutdownCtx)
 }
@@ -8,6 +8,7 @@ import (
 
 type Config struct {
 	Port              string
+	JobsAddr          string
 	DatabaseURL       string
 	PollInterval      time.Duration
 	BatchSize         int
@@ -18,6 +19,9 @@ type Config struct {
 	PushProvider      string
 	ReminderThreshold int
 	PrefsPath         string
+	ConsumerName      string
+	JobLeaseTTL       time.Duration
+	Listen            bool
 }
 
 func Load() Config {
@@ -28,6 +32,7 @@ func Load() Config {
 
 	return Config{
 		Port:              port,
+		JobsAddr:          readString("NOTIF_JOBS_ADDR", "127.0.0.1:9082"),
 		DatabaseURL:       os.Getenv("DB_DSN"),
 		PollInterval:      readDurationSeconds("NOTIF_POLL_SECONDS", 5),
 		BatchSize:         readInt("NOTIF_BATCH_SIZE", 50),
@@ -38,9 +43,20 @@ func Load() Config {
 		PushProvider:      os.Getenv("NOTIF_PUSH_PROVIDER"),
 		ReminderThreshold: readInt("NOTIF_REMINDER_THRESHOLD", 3),
 		PrefsPath:         os.Getenv("NOTIF_PREFS_PATH"),
+		ConsumerName:      os.Getenv("NOTIF_CONSUMER_NAME"),
+		JobLeaseTTL:       readDurationSeconds("JOB_LEASE_SECONDS", 30),
+		Listen:            readBool("NOTIF_LISTEN", true),
 	}
 }
 
+func readString(key, fallback string) string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	return value
+}
+
 func readDurationSeconds(key string, fallback int) time.Duration {
 	value := readInt(key, fallback)
 	if value <= 0 {
@@ -60,3 +76,15 @@ func readInt(key string, fallback int) int {
 	}
 	return value
 }
+
+func readBool(key string, fallback bool) bool {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,136 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeLeaser struct {
+	mu       sync.Mutex
+	holder   string
+	released bool
+}
+
+func (f *fakeLeaser) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.holder == "" {
+		f.holder = holder
+	}
+	return f.holder == holder, nil
+}
+
+func (f *fakeLeaser) ReleaseLease(ctx context.Context, name, holder string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.holder == holder {
+		f.holder = ""
+		f.released = true
+	}
+	return nil
+}
+
+func TestSingletonRunsOnlyOnLeader(t *testing.T) {
+	leaser := &fakeLeaser{}
+	runs := map[string]int{}
+	newRunner := func(holder string) (*Runner, *entry, *entry) {
+		r := NewRunner(leaser, Options{Lease: "notification-service", Holder: holder})
+		r.Add(Job{Name: "digest", Mode: Singleton, Interval: time.Hour, Run: func(ctx context.Context) error {
+			runs[holder+"/digest"]++
+			return nil
+		}})
+		r.Add(Job{Name: "expire", Mode: Shardable, Interval: time.Hour, Run: func(ctx context.Context) error {
+			runs[holder+"/expire"]++
+			return errors.New("boom")
+		}})
+		return r, r.jobs[0], r.jobs[1]
+	}
+	ctx := context.Background()
+	a, aDigest, aExpire := newRunner("a")
+	b, bDigest, bExpire := newRunner("b")
+	a.heartbeat(ctx)
+	b.heartbeat(ctx)
+
+	for _, e := range []*entry{aDigest, aExpire} {
+		a.runOnce(ctx, e)
+	}
+	for _, e := range []*entry{bDigest, bExpire} {
+		b.runOnce(ctx, e)
+	}
+	if runs["a/digest"] != 1 || runs["b/digest"] != 0 {
+		t.Fatalf("expected singleton to run on leader only, got %v", runs)
+	}
+	if runs["a/expire"] != 1 || runs["b/expire"] != 1 {
+		t.Fatalf("expected shardable job to run on both replicas, got %v", runs)
+	}
+
+	report := b.Report()
+	if report.Leader || report.Jobs[0].Skipped != 1 || report.Jobs[1].Failures != 1 || report.Jobs[1].LastError != "boom" {
+		t.Fatalf("unexpected follower report: %+v", report)
+	}
+
+	a.Stop(ctx)
+	if !leaser.released {
+		t.Fatalf("expected leader to release the lease on stop")
+	}
+	b.heartbeat(ctx)
+	b.runOnce(ctx, bDigest)
+	if runs["b/digest"] != 1 || !b.Report().Leader {
+		t.Fatalf("expected standby to take over, got %v", runs)
+	}
+}
+
+func TestLostLeaseCancelsSingleton(t *testing.T) {
+	leaser := &fakeLeaser{}
+	r := NewRunner(leaser, Options{Lease: "notification-service", Holder: "a"})
+	started := make(chan struct{})
+	r.Add(Job{Name: "digest", Mode: Singleton, Interval: time.Hour, Timeout: time.Minute, Run: func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	ctx := context.Background()
+	r.heartbeat(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		r.runOnce(ctx, r.jobs[0])
+		close(done)
+	}()
+	<-started
+	leaser.mu.Lock()
+	leaser.holder = "b"
+	leaser.mu.Unlock()
+	r.heartbeat(ctx)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("expected running singleton to be cancelled")
+	}
+	if status := r.Report().Jobs[0]; status.Failures != 1 {
+		t.Fatalf("expected cancelled run to count as failure, got %+v", status)
+	}
+}
+
+func TestWakeRunsBeforeTick(t *testing.T) {
+	r := NewRunner(&fakeLeaser{}, Options{Lease: "notification-service", Holder: "a"})
+	wake := make(chan struct{}, 1)
+	ran := make(chan struct{}, 1)
+	r.Add(Job{Name: "worker", Mode: Shardable, Interval: time.Hour, Wake: wake, Run: func(ctx context.Context) error {
+		ran <- struct{}{}
+		return nil
+	}})
+	r.Start(context.Background())
+	defer r.Stop(context.Background())
+
+	wake <- struct{}{}
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatalf("expected wake to trigger a run")
+	}
+}
@@ -20,17 +20,26 @@ func NewStore(pool *pgxpool.Pool) *Store {
 	return &Store{pool: pool}
 }
 
-func (s *Store) ListOutboxEvents(ctx context.Context, after time.Time, limit int) ([]store.OutboxEvent, error) {
+// outboxSequencerLock is the advisory lock queue-service and every outbox
+// consumer hold while numbering outbox events.
+const outboxSequencerLock = "outbox:sequencer"
+
+// ListOutboxEvents numbers committed events first: queue-service inserts
+// them without a seq and leaves numbering to the readers.
+func (s *Store) ListOutboxEvents(ctx context.Context, afterSeq int64, limit int) ([]store.OutboxEvent, error) {
 	if limit <= 0 {
 		limit = 50
 	}
+	if err := s.sequenceOutbox(ctx); err != nil {
+		return nil, err
+	}
 	rows, err := s.pool.Query(ctx, `
-		SELECT event_id, tenant_id, type, payload_json, created_at
+		SELECT seq, event_id, tenant_id, type, payload_json, created_at
 		FROM outbox_events
-		WHERE created_at > $1
-		ORDER BY created_at ASC
+		WHERE seq > $1
+		ORDER BY seq ASC
 		LIMIT $2
-	`, after, limit)
+	`, afterSeq, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -39,7 +48,7 @@ func (s *Store) ListOutboxEvents(ctx context.Context, after time.Time, limit int
 	var events []store.OutboxEvent
 	for rows.Next() {
 		var event store.OutboxEvent
-		if err := rows.Scan(&event.EventID, &event.TenantID, &event.Type, &event.Payload, &event.CreatedAt); err != nil {
+		if err := rows.Scan(&event.Seq, &event.EventID, &event.TenantID, &event.Type, &event.Payload, &event.CreatedAt); err != nil {
 			return nil, err
 		}
 		events = append(events, event)
@@ -50,28 +59,77 @@ func (s *Store) ListOutboxEvents(ctx context.Context, after time.Time, limit int
 	return events, nil
 }
 
-func (s *Store) GetLastOffset(ctx context.Context) (time.Time, error) {
-	var value time.Time
-	row := s.pool.QueryRow(ctx, `
-		SELECT last_event_time
-		FROM notification_offsets
-		WHERE id = 1
+// sequenceOutbox gives every committed outbox event without a seq the next
+// values from outbox_sequence, in write order. Only one transaction numbers
+// events at a time and it only sees committed rows, so seq values become
+// visible strictly in order.
+func (s *Store) sequenceOutbox(ctx context.Context) (err error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+		}
+	}()
+	if _, err = tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, outboxSequencerLock); err != nil {
+		return err
+	}
+	tag, err := tx.Exec(ctx, `
+		UPDATE outbox_events o
+		SET seq = q.last_seq + p.n
+		FROM (
+			SELECT event_id, ROW_NUMBER() OVER (ORDER BY write_order ASC) AS n
+			FROM outbox_events
+			WHERE seq IS NULL
+		) p, outbox_sequence q
+		WHERE q.id = 1 AND o.event_id = p.event_id
 	`)
-	if err := row.Scan(&value); err != nil {
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() > 0 {
+		if _, err = tx.Exec(ctx, `UPDATE outbox_sequence SET last_seq = last_seq + $1 WHERE id = 1`, tag.RowsAffected()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// RegisterConsumer adds name to the outbox consumer registry so cleanup
+// keeps events until this consumer has read them.
+func (s *Store) RegisterConsumer(ctx context.Context, name string) error {
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO outbox_consumers (name, last_seq)
+		VALUES ($1, 0)
+		ON CONFLICT (name) DO NOTHING
+	`, name)
+	return err
+}
+
+func (s *Store) GetLastOffset(ctx context.Context, name string) (int64, error) {
+	var seq int64
+	row := s.pool.QueryRow(ctx, `
+		SELECT last_seq
+		FROM outbox_consumers
+		WHERE name = $1
+	`, name)
+	if err := row.Scan(&seq); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return time.Time{}, nil
+			return 0, nil
 		}
-		return time.Time{}, err
+		return 0, err
 	}
-	return value, nil
+	return seq, nil
 }
 
-func (s *Store) UpdateOffset(ctx context.Context, value time.Time) error {
+func (s *Store) UpdateOffset(ctx context.Context, name string, seq int64) error {
 	_, err := s.pool.Exec(ctx, `
-		INSERT INTO notification_offsets (id, last_event_time)
-		VALUES (1, $1)
-		ON CONFLICT (id) DO UPDATE SET last_event_time = EXCLUDED.last_event_time
-	`, value)
+		UPDATE outbox_consumers
+		SET last_seq = GREATEST(last_seq, $2), updated_at = NOW()
+		WHERE name = $1
+	`, name, seq)
 	return err
 }
 
@@ -136,6 +194,7 @@ func (s *Store) InsertNotification(ctx context.Context, notification store.Notif
 		INSERT INTO notifications (
 			notification_id,
 			tenant_id,
+			ticket_id,
 			channel,
 			recipient,
 			status,
@@ -144,11 +203,36 @@ func (s *Store) InsertNotification(ctx context.Context, notification store.Notif
 			message,
 			next_attempt_at
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-	`, notification.NotificationID, notification.TenantID, notification.Channel, notification.Recipient, notification.Status, notification.Attempts, notification.LastError, notification.Message, nullTime(notification.NextAttemptAt))
+		VALUES ($1, $2, NULLIF($3, '')::uuid, $4, $5, $6, $7, $8, $9, $10)
+	`, notification.NotificationID, notification.TenantID, notification.TicketID, notification.Channel, notification.Recipient, notification.Status, notification.Attempts, notification.LastError, notification.Message, nullTime(notification.NextAttemptAt))
 	return err
 }
 
+// ListTicketRecipients returns one notification per channel and recipient
+// already used for a ticket, so follow-up events without contact details in
+// their payload can reach the same customer.
+func (s *Store) ListTicketRecipients(ctx context.Context, tenantID, ticketID string) ([]store.Notification, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT DISTINCT channel, recipient
+		FROM notifications
+		WHERE tenant_id = $1 AND ticket_id = $2
+	`, tenantID, ticketID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recipients []store.Notification
+	for rows.Next() {
+		n := store.Notification{TenantID: tenantID, TicketID: ticketID}
+		if err := rows.Scan(&n.Channel, &n.Recipient); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, n)
+	}
+	return recipients, rows.Err()
+}
+
 func (s *Store) ListDueNotifications(ctx context.Context, limit int) ([]store.Notification, error) {
 	if limit <= 0 {
 		limit = 50
@@ -230,3 +314,87 @@ func nullTime(value *time.Time) interface{} {
 	}
 	return *value
 }
+
+// AcquireLease takes or renews the named lease for holder. It fails while
+// another holder's lease is unexpired.
+func (s *Store) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	var current string
+	err := s.pool.QueryRow(ctx, `
+		INSERT INTO job_leases (name, holder, acquired_at, expires_at)
+		VALUES ($1, $2, NOW(), NOW() + make_interval(secs => $3))
+		ON CONFLICT (name) DO UPDATE
+		SET holder = EXCLUDED.holder,
+			acquired_at = CASE WHEN job_leases.holder = EXCLUDED.holder THEN job_leases.acquired_at ELSE NOW() END,
+			expires_at = EXCLUDED.expires_at
+		WHERE job_leases.holder = EXCLUDED.holder OR job_leases.expires_at < NOW()
+		RETURNING holder
+	`, name, holder, ttl.Seconds()).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *Store) ReleaseLease(ctx context.Context, name, holder string) error {
+	_, err := s.pool.Exec(ctx, `
+		DELETE FROM job_leases
+		WHERE name = $1 AND holder = $2
+	`, name, holder)
+	return err
+}
+
+// RecordEventFailure stores a failed event, or counts one more attempt if it
+// is already stored.
+func (s *Store) RecordEventFailure(ctx context.Context, event store.OutboxEvent, lastError string, nextAttemptAt *time.Time) error {
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO notification_event_failures (event_id, seq, tenant_id, type, payload_json, created_at, last_error, next_attempt_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (event_id) DO UPDATE
+		SET attempts = notification_event_failures.attempts + 1,
+			last_error = EXCLUDED.last_error,
+			next_attempt_at = EXCLUDED.next_attempt_at,
+			updated_at = NOW()
+	`, event.EventID, event.Seq, event.TenantID, event.Type, event.Payload, event.CreatedAt, lastError, nullTime(nextAttemptAt))
+	return err
+}
+
+func (s *Store) ListDueEventFailures(ctx context.Context, limit int) ([]store.EventFailure, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := s.pool.Query(ctx, `
+		SELECT seq, event_id, tenant_id, type, payload_json, created_at, attempts, last_error, next_attempt_at
+		FROM notification_event_failures
+		WHERE next_attempt_at IS NOT NULL AND next_attempt_at <= NOW()
+		ORDER BY seq ASC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var failures []store.EventFailure
+	for rows.Next() {
+		var f store.EventFailure
+		if err := rows.Scan(&f.Event.Seq, &f.Event.EventID, &f.Event.TenantID, &f.Event.Type, &f.Event.Payload, &f.Event.CreatedAt, &f.Attempts, &f.LastError, &f.NextAttemptAt); err != nil {
+			return nil, err
+		}
+		failures = append(failures, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return failures, nil
+}
+
+func (s *Store) ClearEventFailure(ctx context.Context, eventID string) error {
+	_, err := s.pool.Exec(ctx, `
+		DELETE FROM notification_event_failures
+		WHERE event_id = $1
+	`, eventID)
+	return err
+}
@@ -6,6 +6,7 @@ import (
 )
 
 type OutboxEvent struct {
+	Seq       int64
 	EventID   string
 	TenantID  string
 	Type      string
@@ -16,6 +17,7 @@ type OutboxEvent struct {
 type Notification struct {
 	NotificationID string
 	TenantID       string
+	TicketID       string
 	Channel        string
 	Recipient      string
 	Status         string
@@ -26,17 +28,32 @@ type Notification struct {
 	CreatedAt      time.Time
 }
 
+// EventFailure is an outbox event the worker could not process. It is kept
+// for retry once the consumer offset has moved past it; NextAttemptAt is
+// nil after the last attempt.
+type EventFailure struct {
+	Event         OutboxEvent
+	Attempts      int
+	LastError     string
+	NextAttemptAt *time.Time
+}
+
 type Store interface {
-	ListOutboxEvents(ctx context.Context, after time.Time, limit int) ([]OutboxEvent, error)
-	GetLastOffset(ctx context.Context) (time.Time, error)
-	UpdateOffset(ctx context.Context, value time.Time) error
+	ListOutboxEvents(ctx context.Context, afterSeq int64, limit int) ([]OutboxEvent, error)
+	RegisterConsumer(ctx context.Context, name string) error
+	GetLastOffset(ctx context.Context, name string) (int64, error)
+	UpdateOffset(ctx context.Context, name string, seq int64) error
 	IsNotificationsEnabled(ctx context.Context, tenantID string) (bool, error)
 	GetQueuePosition(ctx context.Context, tenantID, branchID, serviceID, ticketID string) (int, error)
 	GetTemplate(ctx context.Context, tenantID, templateID, lang, channel string) (string, error)
 	InsertNotification(ctx context.Context, notification Notification) error
+	ListTicketRecipients(ctx context.Context, tenantID, ticketID string) ([]Notification, error)
 	ListDueNotifications(ctx context.Context, limit int) ([]Notification, error)
 	MarkNotificationSent(ctx context.Context, notificationID string) error
 	MarkNotificationRetry(ctx context.Context, notificationID, lastError string, nextAttemptAt time.Time) (int, error)
 	MarkNotificationFailed(ctx context.Context, notificationID, lastError string) (int, error)
 	InsertDLQ(ctx context.Context, notificationID, reason string) error
+	RecordEventFailure(ctx context.Context, event OutboxEvent, lastError string, nextAttemptAt *time.Time) error
+	ListDueEventFailures(ctx context.Context, limit int) ([]EventFailure, error)
+	ClearEventFailure(ctx context.Context, eventID string) error
 }
@@ -16,6 +16,7 @@ import (
 
 type Worker struct {
 	store             store.Store
+	consumerName      string
 	batchSize         int
 	maxAttempts       int
 	reminderThreshold int
@@ -38,6 +39,7 @@ type Config struct {
 	PushProvider      string
 	ReminderThreshold int
 	PrefsPath         string
+	ConsumerName      string
 }
 
 func New(store store.Store, cfg Config) *Worker {
@@ -53,8 +55,13 @@ func New(store store.Store, cfg Config) *Worker {
 	if threshold <= 0 {
 		threshold = 3
 	}
+	consumerName := cfg.ConsumerName
+	if consumerName == "" {
+		consumerName = "notification"
+	}
 	return &Worker{
 		store:             store,
+		consumerName:      consumerName,
 		batchSize:         batch,
 		maxAttempts:       maxAttempts,
 		reminderThreshold: threshold,
@@ -68,7 +75,7 @@ func New(store store.Store, cfg Config) *Worker {
 }
 
 func (w *Worker) Run(ctx context.Context) error {
-	last, err := w.store.GetLastOffset(ctx)
+	last, err := w.store.GetLastOffset(ctx, w.consumerName)
 	if err != nil {
 		return err
 	}
@@ -78,22 +85,68 @@ func (w *Worker) Run(ctx context.Context) error {
 		return err
 	}
 
+	// An event that fails is recorded for retry and the batch moves on, so
+	// one bad event never holds back the rest. The offset only stops short
+	// when the failure itself cannot be recorded.
+	done := last
+	var processErr error
 	for _, event := range events {
 		if err := w.processEvent(ctx, event); err != nil {
-			log.Printf("notif process error: %v", err)
+			if processErr == nil {
+				processErr = fmt.Errorf("process event seq=%d: %w", event.Seq, err)
+			}
+			if err := w.failEvent(ctx, event, 0, err); err != nil {
+				processErr = fmt.Errorf("record failed event seq=%d: %w", event.Seq, err)
+				break
+			}
 		}
-		last = event.CreatedAt
+		done = event.Seq
 	}
 
-	if !last.IsZero() {
-		if err := w.store.UpdateOffset(ctx, last); err != nil {
+	if done > last {
+		if err := w.store.UpdateOffset(ctx, w.consumerName, done); err != nil {
 			return err
 		}
 	}
 
+	if err := w.processEventRetries(ctx); err != nil {
+		return err
+	}
 	if err := w.processRetries(ctx); err != nil {
 		return err
 	}
+	return processErr
+}
+
+// failEvent records that event failed after attempts earlier tries. It is
+// retried with the delivery backoff until maxAttempts is reached.
+func (w *Worker) failEvent(ctx context.Context, event store.OutboxEvent, attempts int, cause error) error {
+	var next *time.Time
+	if attempts+1 < w.maxAttempts {
+		at := time.Now().Add(retryDelay(attempts + 1))
+		next = &at
+	} else {
+		log.Printf("notif give up event seq=%d after %d attempts: %v", event.Seq, attempts+1, cause)
+	}
+	return w.store.RecordEventFailure(ctx, event, cause.Error(), next)
+}
+
+func (w *Worker) processEventRetries(ctx context.Context) error {
+	failures, err := w.store.ListDueEventFailures(ctx, w.batchSize)
+	if err != nil {
+		return err
+	}
+	for _, failure := range failures {
+		if err := w.processEvent(ctx, failure.Event); err != nil {
+			if err := w.failEvent(ctx, failure.Event, failure.Attempts, err); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := w.store.ClearEventFailure(ctx, failure.Event.EventID); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -108,14 +161,17 @@ func (w *Worker) processEvent(ctx context.Context, event store.OutboxEvent) erro
 
 	payload := payloadData{}
 	if err := json.Unmarshal(event.Payload, &payload); err != nil {
-		return err
+		// Retrying cannot fix a malformed payload; skip it rather than
+		// blocking every later event.
+		log.Printf("notif skip event seq=%d: %v", event.Seq, err)
+		return nil
 	}
 
 	if w.prefsPath != "" {
 		w.prefs = loadNotificationPrefs(w.prefsPath)
 	}
 
-	templateID := templateForEvent(event.Type)
+	templateID := templateForEvent(event.Type, payload)
 	if templateID == "" {
 		return nil
 	}
@@ -134,6 +190,17 @@ func (w *Worker) processEvent(ctx context.Context, event store.OutboxEvent) erro
 
 func (w *Worker) sendNotifications(ctx context.Context, tenantID, templateID string, payload payloadData) error {
 	channels := pickChannels(payload)
+	if len(channels) == 0 && followsEarlierContact(templateID) {
+		// Remote lifecycle events carry no contact details; reuse the
+		// recipients notified when the ticket was created.
+		previous, err := w.store.ListTicketRecipients(ctx, tenantID, optionalStr(payload, "ticket_id"))
+		if err != nil {
+			return err
+		}
+		for _, n := range previous {
+			channels = append(channels, channelTarget{name: n.Channel, recipient: n.Recipient})
+		}
+	}
 	if len(channels) == 0 {
 		return nil
 	}
@@ -160,6 +227,7 @@ func (w *Worker) sendNotifications(ctx context.Context, tenantID, templateID str
 		notification := store.Notification{
 			NotificationID: uuid.NewString(),
 			TenantID:       tenantID,
+			TicketID:       optionalStr(payload, "ticket_id"),
 			Channel:        channel.name,
 			Recipient:      recipient,
 			Status:         "pending",
@@ -260,19 +328,35 @@ func retryDelay(attempt int) time.Duration {
 	return delay
 }
 
-func templateForEvent(eventType string) string {
+func templateForEvent(eventType string, payload payloadData) string {
 	switch eventType {
 	case "ticket.created":
+		if optionalStr(payload, "status") == "remote" {
+			return "ticket_remote_joined"
+		}
 		return "ticket_created"
 	case "ticket.called":
 		return "ticket_called"
 	case "ticket.recalled":
 		return "ticket_recalled"
+	case "ticket.arrived":
+		return "ticket_arrived"
+	case "ticket.remote_expired":
+		return "ticket_remote_expired"
 	default:
 		return ""
 	}
 }
 
+func followsEarlierContact(templateID string) bool {
+	switch templateID {
+	case "ticket_arrived", "ticket_remote_expired":
+		return true
+	default:
+		return false
+	}
+}
+
 func defaultTemplate(templateID, lang string) string {
 	if lang == "en" {
 		switch templateID {
@@ -284,6 +368,12 @@ func defaultTemplate(templateID, lang string) string {
 			return "Ticket {ticket_number} recalled."
 		case "ticket_reminder":
 			return "Ticket {ticket_number}: {queue_position} ahead."
+		case "ticket_remote_joined":
+			return "Ticket {ticket_number} joined remotely. Confirm arrival before {remote_expires_at}."
+		case "ticket_arrived":
+			return "Ticket {ticket_number}: arrival confirmed, you are in the queue."
+		case "ticket_remote_expired":
+			return "Ticket {ticket_number} expired because arrival was not confirmed."
 		}
 	}
 	switch templateID {
@@ -295,6 +385,12 @@ func defaultTemplate(templateID, lang string) string {
 		return "Tiket {ticket_number} dipanggil ulang."
 	case "ticket_reminder":
 		return "Tiket {ticket_number}: {queue_position} nomor lagi."
+	case "ticket_remote_joined":
+		return "Tiket {ticket_number} terdaftar dari jauh. Konfirmasi kedatangan sebelum {remote_expires_at}."
+	case "ticket_arrived":
+		return "Tiket {ticket_number}: kedatangan dikonfirmasi, Anda sudah masuk antrean."
+	case "ticket_remote_expired":
+		return "Tiket {ticket_number} kedaluwarsa karena kedatangan tidak dikonfirmasi."
 	}
 	return ""
 }
@@ -306,6 +402,7 @@ func renderTemplate(template string, payload payloadData) string {
 	result = strings.ReplaceAll(result, "{service_id}", str(payload, "service_id"))
 	result = strings.ReplaceAll(result, "{counter_id}", str(payload, "counter_id"))
 	result = strings.ReplaceAll(result, "{queue_position}", optionalStr(payload, "queue_position"))
+	result = strings.ReplaceAll(result, "{remote_expires_at}", optionalStr(payload, "remote_expires_at"))
 	return result
 }
 
@@ -429,17 +526,9 @@ func (p notificationPrefs) Allow(channel, recipient string) bool {
 	return !blocked
 }
 
-func Start(ctx context.Context, interval time.Duration, w *Worker) {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			if err := w.Run(ctx); err != nil {
-				log.Printf("notif worker error: %v", err)
-			}
-		}
-	}
+// Register adds the worker to the outbox consumer registry. It must succeed
+// before the first Run so cleanup does not delete events the worker has not
+// read.
+func (w *Worker) Register(ctx context.Context) error {
+	return w.store.RegisterConsumer(ctx, w.consumerName)
 }
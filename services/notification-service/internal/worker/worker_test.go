@@ -1,6 +1,14 @@
 package worker
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"qms/notification-service/internal/store"
+)
 
 func TestRenderTemplate(t *testing.T) {
 	payload := payloadData{
@@ -13,3 +21,129 @@ func TestRenderTemplate(t *testing.T) {
 		t.Fatalf("unexpected template render: %s", got)
 	}
 }
+
+type fakeStore struct {
+	store.Store
+	events   []store.OutboxEvent
+	offset   int64
+	failing  map[string]bool
+	enabled  []string
+	failures map[string]store.EventFailure
+}
+
+func (f *fakeStore) ListOutboxEvents(ctx context.Context, afterSeq int64, limit int) ([]store.OutboxEvent, error) {
+	var events []store.OutboxEvent
+	for _, event := range f.events {
+		if event.Seq > afterSeq && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (f *fakeStore) GetLastOffset(ctx context.Context, name string) (int64, error) {
+	return f.offset, nil
+}
+
+func (f *fakeStore) UpdateOffset(ctx context.Context, name string, seq int64) error {
+	f.offset = seq
+	return nil
+}
+
+func (f *fakeStore) IsNotificationsEnabled(ctx context.Context, tenantID string) (bool, error) {
+	if f.failing[tenantID] {
+		return false, errors.New("db unavailable")
+	}
+	f.enabled = append(f.enabled, tenantID)
+	return false, nil
+}
+
+func (f *fakeStore) ListDueNotifications(ctx context.Context, limit int) ([]store.Notification, error) {
+	return nil, nil
+}
+
+func (f *fakeStore) RecordEventFailure(ctx context.Context, event store.OutboxEvent, lastError string, nextAttemptAt *time.Time) error {
+	if f.failures == nil {
+		f.failures = map[string]store.EventFailure{}
+	}
+	failure := f.failures[event.EventID]
+	failure.Event = event
+	failure.Attempts++
+	failure.LastError = lastError
+	failure.NextAttemptAt = nextAttemptAt
+	f.failures[event.EventID] = failure
+	return nil
+}
+
+func (f *fakeStore) ListDueEventFailures(ctx context.Context, limit int) ([]store.EventFailure, error) {
+	var due []store.EventFailure
+	for _, failure := range f.failures {
+		if failure.NextAttemptAt != nil && !failure.NextAttemptAt.After(time.Now()) {
+			due = append(due, failure)
+		}
+	}
+	return due, nil
+}
+
+func (f *fakeStore) ClearEventFailure(ctx context.Context, eventID string) error {
+	delete(f.failures, eventID)
+	return nil
+}
+
+func TestRunRecordsFailedEventAndContinues(t *testing.T) {
+	fs := &fakeStore{
+		events: []store.OutboxEvent{
+			{Seq: 1, EventID: "e1", TenantID: "t1", Payload: []byte(`{}`)},
+			{Seq: 2, EventID: "e2", TenantID: "t2", Payload: []byte(`{}`)},
+			{Seq: 3, EventID: "e3", TenantID: "t1", Payload: []byte(`{}`)},
+		},
+		failing: map[string]bool{"t2": true},
+	}
+	w := New(fs, Config{})
+
+	if err := w.Run(context.Background()); err == nil {
+		t.Fatalf("expected error for failed event")
+	}
+	if fs.offset != 3 {
+		t.Fatalf("expected offset 3, got %d", fs.offset)
+	}
+	failure, ok := fs.failures["e2"]
+	if !ok || failure.Attempts != 1 || failure.NextAttemptAt == nil {
+		t.Fatalf("expected failed event recorded for retry, got %+v", fs.failures)
+	}
+
+	// Make the retry due and let it succeed.
+	past := time.Now().Add(-time.Second)
+	failure.NextAttemptAt = &past
+	fs.failures["e2"] = failure
+	fs.failing = nil
+	if err := w.Run(context.Background()); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(fs.failures) != 0 {
+		t.Fatalf("expected failure cleared, got %+v", fs.failures)
+	}
+	if got := strings.Join(fs.enabled, ","); got != "t1,t1,t2" {
+		t.Fatalf("expected failed event to be retried once, got %s", got)
+	}
+}
+
+func TestRunGivesUpAfterMaxAttempts(t *testing.T) {
+	fs := &fakeStore{
+		events:  []store.OutboxEvent{{Seq: 1, EventID: "e1", TenantID: "t1", Payload: []byte(`{}`)}},
+		failing: map[string]bool{"t1": true},
+	}
+	w := New(fs, Config{MaxAttempts: 2})
+
+	_ = w.Run(context.Background())
+	failure := fs.failures["e1"]
+	past := time.Now().Add(-time.Second)
+	failure.NextAttemptAt = &past
+	fs.failures["e1"] = failure
+	if err := w.Run(context.Background()); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if failure := fs.failures["e1"]; failure.Attempts != 2 || failure.NextAttemptAt != nil {
+		t.Fatalf("expected no further retry after 2 attempts, got %+v", failure)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"qms/queue-service/internal/config"
+	"qms/queue-service/internal/customerref"
+	"qms/queue-service/internal/jobs"
+	"qms/queue-service/internal/store"
+	"qms/queue-service/internal/store/memory"
+	"qms/queue-service/internal/store/postgres"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// backend is the ticket store plus the background jobs main schedules and
+// the leases that keep singleton jobs on one replica.
+type backend interface {
+	store.TicketStore
+	jobs.Leaser
+	AutoNoShow(ctx context.Context, grace time.Duration, batchSize int) (int, error)
+	ExpireHolds(ctx context.Context, batchSize int) (int, error)
+	ExpireRemoteTickets(ctx context.Context, batchSize int) (int, error)
+	PurgeExpiredCustomerRefs(ctx context.Context, batchSize int) (int, error)
+	SealEventDigests(ctx context.Context, day time.Time) ([]store.EventDigest, error)
+}
+
+// openStore builds the store selected by STORE_BACKEND. The returned close
+// function releases the database pool, if any.
+func openStore(cfg config.Config, customerRefs *customerref.Tokenizer) (backend, func(), error) {
+	switch cfg.StoreBackend {
+	case "", "postgres":
+		pool, err := pgxpool.New(context.Background(), cfg.DatabaseURL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("db connect: %w", err)
+		}
+		st := postgres.NewStore(pool, postgres.Options{
+			NoShowReturnToQueue: cfg.NoShowReturnToQueue,
+			PriorityStreakLimit: cfg.PriorityStreakLimit,
+			HoldDuration:        cfg.HoldDuration,
+			HoldExpiryAction:    cfg.HoldExpiryAction,
+			MaxRecalls:          cfg.MaxRecalls,
+			MinRecallInterval:   cfg.MinRecallInterval,
+			ReopenWindow:        cfg.ReopenWindow,
+			RemoteWindow:        cfg.RemoteWindow,
+			CustomerRefs:        customerRefs,
+		})
+		return st, pool.Close, nil
+	case "memory":
+		st := memory.NewStore(memory.Options{
+			NoShowReturnToQueue: cfg.NoShowReturnToQueue,
+			PriorityStreakLimit: cfg.PriorityStreakLimit,
+			HoldDuration:        cfg.HoldDuration,
+			HoldExpiryAction:    cfg.HoldExpiryAction,
+			MaxRecalls:          cfg.MaxRecalls,
+			MinRecallInterval:   cfg.MinRecallInterval,
+			ReopenWindow:        cfg.ReopenWindow,
+			RemoteWindow:        cfg.RemoteWindow,
+			CustomerRefs:        customerRefs,
+		})
+		if cfg.MemorySeedFile != "" {
+			if err := st.LoadSeedFile(cfg.MemorySeedFile); err != nil {
+				return nil, nil, fmt.Errorf("memory seed: %w", err)
+			}
+		}
+		return st, func() {}, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown STORE_BACKEND %q", cfg.StoreBackend)
+	}
+}
@@ -8,17 +8,25 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+	// Branch time zones are loaded by name and the runtime image has no
+	// zoneinfo.
+	_ "time/tzdata"
 
 	"qms/queue-service/internal/config"
+	"qms/queue-service/internal/customerref"
 	"qms/queue-service/internal/httpapi"
-	"qms/queue-service/internal/store/postgres"
+	"qms/queue-service/internal/jobs"
 	"qms/queue-service/internal/telemetry"
 
-	"github.com/jackc/pgx/v5/pgxpool"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		runReplay(os.Args[2:])
+		return
+	}
+
 	cfg := config.Load()
 	shutdownTelemetry := telemetry.Setup("queue-service")
 	defer func() {
@@ -27,18 +35,23 @@ func main() {
 		_ = shutdownTelemetry(ctx)
 	}()
 
-	pool, err := pgxpool.New(context.Background(), cfg.DatabaseURL)
+	customerRefs, err := customerref.New(cfg.CustomerRefHashKey, cfg.CustomerRefEncKey)
 	if err != nil {
-		log.Fatalf("db connect: %v", err)
+		log.Fatalf("customer ref keys: %v", err)
 	}
-	defer pool.Close()
 
-	store := postgres.NewStore(pool, postgres.Options{
-		NoShowReturnToQueue: cfg.NoShowReturnToQueue,
-		PriorityStreakLimit: cfg.PriorityStreakLimit,
-	})
+	store, closeStore, err := openStore(cfg, customerRefs)
+	if err != nil {
+		log.Fatalf("store: %v", err)
+	}
+	defer closeStore()
+	log.Printf("queue-service using %s store", cfg.StoreBackend)
+
+	runner := jobs.NewRunner(store, jobs.Options{Lease: "queue-service", TTL: cfg.JobLeaseTTL})
 	handler := httpapi.NewHandler(store, httpapi.Options{
 		NoShowReturnToQueue: cfg.NoShowReturnToQueue,
+		TrackingTokenSecret: cfg.TrackingTokenSecret,
+		Jobs:                runner,
 	})
 	limiter := httpapi.NewRateLimiter(httpapi.RateLimitConfig{
 		IPPerMinute:     cfg.RateLimitPerMinute,
@@ -63,25 +76,57 @@ func main() {
 		}
 	}()
 
-	go func() {
-		if cfg.NoShowGrace <= 0 || cfg.NoShowInterval <= 0 {
-			return
+	// The expiry jobs lock their rows with SKIP LOCKED, so every replica can
+	// share the work. Purge and digest sealing scan whole tables and run on
+	// the leader only.
+	noShowInterval := cfg.NoShowInterval
+	if cfg.NoShowGrace <= 0 {
+		noShowInterval = 0
+	}
+	runner.Add(jobs.Job{Name: "auto_no_show", Mode: jobs.Shardable, Interval: noShowInterval, Run: func(ctx context.Context) error {
+		count, err := store.AutoNoShow(ctx, cfg.NoShowGrace, cfg.NoShowBatchSize)
+		if count > 0 {
+			log.Printf("auto no-show processed %d tickets", count)
 		}
-		ticker := time.NewTicker(cfg.NoShowInterval)
-		defer ticker.Stop()
-		for range ticker.C {
-			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-			count, err := store.AutoNoShow(ctx, cfg.NoShowGrace, cfg.NoShowBatchSize)
-			cancel()
-			if err != nil {
-				log.Printf("auto no-show error: %v", err)
-				continue
-			}
-			if count > 0 {
-				log.Printf("auto no-show processed %d tickets", count)
+		return err
+	}})
+	runner.Add(jobs.Job{Name: "hold_expiry", Mode: jobs.Shardable, Interval: cfg.HoldExpiryInterval, Run: func(ctx context.Context) error {
+		count, err := store.ExpireHolds(ctx, cfg.HoldExpiryBatchSize)
+		if count > 0 {
+			log.Printf("hold expiry processed %d tickets", count)
+		}
+		return err
+	}})
+	runner.Add(jobs.Job{Name: "remote_expiry", Mode: jobs.Shardable, Interval: cfg.RemoteExpiryInterval, Run: func(ctx context.Context) error {
+		count, err := store.ExpireRemoteTickets(ctx, cfg.RemoteExpiryBatchSize)
+		if count > 0 {
+			log.Printf("remote expiry processed %d tickets", count)
+		}
+		return err
+	}})
+	runner.Add(jobs.Job{Name: "customer_ref_purge", Mode: jobs.Singleton, Interval: cfg.CustomerRefPurgeInterval, Run: func(ctx context.Context) error {
+		count, err := store.PurgeExpiredCustomerRefs(ctx, cfg.CustomerRefPurgeBatchSize)
+		if count > 0 {
+			log.Printf("customer ref purge processed %d records", count)
+		}
+		return err
+	}})
+	runner.Add(jobs.Job{Name: "event_digest", Mode: jobs.Singleton, Interval: cfg.EventDigestInterval, Timeout: time.Minute, Run: func(ctx context.Context) error {
+		digests, err := store.SealEventDigests(ctx, time.Now().UTC().AddDate(0, 0, -1))
+		if err != nil {
+			return err
+		}
+		for _, digest := range digests {
+			if digest.ChainIssues > 0 {
+				log.Printf("event digest tenant=%s date=%s: %d chain issues found", digest.TenantID, digest.Date, digest.ChainIssues)
 			}
 		}
-	}()
+		if len(digests) > 0 {
+			log.Printf("event digest sealed %d tenants", len(digests))
+		}
+		return nil
+	}})
+	runner.Start(context.Background())
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
@@ -92,4 +137,5 @@ func main() {
 	if err := server.Shutdown(ctx); err != nil {
 		log.Printf("shutdown error: %v", err)
 	}
+	runner.Stop(ctx)
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"qms/queue-service/internal/config"
+	"qms/queue-service/internal/store"
+	"qms/queue-service/internal/store/postgres"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// runReplay implements `queue-service replay`, which rebuilds tickets from
+// ticket_events and prints the drift report as JSON. It exits with status 1
+// when drift remains so it can gate scripts after a migration.
+func runReplay(args []string) {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	tenantID := flags.String("tenant", "", "tenant ID (required)")
+	ticketID := flags.String("ticket", "", "replay a single ticket")
+	serviceID := flags.String("service", "", "limit to one service")
+	from := flags.String("from", "", "created at or after, or on a UTC date (YYYY-MM-DD or RFC3339)")
+	to := flags.String("to", "", "created before, or on a UTC date (YYYY-MM-DD or RFC3339)")
+	limit := flags.Int("limit", store.DefaultReplayLimit, "maximum tickets to check")
+	repair := flags.Bool("repair", false, "overwrite drifted projection columns")
+	_ = flags.Parse(args)
+
+	if *tenantID == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	input := store.ReplayInput{
+		TenantID:  *tenantID,
+		TicketID:  *ticketID,
+		ServiceID: *serviceID,
+		Limit:     *limit,
+		Repair:    *repair,
+	}
+	var ok bool
+	if input.From, ok = store.ParseSearchTime(*from, false, time.UTC); !ok {
+		log.Fatalf("invalid -from: expected YYYY-MM-DD or RFC3339: %q", *from)
+	}
+	if input.To, ok = store.ParseSearchTime(*to, true, time.UTC); !ok {
+		log.Fatalf("invalid -to: expected YYYY-MM-DD or RFC3339: %q", *to)
+	}
+
+	cfg := config.Load()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	pool, err := pgxpool.New(ctx, cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("db connect: %v", err)
+	}
+	defer pool.Close()
+
+	report, err := postgres.NewStore(pool, postgres.Options{}).ReplayTickets(ctx, input)
+	if err != nil {
+		log.Fatalf("replay: %v", err)
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Fatalf("write report: %v", err)
+	}
+	if report.Drifted > report.Repaired {
+		pool.Close()
+		os.Exit(1)
+	}
+}
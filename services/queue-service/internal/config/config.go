@@ -9,11 +9,30 @@ import (
 type Config struct {
 	Port        string
 	DatabaseURL string
+	StoreBackend string
+	MemorySeedFile string
 	NoShowGrace time.Duration
 	NoShowInterval time.Duration
 	NoShowBatchSize int
 	NoShowReturnToQueue bool
 	PriorityStreakLimit int
+	HoldDuration time.Duration
+	HoldExpiryAction string
+	HoldExpiryInterval time.Duration
+	HoldExpiryBatchSize int
+	MaxRecalls int
+	MinRecallInterval time.Duration
+	ReopenWindow time.Duration
+	RemoteWindow time.Duration
+	RemoteExpiryInterval time.Duration
+	RemoteExpiryBatchSize int
+	TrackingTokenSecret string
+	CustomerRefHashKey string
+	CustomerRefEncKey string
+	CustomerRefPurgeInterval time.Duration
+	CustomerRefPurgeBatchSize int
+	EventDigestInterval time.Duration
+	JobLeaseTTL time.Duration
 	RateLimitPerMinute int
 	RateLimitBurst int
 	TenantRateLimitPerMinute int
@@ -29,11 +48,30 @@ func Load() Config {
 	return Config{
 		Port:        port,
 		DatabaseURL: os.Getenv("DB_DSN"),
+		StoreBackend: readString("STORE_BACKEND", "postgres"),
+		MemorySeedFile: os.Getenv("MEMORY_SEED_FILE"),
 		NoShowGrace: readDurationSeconds("NO_SHOW_GRACE_SECONDS", 300),
 		NoShowInterval: readDurationSeconds("NO_SHOW_SCAN_INTERVAL_SECONDS", 30),
 		NoShowBatchSize: readInt("NO_SHOW_BATCH_SIZE", 100),
 		NoShowReturnToQueue: readBool("NO_SHOW_RETURN_TO_QUEUE", false),
 		PriorityStreakLimit: readInt("PRIORITY_STREAK_LIMIT", 3),
+		HoldDuration: readDurationSeconds("HOLD_DEFAULT_SECONDS", 900),
+		HoldExpiryAction: os.Getenv("HOLD_EXPIRY_ACTION"),
+		HoldExpiryInterval: readDurationSeconds("HOLD_EXPIRY_SCAN_INTERVAL_SECONDS", 30),
+		HoldExpiryBatchSize: readInt("HOLD_EXPIRY_BATCH_SIZE", 100),
+		MaxRecalls: readInt("RECALL_MAX_COUNT", 3),
+		MinRecallInterval: readDurationSeconds("RECALL_MIN_INTERVAL_SECONDS", 15),
+		ReopenWindow: readDurationSeconds("REOPEN_WINDOW_SECONDS", 900),
+		RemoteWindow: readDurationSeconds("REMOTE_CONFIRM_SECONDS", 7200),
+		RemoteExpiryInterval: readDurationSeconds("REMOTE_EXPIRY_SCAN_INTERVAL_SECONDS", 60),
+		RemoteExpiryBatchSize: readInt("REMOTE_EXPIRY_BATCH_SIZE", 100),
+		TrackingTokenSecret: os.Getenv("TRACKING_TOKEN_SECRET"),
+		CustomerRefHashKey: os.Getenv("CUSTOMER_REF_HASH_KEY"),
+		CustomerRefEncKey: os.Getenv("CUSTOMER_REF_ENC_KEY"),
+		CustomerRefPurgeInterval: readDurationSeconds("CUSTOMER_REF_PURGE_INTERVAL_SECONDS", 3600),
+		CustomerRefPurgeBatchSize: readInt("CUSTOMER_REF_PURGE_BATCH_SIZE", 500),
+		EventDigestInterval: readDurationSeconds("EVENT_DIGEST_INTERVAL_SECONDS", 3600),
+		JobLeaseTTL: readDurationSeconds("JOB_LEASE_SECONDS", 30),
 		RateLimitPerMinute: readInt("RATE_LIMIT_PER_MIN", 120),
 		RateLimitBurst: readInt("RATE_LIMIT_BURST", 30),
 		TenantRateLimitPerMinute: readInt("TENANT_RATE_LIMIT_PER_MIN", 600),
@@ -49,6 +87,13 @@ func readDurationSeconds(key string, fallback int) time.Duration {
 	return time.Duration(value) * time.Second
 }
 
+func readString(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
 func readInt(key string, fallback int) int {
 	raw := os.Getenv(key)
 	if raw == "" {
@@ -0,0 +1,127 @@
+// Package customerref tokenises optional customer references (phone,
+// patient ID, CIF). A reference is stored twice: as a keyed hash used for
+// lookups and as an encrypted copy that authorised staff can reveal. Neither
+// form is useful without the service keys.
+package customerref
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+)
+
+const (
+	TypePhone     = "phone"
+	TypePatientID = "patient_id"
+	TypeCIF       = "cif"
+	TypeOther     = "other"
+)
+
+var (
+	ErrDisabled    = errors.New("customer reference keys not configured")
+	ErrInvalidType = errors.New("invalid customer reference type")
+	ErrCiphertext  = errors.New("customer reference ciphertext invalid")
+)
+
+// Tokenizer hashes and encrypts customer references. A nil Tokenizer is
+// valid and reports ErrDisabled, so deployments without keys keep working as
+// long as no reference is submitted.
+type Tokenizer struct {
+	hashKey []byte
+	aead    cipher.AEAD
+}
+
+// New builds a Tokenizer from the configured secrets. The encryption key is
+// derived with SHA-256 so any secret length is accepted. Both secrets empty
+// returns nil, meaning customer references are disabled.
+func New(hashSecret, encSecret string) (*Tokenizer, error) {
+	if hashSecret == "" && encSecret == "" {
+		return nil, nil
+	}
+	if hashSecret == "" || encSecret == "" {
+		return nil, errors.New("both customer reference hash and encryption keys are required")
+	}
+	key := sha256.Sum256([]byte(encSecret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Tokenizer{hashKey: []byte(hashSecret), aead: aead}, nil
+}
+
+// NormalizeType maps an input type to a known one; empty means other.
+func NormalizeType(refType string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(refType)) {
+	case "", TypeOther:
+		return TypeOther, nil
+	case TypePhone:
+		return TypePhone, nil
+	case TypePatientID:
+		return TypePatientID, nil
+	case TypeCIF:
+		return TypeCIF, nil
+	default:
+		return "", ErrInvalidType
+	}
+}
+
+// Normalize strips formatting so the same reference always hashes the same:
+// whitespace and dashes are removed and letters upper-cased.
+func Normalize(value string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(value) {
+		if r == ' ' || r == '-' || r == '\t' {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Hash returns the keyed lookup hash of a normalised reference.
+func (t *Tokenizer) Hash(value string) (string, error) {
+	if t == nil {
+		return "", ErrDisabled
+	}
+	mac := hmac.New(sha256.New, t.hashKey)
+	mac.Write([]byte(Normalize(value)))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Seal encrypts the reference as entered, prefixed with its nonce.
+func (t *Tokenizer) Seal(value string) ([]byte, error) {
+	if t == nil {
+		return nil, ErrDisabled
+	}
+	nonce := make([]byte, t.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return t.aead.Seal(nonce, nonce, []byte(strings.TrimSpace(value)), nil), nil
+}
+
+// Open decrypts a value produced by Seal.
+func (t *Tokenizer) Open(sealed []byte) (string, error) {
+	if t == nil {
+		return "", ErrDisabled
+	}
+	size := t.aead.NonceSize()
+	if len(sealed) < size {
+		return "", ErrCiphertext
+	}
+	plain, err := t.aead.Open(nil, sealed[:size], sealed[size:], nil)
+	if err != nil {
+		return "", ErrCiphertext
+	}
+	return string(plain), nil
+}
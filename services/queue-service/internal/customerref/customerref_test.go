@@ -0,0 +1,52 @@
+package customerref
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTokenizerHashAndSeal(t *testing.T) {
+	tok, err := New("hash-secret", "enc-secret")
+	if err != nil {
+		t.Fatalf("new tokenizer: %v", err)
+	}
+
+	first, _ := tok.Hash("cif 0012-345")
+	second, _ := tok.Hash("CIF0012345")
+	if first != second {
+		t.Fatalf("expected normalised references to hash equally")
+	}
+	other, _ := New("other-secret", "enc-secret")
+	if otherHash, _ := other.Hash("CIF0012345"); otherHash == first {
+		t.Fatalf("expected hash to depend on the key")
+	}
+
+	sealed, err := tok.Seal(" P-778 ")
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	opened, err := tok.Open(sealed)
+	if err != nil || opened != "P-778" {
+		t.Fatalf("unexpected open result %q %v", opened, err)
+	}
+	sealed[len(sealed)-1] ^= 0xff
+	if _, err := tok.Open(sealed); !errors.Is(err, ErrCiphertext) {
+		t.Fatalf("expected tampered ciphertext to fail, got %v", err)
+	}
+}
+
+func TestTokenizerDisabled(t *testing.T) {
+	tok, err := New("", "")
+	if err != nil || tok != nil {
+		t.Fatalf("expected nil tokenizer without keys, got %v %v", tok, err)
+	}
+	if _, err := tok.Hash("x"); !errors.Is(err, ErrDisabled) {
+		t.Fatalf("expected disabled error, got %v", err)
+	}
+	if _, err := New("only-hash", ""); err == nil {
+		t.Fatalf("expected error when one key is missing")
+	}
+	if _, err := NormalizeType("passport"); !errors.Is(err, ErrInvalidType) {
+		t.Fatalf("expected invalid type, got %v", err)
+	}
+}
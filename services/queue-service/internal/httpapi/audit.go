@@ -0,0 +1,162 @@
+package httpapi
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"qms/queue-service/internal/store"
+)
+
+type replayRequest struct {
+	TenantID  string `json:"tenant_id"`
+	TicketID  string `json:"ticket_id"`
+	ServiceID string `json:"service_id"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Limit     int    `json:"limit"`
+	Repair    bool   `json:"repair"`
+}
+
+// handleChainVerify serves GET /api/audit/ticket-chains. Pass ticket_id to
+// verify one ticket, or date (YYYY-MM-DD) to verify every chain with events
+// on that day and compare its Merkle root with the sealed digest.
+func (h *Handler) handleChainVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	input := store.ChainVerifyInput{
+		TenantID: strings.TrimSpace(query.Get("tenant_id")),
+		TicketID: strings.TrimSpace(query.Get("ticket_id")),
+	}
+	rawDate := strings.TrimSpace(query.Get("date"))
+	if !isValidUUID(input.TenantID) {
+		writeError(w, "", http.StatusBadRequest, "invalid_request", "tenant_id must be a UUID")
+		return
+	}
+	if (input.TicketID == "") == (rawDate == "") {
+		writeError(w, "", http.StatusBadRequest, "invalid_request", "exactly one of ticket_id or date is required")
+		return
+	}
+	if input.TicketID != "" && !isValidUUID(input.TicketID) {
+		writeError(w, "", http.StatusBadRequest, "invalid_request", "ticket_id must be a UUID")
+		return
+	}
+	if rawDate != "" {
+		day, err := time.Parse("2006-01-02", rawDate)
+		if err != nil {
+			writeError(w, "", http.StatusBadRequest, "invalid_request", "date must be YYYY-MM-DD")
+			return
+		}
+		input.Day = day
+	}
+	if !requireTenant(w, r, input.TenantID) {
+		return
+	}
+	if !requireRole(w, r, "supervisor", "admin") {
+		return
+	}
+
+	report, err := h.store.VerifyTicketChains(r.Context(), input)
+	if err != nil {
+		status, code, msg := mapError(err)
+		writeError(w, "", status, code, msg)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleEventDigests serves GET /api/audit/event-digests, the sealed daily
+// Merkle roots for a tenant between from and to (inclusive dates).
+func (h *Handler) handleEventDigests(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	tenantID := strings.TrimSpace(query.Get("tenant_id"))
+	if !isValidUUID(tenantID) {
+		writeError(w, "", http.StatusBadRequest, "invalid_request", "tenant_id must be a UUID")
+		return
+	}
+	from, err := time.Parse("2006-01-02", strings.TrimSpace(query.Get("from")))
+	if err != nil {
+		writeError(w, "", http.StatusBadRequest, "invalid_request", "from must be YYYY-MM-DD")
+		return
+	}
+	to, err := time.Parse("2006-01-02", strings.TrimSpace(query.Get("to")))
+	if err != nil {
+		writeError(w, "", http.StatusBadRequest, "invalid_request", "to must be YYYY-MM-DD")
+		return
+	}
+	if to.Before(from) {
+		writeError(w, "", http.StatusBadRequest, "invalid_request", "from must not be after to")
+		return
+	}
+	if !requireTenant(w, r, tenantID) {
+		return
+	}
+	if !requireRole(w, r, "supervisor", "admin") {
+		return
+	}
+
+	digests, err := h.store.ListEventDigests(r.Context(), tenantID, from, to)
+	if err != nil {
+		status, code, msg := mapError(err)
+		writeError(w, "", status, code, msg)
+		return
+	}
+	if digests == nil {
+		digests = []store.EventDigest{}
+	}
+	writeJSON(w, http.StatusOK, digests)
+}
+
+// handleReplay serves POST /api/admin/replay, which rebuilds tickets from
+// ticket_events, reports projection drift and, with repair, fixes it.
+func (h *Handler) handleReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req replayRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	input := store.ReplayInput{
+		TenantID:  req.TenantID,
+		TicketID:  req.TicketID,
+		ServiceID: req.ServiceID,
+		Limit:     req.Limit,
+		Repair:    req.Repair,
+	}
+	var ok bool
+	if input.From, ok = store.ParseSearchTime(req.From, false, time.UTC); !ok {
+		writeError(w, "", http.StatusBadRequest, "invalid_request", "from must be RFC3339 or YYYY-MM-DD")
+		return
+	}
+	if input.To, ok = store.ParseSearchTime(req.To, true, time.UTC); !ok {
+		writeError(w, "", http.StatusBadRequest, "invalid_request", "to must be RFC3339 or YYYY-MM-DD")
+		return
+	}
+	if input.TicketID == "" && input.ServiceID == "" && (input.From.IsZero() || input.To.IsZero()) {
+		writeError(w, "", http.StatusBadRequest, "invalid_request", "ticket_id, service_id, or a from/to range is required")
+		return
+	}
+	if !requireTenant(w, r, input.TenantID) {
+		return
+	}
+	if !requireRole(w, r, "admin") {
+		return
+	}
+
+	report, err := h.store.ReplayTickets(r.Context(), input)
+	if err != nil {
+		status, code, msg := mapError(err)
+		writeError(w, "", status, code, msg)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
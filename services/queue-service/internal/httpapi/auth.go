@@ -16,7 +16,7 @@ type authInfo struct {
 	Services []string
 }
 
-func AuthMiddleware(store store.TicketStore, next http.Handler) http.Handler {
+func AuthMiddleware(ticketStore store.TicketStore, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if isPublicEndpoint(r) {
 			next.ServeHTTP(w, r)
@@ -27,7 +27,7 @@ func AuthMiddleware(store store.TicketStore, next http.Handler) http.Handler {
 			writeError(w, requestIDFromRequest(r), http.StatusUnauthorized, "unauthorized", "missing session")
 			return
 		}
-		session, err := store.GetSession(r.Context(), sessionID)
+		session, err := ticketStore.GetSession(r.Context(), sessionID)
 		if err != nil {
 			if err == store.ErrSessionNotFound {
 				writeError(w, requestIDFromRequest(r), http.StatusUnauthorized, "unauthorized", "invalid session")
@@ -36,7 +36,7 @@ func AuthMiddleware(store store.TicketStore, next http.Handler) http.Handler {
 			writeError(w, requestIDFromRequest(r), http.StatusInternalServerError, "internal_error", "internal server error")
 			return
 		}
-		branches, services, err := store.GetAccess(r.Context(), session.UserID)
+		branches, services, err := ticketStore.GetAccess(r.Context(), session.UserID)
 		if err != nil {
 			writeError(w, requestIDFromRequest(r), http.StatusInternalServerError, "internal_error", "access lookup failed")
 			return
@@ -127,6 +127,19 @@ func requireServiceAccess(w http.ResponseWriter, r *http.Request, serviceID stri
 	return true
 }
 
+func requireRole(w http.ResponseWriter, r *http.Request, roles ...string) bool {
+	session, ok := sessionFromContext(r.Context())
+	if !ok {
+		writeError(w, requestIDFromRequest(r), http.StatusUnauthorized, "unauthorized", "missing session")
+		return false
+	}
+	if !contains(roles, strings.ToLower(session.Role)) {
+		writeError(w, requestIDFromRequest(r), http.StatusForbidden, "access_denied", "role not permitted")
+		return false
+	}
+	return true
+}
+
 func contains(values []string, value string) bool {
 	for _, item := range values {
 		if item == value {
@@ -170,6 +183,22 @@ func isPublicEndpoint(r *http.Request) bool {
 	case "/api/services":
 		return r.Method == http.MethodGet
 	default:
+		if r.Method == http.MethodPost && isTrackingPath(r.URL.Path) {
+			return true
+		}
 		return r.Method == http.MethodOptions
 	}
 }
+
+// isTrackingPath reports whether the path is a customer-facing ticket action
+// authorised by the tracking token in the body rather than a session.
+func isTrackingPath(path string) bool {
+	if !strings.HasPrefix(path, "/api/tickets/") {
+		return false
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, "/api/tickets/"), "/"), "/")
+	if len(parts) == 2 && parts[1] == "arrival" {
+		return true
+	}
+	return len(parts) == 3 && parts[1] == "self" && (parts[2] == "cancel" || parts[2] == "postpone")
+}
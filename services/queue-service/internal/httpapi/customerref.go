@@ -0,0 +1,107 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"qms/queue-service/internal/store"
+)
+
+type customerRefPurgeRequest struct {
+	RequestID   string `json:"request_id"`
+	TenantID    string `json:"tenant_id"`
+	CustomerRef string `json:"customer_ref"`
+}
+
+// handleCustomerRef serves GET /api/tickets/{id}/customer-ref. Only
+// supervisors and admins may reveal the decrypted reference, and every reveal
+// is audited; without the audit entry the reference is not returned.
+func (h *Handler) handleCustomerRef(w http.ResponseWriter, r *http.Request, ticketID string) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	tenantID := strings.TrimSpace(r.URL.Query().Get("tenant_id"))
+	branchID := strings.TrimSpace(r.URL.Query().Get("branch_id"))
+	if tenantID == "" || branchID == "" {
+		writeError(w, "", http.StatusBadRequest, "invalid_request", "tenant_id and branch_id are required")
+		return
+	}
+	if !isValidUUID(tenantID) || !isValidUUID(branchID) {
+		writeError(w, "", http.StatusBadRequest, "invalid_request", "tenant_id and branch_id must be UUIDs")
+		return
+	}
+	if !requireTenant(w, r, tenantID) {
+		return
+	}
+	if !requireBranchAccess(w, r, branchID) {
+		return
+	}
+	if !requireRole(w, r, "supervisor", "admin") {
+		return
+	}
+
+	ref, err := h.store.GetCustomerRef(r.Context(), tenantID, branchID, ticketID)
+	if err != nil {
+		status, code, msg := mapError(err)
+		writeError(w, "", status, code, msg)
+		return
+	}
+	if err := h.recordAudit(r, tenantID, "customer_ref.reveal", "ticket", ticketID, "branch="+branchID+" type="+ref.Type); err != nil {
+		status, code, msg := mapError(err)
+		writeError(w, "", status, code, msg)
+		return
+	}
+	writeJSON(w, http.StatusOK, ref)
+}
+
+// handleCustomerRefPurge serves POST /api/customer-refs/purge and erases
+// every stored copy of a customer reference within the tenant. The purge is
+// audited without the reference; a retry after a failed audit purges nothing
+// more but records the entry.
+func (h *Handler) handleCustomerRefPurge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req customerRefPurgeRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if !requireTenant(w, r, req.TenantID) {
+		return
+	}
+	if !requireRole(w, r, "supervisor", "admin") {
+		return
+	}
+
+	purged, err := h.store.PurgeCustomerRef(r.Context(), req.TenantID, req.CustomerRef)
+	if err != nil {
+		status, code, msg := mapError(err)
+		writeError(w, req.RequestID, status, code, msg)
+		return
+	}
+	if err := h.recordAudit(r, req.TenantID, "customer_ref.purge", "customer_ref", "", "purged="+strconv.Itoa(purged)); err != nil {
+		status, code, msg := mapError(err)
+		writeError(w, req.RequestID, status, code, msg)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"purged": purged})
+}
+
+// recordAudit writes an audit entry for a privileged action by the session
+// user.
+func (h *Handler) recordAudit(r *http.Request, tenantID, actionType, targetType, targetID, detail string) error {
+	session, _ := sessionFromContext(r.Context())
+	return h.store.RecordAudit(r.Context(), store.AuditEntry{
+		TenantID:    tenantID,
+		ActorUserID: session.UserID,
+		ActionType:  actionType,
+		TargetType:  targetType,
+		TargetID:    targetID,
+		Detail:      detail,
+		IP:          r.RemoteAddr,
+		UserAgent:   r.UserAgent(),
+	})
+}
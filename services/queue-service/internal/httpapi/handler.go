@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"qms/queue-service/internal/models"
 	"qms/queue-service/internal/store"
 
 	"github.com/google/uuid"
@@ -17,17 +18,24 @@ import (
 type Handler struct {
 	store               store.TicketStore
 	noShowReturnToQueue bool
+	trackingSecret      []byte
+	jobs                http.Handler
 }
 
 type createTicketRequest struct {
-	RequestID     string `json:"request_id"`
-	TenantID      string `json:"tenant_id"`
-	BranchID      string `json:"branch_id"`
-	ServiceID     string `json:"service_id"`
-	AreaID        string `json:"area_id"`
-	Channel       string `json:"channel"`
-	PriorityClass string `json:"priority_class"`
-	Phone         string `json:"phone"`
+	RequestID       string `json:"request_id"`
+	TenantID        string `json:"tenant_id"`
+	BranchID        string `json:"branch_id"`
+	ServiceID       string `json:"service_id"`
+	AreaID          string `json:"area_id"`
+	Channel         string `json:"channel"`
+	PriorityClass   string `json:"priority_class"`
+	Phone           string `json:"phone"`
+	CustomerRef     string `json:"customer_ref"`
+	CustomerRefType string `json:"customer_ref_type"`
+	PartySize       int    `json:"party_size"`
+	LinkedTicketID  string `json:"linked_ticket_id"`
+	Remote          bool   `json:"remote"`
 }
 
 type callNextRequest struct {
@@ -50,27 +58,51 @@ type responseError struct {
 
 type Options struct {
 	NoShowReturnToQueue bool
+	TrackingTokenSecret string
+	// Jobs, when set, serves background job status at /jobs.
+	Jobs http.Handler
 }
 
 func NewHandler(store store.TicketStore, options Options) *Handler {
 	return &Handler{
 		store:               store,
 		noShowReturnToQueue: options.NoShowReturnToQueue,
+		trackingSecret:      []byte(options.TrackingTokenSecret),
+		jobs:                options.Jobs,
 	}
 }
 
+// handleJobs exposes the job runner status, which names replicas and carries
+// raw job errors, to admins only.
+func (h *Handler) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, "admin") {
+		return
+	}
+	h.jobs.ServeHTTP(w, r)
+}
+
 func (h *Handler) Routes() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/healthz", h.handleHealth)
 	mux.Handle("/metrics", expvar.Handler())
+	if h.jobs != nil {
+		mux.HandleFunc("/jobs", h.handleJobs)
+	}
 	mux.HandleFunc("/api/tickets", h.handleTickets)
 	mux.HandleFunc("/api/tickets/actions/call-next", h.handleCallNext)
 	mux.HandleFunc("/api/tickets/active", h.handleActiveTicket)
 	mux.HandleFunc("/api/tickets/snapshot", h.handleTicketSnapshot)
+	mux.HandleFunc("/api/tickets/held", h.handleHeldTickets)
+	mux.HandleFunc("/api/tickets/search", h.handleTicketSearch)
 	mux.HandleFunc("/api/tickets/", h.handleTicketActions)
 	mux.HandleFunc("/api/queues", h.handleQueues)
 	mux.HandleFunc("/api/appointments/checkin", h.handleAppointmentCheckin)
+	mux.HandleFunc("/api/customer-refs/purge", h.handleCustomerRefPurge)
+	mux.HandleFunc("/api/audit/ticket-chains", h.handleChainVerify)
+	mux.HandleFunc("/api/audit/event-digests", h.handleEventDigests)
+	mux.HandleFunc("/api/admin/replay", h.handleReplay)
 	mux.HandleFunc("/api/events", h.handleEvents)
+	mux.HandleFunc("/api/admin/outbox-consumers", h.handleOutboxConsumers)
 	mux.HandleFunc("/api/counters", h.handleCounters)
 	mux.HandleFunc("/api/counters/", h.handleCounterStatus)
 	mux.HandleFunc("/api/services", h.handleServices)
@@ -106,6 +138,9 @@ func (h *Handler) handleTickets(w http.ResponseWriter, r *http.Request) {
 	req.Channel = strings.TrimSpace(req.Channel)
 	req.PriorityClass = strings.TrimSpace(req.PriorityClass)
 	req.Phone = strings.TrimSpace(req.Phone)
+	req.CustomerRef = strings.TrimSpace(req.CustomerRef)
+	req.CustomerRefType = strings.TrimSpace(req.CustomerRefType)
+	req.LinkedTicketID = strings.TrimSpace(req.LinkedTicketID)
 
 	if req.RequestID == "" || req.TenantID == "" || req.BranchID == "" || req.ServiceID == "" {
 		writeError(w, req.RequestID, http.StatusBadRequest, "invalid_request", "request_id, tenant_id, branch_id, and service_id are required")
@@ -132,17 +167,33 @@ func (h *Handler) handleTickets(w http.ResponseWriter, r *http.Request) {
 		writeError(w, req.RequestID, http.StatusBadRequest, "invalid_request", "phone must be 8-16 digits")
 		return
 	}
+	if req.PartySize < 0 {
+		writeError(w, req.RequestID, http.StatusBadRequest, "invalid_request", "party_size must be positive")
+		return
+	}
+	if req.PartySize == 0 {
+		req.PartySize = 1
+	}
+	if req.LinkedTicketID != "" && !isValidUUID(req.LinkedTicketID) {
+		writeError(w, req.RequestID, http.StatusBadRequest, "invalid_request", "linked_ticket_id must be a UUID when provided")
+		return
+	}
 
 	input := store.CreateTicketInput{
-		RequestID:     req.RequestID,
-		TenantID:      req.TenantID,
-		BranchID:      req.BranchID,
-		ServiceID:     req.ServiceID,
-		AreaID:        req.AreaID,
-		Channel:       req.Channel,
-		PriorityClass: req.PriorityClass,
-		Phone:         req.Phone,
-		CreatedAt:     time.Now().UTC(),
+		RequestID:       req.RequestID,
+		TenantID:        req.TenantID,
+		BranchID:        req.BranchID,
+		ServiceID:       req.ServiceID,
+		AreaID:          req.AreaID,
+		Channel:         req.Channel,
+		PriorityClass:   req.PriorityClass,
+		Phone:           req.Phone,
+		CustomerRef:     req.CustomerRef,
+		CustomerRefType: req.CustomerRefType,
+		PartySize:       req.PartySize,
+		LinkedTicketID:  req.LinkedTicketID,
+		Remote:          req.Remote,
+		CreatedAt:       time.Now().UTC(),
 	}
 
 	ticket, _, err := h.store.CreateTicket(r.Context(), input)
@@ -151,6 +202,7 @@ func (h *Handler) handleTickets(w http.ResponseWriter, r *http.Request) {
 		writeError(w, req.RequestID, status, code, msg)
 		return
 	}
+	ticket.TrackingToken = h.trackingToken(ticket.TicketID)
 
 	writeJSON(w, http.StatusOK, ticket)
 }
@@ -355,6 +407,19 @@ func (h *Handler) handleActiveTicket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// all=true lists every ticket held by the counter's resources; without it
+	// the most recent call is returned for single-desk clients.
+	if strings.EqualFold(strings.TrimSpace(r.URL.Query().Get("all")), "true") {
+		tickets, err := h.store.ListActiveTickets(r.Context(), tenantID, branchID, counterID)
+		if err != nil {
+			status, code, msg := mapError(err)
+			writeError(w, "", status, code, msg)
+			return
+		}
+		writeJSON(w, http.StatusOK, tickets)
+		return
+	}
+
 	ticket, found, err := h.store.GetActiveTicket(r.Context(), tenantID, branchID, counterID)
 	if err != nil {
 		status, code, msg := mapError(err)
@@ -369,6 +434,43 @@ func (h *Handler) handleActiveTicket(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, ticket)
 }
 
+func (h *Handler) handleHeldTickets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	tenantID := strings.TrimSpace(r.URL.Query().Get("tenant_id"))
+	branchID := strings.TrimSpace(r.URL.Query().Get("branch_id"))
+	counterID := strings.TrimSpace(r.URL.Query().Get("counter_id"))
+	if tenantID == "" || branchID == "" {
+		writeError(w, "", http.StatusBadRequest, "invalid_request", "tenant_id and branch_id are required")
+		return
+	}
+	if !isValidUUID(tenantID) || !isValidUUID(branchID) {
+		writeError(w, "", http.StatusBadRequest, "invalid_request", "tenant_id and branch_id must be UUIDs")
+		return
+	}
+	if counterID != "" && !isValidUUID(counterID) {
+		writeError(w, "", http.StatusBadRequest, "invalid_request", "counter_id must be a UUID")
+		return
+	}
+	if !requireTenant(w, r, tenantID) {
+		return
+	}
+	if !requireBranchAccess(w, r, branchID) {
+		return
+	}
+
+	tickets, err := h.store.ListHeldTickets(r.Context(), tenantID, branchID, counterID)
+	if err != nil {
+		status, code, msg := mapError(err)
+		writeError(w, "", status, code, msg)
+		return
+	}
+	writeJSON(w, http.StatusOK, tickets)
+}
+
 func (h *Handler) handleEvents(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -388,15 +490,18 @@ func (h *Handler) handleEvents(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	afterRaw := strings.TrimSpace(r.URL.Query().Get("after"))
-	var after time.Time
-	if afterRaw != "" {
-		parsed, err := time.Parse(time.RFC3339, afterRaw)
-		if err != nil {
-			writeError(w, "", http.StatusBadRequest, "invalid_request", "after must be RFC3339 timestamp")
+	if r.URL.Query().Get("after") != "" {
+		writeError(w, "", http.StatusBadRequest, "invalid_request", "after is no longer supported; page with after_seq")
+		return
+	}
+	var afterSeq int64
+	if afterRaw := strings.TrimSpace(r.URL.Query().Get("after_seq")); afterRaw != "" {
+		parsed, err := strconv.ParseInt(afterRaw, 10, 64)
+		if err != nil || parsed < 0 {
+			writeError(w, "", http.StatusBadRequest, "invalid_request", "after_seq must be a non-negative integer")
 			return
 		}
-		after = parsed
+		afterSeq = parsed
 	}
 
 	limit := 100
@@ -409,7 +514,7 @@ func (h *Handler) handleEvents(w http.ResponseWriter, r *http.Request) {
 		limit = parsed
 	}
 
-	events, err := h.store.ListOutboxEvents(r.Context(), tenantID, after, limit)
+	events, err := h.store.ListOutboxEvents(r.Context(), tenantID, afterSeq, limit)
 	if err != nil {
 		status, code, msg := mapError(err)
 		writeError(w, "", status, code, msg)
@@ -419,6 +524,29 @@ func (h *Handler) handleEvents(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, events)
 }
 
+// handleOutboxConsumers serves GET /api/admin/outbox-consumers. Consumers
+// read the outbox for every tenant, so the report is limited to admins.
+func (h *Handler) handleOutboxConsumers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireRole(w, r, "admin") {
+		return
+	}
+
+	consumers, err := h.store.ListOutboxConsumers(r.Context())
+	if err != nil {
+		status, code, msg := mapError(err)
+		writeError(w, "", status, code, msg)
+		return
+	}
+	if consumers == nil {
+		consumers = []store.OutboxConsumer{}
+	}
+	writeJSON(w, http.StatusOK, consumers)
+}
+
 func (h *Handler) handleCounters(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -546,6 +674,21 @@ func (h *Handler) handleTicketActions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if len(parts) == 2 && parts[1] == "arrival" {
+		h.handleArrival(w, r, ticketID)
+		return
+	}
+
+	if len(parts) == 3 && parts[1] == "self" {
+		h.handleSelfService(w, r, ticketID, parts[2])
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "customer-ref" {
+		h.handleCustomerRef(w, r, ticketID)
+		return
+	}
+
 	if len(parts) == 2 && parts[1] == "events" {
 		if r.Method != http.MethodGet {
 			w.WriteHeader(http.StatusMethodNotAllowed)
@@ -582,11 +725,46 @@ func (h *Handler) handleTicketActions(w http.ResponseWriter, r *http.Request) {
 		h.handleTransferTicket(w, r, ticketID)
 	case "no-show":
 		h.handleNoShowTicket(w, r, ticketID)
+	case "reopen":
+		h.handleReopenTicket(w, r, ticketID)
+	case "confirm-arrival":
+		h.handleConfirmArrival(w, r, ticketID)
 	default:
 		w.WriteHeader(http.StatusNotFound)
 	}
 }
 
+func (h *Handler) handleConfirmArrival(w http.ResponseWriter, r *http.Request, ticketID string) {
+	var req ticketActionRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if !requireTenant(w, r, req.TenantID) {
+		return
+	}
+	if !requireBranchAccess(w, r, req.BranchID) {
+		return
+	}
+	session, _ := sessionFromContext(r.Context())
+
+	ticket, _, err := h.store.ConfirmArrival(r.Context(), store.TicketActionInput{
+		RequestID:  req.RequestID,
+		TenantID:   req.TenantID,
+		BranchID:   req.BranchID,
+		TicketID:   ticketID,
+		CounterID:  req.CounterID,
+		Method:     models.ArrivalStaff,
+		ActorID:    session.UserID,
+		OccurredAt: time.Now().UTC(),
+	})
+	if err != nil {
+		status, code, msg := mapError(err)
+		writeError(w, req.RequestID, status, code, msg)
+		return
+	}
+	writeJSON(w, http.StatusOK, ticket)
+}
+
 func (h *Handler) handleGetTicket(w http.ResponseWriter, r *http.Request, ticketID string) {
 	if !isValidUUID(ticketID) {
 		writeError(w, "", http.StatusBadRequest, "invalid_request", "ticket_id must be a UUID")
@@ -689,6 +867,23 @@ type ticketActionRequest struct {
 	CounterID string `json:"counter_id"`
 }
 
+type holdRequest struct {
+	RequestID   string `json:"request_id"`
+	TenantID    string `json:"tenant_id"`
+	BranchID    string `json:"branch_id"`
+	CounterID   string `json:"counter_id"`
+	Reason      string `json:"reason"`
+	HoldSeconds int    `json:"hold_seconds"`
+}
+
+type reopenRequest struct {
+	RequestID string `json:"request_id"`
+	TenantID  string `json:"tenant_id"`
+	BranchID  string `json:"branch_id"`
+	CounterID string `json:"counter_id"`
+	Reason    string `json:"reason"`
+}
+
 type transferRequest struct {
 	RequestID   string `json:"request_id"`
 	TenantID    string `json:"tenant_id"`
@@ -818,6 +1013,7 @@ func (h *Handler) handleRecallTicket(w http.ResponseWriter, r *http.Request, tic
 		TenantID:   req.TenantID,
 		BranchID:   req.BranchID,
 		TicketID:   ticketID,
+		CounterID:  req.CounterID,
 		OccurredAt: time.Now().UTC(),
 	})
 	if err != nil {
@@ -829,20 +1025,31 @@ func (h *Handler) handleRecallTicket(w http.ResponseWriter, r *http.Request, tic
 }
 
 func (h *Handler) handleHoldTicket(w http.ResponseWriter, r *http.Request, ticketID string) {
-	var req ticketActionRequest
+	var req holdRequest
 	if !decodeRequest(w, r, &req) {
 		return
 	}
 	if !requireTenant(w, r, req.TenantID) {
 		return
 	}
+	if req.CounterID != "" && !isValidUUID(req.CounterID) {
+		writeError(w, req.RequestID, http.StatusBadRequest, "invalid_request", "counter_id must be a UUID")
+		return
+	}
+	if req.HoldSeconds < 0 {
+		writeError(w, req.RequestID, http.StatusBadRequest, "invalid_request", "hold_seconds must be positive")
+		return
+	}
 
 	ticket, _, err := h.store.HoldTicket(r.Context(), store.TicketActionInput{
-		RequestID:  req.RequestID,
-		TenantID:   req.TenantID,
-		BranchID:   req.BranchID,
-		TicketID:   ticketID,
-		OccurredAt: time.Now().UTC(),
+		RequestID:    req.RequestID,
+		TenantID:     req.TenantID,
+		BranchID:     req.BranchID,
+		TicketID:     ticketID,
+		CounterID:    req.CounterID,
+		Reason:       req.Reason,
+		HoldDuration: time.Duration(req.HoldSeconds) * time.Second,
+		OccurredAt:   time.Now().UTC(),
 	})
 	if err != nil {
 		status, code, msg := mapError(err)
@@ -940,6 +1147,44 @@ func (h *Handler) handleNoShowTicket(w http.ResponseWriter, r *http.Request, tic
 	writeJSON(w, http.StatusOK, ticket)
 }
 
+func (h *Handler) handleReopenTicket(w http.ResponseWriter, r *http.Request, ticketID string) {
+	var req reopenRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if !requireTenant(w, r, req.TenantID) {
+		return
+	}
+	if !requireBranchAccess(w, r, req.BranchID) {
+		return
+	}
+	if !requireRole(w, r, "supervisor", "admin") {
+		return
+	}
+	if req.Reason == "" {
+		writeError(w, req.RequestID, http.StatusBadRequest, "invalid_request", "reason is required")
+		return
+	}
+
+	session, _ := sessionFromContext(r.Context())
+	ticket, _, err := h.store.ReopenTicket(r.Context(), store.TicketActionInput{
+		RequestID:  req.RequestID,
+		TenantID:   req.TenantID,
+		BranchID:   req.BranchID,
+		TicketID:   ticketID,
+		CounterID:  req.CounterID,
+		Reason:     req.Reason,
+		ActorID:    session.UserID,
+		OccurredAt: time.Now().UTC(),
+	})
+	if err != nil {
+		status, code, msg := mapError(err)
+		writeError(w, req.RequestID, status, code, msg)
+		return
+	}
+	writeJSON(w, http.StatusOK, ticket)
+}
+
 func decodeRequest(w http.ResponseWriter, r *http.Request, target interface{}) bool {
 	decoder := json.NewDecoder(r.Body)
 	decoder.DisallowUnknownFields()
@@ -954,6 +1199,49 @@ func decodeRequest(w http.ResponseWriter, r *http.Request, target interface{}) b
 		req.BranchID = strings.TrimSpace(req.BranchID)
 		req.CounterID = strings.TrimSpace(req.CounterID)
 	}
+	hr, ok := target.(*holdRequest)
+	if ok {
+		hr.RequestID = strings.TrimSpace(hr.RequestID)
+		hr.TenantID = strings.TrimSpace(hr.TenantID)
+		hr.BranchID = strings.TrimSpace(hr.BranchID)
+		hr.CounterID = strings.TrimSpace(hr.CounterID)
+		hr.Reason = strings.TrimSpace(hr.Reason)
+	}
+	rr, ok := target.(*reopenRequest)
+	if ok {
+		rr.RequestID = strings.TrimSpace(rr.RequestID)
+		rr.TenantID = strings.TrimSpace(rr.TenantID)
+		rr.BranchID = strings.TrimSpace(rr.BranchID)
+		rr.CounterID = strings.TrimSpace(rr.CounterID)
+		rr.Reason = strings.TrimSpace(rr.Reason)
+	}
+	ar, ok := target.(*arrivalRequest)
+	if ok {
+		ar.RequestID = strings.TrimSpace(ar.RequestID)
+		ar.TenantID = strings.TrimSpace(ar.TenantID)
+		ar.BranchID = strings.TrimSpace(ar.BranchID)
+		ar.Token = strings.TrimSpace(ar.Token)
+		ar.Method = normalizeArrivalMethod(ar.Method)
+	}
+	sr, ok := target.(*selfServiceRequest)
+	if ok {
+		sr.RequestID = strings.TrimSpace(sr.RequestID)
+		sr.TenantID = strings.TrimSpace(sr.TenantID)
+		sr.BranchID = strings.TrimSpace(sr.BranchID)
+		sr.Token = strings.TrimSpace(sr.Token)
+	}
+	cr, ok := target.(*customerRefPurgeRequest)
+	if ok {
+		cr.RequestID = strings.TrimSpace(cr.RequestID)
+		cr.TenantID = strings.TrimSpace(cr.TenantID)
+		cr.CustomerRef = strings.TrimSpace(cr.CustomerRef)
+	}
+	rp, ok := target.(*replayRequest)
+	if ok {
+		rp.TenantID = strings.TrimSpace(rp.TenantID)
+		rp.TicketID = strings.TrimSpace(rp.TicketID)
+		rp.ServiceID = strings.TrimSpace(rp.ServiceID)
+	}
 	tr, ok := target.(*transferRequest)
 	if ok {
 		tr.RequestID = strings.TrimSpace(tr.RequestID)
@@ -973,6 +1261,24 @@ func decodeRequest(w http.ResponseWriter, r *http.Request, target interface{}) b
 			writeError(w, t.RequestID, http.StatusBadRequest, "invalid_request", "request_id, tenant_id, and branch_id must be UUIDs")
 			return false
 		}
+	case *holdRequest:
+		if t.RequestID == "" || t.TenantID == "" || t.BranchID == "" {
+			writeError(w, t.RequestID, http.StatusBadRequest, "invalid_request", "request_id, tenant_id, and branch_id are required")
+			return false
+		}
+		if !isValidUUID(t.RequestID) || !isValidUUID(t.TenantID) || !isValidUUID(t.BranchID) {
+			writeError(w, t.RequestID, http.StatusBadRequest, "invalid_request", "request_id, tenant_id, and branch_id must be UUIDs")
+			return false
+		}
+	case *reopenRequest:
+		if t.RequestID == "" || t.TenantID == "" || t.BranchID == "" {
+			writeError(w, t.RequestID, http.StatusBadRequest, "invalid_request", "request_id, tenant_id, and branch_id are required")
+			return false
+		}
+		if !isValidUUID(t.RequestID) || !isValidUUID(t.TenantID) || !isValidUUID(t.BranchID) {
+			writeError(w, t.RequestID, http.StatusBadRequest, "invalid_request", "request_id, tenant_id, and branch_id must be UUIDs")
+			return false
+		}
 	case *transferRequest:
 		if t.RequestID == "" || t.TenantID == "" || t.BranchID == "" {
 			writeError(w, t.RequestID, http.StatusBadRequest, "invalid_request", "request_id, tenant_id, and branch_id are required")
@@ -982,6 +1288,59 @@ func decodeRequest(w http.ResponseWriter, r *http.Request, target interface{}) b
 			writeError(w, t.RequestID, http.StatusBadRequest, "invalid_request", "request_id, tenant_id, and branch_id must be UUIDs")
 			return false
 		}
+	case *arrivalRequest:
+		if t.RequestID == "" || t.TenantID == "" || t.BranchID == "" || t.Token == "" {
+			writeError(w, t.RequestID, http.StatusBadRequest, "invalid_request", "request_id, tenant_id, branch_id, and token are required")
+			return false
+		}
+		if !isValidUUID(t.RequestID) || !isValidUUID(t.TenantID) || !isValidUUID(t.BranchID) {
+			writeError(w, t.RequestID, http.StatusBadRequest, "invalid_request", "request_id, tenant_id, and branch_id must be UUIDs")
+			return false
+		}
+		if t.Method == "" {
+			writeError(w, t.RequestID, http.StatusBadRequest, "invalid_request", "method must be qr or link")
+			return false
+		}
+	case *selfServiceRequest:
+		if t.RequestID == "" || t.TenantID == "" || t.BranchID == "" || t.Token == "" {
+			writeError(w, t.RequestID, http.StatusBadRequest, "invalid_request", "request_id, tenant_id, branch_id, and token are required")
+			return false
+		}
+		if !isValidUUID(t.RequestID) || !isValidUUID(t.TenantID) || !isValidUUID(t.BranchID) {
+			writeError(w, t.RequestID, http.StatusBadRequest, "invalid_request", "request_id, tenant_id, and branch_id must be UUIDs")
+			return false
+		}
+		if t.Places < 0 || t.Minutes < 0 {
+			writeError(w, t.RequestID, http.StatusBadRequest, "invalid_request", "places and minutes must be >= 0")
+			return false
+		}
+	case *replayRequest:
+		if !isValidUUID(t.TenantID) {
+			writeError(w, "", http.StatusBadRequest, "invalid_request", "tenant_id must be a UUID")
+			return false
+		}
+		if (t.TicketID != "" && !isValidUUID(t.TicketID)) || (t.ServiceID != "" && !isValidUUID(t.ServiceID)) {
+			writeError(w, "", http.StatusBadRequest, "invalid_request", "ticket_id and service_id must be UUIDs when provided")
+			return false
+		}
+		if t.Limit < 0 {
+			writeError(w, "", http.StatusBadRequest, "invalid_request", "limit must be >= 0")
+			return false
+		}
+	case *ticketSearchRequest:
+		if t.Limit < 0 {
+			writeError(w, "", http.StatusBadRequest, "invalid_request", "limit must be a positive integer")
+			return false
+		}
+	case *customerRefPurgeRequest:
+		if t.RequestID == "" || t.TenantID == "" || t.CustomerRef == "" {
+			writeError(w, t.RequestID, http.StatusBadRequest, "invalid_request", "request_id, tenant_id, and customer_ref are required")
+			return false
+		}
+		if !isValidUUID(t.RequestID) || !isValidUUID(t.TenantID) {
+			writeError(w, t.RequestID, http.StatusBadRequest, "invalid_request", "request_id and tenant_id must be UUIDs")
+			return false
+		}
 	default:
 		writeError(w, "", http.StatusBadRequest, "invalid_request", "invalid request payload")
 		return false
@@ -1004,10 +1363,36 @@ func mapError(err error) (int, string, string) {
 		return http.StatusNotFound, "counter_not_found", "counter not found"
 	case errors.Is(err, store.ErrCounterUnavailable):
 		return http.StatusConflict, "counter_unavailable", "counter unavailable"
+	case errors.Is(err, store.ErrCounterAtCapacity):
+		return http.StatusConflict, "counter_at_capacity", "all resources at this counter are occupied"
 	case errors.Is(err, store.ErrAccessDenied):
 		return http.StatusForbidden, "access_denied", "access denied"
 	case errors.Is(err, store.ErrBranchNotFound):
 		return http.StatusNotFound, "branch_not_found", "branch not found"
+	case errors.Is(err, store.ErrRecallTooSoon):
+		return http.StatusConflict, "recall_too_soon", "recall interval has not elapsed"
+	case errors.Is(err, store.ErrReopenExpired):
+		return http.StatusConflict, "reopen_window_expired", "reopen window has expired"
+	case errors.Is(err, store.ErrPartyTooLarge):
+		return http.StatusBadRequest, "party_size_exceeded", "party size exceeds service limit"
+	case errors.Is(err, store.ErrCapacityExceeded):
+		return http.StatusConflict, "capacity_exceeded", "service waiting capacity reached"
+	case errors.Is(err, store.ErrArrivalExpired):
+		return http.StatusConflict, "arrival_window_expired", "arrival confirmation window has expired"
+	case errors.Is(err, store.ErrInvalidCursor):
+		return http.StatusBadRequest, "invalid_cursor", "cursor is invalid"
+	case errors.Is(err, store.ErrPostponeLimit):
+		return http.StatusConflict, "postpone_limit_reached", "ticket cannot be postponed further"
+	case errors.Is(err, store.ErrNothingToPostpone):
+		return http.StatusConflict, "nothing_to_postpone", "no waiting ticket is behind this one"
+	case errors.Is(err, store.ErrCustomerRefOff):
+		return http.StatusBadRequest, "customer_ref_not_collected", "customer references are not collected for this tenant"
+	case errors.Is(err, store.ErrCustomerRefMissing):
+		return http.StatusBadRequest, "customer_ref_required", "customer_ref is required"
+	case errors.Is(err, store.ErrCustomerRefInvalid):
+		return http.StatusBadRequest, "invalid_customer_ref", "customer reference or type is invalid"
+	case errors.Is(err, store.ErrCustomerRefNoKeys):
+		return http.StatusServiceUnavailable, "customer_ref_unavailable", "customer reference tokenisation is not configured"
 	case errors.Is(err, store.ErrHolidayClosed):
 		return http.StatusConflict, "holiday_closed", "appointments are closed for this holiday"
 	default:
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -21,13 +23,18 @@ type fakeStore struct {
 	startFn         func(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error)
 	completeFn      func(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error)
 	cancelFn        func(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error)
+	postponeFn      func(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error)
 	recallFn        func(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error)
 	holdFn          func(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error)
 	unholdFn        func(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error)
 	transferFn      func(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error)
 	noShowFn        func(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error)
+	heldFn          func(ctx context.Context, tenantID, branchID, counterID string) ([]models.Ticket, error)
+	activeListFn    func(ctx context.Context, tenantID, branchID, counterID string) ([]models.Ticket, error)
+	arrivalFn       func(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error)
+	reopenFn        func(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error)
 	snapshotFn      func(ctx context.Context, tenantID, branchID, serviceID string) ([]models.Ticket, error)
-	outboxFn        func(ctx context.Context, tenantID string, after time.Time, limit int) ([]store.OutboxEvent, error)
+	outboxFn        func(ctx context.Context, tenantID string, afterSeq int64, limit int) ([]store.OutboxEvent, error)
 	eventsFn        func(ctx context.Context, tenantID, ticketID string) ([]store.TicketEvent, error)
 	countersFn      func(ctx context.Context, tenantID, branchID string) ([]models.Counter, error)
 	updateCounterFn func(ctx context.Context, tenantID, branchID, counterID, status string) error
@@ -36,6 +43,15 @@ type fakeStore struct {
 	apptFn          func(ctx context.Context, requestID, tenantID, branchID, appointmentID string) (models.Ticket, error)
 	sessionFn       func(ctx context.Context, sessionID string) (store.Session, error)
 	accessFn        func(ctx context.Context, userID string) ([]string, []string, error)
+	searchFn        func(ctx context.Context, input store.TicketSearchInput) (store.TicketSearchPage, error)
+	customerRefFn   func(ctx context.Context, tenantID, branchID, ticketID string) (store.CustomerRef, error)
+	purgeRefFn      func(ctx context.Context, tenantID, value string) (int, error)
+	auditFn         func(ctx context.Context, entry store.AuditEntry) error
+	locationFn      func(ctx context.Context, tenantID, branchID string) (*time.Location, error)
+	chainFn         func(ctx context.Context, input store.ChainVerifyInput) (store.ChainReport, error)
+	digestsFn       func(ctx context.Context, tenantID string, from, to time.Time) ([]store.EventDigest, error)
+	replayFn        func(ctx context.Context, input store.ReplayInput) (store.ReplayReport, error)
+	consumersFn     func(ctx context.Context) ([]store.OutboxConsumer, error)
 }
 
 func (f fakeStore) CreateTicket(ctx context.Context, input store.CreateTicketInput) (models.Ticket, bool, error) {
@@ -122,6 +138,41 @@ func (f fakeStore) NoShowTicket(ctx context.Context, input store.TicketActionInp
 	return f.noShowFn(ctx, input)
 }
 
+func (f fakeStore) ListHeldTickets(ctx context.Context, tenantID, branchID, counterID string) ([]models.Ticket, error) {
+	if f.heldFn == nil {
+		return nil, nil
+	}
+	return f.heldFn(ctx, tenantID, branchID, counterID)
+}
+
+func (f fakeStore) ListActiveTickets(ctx context.Context, tenantID, branchID, counterID string) ([]models.Ticket, error) {
+	if f.activeListFn == nil {
+		return nil, nil
+	}
+	return f.activeListFn(ctx, tenantID, branchID, counterID)
+}
+
+func (f fakeStore) ConfirmArrival(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
+	if f.arrivalFn == nil {
+		return models.Ticket{}, false, nil
+	}
+	return f.arrivalFn(ctx, input)
+}
+
+func (f fakeStore) PostponeTicket(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
+	if f.postponeFn == nil {
+		return models.Ticket{}, false, nil
+	}
+	return f.postponeFn(ctx, input)
+}
+
+func (f fakeStore) ReopenTicket(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
+	if f.reopenFn == nil {
+		return models.Ticket{}, false, nil
+	}
+	return f.reopenFn(ctx, input)
+}
+
 func (f fakeStore) SnapshotTickets(ctx context.Context, tenantID, branchID, serviceID string) ([]models.Ticket, error) {
 	if f.snapshotFn == nil {
 		return nil, nil
@@ -129,11 +180,18 @@ func (f fakeStore) SnapshotTickets(ctx context.Context, tenantID, branchID, serv
 	return f.snapshotFn(ctx, tenantID, branchID, serviceID)
 }
 
-func (f fakeStore) ListOutboxEvents(ctx context.Context, tenantID string, after time.Time, limit int) ([]store.OutboxEvent, error) {
+func (f fakeStore) ListOutboxEvents(ctx context.Context, tenantID string, afterSeq int64, limit int) ([]store.OutboxEvent, error) {
 	if f.outboxFn == nil {
 		return nil, nil
 	}
-	return f.outboxFn(ctx, tenantID, after, limit)
+	return f.outboxFn(ctx, tenantID, afterSeq, limit)
+}
+
+func (f fakeStore) ListOutboxConsumers(ctx context.Context) ([]store.OutboxConsumer, error) {
+	if f.consumersFn == nil {
+		return nil, nil
+	}
+	return f.consumersFn(ctx)
 }
 
 func (f fakeStore) ListTicketEvents(ctx context.Context, tenantID, ticketID string) ([]store.TicketEvent, error) {
@@ -185,6 +243,62 @@ func (f fakeStore) GetSession(ctx context.Context, sessionID string) (store.Sess
 	return f.sessionFn(ctx, sessionID)
 }
 
+func (f fakeStore) SearchTickets(ctx context.Context, input store.TicketSearchInput) (store.TicketSearchPage, error) {
+	if f.searchFn == nil {
+		return store.TicketSearchPage{}, nil
+	}
+	return f.searchFn(ctx, input)
+}
+
+func (f fakeStore) GetCustomerRef(ctx context.Context, tenantID, branchID, ticketID string) (store.CustomerRef, error) {
+	if f.customerRefFn == nil {
+		return store.CustomerRef{}, nil
+	}
+	return f.customerRefFn(ctx, tenantID, branchID, ticketID)
+}
+
+func (f fakeStore) PurgeCustomerRef(ctx context.Context, tenantID, value string) (int, error) {
+	if f.purgeRefFn == nil {
+		return 0, nil
+	}
+	return f.purgeRefFn(ctx, tenantID, value)
+}
+
+func (f fakeStore) RecordAudit(ctx context.Context, entry store.AuditEntry) error {
+	if f.auditFn == nil {
+		return nil
+	}
+	return f.auditFn(ctx, entry)
+}
+
+func (f fakeStore) BranchLocation(ctx context.Context, tenantID, branchID string) (*time.Location, error) {
+	if f.locationFn == nil {
+		return time.UTC, nil
+	}
+	return f.locationFn(ctx, tenantID, branchID)
+}
+
+func (f fakeStore) VerifyTicketChains(ctx context.Context, input store.ChainVerifyInput) (store.ChainReport, error) {
+	if f.chainFn == nil {
+		return store.ChainReport{}, nil
+	}
+	return f.chainFn(ctx, input)
+}
+
+func (f fakeStore) ListEventDigests(ctx context.Context, tenantID string, from, to time.Time) ([]store.EventDigest, error) {
+	if f.digestsFn == nil {
+		return nil, nil
+	}
+	return f.digestsFn(ctx, tenantID, from, to)
+}
+
+func (f fakeStore) ReplayTickets(ctx context.Context, input store.ReplayInput) (store.ReplayReport, error) {
+	if f.replayFn == nil {
+		return store.ReplayReport{}, nil
+	}
+	return f.replayFn(ctx, input)
+}
+
 func (f fakeStore) GetAccess(ctx context.Context, userID string) ([]string, []string, error) {
 	if f.accessFn == nil {
 		return nil, nil, nil
@@ -629,3 +743,674 @@ func TestActiveTicketMissingParams(t *testing.T) {
 		t.Fatalf("expected status 400, got %d", resp.Code)
 	}
 }
+
+func TestHeldTicketsFiltersByCounter(t *testing.T) {
+	var gotCounter string
+	st := fakeStore{
+		sessionFn: func(ctx context.Context, sessionID string) (store.Session, error) {
+			return store.Session{SessionID: sessionID, UserID: "user-1", TenantID: "11111111-1111-1111-1111-111111111111"}, nil
+		},
+		accessFn: func(ctx context.Context, userID string) ([]string, []string, error) {
+			return []string{"22222222-2222-2222-2222-222222222222"}, nil, nil
+		},
+		heldFn: func(ctx context.Context, tenantID, branchID, counterID string) ([]models.Ticket, error) {
+			gotCounter = counterID
+			return []models.Ticket{{TicketID: "ticket-1", Status: models.StatusHeld, HoldReason: "missing documents"}}, nil
+		},
+	}
+	h := NewHandler(st, Options{})
+	req := httptest.NewRequest(http.MethodGet, "/api/tickets/held?tenant_id=11111111-1111-1111-1111-111111111111&branch_id=22222222-2222-2222-2222-222222222222&counter_id=33333333-3333-3333-3333-333333333333", nil)
+	req.Header.Set("Authorization", "Bearer session-1")
+	resp := httptest.NewRecorder()
+
+	h.Routes().ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	if gotCounter != "33333333-3333-3333-3333-333333333333" {
+		t.Fatalf("expected counter filter to be passed, got %q", gotCounter)
+	}
+	var tickets []models.Ticket
+	if err := json.NewDecoder(resp.Body).Decode(&tickets); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(tickets) != 1 || tickets[0].HoldReason != "missing documents" {
+		t.Fatalf("unexpected held tickets: %+v", tickets)
+	}
+}
+
+func TestActiveTicketsListsAllResources(t *testing.T) {
+	st := fakeStore{
+		sessionFn: func(ctx context.Context, sessionID string) (store.Session, error) {
+			return store.Session{SessionID: sessionID, UserID: "user-1", TenantID: "11111111-1111-1111-1111-111111111111"}, nil
+		},
+		accessFn: func(ctx context.Context, userID string) ([]string, []string, error) {
+			return []string{"22222222-2222-2222-2222-222222222222"}, nil, nil
+		},
+		activeListFn: func(ctx context.Context, tenantID, branchID, counterID string) ([]models.Ticket, error) {
+			chairA := "chair-a"
+			chairB := "chair-b"
+			return []models.Ticket{
+				{TicketID: "ticket-1", Status: models.StatusServing, ResourceID: &chairA},
+				{TicketID: "ticket-2", Status: models.StatusCalled, ResourceID: &chairB},
+			}, nil
+		},
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/tickets/active?tenant_id=11111111-1111-1111-1111-111111111111&branch_id=22222222-2222-2222-2222-222222222222&counter_id=33333333-3333-3333-3333-333333333333&all=true", nil)
+	req.Header.Set("Authorization", "Bearer session-1")
+	resp := httptest.NewRecorder()
+
+	NewHandler(st, Options{}).Routes().ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	var tickets []models.Ticket
+	if err := json.NewDecoder(resp.Body).Decode(&tickets); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(tickets) != 2 || tickets[1].ResourceID == nil || *tickets[1].ResourceID != "chair-b" {
+		t.Fatalf("unexpected active tickets: %+v", tickets)
+	}
+}
+
+func TestReopenTicketRequiresSupervisor(t *testing.T) {
+	called := false
+	st := fakeStore{
+		sessionFn: func(ctx context.Context, sessionID string) (store.Session, error) {
+			return store.Session{SessionID: sessionID, UserID: "user-1", TenantID: "11111111-1111-1111-1111-111111111111", Role: "agent"}, nil
+		},
+		reopenFn: func(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
+			called = true
+			return models.Ticket{}, true, nil
+		},
+	}
+	h := NewHandler(st, Options{})
+	payload := map[string]string{
+		"request_id": "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa",
+		"tenant_id":  "11111111-1111-1111-1111-111111111111",
+		"branch_id":  "22222222-2222-2222-2222-222222222222",
+		"reason":     "completed by mistake",
+	}
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, "/api/tickets/33333333-3333-3333-3333-333333333333/actions/reopen", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer session-1")
+	resp := httptest.NewRecorder()
+
+	h.Routes().ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403, got %d", resp.Code)
+	}
+	if called {
+		t.Fatalf("store should not be called for agent role")
+	}
+}
+
+func TestReopenTicketPassesReasonAndActor(t *testing.T) {
+	var got store.TicketActionInput
+	st := fakeStore{
+		sessionFn: func(ctx context.Context, sessionID string) (store.Session, error) {
+			return store.Session{SessionID: sessionID, UserID: "user-9", TenantID: "11111111-1111-1111-1111-111111111111", Role: "supervisor"}, nil
+		},
+		reopenFn: func(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
+			got = input
+			return models.Ticket{TicketID: input.TicketID, Status: models.StatusServing}, true, nil
+		},
+	}
+	h := NewHandler(st, Options{})
+	payload := map[string]string{
+		"request_id": "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa",
+		"tenant_id":  "11111111-1111-1111-1111-111111111111",
+		"branch_id":  "22222222-2222-2222-2222-222222222222",
+		"reason":     "completed by mistake",
+	}
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, "/api/tickets/33333333-3333-3333-3333-333333333333/actions/reopen", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer session-1")
+	resp := httptest.NewRecorder()
+
+	h.Routes().ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	if got.Reason != "completed by mistake" || got.ActorID != "user-9" {
+		t.Fatalf("unexpected reopen input: %+v", got)
+	}
+}
+
+func TestCreateTicketPartySize(t *testing.T) {
+	var got store.CreateTicketInput
+	st := fakeStore{
+		createFn: func(ctx context.Context, input store.CreateTicketInput) (models.Ticket, bool, error) {
+			got = input
+			return models.Ticket{TicketID: "ticket-1", TicketNumber: "CS-001", Status: models.StatusWaiting, PartySize: input.PartySize}, true, nil
+		},
+	}
+	h := NewHandler(st, Options{})
+
+	payload := map[string]interface{}{
+		"request_id": "11111111-1111-1111-1111-111111111111",
+		"tenant_id":  "22222222-2222-2222-2222-222222222222",
+		"branch_id":  "33333333-3333-3333-3333-333333333333",
+		"service_id": "44444444-4444-4444-4444-444444444444",
+		"party_size": 4,
+	}
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, "/api/tickets", bytes.NewReader(body))
+	resp := httptest.NewRecorder()
+
+	h.Routes().ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	if got.PartySize != 4 {
+		t.Fatalf("expected party size 4, got %d", got.PartySize)
+	}
+
+	payload["party_size"] = -1
+	body, _ = json.Marshal(payload)
+	req = httptest.NewRequest(http.MethodPost, "/api/tickets", bytes.NewReader(body))
+	resp = httptest.NewRecorder()
+
+	h.Routes().ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", resp.Code)
+	}
+}
+
+func TestRemoteArrivalUsesTrackingToken(t *testing.T) {
+	var created store.CreateTicketInput
+	var arrival store.TicketActionInput
+	st := fakeStore{
+		createFn: func(ctx context.Context, input store.CreateTicketInput) (models.Ticket, bool, error) {
+			created = input
+			return models.Ticket{TicketID: "55555555-5555-5555-5555-555555555555", TicketNumber: "CS-002", Status: models.StatusRemote}, true, nil
+		},
+		arrivalFn: func(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
+			arrival = input
+			return models.Ticket{TicketID: input.TicketID, Status: models.StatusWaiting}, true, nil
+		},
+	}
+	h := NewHandler(st, Options{TrackingTokenSecret: "test-secret"})
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"request_id": "11111111-1111-1111-1111-111111111111",
+		"tenant_id":  "22222222-2222-2222-2222-222222222222",
+		"branch_id":  "33333333-3333-3333-3333-333333333333",
+		"service_id": "44444444-4444-4444-4444-444444444444",
+		"channel":    "web",
+		"remote":     true,
+	})
+	resp := httptest.NewRecorder()
+	h.Routes().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/api/tickets", bytes.NewReader(body)))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	if !created.Remote {
+		t.Fatalf("expected remote flag to reach the store")
+	}
+	var ticket models.Ticket
+	if err := json.NewDecoder(resp.Body).Decode(&ticket); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if ticket.TrackingToken == "" {
+		t.Fatalf("expected tracking token in create response")
+	}
+
+	arrivalBody := func(token string) *bytes.Reader {
+		body, _ := json.Marshal(map[string]string{
+			"request_id": "66666666-6666-6666-6666-666666666666",
+			"tenant_id":  "22222222-2222-2222-2222-222222222222",
+			"branch_id":  "33333333-3333-3333-3333-333333333333",
+			"token":      token,
+			"method":     "qr",
+		})
+		return bytes.NewReader(body)
+	}
+
+	resp = httptest.NewRecorder()
+	h.Routes().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/api/tickets/55555555-5555-5555-5555-555555555555/arrival", arrivalBody("wrong")))
+	if resp.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403 for bad token, got %d", resp.Code)
+	}
+
+	resp = httptest.NewRecorder()
+	h.Routes().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/api/tickets/55555555-5555-5555-5555-555555555555/arrival", arrivalBody(ticket.TrackingToken)))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	if arrival.Method != models.ArrivalQR || arrival.TicketID != "55555555-5555-5555-5555-555555555555" {
+		t.Fatalf("unexpected arrival input: %+v", arrival)
+	}
+}
+
+func TestRemoteArrivalValidatesRequest(t *testing.T) {
+	called := false
+	method := ""
+	st := fakeStore{
+		arrivalFn: func(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
+			called = true
+			method = input.Method
+			return models.Ticket{TicketID: input.TicketID, Status: models.StatusWaiting}, true, nil
+		},
+	}
+	h := NewHandler(st, Options{TrackingTokenSecret: "test-secret"})
+	ticketID := "55555555-5555-5555-5555-555555555555"
+
+	cases := map[string]map[string]string{
+		"missing tenant": {"request_id": "66666666-6666-6666-6666-666666666666", "branch_id": "33333333-3333-3333-3333-333333333333", "method": "qr"},
+		"bad branch":     {"request_id": "66666666-6666-6666-6666-666666666666", "tenant_id": "22222222-2222-2222-2222-222222222222", "branch_id": "branch", "method": "qr"},
+		"unknown method": {"request_id": "66666666-6666-6666-6666-666666666666", "tenant_id": "22222222-2222-2222-2222-222222222222", "branch_id": "33333333-3333-3333-3333-333333333333", "method": "nfc"},
+	}
+	for name, fields := range cases {
+		fields["token"] = h.trackingToken(ticketID)
+		body, _ := json.Marshal(fields)
+		resp := httptest.NewRecorder()
+		h.Routes().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/api/tickets/"+ticketID+"/arrival", bytes.NewReader(body)))
+		if resp.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected status 400, got %d", name, resp.Code)
+		}
+	}
+	if called {
+		t.Fatalf("expected invalid arrivals to stop before the store")
+	}
+
+	body, _ := json.Marshal(map[string]string{
+		"request_id": "66666666-6666-6666-6666-666666666666",
+		"tenant_id":  "22222222-2222-2222-2222-222222222222",
+		"branch_id":  "33333333-3333-3333-3333-333333333333",
+		"token":      h.trackingToken(ticketID),
+	})
+	resp := httptest.NewRecorder()
+	h.Routes().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/api/tickets/"+ticketID+"/arrival", bytes.NewReader(body)))
+	if resp.Code != http.StatusOK || method != models.ArrivalLink {
+		t.Fatalf("expected an arrival without method to default to the link, got %d with %q", resp.Code, method)
+	}
+}
+
+func TestSelfServicePostponeAndCancel(t *testing.T) {
+	var postponed store.TicketActionInput
+	var cancelled store.TicketActionInput
+	st := fakeStore{
+		postponeFn: func(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
+			postponed = input
+			return models.Ticket{TicketID: input.TicketID, Status: models.StatusWaiting, PostponeCount: 1}, true, nil
+		},
+		cancelFn: func(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
+			cancelled = input
+			return models.Ticket{TicketID: input.TicketID, Status: models.StatusCancelled}, true, nil
+		},
+	}
+	h := NewHandler(st, Options{TrackingTokenSecret: "test-secret"})
+	ticketID := "55555555-5555-5555-5555-555555555555"
+	token := h.trackingToken(ticketID)
+
+	selfBody := func(fields map[string]interface{}) *bytes.Reader {
+		payload := map[string]interface{}{
+			"request_id": "66666666-6666-6666-6666-666666666666",
+			"tenant_id":  "22222222-2222-2222-2222-222222222222",
+			"branch_id":  "33333333-3333-3333-3333-333333333333",
+			"token":      token,
+		}
+		for key, value := range fields {
+			payload[key] = value
+		}
+		body, _ := json.Marshal(payload)
+		return bytes.NewReader(body)
+	}
+
+	resp := httptest.NewRecorder()
+	h.Routes().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/api/tickets/"+ticketID+"/self/postpone", selfBody(map[string]interface{}{"places": 2, "minutes": 10})))
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for places and minutes, got %d", resp.Code)
+	}
+
+	resp = httptest.NewRecorder()
+	h.Routes().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/api/tickets/"+ticketID+"/self/cancel", selfBody(map[string]interface{}{"tenant_id": "tenant"})))
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for a non-UUID tenant, got %d", resp.Code)
+	}
+
+	resp = httptest.NewRecorder()
+	h.Routes().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/api/tickets/"+ticketID+"/self/postpone", selfBody(map[string]interface{}{"minutes": 20, "token": "wrong"})))
+	if resp.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403 for bad token, got %d", resp.Code)
+	}
+
+	resp = httptest.NewRecorder()
+	h.Routes().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/api/tickets/"+ticketID+"/self/postpone", selfBody(map[string]interface{}{"minutes": 20})))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	if postponed.PostponeDelay != 20*time.Minute || postponed.PostponePlaces != 0 {
+		t.Fatalf("unexpected postpone input: %+v", postponed)
+	}
+
+	resp = httptest.NewRecorder()
+	h.Routes().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/api/tickets/"+ticketID+"/self/cancel", selfBody(nil)))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	if cancelled.TicketID != ticketID {
+		t.Fatalf("unexpected cancel input: %+v", cancelled)
+	}
+}
+
+func TestTicketSearchScopesToAllowedServices(t *testing.T) {
+	var got store.TicketSearchInput
+	st := fakeStore{
+		sessionFn: func(ctx context.Context, sessionID string) (store.Session, error) {
+			return store.Session{SessionID: sessionID, UserID: "user-1", TenantID: "11111111-1111-1111-1111-111111111111", Role: "supervisor"}, nil
+		},
+		accessFn: func(ctx context.Context, userID string) ([]string, []string, error) {
+			return []string{"22222222-2222-2222-2222-222222222222"}, []string{"44444444-4444-4444-4444-444444444444"}, nil
+		},
+		searchFn: func(ctx context.Context, input store.TicketSearchInput) (store.TicketSearchPage, error) {
+			got = input
+			return store.TicketSearchPage{Tickets: []models.Ticket{{TicketID: "ticket-1", TicketNumber: "B-042"}}, NextCursor: "next"}, nil
+		},
+		locationFn: func(ctx context.Context, tenantID, branchID string) (*time.Location, error) {
+			return time.FixedZone("WIB", 7*60*60), nil
+		},
+	}
+	h := NewHandler(st, Options{})
+	search := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/tickets/search?tenant_id=11111111-1111-1111-1111-111111111111&branch_id=22222222-2222-2222-2222-222222222222"+query, nil)
+		req.Header.Set("Authorization", "Bearer session-1")
+		resp := httptest.NewRecorder()
+		h.Routes().ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := search("&ticket_number=b-042&status=done,cancelled&from=2024-03-01&to=2024-03-01")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	if len(got.ServiceIDs) != 1 || got.ServiceIDs[0] != "44444444-4444-4444-4444-444444444444" {
+		t.Fatalf("expected search scoped to allowed service, got %v", got.ServiceIDs)
+	}
+	if got.TicketNumber != "B-042" || len(got.Statuses) != 2 || got.To.Sub(got.From) != 24*time.Hour {
+		t.Fatalf("unexpected search input: %+v", got)
+	}
+	if want := time.Date(2024, 2, 29, 17, 0, 0, 0, time.UTC); !got.From.Equal(want) {
+		t.Fatalf("expected from to be midnight at the branch (%s), got %s", want, got.From)
+	}
+	var page store.TicketSearchPage
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if page.NextCursor != "next" || len(page.Tickets) != 1 {
+		t.Fatalf("unexpected page: %+v", page)
+	}
+
+	if resp := search("&service_id=55555555-5555-5555-5555-555555555555"); resp.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403 for other service, got %d", resp.Code)
+	}
+	if resp := search("&status=lost"); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for unknown status, got %d", resp.Code)
+	}
+	if resp := search("&phone=%2B6281234"); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for a phone in the query string, got %d", resp.Code)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"tenant_id": "11111111-1111-1111-1111-111111111111",
+		"branch_id": "22222222-2222-2222-2222-222222222222",
+		"phone":     " +6281234 ",
+		"statuses":  []string{"done"},
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/tickets/search", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer session-1")
+	resp = httptest.NewRecorder()
+	h.Routes().ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200 for a POST search, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if got.Phone != "+6281234" || len(got.Statuses) != 1 {
+		t.Fatalf("unexpected POST search input: %+v", got)
+	}
+}
+
+func TestCustomerRefRevealRequiresSupervisor(t *testing.T) {
+	role := "agent"
+	st := fakeStore{
+		sessionFn: func(ctx context.Context, sessionID string) (store.Session, error) {
+			return store.Session{SessionID: sessionID, UserID: "user-1", TenantID: "11111111-1111-1111-1111-111111111111", Role: role}, nil
+		},
+		customerRefFn: func(ctx context.Context, tenantID, branchID, ticketID string) (store.CustomerRef, error) {
+			return store.CustomerRef{TicketID: ticketID, Type: "cif", Value: "CIF-0042"}, nil
+		},
+		purgeRefFn: func(ctx context.Context, tenantID, value string) (int, error) {
+			if value != "CIF-0042" {
+				t.Fatalf("unexpected purge value %q", value)
+			}
+			return 2, nil
+		},
+	}
+	var audits []store.AuditEntry
+	var auditErr error
+	st.auditFn = func(ctx context.Context, entry store.AuditEntry) error {
+		if auditErr != nil {
+			return auditErr
+		}
+		audits = append(audits, entry)
+		return nil
+	}
+	h := NewHandler(st, Options{})
+	reveal := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/tickets/33333333-3333-3333-3333-333333333333/customer-ref?tenant_id=11111111-1111-1111-1111-111111111111&branch_id=22222222-2222-2222-2222-222222222222", nil)
+		req.Header.Set("Authorization", "Bearer session-1")
+		resp := httptest.NewRecorder()
+		h.Routes().ServeHTTP(resp, req)
+		return resp
+	}
+
+	if resp := reveal(); resp.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403 for agent, got %d", resp.Code)
+	}
+
+	role = "supervisor"
+	resp := reveal()
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	var ref store.CustomerRef
+	if err := json.NewDecoder(resp.Body).Decode(&ref); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if ref.Value != "CIF-0042" || ref.Type != "cif" {
+		t.Fatalf("unexpected customer ref: %+v", ref)
+	}
+	if len(audits) != 1 || audits[0].ActionType != "customer_ref.reveal" || audits[0].ActorUserID != "user-1" ||
+		audits[0].TargetID != "33333333-3333-3333-3333-333333333333" || !strings.Contains(audits[0].Detail, "type=cif") {
+		t.Fatalf("expected the reveal to be audited, got %+v", audits)
+	}
+	if strings.Contains(audits[0].Detail, "CIF-0042") {
+		t.Fatalf("expected the audit entry to leave out the reference, got %q", audits[0].Detail)
+	}
+
+	auditErr = errors.New("audit unavailable")
+	if resp := reveal(); resp.Code != http.StatusInternalServerError || strings.Contains(resp.Body.String(), "CIF-0042") {
+		t.Fatalf("expected no reveal without an audit entry, got %d %s", resp.Code, resp.Body.String())
+	}
+	auditErr = nil
+
+	body := []byte(`{"request_id":"44444444-4444-4444-4444-444444444444","tenant_id":"11111111-1111-1111-1111-111111111111","customer_ref":" CIF-0042 "}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/customer-refs/purge", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer session-1")
+	resp = httptest.NewRecorder()
+	h.Routes().ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200 for purge, got %d", resp.Code)
+	}
+	var purged map[string]int
+	if err := json.NewDecoder(resp.Body).Decode(&purged); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if purged["purged"] != 2 {
+		t.Fatalf("expected 2 purged rows, got %v", purged)
+	}
+	if last := audits[len(audits)-1]; last.ActionType != "customer_ref.purge" || last.TenantID != "11111111-1111-1111-1111-111111111111" || strings.Contains(last.Detail, "CIF-0042") {
+		t.Fatalf("expected the purge to be audited without the reference, got %+v", last)
+	}
+}
+
+func TestChainVerifyByDate(t *testing.T) {
+	var got store.ChainVerifyInput
+	st := fakeStore{
+		sessionFn: func(ctx context.Context, sessionID string) (store.Session, error) {
+			return store.Session{SessionID: sessionID, UserID: "user-1", TenantID: "11111111-1111-1111-1111-111111111111", Role: "admin"}, nil
+		},
+		chainFn: func(ctx context.Context, input store.ChainVerifyInput) (store.ChainReport, error) {
+			got = input
+			return store.ChainReport{
+				TenantID:       input.TenantID,
+				TicketsChecked: 1,
+				EventsChecked:  2,
+				Issues:         []store.ChainIssue{{TicketID: "ticket-1", TicketSeq: 2, Kind: store.ChainHashMismatch}},
+			}, nil
+		},
+	}
+	h := NewHandler(st, Options{})
+	verify := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/audit/ticket-chains?tenant_id=11111111-1111-1111-1111-111111111111"+query, nil)
+		req.Header.Set("Authorization", "Bearer session-1")
+		resp := httptest.NewRecorder()
+		h.Routes().ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := verify("&date=2024-03-01")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	if got.TicketID != "" || !got.Day.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected verify input: %+v", got)
+	}
+	var report store.ChainReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(report.Issues) != 1 || report.Issues[0].Kind != store.ChainHashMismatch {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	if resp := verify(""); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 without ticket_id or date, got %d", resp.Code)
+	}
+}
+
+func TestReplayRequiresAdmin(t *testing.T) {
+	role := "supervisor"
+	var got store.ReplayInput
+	st := fakeStore{
+		sessionFn: func(ctx context.Context, sessionID string) (store.Session, error) {
+			return store.Session{SessionID: sessionID, UserID: "user-1", TenantID: "11111111-1111-1111-1111-111111111111", Role: role}, nil
+		},
+		replayFn: func(ctx context.Context, input store.ReplayInput) (store.ReplayReport, error) {
+			got = input
+			return store.ReplayReport{TenantID: input.TenantID, TicketsChecked: 4, Drifted: 1, Repaired: 1}, nil
+		},
+	}
+	h := NewHandler(st, Options{})
+	replay := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/replay", bytes.NewReader([]byte(body)))
+		req.Header.Set("Authorization", "Bearer session-1")
+		resp := httptest.NewRecorder()
+		h.Routes().ServeHTTP(resp, req)
+		return resp
+	}
+	body := `{"tenant_id":"11111111-1111-1111-1111-111111111111","service_id":"44444444-4444-4444-4444-444444444444","from":"2024-03-01","to":"2024-03-01","repair":true}`
+
+	if resp := replay(body); resp.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403 for supervisor, got %d", resp.Code)
+	}
+
+	role = "admin"
+	resp := replay(body)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	if !got.Repair || got.ServiceID != "44444444-4444-4444-4444-444444444444" || got.To.Sub(got.From) != 24*time.Hour {
+		t.Fatalf("unexpected replay input: %+v", got)
+	}
+
+	if resp := replay(`{"tenant_id":"11111111-1111-1111-1111-111111111111"}`); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 without scope, got %d", resp.Code)
+	}
+}
+
+func TestJobsRequiresAdmin(t *testing.T) {
+	role := "supervisor"
+	st := fakeStore{
+		sessionFn: func(ctx context.Context, sessionID string) (store.Session, error) {
+			return store.Session{SessionID: sessionID, UserID: "user-1", TenantID: "11111111-1111-1111-1111-111111111111", Role: role}, nil
+		},
+	}
+	jobs := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	h := NewHandler(st, Options{Jobs: jobs})
+	status := func(session string) int {
+		req := httptest.NewRequest(http.MethodGet, "/jobs", nil)
+		if session != "" {
+			req.Header.Set("Authorization", "Bearer "+session)
+		}
+		resp := httptest.NewRecorder()
+		h.Routes().ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	if code := status(""); code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 without session, got %d", code)
+	}
+	if code := status("session-1"); code != http.StatusForbidden {
+		t.Fatalf("expected status 403 for supervisor, got %d", code)
+	}
+	role = "admin"
+	if code := status("session-1"); code != http.StatusOK {
+		t.Fatalf("expected status 200 for admin, got %d", code)
+	}
+}
+
+func TestOutboxConsumersRequiresAdmin(t *testing.T) {
+	role := "supervisor"
+	st := fakeStore{
+		sessionFn: func(ctx context.Context, sessionID string) (store.Session, error) {
+			return store.Session{SessionID: sessionID, UserID: "user-1", TenantID: "11111111-1111-1111-1111-111111111111", Role: role}, nil
+		},
+		consumersFn: func(ctx context.Context) ([]store.OutboxConsumer, error) {
+			return []store.OutboxConsumer{{Name: "notification", LastSeq: 40, HeadSeq: 42, Lag: 2}}, nil
+		},
+	}
+	h := NewHandler(st, Options{})
+	list := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/admin/outbox-consumers", nil)
+		req.Header.Set("Authorization", "Bearer session-1")
+		resp := httptest.NewRecorder()
+		h.Routes().ServeHTTP(resp, req)
+		return resp
+	}
+
+	if resp := list(); resp.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403 for supervisor, got %d", resp.Code)
+	}
+
+	role = "admin"
+	resp := list()
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	var consumers []store.OutboxConsumer
+	if err := json.NewDecoder(resp.Body).Decode(&consumers); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(consumers) != 1 || consumers[0].Lag != 2 {
+		t.Fatalf("unexpected consumers: %+v", consumers)
+	}
+}
@@ -0,0 +1,192 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"qms/queue-service/internal/models"
+	"qms/queue-service/internal/store"
+)
+
+var searchableStatuses = map[string]bool{
+	models.StatusWaiting:   true,
+	models.StatusRemote:    true,
+	models.StatusCalled:    true,
+	models.StatusServing:   true,
+	models.StatusHeld:      true,
+	models.StatusDone:      true,
+	models.StatusNoShow:    true,
+	models.StatusCancelled: true,
+}
+
+// ticketSearchRequest holds the search filters. GET reads them from the query
+// string; phone and customer_ref identify a customer, so they are only
+// accepted in a POST body to keep them out of URLs and access logs.
+type ticketSearchRequest struct {
+	TenantID      string   `json:"tenant_id"`
+	BranchID      string   `json:"branch_id"`
+	ServiceIDs    []string `json:"service_ids"`
+	TicketNumber  string   `json:"ticket_number"`
+	Statuses      []string `json:"statuses"`
+	Channel       string   `json:"channel"`
+	PriorityClass string   `json:"priority_class"`
+	CounterID     string   `json:"counter_id"`
+	Phone         string   `json:"phone"`
+	CustomerRef   string   `json:"customer_ref"`
+	From          string   `json:"from"`
+	To            string   `json:"to"`
+	Limit         int      `json:"limit"`
+	Cursor        string   `json:"cursor"`
+}
+
+// handleTicketSearch serves GET and POST /api/tickets/search. Results are
+// limited to the caller's branch and, for service-scoped staff, to their
+// services.
+func (h *Handler) handleTicketSearch(w http.ResponseWriter, r *http.Request) {
+	var req ticketSearchRequest
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		if query.Has("phone") || query.Has("customer_ref") {
+			writeError(w, "", http.StatusBadRequest, "invalid_request", "phone and customer_ref must be sent in a POST body")
+			return
+		}
+		req = ticketSearchRequest{
+			TenantID:      query.Get("tenant_id"),
+			BranchID:      query.Get("branch_id"),
+			ServiceIDs:    listParam(query, "service_id"),
+			TicketNumber:  query.Get("ticket_number"),
+			Statuses:      listParam(query, "status"),
+			Channel:       query.Get("channel"),
+			PriorityClass: query.Get("priority_class"),
+			CounterID:     query.Get("counter_id"),
+			From:          query.Get("from"),
+			To:            query.Get("to"),
+			Cursor:        query.Get("cursor"),
+		}
+		if raw := strings.TrimSpace(query.Get("limit")); raw != "" {
+			limit, err := strconv.Atoi(raw)
+			if err != nil || limit <= 0 {
+				writeError(w, "", http.StatusBadRequest, "invalid_request", "limit must be a positive integer")
+				return
+			}
+			req.Limit = limit
+		}
+	case http.MethodPost:
+		if !decodeRequest(w, r, &req) {
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	input := store.TicketSearchInput{
+		TenantID:      strings.TrimSpace(req.TenantID),
+		BranchID:      strings.TrimSpace(req.BranchID),
+		ServiceIDs:    trimList(req.ServiceIDs),
+		TicketNumber:  strings.ToUpper(strings.TrimSpace(req.TicketNumber)),
+		Statuses:      trimList(req.Statuses),
+		Channel:       strings.TrimSpace(req.Channel),
+		PriorityClass: strings.TrimSpace(req.PriorityClass),
+		CounterID:     strings.TrimSpace(req.CounterID),
+		Phone:         strings.TrimSpace(req.Phone),
+		CustomerRef:   strings.TrimSpace(req.CustomerRef),
+		Limit:         req.Limit,
+		Cursor:        strings.TrimSpace(req.Cursor),
+	}
+	if input.TenantID == "" || input.BranchID == "" {
+		writeError(w, "", http.StatusBadRequest, "invalid_request", "tenant_id and branch_id are required")
+		return
+	}
+	if !isValidUUID(input.TenantID) || !isValidUUID(input.BranchID) {
+		writeError(w, "", http.StatusBadRequest, "invalid_request", "tenant_id and branch_id must be UUIDs")
+		return
+	}
+	for _, serviceID := range input.ServiceIDs {
+		if !isValidUUID(serviceID) {
+			writeError(w, "", http.StatusBadRequest, "invalid_request", "service_id must be a UUID")
+			return
+		}
+	}
+	if input.CounterID != "" && !isValidUUID(input.CounterID) {
+		writeError(w, "", http.StatusBadRequest, "invalid_request", "counter_id must be a UUID")
+		return
+	}
+	for _, status := range input.Statuses {
+		if !searchableStatuses[status] {
+			writeError(w, "", http.StatusBadRequest, "invalid_request", "unknown status: "+status)
+			return
+		}
+	}
+	// Plain dates are days at the branch.
+	loc := time.UTC
+	if strings.TrimSpace(req.From) != "" || strings.TrimSpace(req.To) != "" {
+		var err error
+		if loc, err = h.store.BranchLocation(r.Context(), input.TenantID, input.BranchID); err != nil {
+			writeError(w, "", http.StatusInternalServerError, "internal_error", "internal server error")
+			return
+		}
+	}
+	var ok bool
+	if input.From, ok = store.ParseSearchTime(req.From, false, loc); !ok {
+		writeError(w, "", http.StatusBadRequest, "invalid_request", "from must be RFC3339 or YYYY-MM-DD")
+		return
+	}
+	if input.To, ok = store.ParseSearchTime(req.To, true, loc); !ok {
+		writeError(w, "", http.StatusBadRequest, "invalid_request", "to must be RFC3339 or YYYY-MM-DD")
+		return
+	}
+	if !input.From.IsZero() && !input.To.IsZero() && !input.From.Before(input.To) {
+		writeError(w, "", http.StatusBadRequest, "invalid_request", "from must be before to")
+		return
+	}
+	if !requireTenant(w, r, input.TenantID) {
+		return
+	}
+	if !requireBranchAccess(w, r, input.BranchID) {
+		return
+	}
+	for _, serviceID := range input.ServiceIDs {
+		if !requireServiceAccess(w, r, serviceID) {
+			return
+		}
+	}
+	if info, ok := accessFromContext(r.Context()); ok && len(input.ServiceIDs) == 0 && len(info.Services) > 0 {
+		input.ServiceIDs = info.Services
+	}
+
+	page, err := h.store.SearchTickets(r.Context(), input)
+	if err != nil {
+		status, code, msg := mapError(err)
+		writeError(w, "", status, code, msg)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// listParam accepts both repeated and comma separated query values.
+func listParam(query url.Values, key string) []string {
+	var values []string
+	for _, raw := range query[key] {
+		for _, part := range strings.Split(raw, ",") {
+			if trimmed := strings.TrimSpace(part); trimmed != "" {
+				values = append(values, trimmed)
+			}
+		}
+	}
+	return values
+}
+
+func trimList(values []string) []string {
+	var trimmed []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			trimmed = append(trimmed, value)
+		}
+	}
+	return trimmed
+}
@@ -0,0 +1,146 @@
+package httpapi
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"qms/queue-service/internal/models"
+	"qms/queue-service/internal/store"
+)
+
+// Tracking tokens let a customer act on their own ticket without a staff
+// session. The token is an HMAC of the ticket ID, so it survives idempotent
+// replays of ticket creation and never has to be stored.
+const trackingTokenLength = 32
+
+type arrivalRequest struct {
+	RequestID string `json:"request_id"`
+	TenantID  string `json:"tenant_id"`
+	BranchID  string `json:"branch_id"`
+	Token     string `json:"token"`
+	Method    string `json:"method"`
+}
+
+// selfServiceRequest is posted by the customer to cancel or postpone their
+// own ticket. Postpone takes either places or minutes.
+type selfServiceRequest struct {
+	RequestID string `json:"request_id"`
+	TenantID  string `json:"tenant_id"`
+	BranchID  string `json:"branch_id"`
+	Token     string `json:"token"`
+	Places    int    `json:"places"`
+	Minutes   int    `json:"minutes"`
+}
+
+func (h *Handler) trackingToken(ticketID string) string {
+	if len(h.trackingSecret) == 0 {
+		return ""
+	}
+	mac := hmac.New(sha256.New, h.trackingSecret)
+	mac.Write([]byte(ticketID))
+	return hex.EncodeToString(mac.Sum(nil))[:trackingTokenLength]
+}
+
+func (h *Handler) validTrackingToken(ticketID, token string) bool {
+	expected := h.trackingToken(ticketID)
+	if expected == "" || token == "" {
+		return false
+	}
+	return hmac.Equal([]byte(expected), []byte(token))
+}
+
+// handleArrival confirms a remote ticket from the customer side: the kiosk
+// posts it after scanning the ticket QR code, or the customer opens the
+// arrival link. Both carry the tracking token instead of a session.
+func (h *Handler) handleArrival(w http.ResponseWriter, r *http.Request, ticketID string) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req arrivalRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if !h.validTrackingToken(ticketID, req.Token) {
+		writeError(w, req.RequestID, http.StatusForbidden, "invalid_token", "tracking token is invalid")
+		return
+	}
+
+	ticket, _, err := h.store.ConfirmArrival(r.Context(), store.TicketActionInput{
+		RequestID:  req.RequestID,
+		TenantID:   req.TenantID,
+		BranchID:   req.BranchID,
+		TicketID:   ticketID,
+		Method:     req.Method,
+		OccurredAt: time.Now().UTC(),
+	})
+	if err != nil {
+		status, code, msg := mapError(err)
+		writeError(w, req.RequestID, status, code, msg)
+		return
+	}
+	writeJSON(w, http.StatusOK, ticket)
+}
+
+func normalizeArrivalMethod(method string) string {
+	switch strings.ToLower(strings.TrimSpace(method)) {
+	case models.ArrivalQR:
+		return models.ArrivalQR
+	case "", models.ArrivalLink:
+		return models.ArrivalLink
+	default:
+		return ""
+	}
+}
+
+// handleSelfService lets the customer cancel or postpone their waiting
+// ticket with the tracking token. Both actions are idempotent on request_id.
+func (h *Handler) handleSelfService(w http.ResponseWriter, r *http.Request, ticketID, action string) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if action != "cancel" && action != "postpone" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	var req selfServiceRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if !h.validTrackingToken(ticketID, req.Token) {
+		writeError(w, req.RequestID, http.StatusForbidden, "invalid_token", "tracking token is invalid")
+		return
+	}
+
+	input := store.TicketActionInput{
+		RequestID:  req.RequestID,
+		TenantID:   req.TenantID,
+		BranchID:   req.BranchID,
+		TicketID:   ticketID,
+		OccurredAt: time.Now().UTC(),
+	}
+	var ticket models.Ticket
+	var err error
+	if action == "cancel" {
+		ticket, _, err = h.store.CancelTicket(r.Context(), input)
+	} else {
+		if (req.Places > 0) == (req.Minutes > 0) {
+			writeError(w, req.RequestID, http.StatusBadRequest, "invalid_request", "exactly one of places or minutes must be positive")
+			return
+		}
+		input.PostponePlaces = req.Places
+		input.PostponeDelay = time.Duration(req.Minutes) * time.Minute
+		ticket, _, err = h.store.PostponeTicket(r.Context(), input)
+	}
+	if err != nil {
+		status, code, msg := mapError(err)
+		writeError(w, req.RequestID, status, code, msg)
+		return
+	}
+	writeJSON(w, http.StatusOK, ticket)
+}
@@ -0,0 +1,305 @@
+// Package jobs runs periodic background work on a set of replicas.
+//
+// Singleton jobs run only on the replica that holds the service's leader
+// lease; the lease is renewed every third of its TTL and released on Stop,
+// so another replica takes over within one TTL of a crash. Shardable jobs
+// run on every replica and must split work themselves, e.g. with
+// FOR UPDATE SKIP LOCKED.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Mode string
+
+const (
+	Singleton Mode = "singleton"
+	Shardable Mode = "shardable"
+)
+
+// Leaser grants time-limited named leases. AcquireLease also renews a
+// lease the holder already owns.
+type Leaser interface {
+	AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+	ReleaseLease(ctx context.Context, name, holder string) error
+}
+
+type Job struct {
+	Name     string
+	Mode     Mode
+	Interval time.Duration
+	// Timeout bounds one run; it defaults to 10 seconds.
+	Timeout time.Duration
+	// Wake, when set, triggers a run before the next tick.
+	Wake <-chan struct{}
+	Run  func(ctx context.Context) error
+}
+
+type Status struct {
+	Name            string     `json:"name"`
+	Mode            Mode       `json:"mode"`
+	IntervalSeconds float64    `json:"interval_seconds"`
+	Running         bool       `json:"running"`
+	Runs            int64      `json:"runs"`
+	Failures        int64      `json:"failures"`
+	Skipped         int64      `json:"skipped"`
+	LastStartedAt   *time.Time `json:"last_started_at,omitempty"`
+	LastSuccessAt   *time.Time `json:"last_success_at,omitempty"`
+	LastError       string     `json:"last_error,omitempty"`
+	LastErrorAt     *time.Time `json:"last_error_at,omitempty"`
+}
+
+type Report struct {
+	Lease       string     `json:"lease"`
+	Holder      string     `json:"holder"`
+	Leader      bool       `json:"leader"`
+	LeaderSince *time.Time `json:"leader_since,omitempty"`
+	Jobs        []Status   `json:"jobs"`
+}
+
+type Options struct {
+	// Lease names the leader lease; replicas of one service share it.
+	Lease string
+	// Holder identifies this replica; it defaults to hostname-pid-random.
+	Holder string
+	// TTL is how long a lease survives without renewal; default 30s.
+	TTL time.Duration
+}
+
+type Runner struct {
+	leaser Leaser
+	lease  string
+	holder string
+	ttl    time.Duration
+
+	mu           sync.Mutex
+	jobs         []*entry
+	leaderCtx    context.Context
+	cancelLeader context.CancelFunc
+	leaderSince  time.Time
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
+}
+
+type entry struct {
+	job    Job
+	status Status
+}
+
+func NewRunner(leaser Leaser, opts Options) *Runner {
+	holder := opts.Holder
+	if holder == "" {
+		host, _ := os.Hostname()
+		holder = fmt.Sprintf("%s-%d-%s", host, os.Getpid(), uuid.NewString()[:8])
+	}
+	ttl := opts.TTL
+	if ttl <= 0 {
+		ttl = 30 * time.Second
+	}
+	return &Runner{leaser: leaser, lease: opts.Lease, holder: holder, ttl: ttl}
+}
+
+// Add registers job. Jobs with a non-positive interval are disabled and
+// ignored, matching the *_INTERVAL_SECONDS=0 convention.
+func (r *Runner) Add(job Job) {
+	if job.Interval <= 0 {
+		return
+	}
+	if job.Timeout <= 0 {
+		job.Timeout = 10 * time.Second
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jobs = append(r.jobs, &entry{
+		job: job,
+		status: Status{
+			Name:            job.Name,
+			Mode:            job.Mode,
+			IntervalSeconds: job.Interval.Seconds(),
+		},
+	})
+}
+
+// Start begins lease renewal and the job loops. It returns immediately.
+func (r *Runner) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	r.mu.Lock()
+	r.cancel = cancel
+	jobs := append([]*entry(nil), r.jobs...)
+	r.mu.Unlock()
+
+	if r.hasSingletons() {
+		r.heartbeat(ctx)
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			ticker := time.NewTicker(r.ttl / 3)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					r.heartbeat(ctx)
+				}
+			}
+		}()
+	}
+
+	for _, e := range jobs {
+		e := e
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			ticker := time.NewTicker(e.job.Interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				case <-e.job.Wake:
+				}
+				r.runOnce(ctx, e)
+			}
+		}()
+	}
+}
+
+// Stop cancels running jobs, waits for them and releases the lease so a
+// standby replica can take over without waiting for the TTL.
+func (r *Runner) Stop(ctx context.Context) {
+	r.mu.Lock()
+	cancel := r.cancel
+	r.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	r.wg.Wait()
+
+	r.mu.Lock()
+	wasLeader := r.leaderCtx != nil
+	r.setFollowerLocked()
+	r.mu.Unlock()
+	if wasLeader {
+		if err := r.leaser.ReleaseLease(ctx, r.lease, r.holder); err != nil {
+			log.Printf("jobs release lease %s: %v", r.lease, err)
+		}
+	}
+}
+
+func (r *Runner) hasSingletons() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.jobs {
+		if e.job.Mode == Singleton {
+			return true
+		}
+	}
+	return false
+}
+
+// heartbeat acquires or renews the leader lease. Any failure to renew is
+// treated as lost leadership, and running singleton jobs are cancelled.
+func (r *Runner) heartbeat(ctx context.Context) {
+	leaseCtx, cancel := context.WithTimeout(ctx, r.ttl/3)
+	ok, err := r.leaser.AcquireLease(leaseCtx, r.lease, r.holder, r.ttl)
+	cancel()
+	if err != nil {
+		log.Printf("jobs lease %s: %v", r.lease, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case ok && r.leaderCtx == nil:
+		r.leaderCtx, r.cancelLeader = context.WithCancel(ctx)
+		r.leaderSince = time.Now().UTC()
+		log.Printf("jobs %s: %s is leader", r.lease, r.holder)
+	case !ok && r.leaderCtx != nil:
+		r.setFollowerLocked()
+		log.Printf("jobs %s: %s lost leadership", r.lease, r.holder)
+	}
+}
+
+func (r *Runner) setFollowerLocked() {
+	if r.cancelLeader != nil {
+		r.cancelLeader()
+	}
+	r.leaderCtx, r.cancelLeader = nil, nil
+	r.leaderSince = time.Time{}
+}
+
+func (r *Runner) runOnce(ctx context.Context, e *entry) {
+	r.mu.Lock()
+	parent := ctx
+	if e.job.Mode == Singleton {
+		parent = r.leaderCtx
+	}
+	if parent == nil || e.status.Running {
+		e.status.Skipped++
+		r.mu.Unlock()
+		return
+	}
+	started := time.Now().UTC()
+	e.status.Running = true
+	e.status.LastStartedAt = &started
+	r.mu.Unlock()
+
+	runCtx, cancel := context.WithTimeout(parent, e.job.Timeout)
+	err := e.job.Run(runCtx)
+	cancel()
+
+	finished := time.Now().UTC()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e.status.Running = false
+	e.status.Runs++
+	if err != nil {
+		e.status.Failures++
+		e.status.LastError = err.Error()
+		e.status.LastErrorAt = &finished
+		log.Printf("job %s error: %v", e.job.Name, err)
+		return
+	}
+	e.status.LastSuccessAt = &finished
+}
+
+func (r *Runner) Report() Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	report := Report{
+		Lease:  r.lease,
+		Holder: r.holder,
+		Leader: r.leaderCtx != nil,
+		Jobs:   make([]Status, 0, len(r.jobs)),
+	}
+	if report.Leader {
+		since := r.leaderSince
+		report.LeaderSince = &since
+	}
+	for _, e := range r.jobs {
+		report.Jobs = append(report.Jobs, e.status)
+	}
+	return report
+}
+
+// ServeHTTP writes the Report as JSON.
+func (r *Runner) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(r.Report())
+}
@@ -5,4 +5,6 @@ type Counter struct {
 	BranchID  string `json:"branch_id"`
 	Name      string `json:"name"`
 	Status    string `json:"status"`
+	Capacity  int    `json:"capacity"`
+	InUse     int    `json:"in_use"`
 }
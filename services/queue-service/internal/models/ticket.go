@@ -3,20 +3,38 @@ package models
 import "time"
 
 type Ticket struct {
-	TicketID     string     `json:"ticket_id"`
-	TicketNumber string     `json:"ticket_number"`
-	TenantID     string     `json:"tenant_id,omitempty"`
-	BranchID     string     `json:"branch_id,omitempty"`
-	ServiceID    string     `json:"service_id,omitempty"`
-	AreaID       string     `json:"area_id,omitempty"`
-	Status       string     `json:"status"`
-	CreatedAt    time.Time  `json:"created_at"`
-	RequestID    string     `json:"request_id"`
-	CalledAt     *time.Time `json:"called_at,omitempty"`
-	CounterID    *string    `json:"counter_id,omitempty"`
-	ServedAt     *time.Time `json:"served_at,omitempty"`
-	CompletedAt  *time.Time `json:"completed_at,omitempty"`
-	Phone        string     `json:"phone,omitempty"`
+	TicketID           string     `json:"ticket_id"`
+	TicketNumber       string     `json:"ticket_number"`
+	TenantID           string     `json:"tenant_id,omitempty"`
+	BranchID           string     `json:"branch_id,omitempty"`
+	ServiceID          string     `json:"service_id,omitempty"`
+	AreaID             string     `json:"area_id,omitempty"`
+	Status             string     `json:"status"`
+	Channel            string     `json:"channel,omitempty"`
+	PriorityClass      string     `json:"priority_class,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+	RequestID          string     `json:"request_id"`
+	CalledAt           *time.Time `json:"called_at,omitempty"`
+	CounterID          *string    `json:"counter_id,omitempty"`
+	ServedAt           *time.Time `json:"served_at,omitempty"`
+	CompletedAt        *time.Time `json:"completed_at,omitempty"`
+	Phone              string     `json:"phone,omitempty"`
+	HoldReason         string     `json:"hold_reason,omitempty"`
+	HeldAt             *time.Time `json:"held_at,omitempty"`
+	HoldExpiresAt      *time.Time `json:"hold_expires_at,omitempty"`
+	HoldCounterID      *string    `json:"hold_counter_id,omitempty"`
+	RecallCount        int        `json:"recall_count"`
+	LastRecalledAt     *time.Time `json:"last_recalled_at,omitempty"`
+	CancelledAt        *time.Time `json:"cancelled_at,omitempty"`
+	ReopenedAt         *time.Time `json:"reopened_at,omitempty"`
+	PartySize          int        `json:"party_size"`
+	LinkedTicketID     *string    `json:"linked_ticket_id,omitempty"`
+	ResourceID         *string    `json:"resource_id,omitempty"`
+	ArrivalConfirmedAt *time.Time `json:"arrival_confirmed_at,omitempty"`
+	RemoteExpiresAt    *time.Time `json:"remote_expires_at,omitempty"`
+	PostponeCount      int        `json:"postpone_count,omitempty"`
+	CustomerRefType    string     `json:"customer_ref_type,omitempty"`
+	TrackingToken      string     `json:"tracking_token,omitempty"`
 }
 
 const (
@@ -27,4 +45,16 @@ const (
 	StatusNoShow    = "no_show"
 	StatusCancelled = "cancelled"
 	StatusHeld      = "held"
+	StatusRemote    = "remote"
+)
+
+const (
+	ArrivalQR    = "qr"
+	ArrivalLink  = "link"
+	ArrivalStaff = "staff"
+)
+
+const (
+	HoldExpiryReturn = "return"
+	HoldExpiryCancel = "cancel"
 )
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"time"
+)
+
+const (
+	ChainBrokenLink   = "broken_link"
+	ChainSeqGap       = "seq_gap"
+	ChainHashMismatch = "hash_mismatch"
+)
+
+// ChainIssue is one defect found while walking a ticket's event chain.
+type ChainIssue struct {
+	TicketID  string `json:"ticket_id"`
+	TicketSeq int    `json:"ticket_seq"`
+	Kind      string `json:"kind"`
+	Detail    string `json:"detail"`
+}
+
+// ChainVerifyInput selects the chains to verify: a single ticket, or every
+// ticket of the tenant with events on Day.
+type ChainVerifyInput struct {
+	TenantID string
+	TicketID string
+	Day      time.Time
+}
+
+type ChainReport struct {
+	TenantID       string       `json:"tenant_id"`
+	TicketID       string       `json:"ticket_id,omitempty"`
+	Date           string       `json:"date,omitempty"`
+	TicketsChecked int          `json:"tickets_checked"`
+	EventsChecked  int          `json:"events_checked"`
+	Issues         []ChainIssue `json:"issues"`
+	// MerkleRoot is recomputed from the day's events; StoredRoot is the
+	// digest sealed by the audit job, when one exists.
+	MerkleRoot    string `json:"merkle_root,omitempty"`
+	StoredRoot    string `json:"stored_root,omitempty"`
+	DigestMatches *bool  `json:"digest_matches,omitempty"`
+}
+
+// EventDigest is the sealed Merkle root of a tenant's ticket events for one
+// UTC day.
+type EventDigest struct {
+	TenantID    string    `json:"tenant_id"`
+	Date        string    `json:"date"`
+	EventCount  int       `json:"event_count"`
+	MerkleRoot  string    `json:"merkle_root"`
+	ChainIssues int       `json:"chain_issues"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// VerifyTicketChain checks one ticket's events, ordered by ticket_seq, for
+// sequence gaps, prev_hash links that do not match the previous event, and
+// hashes that do not match the recomputed value.
+func VerifyTicketChain(events []TicketEvent) []ChainIssue {
+	var issues []ChainIssue
+	prevHash := ""
+	prevSeq := 0
+	for _, event := range events {
+		if event.TicketSeq != prevSeq+1 {
+			issues = append(issues, ChainIssue{
+				TicketID:  event.TicketID,
+				TicketSeq: event.TicketSeq,
+				Kind:      ChainSeqGap,
+				Detail:    fmt.Sprintf("expected seq %d", prevSeq+1),
+			})
+		}
+		if event.PrevHash != prevHash {
+			issues = append(issues, ChainIssue{
+				TicketID:  event.TicketID,
+				TicketSeq: event.TicketSeq,
+				Kind:      ChainBrokenLink,
+				Detail:    "prev_hash does not match previous event",
+			})
+		}
+		expected := ComputeTicketEventHash(event.PrevHash, event.TicketID, event.Type, event.Payload, event.CreatedAt, event.TicketSeq)
+		if event.Hash != expected {
+			issues = append(issues, ChainIssue{
+				TicketID:  event.TicketID,
+				TicketSeq: event.TicketSeq,
+				Kind:      ChainHashMismatch,
+				Detail:    "stored hash does not match event content",
+			})
+		}
+		prevHash = event.Hash
+		prevSeq = event.TicketSeq
+	}
+	return issues
+}
+
+// MerkleRoot folds event hashes pairwise with SHA-256 until one remains. An
+// odd node is paired with itself. No hashes yields an empty root.
+func MerkleRoot(hashes []string) string {
+	if len(hashes) == 0 {
+		return ""
+	}
+	level := append([]string(nil), hashes...)
+	for len(level) > 1 {
+		next := make([]string, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			right := level[i]
+			if i+1 < len(level) {
+				right = level[i+1]
+			}
+			sum := sha256.Sum256([]byte(level[i] + right))
+			next = append(next, fmt.Sprintf("%x", sum))
+		}
+		level = next
+	}
+	return level[0]
+}
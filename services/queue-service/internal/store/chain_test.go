@@ -0,0 +1,58 @@
+package store
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func buildChain(ticketID string, count int) []TicketEvent {
+	var events []TicketEvent
+	prev := ""
+	createdAt := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	for seq := 1; seq <= count; seq++ {
+		payload := json.RawMessage(`{"status": "waiting"}`)
+		at := createdAt.Add(time.Duration(seq) * time.Minute)
+		hash := ComputeTicketEventHash(prev, ticketID, "ticket.created", payload, at, seq)
+		events = append(events, TicketEvent{TicketID: ticketID, TicketSeq: seq, Type: "ticket.created", Payload: payload, CreatedAt: at, PrevHash: prev, Hash: hash})
+		prev = hash
+	}
+	return events
+}
+
+func TestVerifyTicketChainDetectsTampering(t *testing.T) {
+	events := buildChain("ticket-1", 3)
+	if issues := VerifyTicketChain(events); len(issues) != 0 {
+		t.Fatalf("expected intact chain, got %+v", issues)
+	}
+
+	tampered := buildChain("ticket-1", 3)
+	tampered[1].Payload = json.RawMessage(`{"status": "done"}`)
+	issues := VerifyTicketChain(tampered)
+	if len(issues) != 1 || issues[0].Kind != ChainHashMismatch || issues[0].TicketSeq != 2 {
+		t.Fatalf("expected hash mismatch at seq 2, got %+v", issues)
+	}
+
+	gapped := buildChain("ticket-1", 3)
+	gapped = append(gapped[:1], gapped[2:]...)
+	issues = VerifyTicketChain(gapped)
+	if len(issues) != 2 || issues[0].Kind != ChainSeqGap || issues[1].Kind != ChainBrokenLink {
+		t.Fatalf("expected gap and broken link, got %+v", issues)
+	}
+}
+
+func TestMerkleRoot(t *testing.T) {
+	if MerkleRoot(nil) != "" {
+		t.Fatalf("expected empty root")
+	}
+	if MerkleRoot([]string{"a"}) != "a" {
+		t.Fatalf("single leaf is its own root")
+	}
+	root := MerkleRoot([]string{"a", "b", "c"})
+	if root != MerkleRoot([]string{"a", "b", "c", "c"}) {
+		t.Fatalf("odd leaf should pair with itself")
+	}
+	if root == MerkleRoot([]string{"a", "c", "b"}) {
+		t.Fatalf("root must depend on order")
+	}
+}
@@ -11,7 +11,20 @@ var (
 	ErrCounterMismatch    = errors.New("counter mismatch")
 	ErrCounterNotFound    = errors.New("counter not found")
 	ErrCounterUnavailable = errors.New("counter unavailable")
+	ErrCounterAtCapacity  = errors.New("counter at capacity")
 	ErrAccessDenied       = errors.New("access denied")
 	ErrHolidayClosed      = errors.New("holiday closed")
 	ErrSessionNotFound    = errors.New("session not found")
+	ErrRecallTooSoon      = errors.New("recall too soon")
+	ErrReopenExpired      = errors.New("reopen window expired")
+	ErrPartyTooLarge      = errors.New("party size exceeds service limit")
+	ErrCapacityExceeded   = errors.New("service waiting capacity exceeded")
+	ErrArrivalExpired     = errors.New("remote arrival window expired")
+	ErrPostponeLimit      = errors.New("postpone limit reached")
+	ErrNothingToPostpone  = errors.New("no waiting ticket to let ahead")
+	ErrInvalidCursor      = errors.New("invalid cursor")
+	ErrCustomerRefOff     = errors.New("customer reference not collected")
+	ErrCustomerRefMissing = errors.New("customer reference required")
+	ErrCustomerRefInvalid = errors.New("invalid customer reference")
+	ErrCustomerRefNoKeys  = errors.New("customer reference tokenisation unavailable")
 )
@@ -0,0 +1,534 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"qms/queue-service/internal/models"
+	"qms/queue-service/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// emit appends an outbox event and the matching link in the ticket's event
+// chain. Payloads use the same keys as the PostgreSQL store.
+func (s *Store) emit(tenantID, eventType, ticketID string, payload map[string]interface{}) error {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	createdAt := now()
+	s.outbox = append(s.outbox, store.OutboxEvent{
+		Seq:       int64(len(s.outbox) + 1),
+		EventID:   uuid.NewString(),
+		TenantID:  tenantID,
+		Type:      eventType,
+		Payload:   payloadJSON,
+		CreatedAt: createdAt,
+	})
+
+	chain := s.events[ticketID]
+	seq := len(chain) + 1
+	prev := ""
+	if len(chain) > 0 {
+		prev = chain[len(chain)-1].Hash
+	}
+	s.events[ticketID] = append(chain, store.TicketEvent{
+		TicketID:  ticketID,
+		TicketSeq: seq,
+		Type:      eventType,
+		Payload:   payloadJSON,
+		CreatedAt: createdAt,
+		PrevHash:  prev,
+		Hash:      store.ComputeTicketEventHash(prev, ticketID, eventType, payloadJSON, createdAt, seq),
+	})
+	return nil
+}
+
+func createdPayload(ticket models.Ticket, scheduledAt *time.Time) map[string]interface{} {
+	payload := map[string]interface{}{
+		"ticket_id":      ticket.TicketID,
+		"ticket_number":  ticket.TicketNumber,
+		"status":         ticket.Status,
+		"created_at":     ticket.CreatedAt,
+		"request_id":     ticket.RequestID,
+		"tenant_id":      ticket.TenantID,
+		"branch_id":      ticket.BranchID,
+		"service_id":     ticket.ServiceID,
+		"area_id":        ticket.AreaID,
+		"phone":          ticket.Phone,
+		"party_size":     ticket.PartySize,
+		"priority_class": ticket.PriorityClass,
+	}
+	if ticket.LinkedTicketID != nil {
+		payload["linked_ticket_id"] = *ticket.LinkedTicketID
+	}
+	if ticket.RemoteExpiresAt != nil {
+		payload["remote_expires_at"] = ticket.RemoteExpiresAt
+	}
+	if scheduledAt != nil {
+		payload["appointment_scheduled_at"] = scheduledAt
+	}
+	return payload
+}
+
+func calledPayload(ticket models.Ticket) map[string]interface{} {
+	payload := map[string]interface{}{
+		"ticket_id":     ticket.TicketID,
+		"ticket_number": ticket.TicketNumber,
+		"status":        ticket.Status,
+		"called_at":     ticket.CalledAt,
+		"counter_id":    ticket.CounterID,
+		"request_id":    ticket.RequestID,
+		"tenant_id":     ticket.TenantID,
+		"branch_id":     ticket.BranchID,
+		"service_id":    ticket.ServiceID,
+		"area_id":       ticket.AreaID,
+		"party_size":    ticket.PartySize,
+	}
+	if ticket.ResourceID != nil {
+		payload["resource_id"] = *ticket.ResourceID
+	}
+	return payload
+}
+
+func genericPayload(ticket models.Ticket) map[string]interface{} {
+	return map[string]interface{}{
+		"ticket_id":     ticket.TicketID,
+		"ticket_number": ticket.TicketNumber,
+		"status":        ticket.Status,
+		"request_id":    ticket.RequestID,
+		"called_at":     ticket.CalledAt,
+		"served_at":     ticket.ServedAt,
+		"completed_at":  ticket.CompletedAt,
+		"counter_id":    ticket.CounterID,
+		"tenant_id":     ticket.TenantID,
+		"branch_id":     ticket.BranchID,
+		"service_id":    ticket.ServiceID,
+		"area_id":       ticket.AreaID,
+	}
+}
+
+func recalledPayload(ticket models.Ticket, maxRecalls int) map[string]interface{} {
+	return map[string]interface{}{
+		"ticket_id":        ticket.TicketID,
+		"ticket_number":    ticket.TicketNumber,
+		"status":           ticket.Status,
+		"request_id":       ticket.RequestID,
+		"called_at":        ticket.CalledAt,
+		"counter_id":       ticket.CounterID,
+		"recall_count":     ticket.RecallCount,
+		"max_recalls":      maxRecalls,
+		"last_recalled_at": ticket.LastRecalledAt,
+		"tenant_id":        ticket.TenantID,
+		"branch_id":        ticket.BranchID,
+		"service_id":       ticket.ServiceID,
+		"area_id":          ticket.AreaID,
+	}
+}
+
+func reopenedPayload(ticket models.Ticket, fromStatus, reason, actorID string) map[string]interface{} {
+	payload := map[string]interface{}{
+		"ticket_id":     ticket.TicketID,
+		"ticket_number": ticket.TicketNumber,
+		"status":        ticket.Status,
+		"from_status":   fromStatus,
+		"request_id":    ticket.RequestID,
+		"reason":        reason,
+		"reopened_at":   ticket.ReopenedAt,
+		"called_at":     ticket.CalledAt,
+		"served_at":     ticket.ServedAt,
+		"counter_id":    ticket.CounterID,
+		"tenant_id":     ticket.TenantID,
+		"branch_id":     ticket.BranchID,
+		"service_id":    ticket.ServiceID,
+		"area_id":       ticket.AreaID,
+	}
+	if actorID != "" {
+		payload["reopened_by"] = actorID
+	}
+	return payload
+}
+
+func transferPayload(ticket models.Ticket, fromServiceID, toServiceID, reason string) map[string]interface{} {
+	payload := map[string]interface{}{
+		"ticket_id":       ticket.TicketID,
+		"ticket_number":   ticket.TicketNumber,
+		"status":          ticket.Status,
+		"request_id":      ticket.RequestID,
+		"from_service_id": fromServiceID,
+		"to_service_id":   toServiceID,
+		"tenant_id":       ticket.TenantID,
+		"branch_id":       ticket.BranchID,
+		"service_id":      ticket.ServiceID,
+		"area_id":         ticket.AreaID,
+	}
+	if reason != "" {
+		payload["reason"] = reason
+	}
+	return payload
+}
+
+func noShowPayload(ticket models.Ticket, returned bool) map[string]interface{} {
+	return map[string]interface{}{
+		"ticket_id":     ticket.TicketID,
+		"ticket_number": ticket.TicketNumber,
+		"status":        ticket.Status,
+		"request_id":    ticket.RequestID,
+		"called_at":     ticket.CalledAt,
+		"counter_id":    ticket.CounterID,
+		"returned":      returned,
+		"recall_count":  ticket.RecallCount,
+		"tenant_id":     ticket.TenantID,
+		"branch_id":     ticket.BranchID,
+		"service_id":    ticket.ServiceID,
+		"area_id":       ticket.AreaID,
+	}
+}
+
+func arrivedPayload(ticket models.Ticket, queuedAt time.Time, method string, keptPlace bool) map[string]interface{} {
+	return map[string]interface{}{
+		"ticket_id":            ticket.TicketID,
+		"ticket_number":        ticket.TicketNumber,
+		"status":               ticket.Status,
+		"request_id":           ticket.RequestID,
+		"created_at":           ticket.CreatedAt,
+		"queued_at":            queuedAt,
+		"arrival_confirmed_at": ticket.ArrivalConfirmedAt,
+		"arrival_method":       method,
+		"kept_place":           keptPlace,
+		"tenant_id":            ticket.TenantID,
+		"branch_id":            ticket.BranchID,
+		"service_id":           ticket.ServiceID,
+		"area_id":              ticket.AreaID,
+	}
+}
+
+func postponedPayload(ticket models.Ticket, previousQueuedAt, queuedAt time.Time, places int, delay time.Duration) map[string]interface{} {
+	return map[string]interface{}{
+		"ticket_id":          ticket.TicketID,
+		"ticket_number":      ticket.TicketNumber,
+		"status":             ticket.Status,
+		"request_id":         ticket.RequestID,
+		"created_at":         ticket.CreatedAt,
+		"queued_at":          queuedAt,
+		"previous_queued_at": previousQueuedAt,
+		"postpone_places":    places,
+		"postpone_minutes":   int(delay / time.Minute),
+		"postpone_count":     ticket.PostponeCount,
+		"tenant_id":          ticket.TenantID,
+		"branch_id":          ticket.BranchID,
+		"service_id":         ticket.ServiceID,
+		"area_id":            ticket.AreaID,
+	}
+}
+
+func holdPayload(ticket models.Ticket, expiryAction string) map[string]interface{} {
+	payload := map[string]interface{}{
+		"ticket_id":       ticket.TicketID,
+		"ticket_number":   ticket.TicketNumber,
+		"status":          ticket.Status,
+		"request_id":      ticket.RequestID,
+		"hold_reason":     ticket.HoldReason,
+		"held_at":         ticket.HeldAt,
+		"hold_expires_at": ticket.HoldExpiresAt,
+		"hold_counter_id": ticket.HoldCounterID,
+		"tenant_id":       ticket.TenantID,
+		"branch_id":       ticket.BranchID,
+		"service_id":      ticket.ServiceID,
+		"area_id":         ticket.AreaID,
+	}
+	if expiryAction != "" {
+		payload["expiry_action"] = expiryAction
+	}
+	return payload
+}
+
+func (s *Store) ListOutboxEvents(ctx context.Context, tenantID string, afterSeq int64, limit int) ([]store.OutboxEvent, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []store.OutboxEvent
+	for _, event := range s.outbox {
+		if event.TenantID != tenantID || event.Seq <= afterSeq {
+			continue
+		}
+		events = append(events, event)
+		if len(events) == limit {
+			break
+		}
+	}
+	return events, nil
+}
+
+// ListOutboxConsumers reports no consumers: outbox readers track their
+// offsets in PostgreSQL, so none can read from a memory store.
+func (s *Store) ListOutboxConsumers(ctx context.Context) ([]store.OutboxConsumer, error) {
+	return nil, nil
+}
+
+func (s *Store) ListTicketEvents(ctx context.Context, tenantID, ticketID string) ([]store.TicketEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.tickets[ticketID]
+	if !ok || rec.ticket.TenantID != tenantID {
+		return nil, nil
+	}
+	return append([]store.TicketEvent(nil), s.events[ticketID]...), nil
+}
+
+// VerifyTicketChains walks the event chain of one ticket, or of every tenant
+// ticket with events on input.Day, and compares the day's Merkle root with
+// the sealed digest.
+func (s *Store) VerifyTicketChains(ctx context.Context, input store.ChainVerifyInput) (store.ChainReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.verifyTicketChains(input), nil
+}
+
+func (s *Store) verifyTicketChains(input store.ChainVerifyInput) store.ChainReport {
+	report := store.ChainReport{TenantID: input.TenantID, TicketID: input.TicketID, Issues: []store.ChainIssue{}}
+	var ticketIDs []string
+	if input.TicketID != "" {
+		if rec, ok := s.tickets[input.TicketID]; ok && rec.ticket.TenantID == input.TenantID {
+			ticketIDs = append(ticketIDs, input.TicketID)
+		}
+	} else {
+		dayStart := input.Day.UTC().Truncate(24 * time.Hour)
+		report.Date = dayStart.Format("2006-01-02")
+		for ticketID, chain := range s.events {
+			if rec, ok := s.tickets[ticketID]; !ok || rec.ticket.TenantID != input.TenantID {
+				continue
+			}
+			for _, event := range chain {
+				if inDay(event.CreatedAt, dayStart) {
+					ticketIDs = append(ticketIDs, ticketID)
+					break
+				}
+			}
+		}
+		sort.Strings(ticketIDs)
+	}
+	for _, ticketID := range ticketIDs {
+		chain := s.events[ticketID]
+		if len(chain) == 0 {
+			continue
+		}
+		report.TicketsChecked++
+		report.EventsChecked += len(chain)
+		report.Issues = append(report.Issues, store.VerifyTicketChain(chain)...)
+	}
+	if input.TicketID != "" {
+		return report
+	}
+
+	root, _ := s.dayMerkleRoot(input.TenantID, input.Day)
+	report.MerkleRoot = root
+	if digest, ok := s.digests[input.TenantID+"|"+report.Date]; ok {
+		matches := digest.MerkleRoot == root
+		report.StoredRoot = digest.MerkleRoot
+		report.DigestMatches = &matches
+	}
+	return report
+}
+
+// dayMerkleRoot computes the Merkle root over a tenant's ticket event hashes
+// for one UTC day, ordered by creation time, ticket and sequence.
+func (s *Store) dayMerkleRoot(tenantID string, day time.Time) (string, int) {
+	dayStart := day.UTC().Truncate(24 * time.Hour)
+	var events []store.TicketEvent
+	for ticketID, chain := range s.events {
+		if rec, ok := s.tickets[ticketID]; !ok || rec.ticket.TenantID != tenantID {
+			continue
+		}
+		for _, event := range chain {
+			if inDay(event.CreatedAt, dayStart) {
+				events = append(events, event)
+			}
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].CreatedAt.Equal(events[j].CreatedAt) {
+			return events[i].CreatedAt.Before(events[j].CreatedAt)
+		}
+		if events[i].TicketID != events[j].TicketID {
+			return events[i].TicketID < events[j].TicketID
+		}
+		return events[i].TicketSeq < events[j].TicketSeq
+	})
+	hashes := make([]string, 0, len(events))
+	for _, event := range events {
+		hashes = append(hashes, event.Hash)
+	}
+	return store.MerkleRoot(hashes), len(hashes)
+}
+
+func inDay(at, dayStart time.Time) bool {
+	return !at.Before(dayStart) && at.Before(dayStart.Add(24*time.Hour))
+}
+
+func (s *Store) ListEventDigests(ctx context.Context, tenantID string, from, to time.Time) ([]store.EventDigest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fromDate := from.UTC().Format("2006-01-02")
+	toDate := to.UTC().Format("2006-01-02")
+	var digests []store.EventDigest
+	for _, digest := range s.digests {
+		if digest.TenantID == tenantID && digest.Date >= fromDate && digest.Date <= toDate {
+			digests = append(digests, digest)
+		}
+	}
+	sort.Slice(digests, func(i, j int) bool {
+		return digests[i].Date < digests[j].Date
+	})
+	return digests, nil
+}
+
+// SealEventDigests seals the Merkle root for every tenant with ticket events
+// on day that has no digest yet. Existing digests are never rewritten.
+func (s *Store) SealEventDigests(ctx context.Context, day time.Time) ([]store.EventDigest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dayStart := day.UTC().Truncate(24 * time.Hour)
+	date := dayStart.Format("2006-01-02")
+	tenants := map[string]bool{}
+	for ticketID, chain := range s.events {
+		rec, ok := s.tickets[ticketID]
+		if !ok {
+			continue
+		}
+		for _, event := range chain {
+			if inDay(event.CreatedAt, dayStart) {
+				tenants[rec.ticket.TenantID] = true
+				break
+			}
+		}
+	}
+	tenantIDs := make([]string, 0, len(tenants))
+	for tenantID := range tenants {
+		if _, sealed := s.digests[tenantID+"|"+date]; !sealed {
+			tenantIDs = append(tenantIDs, tenantID)
+		}
+	}
+	sort.Strings(tenantIDs)
+
+	var sealed []store.EventDigest
+	for _, tenantID := range tenantIDs {
+		report := s.verifyTicketChains(store.ChainVerifyInput{TenantID: tenantID, Day: dayStart})
+		root, count := s.dayMerkleRoot(tenantID, dayStart)
+		digest := store.EventDigest{
+			TenantID:    tenantID,
+			Date:        date,
+			EventCount:  count,
+			MerkleRoot:  root,
+			ChainIssues: len(report.Issues),
+			CreatedAt:   now(),
+		}
+		s.digests[tenantID+"|"+date] = digest
+		sealed = append(sealed, digest)
+	}
+	return sealed, nil
+}
+
+// ReplayTickets rebuilds each ticket in scope from its events and reports
+// where the stored ticket has drifted, optionally repairing it.
+func (s *Store) ReplayTickets(ctx context.Context, input store.ReplayInput) (store.ReplayReport, error) {
+	limit := input.Limit
+	if limit <= 0 {
+		limit = store.DefaultReplayLimit
+	}
+	if limit > store.MaxReplayLimit {
+		limit = store.MaxReplayLimit
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := s.collect(func(rec *ticketRecord) bool {
+		t := rec.ticket
+		switch {
+		case t.TenantID != input.TenantID:
+			return false
+		case input.TicketID != "" && t.TicketID != input.TicketID:
+			return false
+		case input.ServiceID != "" && t.ServiceID != input.ServiceID:
+			return false
+		case !input.From.IsZero() && t.CreatedAt.Before(input.From):
+			return false
+		case !input.To.IsZero() && !t.CreatedAt.Before(input.To):
+			return false
+		}
+		return true
+	})
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].ticket.CreatedAt.Equal(records[j].ticket.CreatedAt) {
+			return records[i].ticket.CreatedAt.Before(records[j].ticket.CreatedAt)
+		}
+		return records[i].ticket.TicketID < records[j].ticket.TicketID
+	})
+
+	report := store.ReplayReport{TenantID: input.TenantID, Tickets: []store.TicketDrift{}}
+	if len(records) > limit {
+		records = records[:limit]
+		report.Truncated = true
+	}
+	for _, rec := range records {
+		drift := store.TicketDrift{TicketID: rec.ticket.TicketID, TicketNumber: rec.ticket.TicketNumber}
+		events := s.events[rec.ticket.TicketID]
+		if len(events) == 0 {
+			drift.NoEvents = true
+		} else {
+			rebuilt, err := store.RehydrateTicket(events)
+			if err != nil {
+				return report, err
+			}
+			drift.Fields = store.CompareProjection(rec.ticket, rebuilt)
+			if input.Repair && len(drift.Fields) > 0 {
+				repairProjection(rec, rebuilt, drift.Fields)
+				drift.Repaired = true
+			}
+		}
+		report.TicketsChecked++
+		if !drift.NoEvents && len(drift.Fields) == 0 {
+			continue
+		}
+		report.Drifted++
+		if drift.Repaired {
+			report.Repaired++
+		}
+		report.Tickets = append(report.Tickets, drift)
+	}
+	return report, nil
+}
+
+// repairProjection overwrites only the drifted fields with replayed values.
+func repairProjection(rec *ticketRecord, rebuilt models.Ticket, fields []store.FieldDrift) {
+	for _, field := range fields {
+		switch field.Field {
+		case "status":
+			rec.ticket.Status = rebuilt.Status
+		case "service_id":
+			rec.ticket.ServiceID = rebuilt.ServiceID
+		case "created_at":
+			rec.ticket.CreatedAt = rebuilt.CreatedAt
+		case "called_at":
+			rec.ticket.CalledAt = rebuilt.CalledAt
+		case "served_at":
+			rec.ticket.ServedAt = rebuilt.ServedAt
+		case "completed_at":
+			rec.ticket.CompletedAt = rebuilt.CompletedAt
+		case "counter_id":
+			rec.ticket.CounterID = rebuilt.CounterID
+		}
+	}
+}
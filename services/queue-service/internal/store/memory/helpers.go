@@ -0,0 +1,332 @@
+package memory
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"qms/queue-service/internal/customerref"
+	"qms/queue-service/internal/models"
+	"qms/queue-service/internal/store"
+)
+
+// view returns a copy of the stored ticket as seen by one request.
+func (s *Store) view(rec *ticketRecord, requestID string) models.Ticket {
+	ticket := rec.ticket
+	ticket.RequestID = requestID
+	return ticket
+}
+
+func (s *Store) insertTicket(rec *ticketRecord) {
+	s.nextSeq++
+	rec.seq = s.nextSeq
+	if rec.queuedAt.IsZero() {
+		rec.queuedAt = rec.ticket.CreatedAt
+	}
+	s.tickets[rec.ticket.TicketID] = rec
+	if rec.requestID != "" {
+		s.ticketRequests[rec.requestID] = rec.ticket.TicketID
+	}
+}
+
+func (s *Store) ticketIn(ticketID, tenantID, branchID string) (*ticketRecord, bool) {
+	rec, ok := s.tickets[ticketID]
+	if !ok || rec.ticket.TenantID != tenantID || rec.ticket.BranchID != branchID {
+		return nil, false
+	}
+	return rec, true
+}
+
+// findAction reports whether requestID was already used for action, and
+// whether that earlier attempt found no ticket.
+func (s *Store) findAction(action, requestID string) (models.Ticket, bool, bool) {
+	request, ok := s.actions[requestID]
+	if !ok || request.action != action {
+		return models.Ticket{}, false, false
+	}
+	if request.ticketID == "" {
+		return models.Ticket{}, true, true
+	}
+	rec, ok := s.tickets[request.ticketID]
+	if !ok {
+		return models.Ticket{}, true, true
+	}
+	return s.view(rec, requestID), true, false
+}
+
+// insertAction records a request ID. Like the request_id primary key, the
+// first action to use an ID keeps it.
+func (s *Store) insertAction(action, requestID, ticketID string) {
+	if _, exists := s.actions[requestID]; exists {
+		return
+	}
+	s.actions[requestID] = actionRequest{action: action, ticketID: ticketID}
+}
+
+func (s *Store) activeService(tenantID, branchID, serviceID string) (*serviceRecord, bool) {
+	record, ok := s.services[serviceID]
+	if !ok || !record.active || record.service.BranchID != branchID || record.tenantID != tenantID {
+		return nil, false
+	}
+	return record, true
+}
+
+func (s *Store) counterAllowsService(counterID, serviceID string) bool {
+	record, ok := s.counters[counterID]
+	if !ok || len(record.services) == 0 {
+		return true
+	}
+	return record.services[serviceID]
+}
+
+// reserveCounterResource picks the active resource with the most free places.
+// Counters without resources return an empty resource ID.
+func (s *Store) reserveCounterResource(record *counterRecord) (string, error) {
+	var active []resourceRecord
+	for _, resource := range record.resources {
+		if resource.active {
+			active = append(active, resource)
+		}
+	}
+	if len(active) == 0 {
+		return "", nil
+	}
+	inUse := map[string]int{}
+	for _, rec := range s.tickets {
+		if rec.ticket.ResourceID != nil && isActiveStatus(rec.ticket.Status) {
+			inUse[*rec.ticket.ResourceID]++
+		}
+	}
+	sort.Slice(active, func(i, j int) bool {
+		freeI := active[i].capacity - inUse[active[i].resourceID]
+		freeJ := active[j].capacity - inUse[active[j].resourceID]
+		if freeI != freeJ {
+			return freeI > freeJ
+		}
+		return active[i].name < active[j].name
+	})
+	if active[0].capacity-inUse[active[0].resourceID] <= 0 {
+		return "", store.ErrCounterAtCapacity
+	}
+	return active[0].resourceID, nil
+}
+
+// reopenCounterSlot reports whether a reopened ticket can go back to serving
+// at counterID, and on which resource. The counter must still be open and have
+// a free place: a resource below capacity or, without resources, no other
+// active ticket there.
+func (s *Store) reopenCounterSlot(counterID, branchID, ticketID string) (string, bool) {
+	record, ok := s.counters[counterID]
+	if !ok || record.counter.BranchID != branchID || !isCounterAvailable(record.counter.Status) {
+		return "", false
+	}
+	resourceID, err := s.reserveCounterResource(record)
+	if err != nil || resourceID != "" {
+		return resourceID, err == nil
+	}
+	for _, rec := range s.tickets {
+		if rec.ticket.TicketID != ticketID && rec.ticket.CounterID != nil && *rec.ticket.CounterID == counterID && isActiveStatus(rec.ticket.Status) {
+			return "", false
+		}
+	}
+	return "", true
+}
+
+// counterCapacity is the sum of active resource places, at least one.
+func counterCapacity(record *counterRecord) int {
+	capacity := 0
+	for _, resource := range record.resources {
+		if resource.active {
+			capacity += resource.capacity
+		}
+	}
+	if capacity < 1 {
+		return 1
+	}
+	return capacity
+}
+
+func isActiveStatus(status string) bool {
+	return status == models.StatusCalled || status == models.StatusServing
+}
+
+func (s *Store) policy(tenantID, branchID, serviceID string) (ServicePolicy, bool) {
+	policy, ok := s.policies[scopeKey{tenantID, branchID, serviceID}]
+	return policy, ok
+}
+
+func (s *Store) nextTicketNumber(branchID, serviceID string) int64 {
+	key := branchID + "|" + serviceID
+	s.sequences[key]++
+	return s.sequences[key]
+}
+
+func formatTicketNumber(code string, seq int64) string {
+	return fmt.Sprintf("%s-%0*d", code, ticketNumberPad, seq)
+}
+
+// checkPartyCapacity enforces the service policy's party size cap (or
+// defaultMaxPartySize when the service has no policy) and, when configured,
+// the maximum number of people waiting for the service.
+func (s *Store) checkPartyCapacity(input store.CreateTicketInput, partySize int) error {
+	policy, found := s.policy(input.TenantID, input.BranchID, input.ServiceID)
+	if !found {
+		policy.MaxPartySize = defaultMaxPartySize
+	}
+	if policy.MaxPartySize > 0 && partySize > policy.MaxPartySize {
+		return store.ErrPartyTooLarge
+	}
+	if policy.MaxWaitingPeople <= 0 {
+		return nil
+	}
+	waitingPeople := 0
+	for _, rec := range s.tickets {
+		t := rec.ticket
+		if t.TenantID != input.TenantID || t.BranchID != input.BranchID || t.ServiceID != input.ServiceID {
+			continue
+		}
+		switch t.Status {
+		case models.StatusWaiting, models.StatusHeld, models.StatusRemote:
+			waitingPeople += t.PartySize
+		}
+	}
+	if waitingPeople+partySize > policy.MaxWaitingPeople {
+		return store.ErrCapacityExceeded
+	}
+	return nil
+}
+
+func (s *Store) ensureLinkedTicket(input store.CreateTicketInput) error {
+	rec, ok := s.ticketIn(input.LinkedTicketID, input.TenantID, input.BranchID)
+	if !ok {
+		return store.ErrTicketNotFound
+	}
+	switch rec.ticket.Status {
+	case models.StatusDone, models.StatusCancelled, models.StatusNoShow:
+		return store.ErrInvalidState
+	}
+	return nil
+}
+
+func (s *Store) remoteConfirmWindow(tenantID, branchID, serviceID string) time.Duration {
+	policy, found := s.policy(tenantID, branchID, serviceID)
+	if found && policy.RemoteConfirmSeconds > 0 {
+		return time.Duration(policy.RemoteConfirmSeconds) * time.Second
+	}
+	return s.remoteWindow
+}
+
+func (s *Store) customerRefMode(tenantID string) string {
+	prefs, ok := s.privacy[tenantID]
+	if !ok || prefs.mode == "" {
+		return customerRefOff
+	}
+	return prefs.mode
+}
+
+type tokenisedRef struct {
+	refType string
+	hash    string
+	enc     []byte
+}
+
+// tokeniseCustomerRef applies the tenant's collection mode and returns the
+// hash and encrypted copy to store. The plain value is never kept.
+func (s *Store) tokeniseCustomerRef(tenantID, refType, value string) (tokenisedRef, error) {
+	mode := s.customerRefMode(tenantID)
+	value = strings.TrimSpace(value)
+	if value == "" {
+		if mode == customerRefRequired {
+			return tokenisedRef{}, store.ErrCustomerRefMissing
+		}
+		return tokenisedRef{}, nil
+	}
+	if mode == customerRefOff {
+		return tokenisedRef{}, store.ErrCustomerRefOff
+	}
+	normalizedType, err := customerref.NormalizeType(refType)
+	if err != nil {
+		return tokenisedRef{}, store.ErrCustomerRefInvalid
+	}
+	if customerref.Normalize(value) == "" {
+		return tokenisedRef{}, store.ErrCustomerRefInvalid
+	}
+	hash, err := s.customerRefs.Hash(value)
+	if err != nil {
+		return tokenisedRef{}, store.ErrCustomerRefNoKeys
+	}
+	enc, err := s.customerRefs.Seal(value)
+	if err != nil {
+		if errors.Is(err, customerref.ErrDisabled) {
+			return tokenisedRef{}, store.ErrCustomerRefNoKeys
+		}
+		return tokenisedRef{}, err
+	}
+	return tokenisedRef{refType: normalizedType, hash: hash, enc: enc}, nil
+}
+
+func appointmentTargetCount(ratioPercent int, window int) int {
+	if ratioPercent <= 0 || window <= 0 {
+		return 0
+	}
+	return int(math.Round(float64(ratioPercent) * float64(window) / 100.0))
+}
+
+func nextRoutingState(state routingState, priorityClass string, isAppointment bool, appointmentWindow int) routingState {
+	if priorityClass == "regular" {
+		state.PriorityStreak = 0
+	} else if priorityClass != "" {
+		state.PriorityStreak++
+	}
+	state.TotalServed++
+	if isAppointment {
+		state.AppointmentServed++
+	}
+	if appointmentWindow > 0 && state.TotalServed >= appointmentWindow {
+		state.TotalServed = 0
+		state.AppointmentServed = 0
+	}
+	return state
+}
+
+func hashPhone(phone string) string {
+	trimmed := strings.TrimSpace(phone)
+	if trimmed == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(trimmed))
+	return fmt.Sprintf("%x", sum)
+}
+
+// sortByQueued orders tickets as the queue does: earliest queuedAt first,
+// insertion order breaking ties.
+func sortByQueued(records []*ticketRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].queuedAt.Equal(records[j].queuedAt) {
+			return records[i].queuedAt.Before(records[j].queuedAt)
+		}
+		return records[i].seq < records[j].seq
+	})
+}
+
+func (s *Store) collect(match func(rec *ticketRecord) bool) []*ticketRecord {
+	var records []*ticketRecord
+	for _, rec := range s.tickets {
+		if match(rec) {
+			records = append(records, rec)
+		}
+	}
+	return records
+}
+
+func (s *Store) views(records []*ticketRecord) []models.Ticket {
+	var tickets []models.Ticket
+	for _, rec := range records {
+		tickets = append(tickets, s.view(rec, ""))
+	}
+	return tickets
+}
@@ -0,0 +1,331 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"qms/queue-service/internal/customerref"
+	"qms/queue-service/internal/models"
+	"qms/queue-service/internal/store"
+)
+
+// SearchTickets pages through ticket history newest first using the same
+// keyset cursor as the PostgreSQL store.
+func (s *Store) SearchTickets(ctx context.Context, input store.TicketSearchInput) (store.TicketSearchPage, error) {
+	limit := input.Limit
+	if limit <= 0 {
+		limit = store.DefaultSearchLimit
+	}
+	if limit > store.MaxSearchLimit {
+		limit = store.MaxSearchLimit
+	}
+
+	var cursorAt time.Time
+	var cursorID string
+	if input.Cursor != "" {
+		var err error
+		cursorAt, cursorID, err = store.DecodeSearchCursor(input.Cursor)
+		if err != nil {
+			return store.TicketSearchPage{}, err
+		}
+	}
+	refHash := ""
+	if input.CustomerRef != "" {
+		var err error
+		if refHash, err = s.customerRefs.Hash(input.CustomerRef); err != nil {
+			return store.TicketSearchPage{}, store.ErrCustomerRefNoKeys
+		}
+	}
+	phoneHash := hashPhone(input.Phone)
+	services := toSet(input.ServiceIDs)
+	statuses := toSet(input.Statuses)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := s.collect(func(rec *ticketRecord) bool {
+		t := rec.ticket
+		switch {
+		case t.TenantID != input.TenantID || t.BranchID != input.BranchID:
+			return false
+		case len(services) > 0 && !services[t.ServiceID]:
+			return false
+		case input.TicketNumber != "" && t.TicketNumber != input.TicketNumber:
+			return false
+		case len(statuses) > 0 && !statuses[t.Status]:
+			return false
+		case input.Channel != "" && t.Channel != input.Channel:
+			return false
+		case input.PriorityClass != "" && t.PriorityClass != input.PriorityClass:
+			return false
+		case input.CounterID != "" && (t.CounterID == nil || *t.CounterID != input.CounterID):
+			return false
+		case !input.From.IsZero() && t.CreatedAt.Before(input.From):
+			return false
+		case !input.To.IsZero() && !t.CreatedAt.Before(input.To):
+			return false
+		case phoneHash != "" && rec.phoneHash != phoneHash:
+			return false
+		case refHash != "" && rec.refHash != refHash:
+			return false
+		case cursorID != "" && !searchBefore(t, cursorAt, cursorID):
+			return false
+		}
+		return true
+	})
+	sort.Slice(records, func(i, j int) bool {
+		return searchBefore(records[j].ticket, records[i].ticket.CreatedAt, records[i].ticket.TicketID)
+	})
+
+	page := store.TicketSearchPage{Tickets: []models.Ticket{}}
+	for _, rec := range records {
+		page.Tickets = append(page.Tickets, s.view(rec, ""))
+	}
+	if len(page.Tickets) > limit {
+		page.Tickets = page.Tickets[:limit]
+		last := page.Tickets[limit-1]
+		page.NextCursor = store.EncodeSearchCursor(last.CreatedAt, last.TicketID)
+	}
+	return page, nil
+}
+
+// searchBefore reports whether ticket sorts after (createdAt, ticketID) in
+// the newest-first search order.
+func searchBefore(ticket models.Ticket, createdAt time.Time, ticketID string) bool {
+	if !ticket.CreatedAt.Equal(createdAt) {
+		return ticket.CreatedAt.Before(createdAt)
+	}
+	return ticket.TicketID < ticketID
+}
+
+func toSet(values []string) map[string]bool {
+	set := map[string]bool{}
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
+
+func (s *Store) ListCounters(ctx context.Context, tenantID, branchID string) ([]models.Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var counters []models.Counter
+	for _, record := range s.counters {
+		if record.counter.BranchID != branchID || s.branches[branchID] != tenantID {
+			continue
+		}
+		counter := record.counter
+		counter.Capacity = counterCapacity(record)
+		counter.InUse = 0
+		for _, rec := range s.tickets {
+			if rec.ticket.CounterID != nil && *rec.ticket.CounterID == counter.CounterID && isActiveStatus(rec.ticket.Status) {
+				counter.InUse++
+			}
+		}
+		counters = append(counters, counter)
+	}
+	sort.Slice(counters, func(i, j int) bool {
+		return counters[i].Name < counters[j].Name
+	})
+	return counters, nil
+}
+
+func (s *Store) UpdateCounterStatus(ctx context.Context, tenantID, branchID, counterID, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.counters[counterID]
+	if !ok || record.counter.BranchID != branchID || s.branches[branchID] != tenantID {
+		return store.ErrCounterNotFound
+	}
+	record.counter.Status = status
+	return nil
+}
+
+func (s *Store) BranchLocation(ctx context.Context, tenantID, branchID string) (*time.Location, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if loc, ok := s.locations[branchID]; ok && s.branches[branchID] == tenantID {
+		return loc, nil
+	}
+	return time.UTC, nil
+}
+
+func (s *Store) ListServices(ctx context.Context, tenantID, branchID string) ([]models.Service, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var services []models.Service
+	for serviceID, record := range s.services {
+		if !record.active || record.service.BranchID != branchID || record.tenantID != tenantID {
+			continue
+		}
+		service := record.service
+		service.ParallelCapacity = 0
+		for _, counter := range s.counters {
+			if !counter.services[serviceID] {
+				continue
+			}
+			switch counter.counter.Status {
+			case "active", "available", "busy":
+				service.ParallelCapacity += counterCapacity(counter)
+			}
+		}
+		if service.ParallelCapacity < 1 {
+			service.ParallelCapacity = 1
+		}
+		services = append(services, service)
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Name < services[j].Name
+	})
+	return services, nil
+}
+
+// GetCustomerRef decrypts a ticket's customer reference for display. Tickets
+// without a reference return an empty value.
+func (s *Store) GetCustomerRef(ctx context.Context, tenantID, branchID, ticketID string) (store.CustomerRef, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.ticketIn(ticketID, tenantID, branchID)
+	if !ok {
+		return store.CustomerRef{}, store.ErrTicketNotFound
+	}
+	ref := store.CustomerRef{TicketID: ticketID, Type: rec.ticket.CustomerRefType}
+	if len(rec.refEnc) == 0 {
+		return ref, nil
+	}
+	value, err := s.customerRefs.Open(rec.refEnc)
+	if err != nil {
+		if errors.Is(err, customerref.ErrDisabled) {
+			return store.CustomerRef{}, store.ErrCustomerRefNoKeys
+		}
+		return store.CustomerRef{}, err
+	}
+	ref.Value = value
+	return ref, nil
+}
+
+func (s *Store) RecordAudit(ctx context.Context, entry store.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.audits = append(s.audits, entry)
+	return nil
+}
+
+// PurgeCustomerRef erases every stored copy of a reference for the tenant and
+// returns the tickets and appointments touched.
+func (s *Store) PurgeCustomerRef(ctx context.Context, tenantID, value string) (int, error) {
+	hash, err := s.customerRefs.Hash(strings.TrimSpace(value))
+	if err != nil {
+		return 0, store.ErrCustomerRefNoKeys
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := 0
+	for _, rec := range s.tickets {
+		if rec.ticket.TenantID == tenantID && rec.refHash == hash {
+			clearTicketRef(rec)
+			purged++
+		}
+	}
+	for _, appointment := range s.appointments {
+		if appointment.appointment.TenantID == tenantID && appointment.refHash == hash {
+			clearAppointmentRef(appointment)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// PurgeExpiredCustomerRefs clears references older than the tenant's
+// retention period from finished tickets and past appointments.
+func (s *Store) PurgeExpiredCustomerRefs(ctx context.Context, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := time.Now().UTC()
+	expired := func(tenantID string, at time.Time) bool {
+		prefs, ok := s.privacy[tenantID]
+		return ok && prefs.retentionDays > 0 && at.Before(current.AddDate(0, 0, -prefs.retentionDays))
+	}
+
+	tickets := 0
+	for _, rec := range s.tickets {
+		if tickets >= batchSize {
+			break
+		}
+		switch rec.ticket.Status {
+		case models.StatusDone, models.StatusCancelled, models.StatusNoShow:
+		default:
+			continue
+		}
+		if rec.refHash != "" && expired(rec.ticket.TenantID, rec.ticket.CreatedAt) {
+			clearTicketRef(rec)
+			tickets++
+		}
+	}
+	appointments := 0
+	for _, appointment := range s.appointments {
+		if appointments >= batchSize {
+			break
+		}
+		if appointment.status != "scheduled" && appointment.refHash != "" && expired(appointment.appointment.TenantID, appointment.appointment.ScheduledAt) {
+			clearAppointmentRef(appointment)
+			appointments++
+		}
+	}
+	return tickets + appointments, nil
+}
+
+func clearTicketRef(rec *ticketRecord) {
+	rec.ticket.CustomerRefType = ""
+	rec.refHash = ""
+	rec.refEnc = nil
+}
+
+func clearAppointmentRef(appointment *appointmentRecord) {
+	appointment.refType = ""
+	appointment.refHash = ""
+	appointment.refEnc = nil
+}
+
+func (s *Store) GetSession(ctx context.Context, sessionID string) (store.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[sessionID]
+	if !ok || !session.ExpiresAt.After(time.Now()) {
+		return store.Session{}, store.ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (s *Store) GetAccess(ctx context.Context, userID string) ([]string, []string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	access := s.access[userID]
+	return append([]string(nil), access.branches...), append([]string(nil), access.services...), nil
+}
+
+// AcquireLease always succeeds: a memory store lives in one process, so
+// there is no other replica to coordinate with.
+func (s *Store) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (s *Store) ReleaseLease(ctx context.Context, name, holder string) error {
+	return nil
+}
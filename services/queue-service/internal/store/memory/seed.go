@@ -0,0 +1,76 @@
+package memory
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"qms/queue-service/internal/models"
+	"qms/queue-service/internal/store"
+)
+
+// Seed is the JSON reference data loaded into a memory store at startup, so
+// the service can run locally without the admin service or a database.
+type Seed struct {
+	Branches []struct {
+		TenantID string `json:"tenant_id"`
+		BranchID string `json:"branch_id"`
+	} `json:"branches"`
+	Services []models.Service `json:"services"`
+	Counters []struct {
+		models.Counter
+		ServiceIDs []string `json:"service_ids"`
+	} `json:"counters"`
+	Sessions []struct {
+		SessionID string    `json:"session_id"`
+		UserID    string    `json:"user_id"`
+		TenantID  string    `json:"tenant_id"`
+		Role      string    `json:"role"`
+		ExpiresAt time.Time `json:"expires_at"`
+	} `json:"sessions"`
+	Access []struct {
+		UserID   string   `json:"user_id"`
+		Branches []string `json:"branches"`
+		Services []string `json:"services"`
+	} `json:"access"`
+}
+
+// LoadSeedFile reads a Seed from path and applies it. Sessions without an
+// expiry are valid for a year.
+func (s *Store) LoadSeedFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var seed Seed
+	if err := json.Unmarshal(data, &seed); err != nil {
+		return err
+	}
+
+	for _, branch := range seed.Branches {
+		s.AddBranch(branch.TenantID, branch.BranchID)
+	}
+	for _, service := range seed.Services {
+		s.AddService(service)
+	}
+	for _, counter := range seed.Counters {
+		s.AddCounter(counter.Counter, counter.ServiceIDs...)
+	}
+	for _, session := range seed.Sessions {
+		expiresAt := session.ExpiresAt
+		if expiresAt.IsZero() {
+			expiresAt = time.Now().AddDate(1, 0, 0)
+		}
+		s.AddSession(store.Session{
+			SessionID: session.SessionID,
+			UserID:    session.UserID,
+			TenantID:  session.TenantID,
+			Role:      session.Role,
+			ExpiresAt: expiresAt,
+		})
+	}
+	for _, access := range seed.Access {
+		s.SetAccess(access.UserID, access.Branches, access.Services)
+	}
+	return nil
+}
@@ -0,0 +1,398 @@
+// Package memory is an in-process implementation of store.TicketStore for
+// local development and tests. It follows the PostgreSQL store's rules for
+// request idempotency, status transitions, routing and the outbox, keeping
+// all state in maps behind a single mutex. Nothing survives a restart.
+package memory
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"qms/queue-service/internal/customerref"
+	"qms/queue-service/internal/models"
+	"qms/queue-service/internal/store"
+)
+
+const ticketNumberPad = 3
+
+const (
+	defaultHoldDuration = 15 * time.Minute
+	defaultMaxRecalls   = 3
+	defaultReopenWindow = 15 * time.Minute
+	defaultRemoteWindow = 2 * time.Hour
+
+	defaultMaxPostpones       = 1
+	defaultMaxPostponePlaces  = 5
+	defaultMaxPostponeMinutes = 30
+
+	defaultMaxPartySize = 10
+
+	defaultAppointmentWindow = 10
+)
+
+const (
+	customerRefOff      = "off"
+	customerRefOptional = "optional"
+	customerRefRequired = "required"
+)
+
+// Options mirrors postgres.Options so both stores are configured the same way.
+type Options struct {
+	NoShowReturnToQueue bool
+	PriorityStreakLimit int
+	HoldDuration        time.Duration
+	HoldExpiryAction    string
+	MaxRecalls          int
+	MinRecallInterval   time.Duration
+	ReopenWindow        time.Duration
+	RemoteWindow        time.Duration
+	CustomerRefs        *customerref.Tokenizer
+}
+
+// ServicePolicy holds the per-service overrides stored in service_policies.
+// A service without a policy uses the store options.
+type ServicePolicy struct {
+	NoShowGraceSeconds       int
+	ReturnToQueue            bool
+	AppointmentRatioPercent  int
+	AppointmentWindowSize    int
+	AppointmentBoostMinutes  int
+	HoldMaxSeconds           int
+	HoldExpiryAction         string
+	MaxRecalls               int
+	MinRecallIntervalSeconds int
+	MaxPartySize             int
+	MaxWaitingPeople         int
+	RemoteConfirmSeconds     int
+	RemoteKeepPlaceSeconds   int
+	MaxPostpones             int
+	MaxPostponePlaces        int
+	MaxPostponeMinutes       int
+}
+
+// Appointment is a scheduled visit that can be checked in as a ticket.
+type Appointment struct {
+	AppointmentID   string
+	TenantID        string
+	BranchID        string
+	ServiceID       string
+	ScheduledAt     time.Time
+	CustomerRef     string
+	CustomerRefType string
+}
+
+type serviceRecord struct {
+	tenantID string
+	service  models.Service
+	active   bool
+}
+
+type resourceRecord struct {
+	resourceID string
+	name       string
+	capacity   int
+	active     bool
+}
+
+type counterRecord struct {
+	counter   models.Counter
+	services  map[string]bool
+	resources []resourceRecord
+}
+
+type appointmentRecord struct {
+	appointment Appointment
+	status      string
+	refType     string
+	refHash     string
+	refEnc      []byte
+}
+
+// ticketRecord is a row of the tickets table. The embedded ticket never
+// carries a request ID or raw phone number; those are filled in per call.
+type ticketRecord struct {
+	ticket        models.Ticket
+	requestID     string
+	appointmentID string
+	phoneHash     string
+	refHash       string
+	refEnc        []byte
+	returned      bool
+	reopenCount   int
+	seq           int64
+	// queuedAt orders the queue. It starts at the ticket's CreatedAt and
+	// moves on late arrival or postpone; CreatedAt itself never changes.
+	queuedAt time.Time
+}
+
+type scopeKey struct {
+	tenantID  string
+	branchID  string
+	serviceID string
+}
+
+type routingState struct {
+	PriorityStreak    int
+	AppointmentServed int
+	TotalServed       int
+}
+
+type actionRequest struct {
+	action   string
+	ticketID string
+}
+
+type privacyPrefs struct {
+	mode          string
+	retentionDays int
+}
+
+type userAccess struct {
+	branches []string
+	services []string
+}
+
+type Store struct {
+	mu sync.Mutex
+
+	noShowReturnToQueue bool
+	priorityStreakLimit int
+	holdDuration        time.Duration
+	holdExpiryAction    string
+	maxRecalls          int
+	minRecallInterval   time.Duration
+	reopenWindow        time.Duration
+	remoteWindow        time.Duration
+	customerRefs        *customerref.Tokenizer
+
+	branches     map[string]string
+	locations    map[string]*time.Location
+	services     map[string]*serviceRecord
+	counters     map[string]*counterRecord
+	policies     map[scopeKey]ServicePolicy
+	routing      map[scopeKey]routingState
+	sequences    map[string]int64
+	appointments map[string]*appointmentRecord
+	holidays     map[string]bool
+	privacy      map[string]privacyPrefs
+	sessions     map[string]store.Session
+	access       map[string]userAccess
+
+	tickets        map[string]*ticketRecord
+	ticketRequests map[string]string
+	actions        map[string]actionRequest
+	nextSeq        int64
+
+	outbox  []store.OutboxEvent
+	events  map[string][]store.TicketEvent
+	digests map[string]store.EventDigest
+	audits  []store.AuditEntry
+}
+
+func NewStore(options Options) *Store {
+	limit := options.PriorityStreakLimit
+	if limit <= 0 {
+		limit = 3
+	}
+	holdDuration := options.HoldDuration
+	if holdDuration <= 0 {
+		holdDuration = defaultHoldDuration
+	}
+	maxRecalls := options.MaxRecalls
+	if maxRecalls <= 0 {
+		maxRecalls = defaultMaxRecalls
+	}
+	reopenWindow := options.ReopenWindow
+	if reopenWindow <= 0 {
+		reopenWindow = defaultReopenWindow
+	}
+	remoteWindow := options.RemoteWindow
+	if remoteWindow <= 0 {
+		remoteWindow = defaultRemoteWindow
+	}
+	return &Store{
+		noShowReturnToQueue: options.NoShowReturnToQueue,
+		priorityStreakLimit: limit,
+		holdDuration:        holdDuration,
+		holdExpiryAction:    normalizeHoldExpiryAction(options.HoldExpiryAction),
+		maxRecalls:          maxRecalls,
+		minRecallInterval:   options.MinRecallInterval,
+		reopenWindow:        reopenWindow,
+		remoteWindow:        remoteWindow,
+		customerRefs:        options.CustomerRefs,
+
+		branches:       map[string]string{},
+		locations:      map[string]*time.Location{},
+		services:       map[string]*serviceRecord{},
+		counters:       map[string]*counterRecord{},
+		policies:       map[scopeKey]ServicePolicy{},
+		routing:        map[scopeKey]routingState{},
+		sequences:      map[string]int64{},
+		appointments:   map[string]*appointmentRecord{},
+		holidays:       map[string]bool{},
+		privacy:        map[string]privacyPrefs{},
+		sessions:       map[string]store.Session{},
+		access:         map[string]userAccess{},
+		tickets:        map[string]*ticketRecord{},
+		ticketRequests: map[string]string{},
+		actions:        map[string]actionRequest{},
+		events:         map[string][]store.TicketEvent{},
+		digests:        map[string]store.EventDigest{},
+	}
+}
+
+// AddBranch registers a branch under a tenant.
+func (s *Store) AddBranch(tenantID, branchID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.branches[branchID] = tenantID
+}
+
+// SetBranchLocation sets the time zone of a branch; branches default to UTC.
+func (s *Store) SetBranchLocation(branchID string, loc *time.Location) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.locations[branchID] = loc
+}
+
+// AddService registers an active service. The branch must be added first.
+func (s *Store) AddService(service models.Service) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.services[service.ServiceID] = &serviceRecord{tenantID: s.branches[service.BranchID], service: service, active: true}
+}
+
+// SetServiceActive enables or disables a service.
+func (s *Store) SetServiceActive(serviceID string, active bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if record, ok := s.services[serviceID]; ok {
+		record.active = active
+	}
+}
+
+// AddCounter registers a counter. A counter mapped to no services may serve
+// every service, as with an empty counter_services table.
+func (s *Store) AddCounter(counter models.Counter, serviceIDs ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record := &counterRecord{counter: counter, services: map[string]bool{}}
+	for _, serviceID := range serviceIDs {
+		record.services[serviceID] = true
+	}
+	s.counters[counter.CounterID] = record
+}
+
+// AddResource attaches an active resource (chair, room) to a counter.
+func (s *Store) AddResource(counterID, resourceID, name string, capacity int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.counters[counterID]
+	if !ok {
+		return
+	}
+	if capacity <= 0 {
+		capacity = 1
+	}
+	record.resources = append(record.resources, resourceRecord{resourceID: resourceID, name: name, capacity: capacity, active: true})
+}
+
+// SetServicePolicy stores the policy for a service, replacing any previous one.
+func (s *Store) SetServicePolicy(tenantID, branchID, serviceID string, policy ServicePolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policies[scopeKey{tenantID, branchID, serviceID}] = policy
+}
+
+// SetPrivacyPrefs sets the tenant's customer reference mode and retention.
+func (s *Store) SetPrivacyPrefs(tenantID, mode string, retentionDays int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.privacy[tenantID] = privacyPrefs{mode: mode, retentionDays: retentionDays}
+}
+
+// AddAppointment stores a scheduled appointment. A customer reference is
+// tokenised as on insert through the admin service; without keys it is
+// dropped.
+func (s *Store) AddAppointment(appointment Appointment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record := &appointmentRecord{appointment: appointment, status: "scheduled"}
+	if value := strings.TrimSpace(appointment.CustomerRef); value != "" && s.customerRefs != nil {
+		refType, err := customerref.NormalizeType(appointment.CustomerRefType)
+		if err != nil {
+			refType = customerref.TypeOther
+		}
+		record.refType = refType
+		record.refHash, _ = s.customerRefs.Hash(value)
+		record.refEnc, _ = s.customerRefs.Seal(value)
+	}
+	record.appointment.CustomerRef = ""
+	s.appointments[appointment.AppointmentID] = record
+}
+
+// AddHoliday closes a branch for the given date.
+func (s *Store) AddHoliday(tenantID, branchID string, date time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.holidays[holidayKey(tenantID, branchID, date)] = true
+}
+
+// AddSession registers a staff session for GetSession.
+func (s *Store) AddSession(session store.Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[session.SessionID] = session
+}
+
+// SetAccess sets the branches and services a user may act on.
+func (s *Store) SetAccess(userID string, branches, services []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.access[userID] = userAccess{branches: append([]string(nil), branches...), services: append([]string(nil), services...)}
+}
+
+func holidayKey(tenantID, branchID string, date time.Time) string {
+	return tenantID + "|" + branchID + "|" + date.UTC().Format("2006-01-02")
+}
+
+func normalizeAppointmentWindow(value int) int {
+	if value <= 0 {
+		return defaultAppointmentWindow
+	}
+	return value
+}
+
+func normalizeHoldExpiryAction(value string) string {
+	if strings.ToLower(strings.TrimSpace(value)) == models.HoldExpiryCancel {
+		return models.HoldExpiryCancel
+	}
+	return models.HoldExpiryReturn
+}
+
+func isCounterAvailable(status string) bool {
+	switch strings.ToLower(strings.TrimSpace(status)) {
+	case "", "active", "available", "busy":
+		return true
+	default:
+		return false
+	}
+}
+
+// stamp truncates to microseconds, the precision PostgreSQL keeps.
+func stamp(value time.Time) time.Time {
+	return value.UTC().Truncate(time.Microsecond)
+}
+
+func timePtr(value time.Time) *time.Time {
+	return &value
+}
+
+func stringPtr(value string) *string {
+	return &value
+}
+
+func now() time.Time {
+	return stamp(time.Now())
+}
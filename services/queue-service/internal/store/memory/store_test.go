@@ -0,0 +1,66 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"qms/queue-service/internal/models"
+	"qms/queue-service/internal/store/storetest"
+
+	"github.com/google/uuid"
+)
+
+type harness struct {
+	st *Store
+}
+
+func (h *harness) Store() storetest.Store {
+	return h.st
+}
+
+func (h *harness) Seed(t *testing.T) storetest.Fixture {
+	fx := storetest.Fixture{
+		TenantID:  uuid.NewString(),
+		BranchID:  uuid.NewString(),
+		ServiceID: uuid.NewString(),
+		CounterA:  uuid.NewString(),
+		CounterB:  uuid.NewString(),
+	}
+	h.st.AddBranch(fx.TenantID, fx.BranchID)
+	h.st.AddService(models.Service{ServiceID: fx.ServiceID, BranchID: fx.BranchID, Name: "Service", Code: "SV"})
+	h.st.AddCounter(models.Counter{CounterID: fx.CounterA, BranchID: fx.BranchID, Name: "Counter A", Status: "active"}, fx.ServiceID)
+	h.st.AddCounter(models.Counter{CounterID: fx.CounterB, BranchID: fx.BranchID, Name: "Counter B", Status: "active"}, fx.ServiceID)
+	return fx
+}
+
+func (h *harness) AddService(t *testing.T, fx storetest.Fixture, code string) string {
+	serviceID := uuid.NewString()
+	h.st.AddService(models.Service{ServiceID: serviceID, BranchID: fx.BranchID, Name: "Service " + code, Code: code})
+	return serviceID
+}
+
+func (h *harness) SetPolicy(t *testing.T, fx storetest.Fixture, serviceID string, policy storetest.Policy) {
+	h.st.SetServicePolicy(fx.TenantID, fx.BranchID, serviceID, ServicePolicy(policy))
+}
+
+func (h *harness) AddAppointment(t *testing.T, fx storetest.Fixture, serviceID string, scheduledAt time.Time) string {
+	appointmentID := uuid.NewString()
+	h.st.AddAppointment(Appointment{
+		AppointmentID: appointmentID,
+		TenantID:      fx.TenantID,
+		BranchID:      fx.BranchID,
+		ServiceID:     serviceID,
+		ScheduledAt:   scheduledAt,
+	})
+	return appointmentID
+}
+
+func (h *harness) AddResource(t *testing.T, fx storetest.Fixture, counterID string, capacity int) {
+	h.st.AddResource(counterID, uuid.NewString(), "Room 1", capacity)
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Harness {
+		return &harness{st: NewStore(Options{NoShowReturnToQueue: false, PriorityStreakLimit: 3})}
+	})
+}
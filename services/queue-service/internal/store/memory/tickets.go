@@ -0,0 +1,1065 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"qms/queue-service/internal/models"
+	"qms/queue-service/internal/store"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) CreateTicket(ctx context.Context, input store.CreateTicketInput) (models.Ticket, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ticketID, ok := s.ticketRequests[input.RequestID]; ok {
+		return s.view(s.tickets[ticketID], input.RequestID), false, nil
+	}
+
+	service, ok := s.activeService(input.TenantID, input.BranchID, input.ServiceID)
+	if !ok {
+		return models.Ticket{}, false, store.ErrServiceNotFound
+	}
+	partySize := input.PartySize
+	if partySize <= 0 {
+		partySize = 1
+	}
+	if err := s.checkPartyCapacity(input, partySize); err != nil {
+		return models.Ticket{}, false, err
+	}
+	if input.LinkedTicketID != "" {
+		if err := s.ensureLinkedTicket(input); err != nil {
+			return models.Ticket{}, false, err
+		}
+	}
+	ref, err := s.tokeniseCustomerRef(input.TenantID, input.CustomerRefType, input.CustomerRef)
+	if err != nil {
+		return models.Ticket{}, false, err
+	}
+
+	createdAt := stamp(input.CreatedAt)
+	if input.CreatedAt.IsZero() {
+		createdAt = now()
+	}
+	// Remote joiners hold a place from the moment they join but stay out of
+	// call-next until they confirm arrival on site.
+	status := models.StatusWaiting
+	var remoteExpiresAt *time.Time
+	if input.Remote {
+		status = models.StatusRemote
+		remoteExpiresAt = timePtr(createdAt.Add(s.remoteConfirmWindow(input.TenantID, input.BranchID, input.ServiceID)))
+	}
+
+	rec := &ticketRecord{
+		ticket: models.Ticket{
+			TicketID:        uuid.NewString(),
+			TicketNumber:    formatTicketNumber(service.service.Code, s.nextTicketNumber(input.BranchID, input.ServiceID)),
+			TenantID:        input.TenantID,
+			BranchID:        input.BranchID,
+			ServiceID:       input.ServiceID,
+			AreaID:          input.AreaID,
+			Status:          status,
+			Channel:         input.Channel,
+			PriorityClass:   input.PriorityClass,
+			CreatedAt:       createdAt,
+			PartySize:       partySize,
+			RemoteExpiresAt: remoteExpiresAt,
+			CustomerRefType: ref.refType,
+		},
+		requestID: input.RequestID,
+		phoneHash: hashPhone(input.Phone),
+		refHash:   ref.hash,
+		refEnc:    ref.enc,
+	}
+	if input.LinkedTicketID != "" {
+		rec.ticket.LinkedTicketID = stringPtr(input.LinkedTicketID)
+	}
+	s.insertTicket(rec)
+
+	ticket := s.view(rec, input.RequestID)
+	ticket.Phone = input.Phone
+	if err := s.emit(input.TenantID, "ticket.created", ticket.TicketID, createdPayload(ticket, nil)); err != nil {
+		return models.Ticket{}, false, err
+	}
+	return ticket, true, nil
+}
+
+func (s *Store) GetTicket(ctx context.Context, tenantID, branchID, ticketID string) (models.Ticket, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.ticketIn(ticketID, tenantID, branchID)
+	if !ok {
+		return models.Ticket{}, false, store.ErrTicketNotFound
+	}
+	return s.view(rec, ""), true, nil
+}
+
+func (s *Store) ListQueue(ctx context.Context, tenantID, branchID, serviceID string) ([]models.Ticket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := s.collect(func(rec *ticketRecord) bool {
+		t := rec.ticket
+		if t.TenantID != tenantID || t.BranchID != branchID || (serviceID != "" && t.ServiceID != serviceID) {
+			return false
+		}
+		return t.Status == models.StatusWaiting || t.Status == models.StatusHeld
+	})
+	sortByQueued(records)
+	return s.views(records), nil
+}
+
+func (s *Store) CallNext(ctx context.Context, input store.CallNextInput) (models.Ticket, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, found, empty := s.findAction("call_next", input.RequestID); found {
+		if empty {
+			return models.Ticket{}, false, store.ErrNoTicket
+		}
+		return existing, false, nil
+	}
+
+	if _, ok := s.activeService(input.TenantID, input.BranchID, input.ServiceID); !ok {
+		return models.Ticket{}, false, store.ErrServiceNotFound
+	}
+	if !s.counterAllowsService(input.CounterID, input.ServiceID) {
+		return models.Ticket{}, false, store.ErrAccessDenied
+	}
+	counter, ok := s.counters[input.CounterID]
+	if !ok || counter.counter.BranchID != input.BranchID {
+		return models.Ticket{}, false, store.ErrCounterNotFound
+	}
+	if !isCounterAvailable(counter.counter.Status) {
+		return models.Ticket{}, false, store.ErrCounterUnavailable
+	}
+	resourceID, err := s.reserveCounterResource(counter)
+	if err != nil {
+		return models.Ticket{}, false, err
+	}
+
+	calledAt := stamp(input.CalledAt)
+	if input.CalledAt.IsZero() {
+		calledAt = now()
+	}
+
+	key := scopeKey{input.TenantID, input.BranchID, input.ServiceID}
+	state := s.routing[key]
+	preferRegular := state.PriorityStreak >= s.priorityStreakLimit
+	policy, _ := s.policy(input.TenantID, input.BranchID, input.ServiceID)
+	appointmentWindow := normalizeAppointmentWindow(policy.AppointmentWindowSize)
+	appointmentTarget := appointmentTargetCount(policy.AppointmentRatioPercent, appointmentWindow)
+	if state.TotalServed >= appointmentWindow {
+		state.TotalServed = 0
+		state.AppointmentServed = 0
+	}
+	preferAppointment := policy.AppointmentRatioPercent > 0 && state.AppointmentServed < appointmentTarget
+	boostCutoff := time.Time{}
+	if policy.AppointmentBoostMinutes > 0 {
+		boostCutoff = calledAt.Add(time.Duration(policy.AppointmentBoostMinutes) * time.Minute)
+	}
+
+	input.CalledAt = calledAt
+	rec, isAppointment := s.nextTicket(input, preferRegular, preferAppointment, boostCutoff)
+	if rec == nil {
+		s.insertAction("call_next", input.RequestID, "")
+		return models.Ticket{}, false, store.ErrNoTicket
+	}
+
+	rec.ticket.Status = models.StatusCalled
+	rec.ticket.CounterID = stringPtr(input.CounterID)
+	rec.ticket.CalledAt = timePtr(calledAt)
+	if resourceID != "" {
+		rec.ticket.ResourceID = stringPtr(resourceID)
+	}
+	s.insertAction("call_next", input.RequestID, rec.ticket.TicketID)
+	s.routing[key] = nextRoutingState(state, rec.ticket.PriorityClass, isAppointment, appointmentWindow)
+
+	ticket := s.view(rec, input.RequestID)
+	if err := s.emit(input.TenantID, "ticket.called", ticket.TicketID, calledPayload(ticket)); err != nil {
+		return models.Ticket{}, false, err
+	}
+	return ticket, true, nil
+}
+
+// nextTicket applies the routing order: boosted appointments, appointments
+// owed by the blending ratio, walk-ins, then any remaining appointment.
+func (s *Store) nextTicket(input store.CallNextInput, preferRegular, preferAppointment bool, boostCutoff time.Time) (*ticketRecord, bool) {
+	if !boostCutoff.IsZero() {
+		if rec := s.nextWaiting(input, true, boostCutoff, preferRegular); rec != nil {
+			return rec, true
+		}
+	}
+	if preferAppointment {
+		if rec := s.nextWaiting(input, true, time.Time{}, preferRegular); rec != nil {
+			return rec, true
+		}
+	}
+	if rec := s.nextWaiting(input, false, time.Time{}, preferRegular); rec != nil {
+		return rec, false
+	}
+	if rec := s.nextWaiting(input, true, time.Time{}, preferRegular); rec != nil {
+		return rec, true
+	}
+	return nil, false
+}
+
+// nextWaiting returns the first waiting walk-in or appointment ticket,
+// trying the preferred priority classes before falling back to any class.
+// Appointments are ordered by scheduled time, walk-ins by queue time.
+// Tickets postponed past input.CalledAt are skipped.
+func (s *Store) nextWaiting(input store.CallNextInput, appointments bool, cutoff time.Time, preferRegular bool) *ticketRecord {
+	candidates := s.collect(func(rec *ticketRecord) bool {
+		t := rec.ticket
+		if t.TenantID != input.TenantID || t.BranchID != input.BranchID || t.ServiceID != input.ServiceID || t.Status != models.StatusWaiting {
+			return false
+		}
+		if rec.queuedAt.After(input.CalledAt) {
+			return false
+		}
+		if !appointments {
+			return rec.appointmentID == ""
+		}
+		appointment, ok := s.appointments[rec.appointmentID]
+		if !ok {
+			return false
+		}
+		return cutoff.IsZero() || !appointment.appointment.ScheduledAt.After(cutoff)
+	})
+	if appointments {
+		sort.Slice(candidates, func(i, j int) bool {
+			a := s.appointments[candidates[i].appointmentID].appointment.ScheduledAt
+			b := s.appointments[candidates[j].appointmentID].appointment.ScheduledAt
+			if !a.Equal(b) {
+				return a.Before(b)
+			}
+			if !candidates[i].queuedAt.Equal(candidates[j].queuedAt) {
+				return candidates[i].queuedAt.Before(candidates[j].queuedAt)
+			}
+			return candidates[i].seq < candidates[j].seq
+		})
+	} else {
+		sortByQueued(candidates)
+	}
+	for _, rec := range candidates {
+		if (rec.ticket.PriorityClass == "regular") == preferRegular {
+			return rec
+		}
+	}
+	if len(candidates) > 0 {
+		return candidates[0]
+	}
+	return nil
+}
+
+func (s *Store) AutoNoShow(ctx context.Context, grace time.Duration, batchSize int) (int, error) {
+	if grace <= 0 {
+		return 0, nil
+	}
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().UTC().Add(-grace)
+	items := s.collect(func(rec *ticketRecord) bool {
+		return rec.ticket.Status == models.StatusCalled && rec.ticket.CalledAt != nil && !rec.ticket.CalledAt.After(cutoff)
+	})
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].ticket.CalledAt.Before(*items[j].ticket.CalledAt)
+	})
+	if len(items) > batchSize {
+		items = items[:batchSize]
+	}
+
+	processed := 0
+	for _, rec := range items {
+		policy, found := s.policy(rec.ticket.TenantID, rec.ticket.BranchID, rec.ticket.ServiceID)
+		effectiveGrace := grace
+		returnToQueue := s.noShowReturnToQueue
+		if found {
+			effectiveGrace = time.Duration(policy.NoShowGraceSeconds) * time.Second
+			returnToQueue = policy.ReturnToQueue
+		}
+		if time.Since(*rec.ticket.CalledAt) < effectiveGrace {
+			continue
+		}
+
+		ticket := s.view(rec, "")
+		applyNoShowStatus(rec, returnToQueue)
+		ticket.Status = rec.ticket.Status
+		if err := s.emit(ticket.TenantID, "ticket.no_show", ticket.TicketID, noShowPayload(ticket, returnToQueue)); err != nil {
+			return processed, err
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// applyNoShowStatus marks a called ticket as a no-show, or puts it back in
+// the queue at its original position with a fresh recall budget.
+func applyNoShowStatus(rec *ticketRecord, returnToQueue bool) {
+	if !returnToQueue {
+		rec.ticket.Status = models.StatusNoShow
+		return
+	}
+	rec.ticket.Status = models.StatusWaiting
+	rec.ticket.CounterID = nil
+	rec.ticket.CalledAt = nil
+	rec.ticket.RecallCount = 0
+	rec.ticket.LastRecalledAt = nil
+	rec.returned = true
+}
+
+func (s *Store) NoShowTicket(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, found, empty := s.findAction("no_show", input.RequestID); found {
+		if empty {
+			return models.Ticket{}, false, store.ErrInvalidState
+		}
+		return existing, false, nil
+	}
+
+	rec, ok := s.ticketIn(input.TicketID, input.TenantID, input.BranchID)
+	if !ok {
+		return models.Ticket{}, false, store.ErrTicketNotFound
+	}
+	if rec.ticket.Status != models.StatusCalled {
+		return models.Ticket{}, false, store.ErrInvalidState
+	}
+	applyNoShowStatus(rec, input.ReturnToQueue)
+	s.insertAction("no_show", input.RequestID, rec.ticket.TicketID)
+
+	ticket := s.view(rec, input.RequestID)
+	if err := s.emit(input.TenantID, "ticket.no_show", ticket.TicketID, noShowPayload(ticket, input.ReturnToQueue)); err != nil {
+		return models.Ticket{}, false, err
+	}
+	return ticket, true, nil
+}
+
+func (s *Store) SnapshotTickets(ctx context.Context, tenantID, branchID, serviceID string) ([]models.Ticket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := s.collect(func(rec *ticketRecord) bool {
+		t := rec.ticket
+		if t.TenantID != tenantID || t.BranchID != branchID || t.ServiceID != serviceID {
+			return false
+		}
+		switch t.Status {
+		case models.StatusRemote, models.StatusWaiting, models.StatusCalled, models.StatusServing:
+			return true
+		}
+		return false
+	})
+	sortByQueued(records)
+	return s.views(records), nil
+}
+
+func (s *Store) activeAtCounter(tenantID, branchID, counterID string) []*ticketRecord {
+	records := s.collect(func(rec *ticketRecord) bool {
+		t := rec.ticket
+		return t.TenantID == tenantID && t.BranchID == branchID && t.CounterID != nil && *t.CounterID == counterID && isActiveStatus(t.Status)
+	})
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i].ticket.CalledAt, records[j].ticket.CalledAt
+		if a == nil || b == nil {
+			return b != nil
+		}
+		if !a.Equal(*b) {
+			return a.Before(*b)
+		}
+		return records[i].seq < records[j].seq
+	})
+	return records
+}
+
+func (s *Store) GetActiveTicket(ctx context.Context, tenantID, branchID, counterID string) (models.Ticket, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := s.activeAtCounter(tenantID, branchID, counterID)
+	if len(records) == 0 {
+		return models.Ticket{}, false, nil
+	}
+	return s.view(records[len(records)-1], ""), true, nil
+}
+
+// ListActiveTickets returns every called or serving ticket at a counter, the
+// oldest call first.
+func (s *Store) ListActiveTickets(ctx context.Context, tenantID, branchID, counterID string) ([]models.Ticket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.views(s.activeAtCounter(tenantID, branchID, counterID)), nil
+}
+
+func (s *Store) CheckInAppointment(ctx context.Context, requestID, tenantID, branchID, appointmentID string) (models.Ticket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ticketID, ok := s.ticketRequests[requestID]; ok {
+		return s.view(s.tickets[ticketID], requestID), nil
+	}
+
+	appointment, ok := s.appointments[appointmentID]
+	if !ok || appointment.status != "scheduled" || appointment.appointment.TenantID != tenantID || appointment.appointment.BranchID != branchID {
+		return models.Ticket{}, store.ErrTicketNotFound
+	}
+	if s.holidays[holidayKey(tenantID, branchID, appointment.appointment.ScheduledAt)] {
+		return models.Ticket{}, store.ErrHolidayClosed
+	}
+	serviceID := appointment.appointment.ServiceID
+	service, ok := s.activeService(tenantID, branchID, serviceID)
+	if !ok {
+		return models.Ticket{}, store.ErrServiceNotFound
+	}
+	appointment.status = "checked_in"
+
+	rec := &ticketRecord{
+		ticket: models.Ticket{
+			TicketID:        uuid.NewString(),
+			TicketNumber:    formatTicketNumber(service.service.Code, s.nextTicketNumber(branchID, serviceID)),
+			TenantID:        tenantID,
+			BranchID:        branchID,
+			ServiceID:       serviceID,
+			Status:          models.StatusWaiting,
+			Channel:         "kiosk",
+			PriorityClass:   "regular",
+			CreatedAt:       now(),
+			PartySize:       1,
+			CustomerRefType: appointment.refType,
+		},
+		requestID:     requestID,
+		appointmentID: appointmentID,
+		refHash:       appointment.refHash,
+		refEnc:        appointment.refEnc,
+	}
+	s.insertTicket(rec)
+
+	ticket := s.view(rec, requestID)
+	scheduledAt := appointment.appointment.ScheduledAt
+	if err := s.emit(tenantID, "ticket.created", ticket.TicketID, createdPayload(ticket, &scheduledAt)); err != nil {
+		return models.Ticket{}, err
+	}
+	return ticket, nil
+}
+
+func (s *Store) StartServing(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
+	return s.updateTicketStatus(input, "start_serving", models.StatusCalled, models.StatusServing, "ticket.serving", true)
+}
+
+func (s *Store) CompleteTicket(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
+	return s.updateTicketStatus(input, "complete", models.StatusServing, models.StatusDone, "ticket.done", false)
+}
+
+func (s *Store) CancelTicket(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
+	ticket, created, err := s.updateTicketStatus(input, "cancel", models.StatusWaiting, models.StatusCancelled, "ticket.cancelled", false)
+	if err == store.ErrInvalidState {
+		// Remote tickets that never arrived can be cancelled as well.
+		return s.updateTicketStatus(input, "cancel", models.StatusRemote, models.StatusCancelled, "ticket.cancelled", false)
+	}
+	return ticket, created, err
+}
+
+// updateTicketStatus moves a ticket from fromStatus to toStatus and stamps the
+// timestamp that belongs to the new status.
+func (s *Store) updateTicketStatus(input store.TicketActionInput, action, fromStatus, toStatus, eventType string, requireCounter bool) (models.Ticket, bool, error) {
+	if !store.ValidTransition(action, fromStatus) {
+		return models.Ticket{}, false, store.ErrInvalidState
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, found, empty := s.findAction(action, input.RequestID); found {
+		if empty {
+			return models.Ticket{}, false, store.ErrInvalidState
+		}
+		return existing, false, nil
+	}
+
+	occurredAt := stamp(input.OccurredAt)
+	if input.OccurredAt.IsZero() {
+		occurredAt = now()
+	}
+
+	rec, ok := s.ticketIn(input.TicketID, input.TenantID, input.BranchID)
+	if !ok {
+		return models.Ticket{}, false, store.ErrTicketNotFound
+	}
+	counter := ""
+	if rec.ticket.CounterID != nil {
+		counter = *rec.ticket.CounterID
+	}
+	if requireCounter && counter != input.CounterID {
+		if counter != "" {
+			return models.Ticket{}, false, store.ErrCounterMismatch
+		}
+		return models.Ticket{}, false, store.ErrInvalidState
+	}
+	if rec.ticket.Status != fromStatus {
+		return models.Ticket{}, false, store.ErrInvalidState
+	}
+
+	rec.ticket.Status = toStatus
+	switch toStatus {
+	case models.StatusServing:
+		rec.ticket.ServedAt = timePtr(occurredAt)
+	case models.StatusDone:
+		rec.ticket.CompletedAt = timePtr(occurredAt)
+	case models.StatusCancelled:
+		rec.ticket.CancelledAt = timePtr(occurredAt)
+	}
+	s.insertAction(action, input.RequestID, rec.ticket.TicketID)
+
+	ticket := s.view(rec, input.RequestID)
+	if err := s.emit(input.TenantID, eventType, ticket.TicketID, genericPayload(ticket)); err != nil {
+		return models.Ticket{}, false, err
+	}
+	return ticket, true, nil
+}
+
+// PostponeTicket lets a waiting customer defer their own ticket, either by a
+// number of places or by re-queueing as if they arrived after the delay. The
+// ticket is not called before its queuedAt.
+func (s *Store) PostponeTicket(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, found, empty := s.findAction("postpone", input.RequestID); found {
+		if empty {
+			return models.Ticket{}, false, store.ErrInvalidState
+		}
+		return existing, false, nil
+	}
+
+	rec, ok := s.ticketIn(input.TicketID, input.TenantID, input.BranchID)
+	if !ok {
+		return models.Ticket{}, false, store.ErrTicketNotFound
+	}
+	if !store.ValidTransition("postpone", rec.ticket.Status) {
+		return models.Ticket{}, false, store.ErrInvalidState
+	}
+
+	policy, found := s.policy(input.TenantID, input.BranchID, rec.ticket.ServiceID)
+	if !found {
+		policy.MaxPostpones = defaultMaxPostpones
+		policy.MaxPostponePlaces = defaultMaxPostponePlaces
+		policy.MaxPostponeMinutes = defaultMaxPostponeMinutes
+	}
+	if rec.ticket.PostponeCount >= policy.MaxPostpones {
+		return models.Ticket{}, false, store.ErrPostponeLimit
+	}
+
+	occurredAt := stamp(input.OccurredAt)
+	if input.OccurredAt.IsZero() {
+		occurredAt = now()
+	}
+	queuedAt := rec.queuedAt
+	newQueuedAt := queuedAt
+	places := 0
+	var delay time.Duration
+	if input.PostponePlaces > 0 {
+		places = input.PostponePlaces
+		if places > policy.MaxPostponePlaces {
+			places = policy.MaxPostponePlaces
+		}
+		if places <= 0 {
+			return models.Ticket{}, false, store.ErrPostponeLimit
+		}
+		behind := s.collect(func(other *ticketRecord) bool {
+			t := other.ticket
+			return t.TenantID == input.TenantID && t.BranchID == input.BranchID && t.ServiceID == rec.ticket.ServiceID &&
+				t.Status == models.StatusWaiting && other.queuedAt.After(queuedAt) && t.TicketID != rec.ticket.TicketID
+		})
+		sortByQueued(behind)
+		if len(behind) < places {
+			places = len(behind)
+		}
+		if places == 0 {
+			return models.Ticket{}, false, store.ErrNothingToPostpone
+		}
+		// Slot in right after the last ticket we let ahead.
+		newQueuedAt = behind[places-1].queuedAt.Add(time.Microsecond)
+	} else {
+		delay = input.PostponeDelay
+		maxDelay := time.Duration(policy.MaxPostponeMinutes) * time.Minute
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+		if delay <= 0 {
+			return models.Ticket{}, false, store.ErrPostponeLimit
+		}
+		newQueuedAt = occurredAt.Add(delay)
+	}
+
+	rec.queuedAt = newQueuedAt
+	rec.ticket.PostponeCount++
+	s.insertAction("postpone", input.RequestID, rec.ticket.TicketID)
+
+	ticket := s.view(rec, input.RequestID)
+	if err := s.emit(input.TenantID, "ticket.postponed", ticket.TicketID, postponedPayload(ticket, queuedAt, newQueuedAt, places, delay)); err != nil {
+		return models.Ticket{}, false, err
+	}
+	return ticket, true, nil
+}
+
+func (s *Store) HoldTicket(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, found, empty := s.findAction("hold", input.RequestID); found {
+		if empty {
+			return models.Ticket{}, false, store.ErrInvalidState
+		}
+		return existing, false, nil
+	}
+
+	rec, ok := s.ticketIn(input.TicketID, input.TenantID, input.BranchID)
+	if !ok {
+		return models.Ticket{}, false, store.ErrTicketNotFound
+	}
+	if !store.ValidTransition("hold", rec.ticket.Status) {
+		return models.Ticket{}, false, store.ErrInvalidState
+	}
+
+	policy, found := s.policy(input.TenantID, input.BranchID, rec.ticket.ServiceID)
+	maxDuration := s.holdDuration
+	if found && policy.HoldMaxSeconds > 0 {
+		maxDuration = time.Duration(policy.HoldMaxSeconds) * time.Second
+	}
+	duration := input.HoldDuration
+	if duration <= 0 || duration > maxDuration {
+		duration = maxDuration
+	}
+	heldAt := stamp(input.OccurredAt)
+	if input.OccurredAt.IsZero() {
+		heldAt = now()
+	}
+
+	holdCounterID := input.CounterID
+	if holdCounterID == "" && rec.ticket.CounterID != nil {
+		holdCounterID = *rec.ticket.CounterID
+	}
+
+	rec.ticket.Status = models.StatusHeld
+	rec.ticket.CounterID = nil
+	rec.ticket.CalledAt = nil
+	rec.ticket.HoldReason = input.Reason
+	rec.ticket.HeldAt = timePtr(heldAt)
+	rec.ticket.HoldExpiresAt = timePtr(stamp(heldAt.Add(duration)))
+	rec.ticket.HoldCounterID = nil
+	if holdCounterID != "" {
+		rec.ticket.HoldCounterID = stringPtr(holdCounterID)
+	}
+	s.insertAction("hold", input.RequestID, rec.ticket.TicketID)
+
+	ticket := s.view(rec, input.RequestID)
+	if err := s.emit(input.TenantID, "ticket.held", ticket.TicketID, holdPayload(ticket, "")); err != nil {
+		return models.Ticket{}, false, err
+	}
+	return ticket, true, nil
+}
+
+// releaseHold moves a held ticket to toStatus and clears its hold metadata.
+// The returned ticket still carries the hold fields for event payloads.
+func releaseHold(rec *ticketRecord, toStatus string) models.Ticket {
+	released := rec.ticket
+	released.Status = toStatus
+	rec.ticket.Status = toStatus
+	rec.ticket.HoldReason = ""
+	rec.ticket.HeldAt = nil
+	rec.ticket.HoldExpiresAt = nil
+	rec.ticket.HoldCounterID = nil
+	return released
+}
+
+func (s *Store) UnholdTicket(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, found, empty := s.findAction("unhold", input.RequestID); found {
+		if empty {
+			return models.Ticket{}, false, store.ErrInvalidState
+		}
+		return existing, false, nil
+	}
+
+	rec, ok := s.ticketIn(input.TicketID, input.TenantID, input.BranchID)
+	if !ok {
+		return models.Ticket{}, false, store.ErrTicketNotFound
+	}
+	if rec.ticket.Status != models.StatusHeld {
+		return models.Ticket{}, false, store.ErrInvalidState
+	}
+	ticket := releaseHold(rec, models.StatusWaiting)
+	ticket.RequestID = input.RequestID
+	s.insertAction("unhold", input.RequestID, rec.ticket.TicketID)
+
+	if err := s.emit(input.TenantID, "ticket.unheld", ticket.TicketID, holdPayload(ticket, "")); err != nil {
+		return models.Ticket{}, false, err
+	}
+	return ticket, true, nil
+}
+
+func (s *Store) ListHeldTickets(ctx context.Context, tenantID, branchID, counterID string) ([]models.Ticket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := s.collect(func(rec *ticketRecord) bool {
+		t := rec.ticket
+		if t.TenantID != tenantID || t.BranchID != branchID || t.Status != models.StatusHeld {
+			return false
+		}
+		return counterID == "" || (t.HoldCounterID != nil && *t.HoldCounterID == counterID)
+	})
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i].ticket.HoldExpiresAt, records[j].ticket.HoldExpiresAt
+		if a != nil && b != nil && !a.Equal(*b) {
+			return a.Before(*b)
+		}
+		if (a == nil) != (b == nil) {
+			return a != nil
+		}
+		if !records[i].queuedAt.Equal(records[j].queuedAt) {
+			return records[i].queuedAt.Before(records[j].queuedAt)
+		}
+		return records[i].seq < records[j].seq
+	})
+	return s.views(records), nil
+}
+
+// ExpireHolds releases held tickets whose hold has lapsed, either back into the
+// queue at their original position or by cancelling them, per service policy.
+func (s *Store) ExpireHolds(ctx context.Context, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := time.Now().UTC()
+	items := s.collect(func(rec *ticketRecord) bool {
+		return store.ValidTransition("expire_hold", rec.ticket.Status) && rec.ticket.HoldExpiresAt != nil && !rec.ticket.HoldExpiresAt.After(current)
+	})
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].ticket.HoldExpiresAt.Before(*items[j].ticket.HoldExpiresAt)
+	})
+	if len(items) > batchSize {
+		items = items[:batchSize]
+	}
+
+	processed := 0
+	for _, rec := range items {
+		action := s.holdExpiryAction
+		if policy, found := s.policy(rec.ticket.TenantID, rec.ticket.BranchID, rec.ticket.ServiceID); found && policy.HoldExpiryAction != "" {
+			action = normalizeHoldExpiryAction(policy.HoldExpiryAction)
+		}
+		toStatus := models.StatusWaiting
+		if action == models.HoldExpiryCancel {
+			toStatus = models.StatusCancelled
+		}
+		ticket := releaseHold(rec, toStatus)
+		if toStatus == models.StatusCancelled {
+			rec.ticket.CancelledAt = timePtr(current)
+			ticket.CancelledAt = rec.ticket.CancelledAt
+		}
+		if err := s.emit(ticket.TenantID, "ticket.hold_expired", ticket.TicketID, holdPayload(ticket, action)); err != nil {
+			return processed, err
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// ReopenTicket reverses a mistaken complete or cancel while the terminal event
+// is still inside the reopen window.
+func (s *Store) ReopenTicket(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, found, empty := s.findAction("reopen", input.RequestID); found {
+		if empty {
+			return models.Ticket{}, false, store.ErrInvalidState
+		}
+		return existing, false, nil
+	}
+
+	rec, ok := s.ticketIn(input.TicketID, input.TenantID, input.BranchID)
+	if !ok {
+		return models.Ticket{}, false, store.ErrTicketNotFound
+	}
+	if !store.ValidTransition("reopen", rec.ticket.Status) {
+		return models.Ticket{}, false, store.ErrInvalidState
+	}
+
+	fromStatus := rec.ticket.Status
+	terminalAt, previousStatus := s.lastTerminalEvent(rec.ticket.TicketID, fromStatus)
+	occurredAt := stamp(input.OccurredAt)
+	if input.OccurredAt.IsZero() {
+		occurredAt = now()
+	}
+	if terminalAt.IsZero() || occurredAt.Sub(terminalAt) > s.reopenWindow {
+		return models.Ticket{}, false, store.ErrReopenExpired
+	}
+
+	// A ticket goes back to its counter only while that counter can still
+	// take it; otherwise it rejoins the queue to be called again.
+	rec.ticket.Status = previousStatus
+	if previousStatus == models.StatusServing {
+		held := false
+		resourceID := ""
+		if rec.ticket.CounterID != nil {
+			resourceID, held = s.reopenCounterSlot(*rec.ticket.CounterID, input.BranchID, rec.ticket.TicketID)
+		}
+		if held {
+			rec.ticket.ResourceID = nil
+			if resourceID != "" {
+				rec.ticket.ResourceID = &resourceID
+			}
+		} else {
+			rec.ticket.Status = models.StatusWaiting
+			rec.ticket.CounterID = nil
+			rec.ticket.CalledAt = nil
+			rec.ticket.ServedAt = nil
+			rec.ticket.ResourceID = nil
+		}
+	}
+	rec.ticket.CompletedAt = nil
+	rec.ticket.CancelledAt = nil
+	rec.ticket.ReopenedAt = timePtr(occurredAt)
+	rec.reopenCount++
+	s.insertAction("reopen", input.RequestID, rec.ticket.TicketID)
+
+	ticket := s.view(rec, input.RequestID)
+	if err := s.emit(input.TenantID, "ticket.reopened", ticket.TicketID, reopenedPayload(ticket, fromStatus, input.Reason, input.ActorID)); err != nil {
+		return models.Ticket{}, false, err
+	}
+	return ticket, true, nil
+}
+
+// lastTerminalEvent returns when the ticket entered terminalStatus and the
+// status recorded by the event before it.
+func (s *Store) lastTerminalEvent(ticketID, terminalStatus string) (time.Time, string) {
+	events := s.events[ticketID]
+	var decoded struct {
+		Status string `json:"status"`
+	}
+	if len(events) == 0 {
+		return time.Time{}, ""
+	}
+	last := events[len(events)-1]
+	_ = json.Unmarshal(last.Payload, &decoded)
+	if decoded.Status != terminalStatus {
+		return time.Time{}, ""
+	}
+	previous := ""
+	if len(events) > 1 {
+		decoded.Status = ""
+		_ = json.Unmarshal(events[len(events)-2].Payload, &decoded)
+		previous = decoded.Status
+	}
+	switch previous {
+	case models.StatusServing, models.StatusWaiting:
+		return last.CreatedAt, previous
+	}
+	if terminalStatus == models.StatusDone {
+		return last.CreatedAt, models.StatusServing
+	}
+	return last.CreatedAt, models.StatusWaiting
+}
+
+// ConfirmArrival moves a remote ticket into the live queue once the customer
+// is on site, keeping its place when it arrives inside the keep-place window.
+func (s *Store) ConfirmArrival(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, found, empty := s.findAction("confirm_arrival", input.RequestID); found {
+		if empty {
+			return models.Ticket{}, false, store.ErrInvalidState
+		}
+		return existing, false, nil
+	}
+
+	rec, ok := s.ticketIn(input.TicketID, input.TenantID, input.BranchID)
+	if !ok {
+		return models.Ticket{}, false, store.ErrTicketNotFound
+	}
+	if !store.ValidTransition("confirm_arrival", rec.ticket.Status) {
+		return models.Ticket{}, false, store.ErrInvalidState
+	}
+
+	arrivedAt := stamp(input.OccurredAt)
+	if input.OccurredAt.IsZero() {
+		arrivedAt = now()
+	}
+	if rec.ticket.RemoteExpiresAt != nil && arrivedAt.After(*rec.ticket.RemoteExpiresAt) {
+		return models.Ticket{}, false, store.ErrArrivalExpired
+	}
+
+	policy, _ := s.policy(input.TenantID, input.BranchID, rec.ticket.ServiceID)
+	joinedAt := rec.ticket.CreatedAt
+	keptPlace := policy.RemoteKeepPlaceSeconds <= 0 || arrivedAt.Sub(joinedAt) <= time.Duration(policy.RemoteKeepPlaceSeconds)*time.Second
+	if !keptPlace {
+		rec.queuedAt = arrivedAt
+	}
+	rec.ticket.Status = models.StatusWaiting
+	rec.ticket.ArrivalConfirmedAt = timePtr(arrivedAt)
+	rec.ticket.RemoteExpiresAt = nil
+	s.insertAction("confirm_arrival", input.RequestID, rec.ticket.TicketID)
+
+	ticket := s.view(rec, input.RequestID)
+	if err := s.emit(input.TenantID, "ticket.arrived", ticket.TicketID, arrivedPayload(ticket, rec.queuedAt, input.Method, keptPlace)); err != nil {
+		return models.Ticket{}, false, err
+	}
+	return ticket, true, nil
+}
+
+// ExpireRemoteTickets cancels remote tickets whose arrival was never
+// confirmed within the service's confirmation window.
+func (s *Store) ExpireRemoteTickets(ctx context.Context, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := now()
+	items := s.collect(func(rec *ticketRecord) bool {
+		return rec.ticket.Status == models.StatusRemote && rec.ticket.RemoteExpiresAt != nil && !rec.ticket.RemoteExpiresAt.After(current)
+	})
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].ticket.RemoteExpiresAt.Before(*items[j].ticket.RemoteExpiresAt)
+	})
+	if len(items) > batchSize {
+		items = items[:batchSize]
+	}
+
+	processed := 0
+	for _, rec := range items {
+		rec.ticket.Status = models.StatusCancelled
+		rec.ticket.CancelledAt = timePtr(current)
+		ticket := s.view(rec, "")
+		if err := s.emit(ticket.TenantID, "ticket.remote_expired", ticket.TicketID, genericPayload(ticket)); err != nil {
+			return processed, err
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// RecallTicket announces a called ticket again. Once the recall limit is
+// reached the ticket is treated as a no-show instead.
+func (s *Store) RecallTicket(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, found, empty := s.findAction("recall", input.RequestID); found {
+		if empty {
+			return models.Ticket{}, false, store.ErrInvalidState
+		}
+		return existing, false, nil
+	}
+
+	rec, ok := s.ticketIn(input.TicketID, input.TenantID, input.BranchID)
+	if !ok {
+		return models.Ticket{}, false, store.ErrTicketNotFound
+	}
+	if !store.ValidTransition("recall", rec.ticket.Status) {
+		return models.Ticket{}, false, store.ErrInvalidState
+	}
+
+	policy, found := s.policy(input.TenantID, input.BranchID, rec.ticket.ServiceID)
+	maxRecalls := s.maxRecalls
+	minInterval := s.minRecallInterval
+	returnToQueue := s.noShowReturnToQueue
+	if found {
+		if policy.MaxRecalls > 0 {
+			maxRecalls = policy.MaxRecalls
+		}
+		minInterval = time.Duration(policy.MinRecallIntervalSeconds) * time.Second
+		returnToQueue = policy.ReturnToQueue
+	}
+
+	occurredAt := stamp(input.OccurredAt)
+	if input.OccurredAt.IsZero() {
+		occurredAt = now()
+	}
+	lastAnnounced := rec.ticket.LastRecalledAt
+	if lastAnnounced == nil {
+		lastAnnounced = rec.ticket.CalledAt
+	}
+	if minInterval > 0 && lastAnnounced != nil && occurredAt.Sub(*lastAnnounced) < minInterval {
+		return models.Ticket{}, false, store.ErrRecallTooSoon
+	}
+
+	if rec.ticket.RecallCount >= maxRecalls {
+		counterID := rec.ticket.CounterID
+		applyNoShowStatus(rec, returnToQueue)
+		s.insertAction("recall", input.RequestID, rec.ticket.TicketID)
+		ticket := s.view(rec, input.RequestID)
+		if ticket.CounterID == nil {
+			// Keep the counter on the event so displays can clear the right call.
+			ticket.CounterID = counterID
+		}
+		if err := s.emit(input.TenantID, "ticket.no_show", ticket.TicketID, noShowPayload(ticket, returnToQueue)); err != nil {
+			return models.Ticket{}, false, err
+		}
+		return ticket, true, nil
+	}
+
+	rec.ticket.RecallCount++
+	rec.ticket.LastRecalledAt = timePtr(occurredAt)
+	s.insertAction("recall", input.RequestID, rec.ticket.TicketID)
+
+	ticket := s.view(rec, input.RequestID)
+	if err := s.emit(input.TenantID, "ticket.recalled", ticket.TicketID, recalledPayload(ticket, maxRecalls)); err != nil {
+		return models.Ticket{}, false, err
+	}
+	return ticket, true, nil
+}
+
+func (s *Store) TransferTicket(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, found, empty := s.findAction("transfer", input.RequestID); found {
+		if empty {
+			return models.Ticket{}, false, store.ErrInvalidState
+		}
+		return existing, false, nil
+	}
+
+	if _, ok := s.activeService(input.TenantID, input.BranchID, input.ServiceID); !ok {
+		return models.Ticket{}, false, store.ErrServiceNotFound
+	}
+	rec, ok := s.ticketIn(input.TicketID, input.TenantID, input.BranchID)
+	if !ok || !store.ValidTransition("transfer", rec.ticket.Status) {
+		return models.Ticket{}, false, store.ErrInvalidState
+	}
+
+	fromServiceID := rec.ticket.ServiceID
+	rec.ticket.Status = models.StatusWaiting
+	rec.ticket.ServiceID = input.ServiceID
+	rec.ticket.CounterID = nil
+	s.insertAction("transfer", input.RequestID, rec.ticket.TicketID)
+
+	ticket := s.view(rec, input.RequestID)
+	if err := s.emit(input.TenantID, "ticket.transferred", ticket.TicketID, transferPayload(ticket, fromServiceID, input.ServiceID, input.Reason)); err != nil {
+		return models.Ticket{}, false, err
+	}
+	return ticket, true, nil
+}
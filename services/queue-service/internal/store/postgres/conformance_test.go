@@ -0,0 +1,86 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"qms/queue-service/internal/store/storetest"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type harness struct {
+	st   *Store
+	pool *pgxpool.Pool
+}
+
+func (h *harness) Store() storetest.Store {
+	return h.st
+}
+
+func (h *harness) Seed(t *testing.T) storetest.Fixture {
+	fx := storetest.Fixture{
+		TenantID:  uuid.NewString(),
+		BranchID:  uuid.NewString(),
+		ServiceID: uuid.NewString(),
+		CounterA:  uuid.NewString(),
+		CounterB:  uuid.NewString(),
+	}
+	seedBaseData(t, context.Background(), h.pool, fx.TenantID, fx.BranchID, fx.ServiceID, fx.CounterA, fx.CounterB)
+	return fx
+}
+
+func (h *harness) AddService(t *testing.T, fx storetest.Fixture, code string) string {
+	t.Helper()
+	serviceID := uuid.NewString()
+	if _, err := h.pool.Exec(context.Background(), `
+		INSERT INTO services (service_id, branch_id, name, code, active) VALUES ($1, $2, $3, $4, true)
+	`, serviceID, fx.BranchID, "Service "+code, code); err != nil {
+		t.Fatalf("insert service: %v", err)
+	}
+	return serviceID
+}
+
+func (h *harness) SetPolicy(t *testing.T, fx storetest.Fixture, serviceID string, policy storetest.Policy) {
+	t.Helper()
+	if _, err := h.pool.Exec(context.Background(), `
+		INSERT INTO service_policies (
+			tenant_id, branch_id, service_id, no_show_grace_seconds, return_to_queue,
+			appointment_ratio_percent, appointment_window_size, appointment_boost_minutes,
+			hold_max_seconds, hold_expiry_action, max_recalls, min_recall_interval_seconds,
+			max_party_size, max_waiting_people, remote_confirm_seconds, remote_keep_place_seconds,
+			max_postpones, max_postpone_places, max_postpone_minutes
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, 0), NULLIF($10, ''), $11, $12, $13, $14, $15, $16, $17, $18, $19)
+	`, fx.TenantID, fx.BranchID, serviceID, policy.NoShowGraceSeconds, policy.ReturnToQueue,
+		policy.AppointmentRatioPercent, policy.AppointmentWindowSize, policy.AppointmentBoostMinutes,
+		policy.HoldMaxSeconds, policy.HoldExpiryAction, policy.MaxRecalls, policy.MinRecallIntervalSeconds,
+		policy.MaxPartySize, policy.MaxWaitingPeople, policy.RemoteConfirmSeconds, policy.RemoteKeepPlaceSeconds,
+		policy.MaxPostpones, policy.MaxPostponePlaces, policy.MaxPostponeMinutes); err != nil {
+		t.Fatalf("insert policy: %v", err)
+	}
+}
+
+func (h *harness) AddAppointment(t *testing.T, fx storetest.Fixture, serviceID string, scheduledAt time.Time) string {
+	return createAppointment(t, context.Background(), h.pool, fx.TenantID, fx.BranchID, serviceID, scheduledAt)
+}
+
+func (h *harness) AddResource(t *testing.T, fx storetest.Fixture, counterID string, capacity int) {
+	t.Helper()
+	if _, err := h.pool.Exec(context.Background(), `
+		INSERT INTO resources (resource_id, branch_id, counter_id, name, kind, capacity)
+		VALUES ($1, $2, $3, 'Room 1', 'room', $4)
+	`, uuid.NewString(), fx.BranchID, counterID, capacity); err != nil {
+		t.Fatalf("insert resource: %v", err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Harness {
+		st, pool, cleanup := setupTestStore(t, context.Background())
+		t.Cleanup(cleanup)
+		return &harness{st: st, pool: pool}
+	})
+}
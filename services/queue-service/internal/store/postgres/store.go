@@ -11,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"qms/queue-service/internal/customerref"
 	"qms/queue-service/internal/models"
 	"qms/queue-service/internal/store"
 
@@ -21,15 +22,45 @@ import (
 
 const ticketNumberPad = 3
 
+const (
+	defaultHoldDuration = 15 * time.Minute
+	defaultMaxRecalls   = 3
+	defaultReopenWindow = 15 * time.Minute
+	defaultRemoteWindow = 2 * time.Hour
+
+	// Self-service postpone limits used when a service has no policy row.
+	defaultMaxPostpones       = 1
+	defaultMaxPostponePlaces  = 5
+	defaultMaxPostponeMinutes = 30
+
+	// Party size cap used when a service has no policy row, matching the
+	// max_party_size column default.
+	defaultMaxPartySize = 10
+)
+
 type Store struct {
 	pool                *pgxpool.Pool
 	noShowReturnToQueue bool
 	priorityStreakLimit int
+	holdDuration        time.Duration
+	holdExpiryAction    string
+	maxRecalls          int
+	minRecallInterval   time.Duration
+	reopenWindow        time.Duration
+	remoteWindow        time.Duration
+	customerRefs        *customerref.Tokenizer
 }
 
 type Options struct {
 	NoShowReturnToQueue bool
 	PriorityStreakLimit int
+	HoldDuration        time.Duration
+	HoldExpiryAction    string
+	MaxRecalls          int
+	MinRecallInterval   time.Duration
+	ReopenWindow        time.Duration
+	RemoteWindow        time.Duration
+	CustomerRefs        *customerref.Tokenizer
 }
 
 func NewStore(pool *pgxpool.Pool, options Options) *Store {
@@ -37,10 +68,33 @@ func NewStore(pool *pgxpool.Pool, options Options) *Store {
 	if limit <= 0 {
 		limit = 3
 	}
+	holdDuration := options.HoldDuration
+	if holdDuration <= 0 {
+		holdDuration = defaultHoldDuration
+	}
+	maxRecalls := options.MaxRecalls
+	if maxRecalls <= 0 {
+		maxRecalls = defaultMaxRecalls
+	}
+	reopenWindow := options.ReopenWindow
+	if reopenWindow <= 0 {
+		reopenWindow = defaultReopenWindow
+	}
+	remoteWindow := options.RemoteWindow
+	if remoteWindow <= 0 {
+		remoteWindow = defaultRemoteWindow
+	}
 	return &Store{
 		pool:                pool,
 		noShowReturnToQueue: options.NoShowReturnToQueue,
 		priorityStreakLimit: limit,
+		holdDuration:        holdDuration,
+		holdExpiryAction:    normalizeHoldExpiryAction(options.HoldExpiryAction),
+		maxRecalls:          maxRecalls,
+		minRecallInterval:   options.MinRecallInterval,
+		reopenWindow:        reopenWindow,
+		remoteWindow:        remoteWindow,
+		customerRefs:        options.CustomerRefs,
 	}
 }
 
@@ -77,32 +131,71 @@ func (s *Store) CreateTicket(ctx context.Context, input store.CreateTicketInput)
 	}
 	formattedNumber := fmt.Sprintf("%s-%0*d", serviceCode, ticketNumberPad, seq)
 
+	partySize := input.PartySize
+	if partySize <= 0 {
+		partySize = 1
+	}
+	if err = checkPartyCapacity(ctx, tx, input, partySize); err != nil {
+		return models.Ticket{}, false, err
+	}
+	if input.LinkedTicketID != "" {
+		if err = ensureLinkedTicket(ctx, tx, input); err != nil {
+			return models.Ticket{}, false, err
+		}
+	}
+	ref, err := s.tokeniseCustomerRef(ctx, tx, input.TenantID, input.CustomerRefType, input.CustomerRef)
+	if err != nil {
+		return models.Ticket{}, false, err
+	}
+
 	ticketID := uuid.NewString()
 	createdAt := input.CreatedAt
 	if createdAt.IsZero() {
 		createdAt = time.Now().UTC()
 	}
 
+	// Remote joiners hold a place from the moment they join but stay out of
+	// call-next until they confirm arrival on site.
+	status := models.StatusWaiting
+	var remoteExpiresAt sql.NullTime
+	if input.Remote {
+		window, err := s.remoteConfirmWindow(ctx, tx, input.TenantID, input.BranchID, input.ServiceID)
+		if err != nil {
+			return models.Ticket{}, false, err
+		}
+		status = models.StatusRemote
+		remoteExpiresAt = sql.NullTime{Time: createdAt.Add(window), Valid: true}
+	}
+
 	var ticket models.Ticket
 	row := tx.QueryRow(ctx, `
 		INSERT INTO tickets (
 			ticket_id, request_id, ticket_number, tenant_id, branch_id, service_id, area_id,
-			status, channel, priority_class, created_at, phone_hash
-		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
+			status, channel, priority_class, created_at, queued_at, phone_hash, party_size, linked_ticket_id, remote_expires_at,
+			customer_ref_type, customer_ref_hash, customer_ref_enc
+		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$11,$12,$13,$14,$15,$16,$17,$18)
 		ON CONFLICT (request_id) DO NOTHING
-		RETURNING ticket_id, ticket_number, status, created_at, request_id
-	`, ticketID, input.RequestID, formattedNumber, input.TenantID, input.BranchID, input.ServiceID, nullIfEmpty(input.AreaID), models.StatusWaiting, input.Channel, input.PriorityClass, createdAt, hashPhone(input.Phone))
+		RETURNING ticket_id, ticket_number, status, created_at, request_id, party_size
+	`, ticketID, input.RequestID, formattedNumber, input.TenantID, input.BranchID, input.ServiceID, nullIfEmpty(input.AreaID), status, input.Channel, input.PriorityClass, createdAt, hashPhone(input.Phone), partySize, nullIfEmpty(input.LinkedTicketID), remoteExpiresAt,
+		nullIfEmpty(ref.refType), nullIfEmpty(ref.hash), ref.enc)
 
-	if err = row.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.CreatedAt, &ticket.RequestID); err != nil {
+	if err = row.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.CreatedAt, &ticket.RequestID, &ticket.PartySize); err != nil {
 		return models.Ticket{}, false, err
 	}
+	ticket.RemoteExpiresAt = nullTimePtr(remoteExpiresAt)
+	ticket.CustomerRefType = ref.refType
+	if input.LinkedTicketID != "" {
+		linked := input.LinkedTicketID
+		ticket.LinkedTicketID = &linked
+	}
 	ticket.TenantID = input.TenantID
 	ticket.BranchID = input.BranchID
 	ticket.ServiceID = input.ServiceID
 	ticket.AreaID = input.AreaID
 	ticket.Phone = input.Phone
+	ticket.PriorityClass = input.PriorityClass
 
-	if err = insertOutboxEvent(ctx, tx, input.TenantID, ticket); err != nil {
+	if err = insertOutboxEvent(ctx, tx, input.TenantID, ticket, nil); err != nil {
 		return models.Ticket{}, false, err
 	}
 
@@ -120,12 +213,25 @@ func (s *Store) GetTicket(ctx context.Context, tenantID, branchID, ticketID stri
 	var servedAtNull sql.NullTime
 	var completedAtNull sql.NullTime
 	var areaIDNull sql.NullString
+	var holdReasonNull sql.NullString
+	var heldAtNull sql.NullTime
+	var holdExpiresAtNull sql.NullTime
+	var holdCounterIDNull sql.NullString
+	var linkedTicketNull sql.NullString
+	var resourceIDNull sql.NullString
+	var arrivedAtNull sql.NullTime
+	var remoteExpiresNull sql.NullTime
+	var customerRefTypeNull sql.NullString
 	row := s.pool.QueryRow(ctx, `
-		SELECT ticket_id, ticket_number, status, created_at, called_at, counter_id, served_at, completed_at, branch_id, service_id, area_id, tenant_id
+		SELECT ticket_id, ticket_number, status, created_at, called_at, counter_id, served_at, completed_at, branch_id, service_id, area_id, tenant_id,
+			hold_reason, held_at, hold_expires_at, hold_counter_id, recall_count, party_size, linked_ticket_id, resource_id,
+			arrival_confirmed_at, remote_expires_at, customer_ref_type
 		FROM tickets
 		WHERE ticket_id = $1 AND tenant_id = $2 AND branch_id = $3
 	`, ticketID, tenantID, branchID)
-	if err := row.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.CreatedAt, &calledAtNull, &counterIDNull, &servedAtNull, &completedAtNull, &ticket.BranchID, &ticket.ServiceID, &areaIDNull, &ticket.TenantID); err != nil {
+	if err := row.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.CreatedAt, &calledAtNull, &counterIDNull, &servedAtNull, &completedAtNull, &ticket.BranchID, &ticket.ServiceID, &areaIDNull, &ticket.TenantID,
+		&holdReasonNull, &heldAtNull, &holdExpiresAtNull, &holdCounterIDNull, &ticket.RecallCount, &ticket.PartySize, &linkedTicketNull, &resourceIDNull,
+		&arrivedAtNull, &remoteExpiresNull, &customerRefTypeNull); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return models.Ticket{}, false, store.ErrTicketNotFound
 		}
@@ -138,12 +244,18 @@ func (s *Store) GetTicket(ctx context.Context, tenantID, branchID, ticketID stri
 	if areaIDNull.Valid {
 		ticket.AreaID = areaIDNull.String
 	}
+	ticket.LinkedTicketID = nullStringPtr(linkedTicketNull)
+	ticket.ResourceID = nullStringPtr(resourceIDNull)
+	ticket.ArrivalConfirmedAt = nullTimePtr(arrivedAtNull)
+	ticket.RemoteExpiresAt = nullTimePtr(remoteExpiresNull)
+	ticket.CustomerRefType = customerRefTypeNull.String
+	applyHoldFields(&ticket, holdReasonNull, heldAtNull, holdExpiresAtNull, holdCounterIDNull)
 	return ticket, true, nil
 }
 
 func (s *Store) ListQueue(ctx context.Context, tenantID, branchID, serviceID string) ([]models.Ticket, error) {
 	query := `
-		SELECT ticket_id, ticket_number, status, created_at, called_at, counter_id, served_at, completed_at, branch_id, service_id, area_id, tenant_id
+		SELECT ticket_id, ticket_number, status, created_at, called_at, counter_id, served_at, completed_at, branch_id, service_id, area_id, tenant_id, party_size
 		FROM tickets
 		WHERE tenant_id = $1 AND branch_id = $2 AND status IN ('waiting','held')
 	`
@@ -152,7 +264,7 @@ func (s *Store) ListQueue(ctx context.Context, tenantID, branchID, serviceID str
 		query += " AND service_id = $3"
 		args = append(args, serviceID)
 	}
-	query += " ORDER BY created_at ASC"
+	query += " ORDER BY queued_at ASC"
 
 	rows, err := s.pool.Query(ctx, query, args...)
 	if err != nil {
@@ -168,7 +280,7 @@ func (s *Store) ListQueue(ctx context.Context, tenantID, branchID, serviceID str
 		var servedAtNull sql.NullTime
 		var completedAtNull sql.NullTime
 		var areaIDNull sql.NullString
-		if err := rows.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.CreatedAt, &calledAtNull, &counterIDNull, &servedAtNull, &completedAtNull, &ticket.BranchID, &ticket.ServiceID, &areaIDNull, &ticket.TenantID); err != nil {
+		if err := rows.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.CreatedAt, &calledAtNull, &counterIDNull, &servedAtNull, &completedAtNull, &ticket.BranchID, &ticket.ServiceID, &areaIDNull, &ticket.TenantID, &ticket.PartySize); err != nil {
 			return nil, err
 		}
 		ticket.CalledAt = nullTimePtr(calledAtNull)
@@ -231,6 +343,11 @@ func (s *Store) CallNext(ctx context.Context, input store.CallNextInput) (models
 		return models.Ticket{}, false, store.ErrCounterUnavailable
 	}
 
+	resourceID, err := reserveCounterResource(ctx, tx, input.CounterID)
+	if err != nil {
+		return models.Ticket{}, false, err
+	}
+
 	calledAt := input.CalledAt
 	if calledAt.IsZero() {
 		calledAt = time.Now().UTC()
@@ -274,6 +391,13 @@ func (s *Store) CallNext(ctx context.Context, input store.CallNextInput) (models
 
 	ticket.RequestID = input.RequestID
 
+	if resourceID != "" {
+		if _, err = tx.Exec(ctx, `UPDATE tickets SET resource_id = $1 WHERE ticket_id = $2`, resourceID, ticket.TicketID); err != nil {
+			return models.Ticket{}, false, err
+		}
+		ticket.ResourceID = &resourceID
+	}
+
 	if err = insertActionRequest(ctx, tx, "call_next", input.RequestID, input.TenantID, input.BranchID, input.ServiceID, input.CounterID, ticket.TicketID); err != nil {
 		return models.Ticket{}, false, err
 	}
@@ -385,7 +509,9 @@ func (s *Store) AutoNoShow(ctx context.Context, grace time.Duration, batchSize i
 				SET status = 'waiting',
 					counter_id = NULL,
 					called_at = NULL,
-					returned = TRUE
+					returned = TRUE,
+					recall_count = 0,
+					last_recalled_at = NULL
 				WHERE ticket_id = $1
 			`, items[i].ticket.TicketID)
 		} else {
@@ -462,7 +588,9 @@ func (s *Store) applyNoShow(ctx context.Context, input store.TicketActionInput,
 			SET status = 'waiting',
 				counter_id = NULL,
 				called_at = NULL,
-				returned = TRUE
+				returned = TRUE,
+				recall_count = 0,
+				last_recalled_at = NULL
 			WHERE ticket_id = $1 AND tenant_id = $2 AND branch_id = $3 AND status = 'called'
 			RETURNING ticket_id, ticket_number, status, created_at, called_at, counter_id, service_id, branch_id, area_id, tenant_id
 		`
@@ -510,11 +638,11 @@ func (s *Store) applyNoShow(ctx context.Context, input store.TicketActionInput,
 
 func (s *Store) SnapshotTickets(ctx context.Context, tenantID, branchID, serviceID string) ([]models.Ticket, error) {
 	rows, err := s.pool.Query(ctx, `
-		SELECT ticket_id, ticket_number, status, created_at, called_at, counter_id, served_at, completed_at, branch_id, service_id, area_id, tenant_id
+		SELECT ticket_id, ticket_number, status, created_at, called_at, counter_id, served_at, completed_at, branch_id, service_id, area_id, tenant_id, recall_count, party_size
 		FROM tickets
 		WHERE tenant_id = $1 AND branch_id = $2 AND service_id = $3
-			AND status IN ('waiting', 'called', 'serving')
-		ORDER BY created_at ASC
+			AND status IN ('remote', 'waiting', 'called', 'serving')
+		ORDER BY queued_at ASC
 	`, tenantID, branchID, serviceID)
 	if err != nil {
 		return nil, err
@@ -529,7 +657,7 @@ func (s *Store) SnapshotTickets(ctx context.Context, tenantID, branchID, service
 		var servedAtNull sql.NullTime
 		var completedAtNull sql.NullTime
 		var areaIDNull sql.NullString
-		if err := rows.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.CreatedAt, &calledAtNull, &counterIDNull, &servedAtNull, &completedAtNull, &ticket.BranchID, &ticket.ServiceID, &areaIDNull, &ticket.TenantID); err != nil {
+		if err := rows.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.CreatedAt, &calledAtNull, &counterIDNull, &servedAtNull, &completedAtNull, &ticket.BranchID, &ticket.ServiceID, &areaIDNull, &ticket.TenantID, &ticket.RecallCount, &ticket.PartySize); err != nil {
 			return nil, err
 		}
 		ticket.CalledAt = nullTimePtr(calledAtNull)
@@ -555,14 +683,14 @@ func (s *Store) GetActiveTicket(ctx context.Context, tenantID, branchID, counter
 	var completedAtNull sql.NullTime
 	var areaIDNull sql.NullString
 	row := s.pool.QueryRow(ctx, `
-		SELECT ticket_id, ticket_number, status, created_at, called_at, counter_id, served_at, completed_at, branch_id, service_id, area_id, tenant_id
+		SELECT ticket_id, ticket_number, status, created_at, called_at, counter_id, served_at, completed_at, branch_id, service_id, area_id, tenant_id, recall_count, party_size
 		FROM tickets
 		WHERE tenant_id = $1 AND branch_id = $2 AND counter_id = $3
 			AND status IN ('called', 'serving')
 		ORDER BY called_at DESC
 		LIMIT 1
 	`, tenantID, branchID, counterID)
-	if err := row.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.CreatedAt, &calledAtNull, &counterIDNull, &servedAtNull, &completedAtNull, &ticket.BranchID, &ticket.ServiceID, &areaIDNull, &ticket.TenantID); err != nil {
+	if err := row.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.CreatedAt, &calledAtNull, &counterIDNull, &servedAtNull, &completedAtNull, &ticket.BranchID, &ticket.ServiceID, &areaIDNull, &ticket.TenantID, &ticket.RecallCount, &ticket.PartySize); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return models.Ticket{}, false, nil
 		}
@@ -578,27 +706,64 @@ func (s *Store) GetActiveTicket(ctx context.Context, tenantID, branchID, counter
 	return ticket, true, nil
 }
 
-func (s *Store) ListOutboxEvents(ctx context.Context, tenantID string, after time.Time, limit int) ([]store.OutboxEvent, error) {
+// ListActiveTickets returns every called or serving ticket at a counter. A
+// counter backed by resources can hold several at once; the oldest call is
+// listed first.
+func (s *Store) ListActiveTickets(ctx context.Context, tenantID, branchID, counterID string) ([]models.Ticket, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT ticket_id, ticket_number, status, created_at, called_at, counter_id, served_at, branch_id, service_id, area_id, tenant_id, recall_count, party_size, resource_id
+		FROM tickets
+		WHERE tenant_id = $1 AND branch_id = $2 AND counter_id = $3
+			AND status IN ('called', 'serving')
+		ORDER BY called_at ASC
+	`, tenantID, branchID, counterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tickets []models.Ticket
+	for rows.Next() {
+		var ticket models.Ticket
+		var calledAtNull sql.NullTime
+		var counterIDNull sql.NullString
+		var servedAtNull sql.NullTime
+		var areaIDNull sql.NullString
+		var resourceIDNull sql.NullString
+		if err := rows.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.CreatedAt, &calledAtNull, &counterIDNull, &servedAtNull, &ticket.BranchID, &ticket.ServiceID, &areaIDNull, &ticket.TenantID, &ticket.RecallCount, &ticket.PartySize, &resourceIDNull); err != nil {
+			return nil, err
+		}
+		ticket.CalledAt = nullTimePtr(calledAtNull)
+		ticket.CounterID = nullStringPtr(counterIDNull)
+		ticket.ServedAt = nullTimePtr(servedAtNull)
+		ticket.ResourceID = nullStringPtr(resourceIDNull)
+		if areaIDNull.Valid {
+			ticket.AreaID = areaIDNull.String
+		}
+		tickets = append(tickets, ticket)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tickets, nil
+}
+
+// ListOutboxEvents numbers committed events first, so a tenant reading its
+// own outbox sees its writes without waiting for a consumer to do it.
+func (s *Store) ListOutboxEvents(ctx context.Context, tenantID string, afterSeq int64, limit int) ([]store.OutboxEvent, error) {
 	if limit <= 0 {
 		limit = 100
 	}
-	query := `
-		SELECT event_id, tenant_id, type, payload_json, created_at
-		FROM outbox_events
-		WHERE tenant_id = $1
-	`
-	args := []interface{}{tenantID}
-	if !after.IsZero() {
-		query += " AND created_at > $2"
-		args = append(args, after)
-		query += " ORDER BY created_at ASC LIMIT $3"
-		args = append(args, limit)
-	} else {
-		query += " ORDER BY created_at ASC LIMIT $2"
-		args = append(args, limit)
+	if err := s.sequenceOutbox(ctx); err != nil {
+		return nil, err
 	}
-
-	rows, err := s.pool.Query(ctx, query, args...)
+	rows, err := s.pool.Query(ctx, `
+		SELECT event_id, tenant_id, type, payload_json, created_at, seq
+		FROM outbox_events
+		WHERE tenant_id = $1 AND seq > $2
+		ORDER BY seq ASC
+		LIMIT $3
+	`, tenantID, afterSeq, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -607,7 +772,7 @@ func (s *Store) ListOutboxEvents(ctx context.Context, tenantID string, after tim
 	var events []store.OutboxEvent
 	for rows.Next() {
 		var event store.OutboxEvent
-		if err := rows.Scan(&event.EventID, &event.TenantID, &event.Type, &event.Payload, &event.CreatedAt); err != nil {
+		if err := rows.Scan(&event.EventID, &event.TenantID, &event.Type, &event.Payload, &event.CreatedAt, &event.Seq); err != nil {
 			return nil, err
 		}
 		events = append(events, event)
@@ -618,6 +783,51 @@ func (s *Store) ListOutboxEvents(ctx context.Context, tenantID string, after tim
 	return events, nil
 }
 
+func (s *Store) sequenceOutbox(ctx context.Context) (err error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+		}
+	}()
+	if err = sequenceOutbox(ctx, tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (s *Store) ListOutboxConsumers(ctx context.Context) ([]store.OutboxConsumer, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT c.name, c.last_seq, q.last_seq, c.updated_at,
+			(SELECT MIN(o.created_at) FROM outbox_events o WHERE o.seq > c.last_seq OR o.seq IS NULL)
+		FROM outbox_consumers c
+		CROSS JOIN outbox_sequence q
+		WHERE q.id = 1
+		ORDER BY c.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var consumers []store.OutboxConsumer
+	for rows.Next() {
+		var consumer store.OutboxConsumer
+		if err := rows.Scan(&consumer.Name, &consumer.LastSeq, &consumer.HeadSeq, &consumer.UpdatedAt, &consumer.OldestPendingAt); err != nil {
+			return nil, err
+		}
+		consumer.Lag = consumer.HeadSeq - consumer.LastSeq
+		consumers = append(consumers, consumer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return consumers, nil
+}
+
 func (s *Store) ListTicketEvents(ctx context.Context, tenantID, ticketID string) ([]store.TicketEvent, error) {
 	rows, err := s.pool.Query(ctx, `
 		SELECT e.ticket_id, e.ticket_seq, e.type, e.payload, e.created_at, e.prev_hash, e.hash
@@ -645,172 +855,598 @@ func (s *Store) ListTicketEvents(ctx context.Context, tenantID, ticketID string)
 	return events, nil
 }
 
-func (s *Store) ListCounters(ctx context.Context, tenantID, branchID string) ([]models.Counter, error) {
-	rows, err := s.pool.Query(ctx, `
-		SELECT c.counter_id, c.branch_id, c.name, c.status
-		FROM counters c
-		JOIN branches b ON b.branch_id = c.branch_id
-		WHERE b.tenant_id = $1 AND c.branch_id = $2
-		ORDER BY c.name ASC
-	`, tenantID, branchID)
+// VerifyTicketChains walks the event chain of one ticket, or of every tenant
+// ticket with events on input.Day, and reports defects. Day scope also
+// recomputes the day's Merkle root and compares it with the sealed digest.
+func (s *Store) VerifyTicketChains(ctx context.Context, input store.ChainVerifyInput) (store.ChainReport, error) {
+	report := store.ChainReport{TenantID: input.TenantID, TicketID: input.TicketID, Issues: []store.ChainIssue{}}
+	var rows pgx.Rows
+	var err error
+	if input.TicketID != "" {
+		rows, err = s.pool.Query(ctx, `
+			SELECT e.ticket_id, e.ticket_seq, e.type, e.payload, e.created_at, COALESCE(e.prev_hash, ''), COALESCE(e.hash, '')
+			FROM ticket_events e
+			JOIN tickets t ON t.ticket_id = e.ticket_id
+			WHERE t.tenant_id = $1 AND e.ticket_id = $2
+			ORDER BY e.ticket_seq ASC
+		`, input.TenantID, input.TicketID)
+	} else {
+		dayStart := input.Day.UTC().Truncate(24 * time.Hour)
+		report.Date = dayStart.Format("2006-01-02")
+		rows, err = s.pool.Query(ctx, `
+			SELECT e.ticket_id, e.ticket_seq, e.type, e.payload, e.created_at, COALESCE(e.prev_hash, ''), COALESCE(e.hash, '')
+			FROM ticket_events e
+			JOIN tickets t ON t.ticket_id = e.ticket_id
+			WHERE t.tenant_id = $1 AND e.ticket_id IN (
+				SELECT ticket_id FROM ticket_events WHERE created_at >= $2 AND created_at < $3
+			)
+			ORDER BY e.ticket_id ASC, e.ticket_seq ASC
+		`, input.TenantID, dayStart, dayStart.Add(24*time.Hour))
+	}
 	if err != nil {
-		return nil, err
+		return store.ChainReport{}, err
 	}
 	defer rows.Close()
 
-	var counters []models.Counter
+	var chain []store.TicketEvent
+	flush := func() {
+		if len(chain) == 0 {
+			return
+		}
+		report.TicketsChecked++
+		report.EventsChecked += len(chain)
+		report.Issues = append(report.Issues, store.VerifyTicketChain(chain)...)
+		chain = nil
+	}
 	for rows.Next() {
-		var counter models.Counter
-		if err := rows.Scan(&counter.CounterID, &counter.BranchID, &counter.Name, &counter.Status); err != nil {
-			return nil, err
+		var event store.TicketEvent
+		if err := rows.Scan(&event.TicketID, &event.TicketSeq, &event.Type, &event.Payload, &event.CreatedAt, &event.PrevHash, &event.Hash); err != nil {
+			return store.ChainReport{}, err
 		}
-		counters = append(counters, counter)
+		if len(chain) > 0 && chain[0].TicketID != event.TicketID {
+			flush()
+		}
+		chain = append(chain, event)
 	}
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return store.ChainReport{}, err
 	}
-	return counters, nil
-}
+	flush()
 
-func (s *Store) UpdateCounterStatus(ctx context.Context, tenantID, branchID, counterID, status string) error {
-	tag, err := s.pool.Exec(ctx, `
-		UPDATE counters c
-		SET status = $1
-		FROM branches b
-		WHERE c.counter_id = $2 AND c.branch_id = $3 AND b.branch_id = c.branch_id AND b.tenant_id = $4
-	`, status, counterID, branchID, tenantID)
+	if input.TicketID != "" {
+		return report, nil
+	}
+	root, _, err := dayMerkleRoot(ctx, s.pool, input.TenantID, input.Day)
 	if err != nil {
-		return err
+		return store.ChainReport{}, err
 	}
-	if tag.RowsAffected() == 0 {
-		return store.ErrCounterNotFound
+	report.MerkleRoot = root
+	var storedRoot string
+	row := s.pool.QueryRow(ctx, `
+		SELECT merkle_root FROM ticket_event_digests WHERE tenant_id = $1 AND digest_date = $2::date
+	`, input.TenantID, report.Date)
+	if err := row.Scan(&storedRoot); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return report, nil
+		}
+		return store.ChainReport{}, err
 	}
-	return nil
+	matches := storedRoot == root
+	report.StoredRoot = storedRoot
+	report.DigestMatches = &matches
+	return report, nil
 }
 
-func (s *Store) ListServices(ctx context.Context, tenantID, branchID string) ([]models.Service, error) {
+func (s *Store) ListEventDigests(ctx context.Context, tenantID string, from, to time.Time) ([]store.EventDigest, error) {
 	rows, err := s.pool.Query(ctx, `
-		SELECT s.service_id, s.branch_id, s.name, s.code, s.sla_minutes, s.priority_policy, COALESCE(s.hours_json::text, '')
-		FROM services s
-		JOIN branches b ON b.branch_id = s.branch_id
-		WHERE b.tenant_id = $1 AND s.branch_id = $2 AND s.active = TRUE
-		ORDER BY s.name ASC
-	`, tenantID, branchID)
+		SELECT tenant_id, digest_date, event_count, merkle_root, chain_issues, created_at
+		FROM ticket_event_digests
+		WHERE tenant_id = $1 AND digest_date >= $2::date AND digest_date <= $3::date
+		ORDER BY digest_date ASC
+	`, tenantID, from.UTC().Format("2006-01-02"), to.UTC().Format("2006-01-02"))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var services []models.Service
+	var digests []store.EventDigest
 	for rows.Next() {
-		var svc models.Service
-		if err := rows.Scan(&svc.ServiceID, &svc.BranchID, &svc.Name, &svc.Code, &svc.SLAMinutes, &svc.PriorityPolicy, &svc.HoursJSON); err != nil {
+		var digest store.EventDigest
+		var date time.Time
+		if err := rows.Scan(&digest.TenantID, &date, &digest.EventCount, &digest.MerkleRoot, &digest.ChainIssues, &digest.CreatedAt); err != nil {
 			return nil, err
 		}
-		services = append(services, svc)
+		digest.Date = date.Format("2006-01-02")
+		digests = append(digests, digest)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	return services, nil
+	return digests, nil
 }
 
-func (s *Store) CheckInAppointment(ctx context.Context, requestID, tenantID, branchID, appointmentID string) (models.Ticket, error) {
-	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+// SealEventDigests verifies and seals the Merkle root for every tenant with
+// ticket events on day that has no digest yet. Existing digests are never
+// rewritten, so a later mismatch proves the events changed.
+func (s *Store) SealEventDigests(ctx context.Context, day time.Time) ([]store.EventDigest, error) {
+	dayStart := day.UTC().Truncate(24 * time.Hour)
+	date := dayStart.Format("2006-01-02")
+	rows, err := s.pool.Query(ctx, `
+		SELECT DISTINCT t.tenant_id
+		FROM ticket_events e
+		JOIN tickets t ON t.ticket_id = e.ticket_id
+		WHERE e.created_at >= $1 AND e.created_at < $2
+			AND NOT EXISTS (
+				SELECT 1 FROM ticket_event_digests d WHERE d.tenant_id = t.tenant_id AND d.digest_date = $3::date
+			)
+	`, dayStart, dayStart.Add(24*time.Hour), date)
 	if err != nil {
-		return models.Ticket{}, err
+		return nil, err
 	}
-	defer func() {
+	var tenants []string
+	for rows.Next() {
+		var tenantID string
+		if err := rows.Scan(&tenantID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tenants = append(tenants, tenantID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var sealed []store.EventDigest
+	for _, tenantID := range tenants {
+		report, err := s.VerifyTicketChains(ctx, store.ChainVerifyInput{TenantID: tenantID, Day: dayStart})
 		if err != nil {
-			_ = tx.Rollback(ctx)
+			return sealed, err
 		}
-	}()
+		root, count, err := dayMerkleRoot(ctx, s.pool, tenantID, dayStart)
+		if err != nil {
+			return sealed, err
+		}
+		digest := store.EventDigest{
+			TenantID:    tenantID,
+			Date:        date,
+			EventCount:  count,
+			MerkleRoot:  root,
+			ChainIssues: len(report.Issues),
+		}
+		tag, err := s.pool.Exec(ctx, `
+			INSERT INTO ticket_event_digests (tenant_id, digest_date, event_count, merkle_root, chain_issues, created_at)
+			VALUES ($1, $2::date, $3, $4, $5, $6)
+			ON CONFLICT (tenant_id, digest_date) DO NOTHING
+		`, tenantID, date, count, root, digest.ChainIssues, time.Now().UTC())
+		if err != nil {
+			return sealed, err
+		}
+		if tag.RowsAffected() == 0 {
+			continue
+		}
+		sealed = append(sealed, digest)
+	}
+	return sealed, nil
+}
 
-	existing, found, err := findTicketByRequestID(ctx, tx, requestID)
+// dayMerkleRoot computes the Merkle root over a tenant's ticket event hashes
+// for one UTC day, ordered by creation time, ticket and sequence.
+func dayMerkleRoot(ctx context.Context, pool *pgxpool.Pool, tenantID string, day time.Time) (string, int, error) {
+	dayStart := day.UTC().Truncate(24 * time.Hour)
+	rows, err := pool.Query(ctx, `
+		SELECT COALESCE(e.hash, '')
+		FROM ticket_events e
+		JOIN tickets t ON t.ticket_id = e.ticket_id
+		WHERE t.tenant_id = $1 AND e.created_at >= $2 AND e.created_at < $3
+		ORDER BY e.created_at ASC, e.ticket_id ASC, e.ticket_seq ASC
+	`, tenantID, dayStart, dayStart.Add(24*time.Hour))
 	if err != nil {
-		return models.Ticket{}, err
-	}
-	if found {
-		if err = tx.Commit(ctx); err != nil {
-			return models.Ticket{}, err
-		}
-		return existing, nil
+		return "", 0, err
 	}
+	defer rows.Close()
 
-	var serviceID string
-	var scheduledDate time.Time
-	row := tx.QueryRow(ctx, `
-		SELECT service_id, scheduled_at::date
-		FROM appointments
-		WHERE appointment_id = $1 AND tenant_id = $2 AND branch_id = $3 AND status = 'scheduled'
-	`, appointmentID, tenantID, branchID)
-	if err = row.Scan(&serviceID, &scheduledDate); err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return models.Ticket{}, store.ErrTicketNotFound
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return "", 0, err
 		}
-		return models.Ticket{}, err
+		hashes = append(hashes, hash)
+	}
+	if err := rows.Err(); err != nil {
+		return "", 0, err
 	}
+	return store.MerkleRoot(hashes), len(hashes), nil
+}
 
-	var holidayExists bool
-	row = tx.QueryRow(ctx, `
-		SELECT EXISTS (
-			SELECT 1
-			FROM holidays
-			WHERE tenant_id = $1 AND branch_id = $2 AND date = $3
-		)
-	`, tenantID, branchID, scheduledDate)
-	if err = row.Scan(&holidayExists); err != nil {
-		return models.Ticket{}, err
+// ReplayTickets rebuilds each ticket in scope from its ticket_events and
+// reports where the tickets projection has drifted. With input.Repair the
+// drifted columns are overwritten with the replayed values.
+func (s *Store) ReplayTickets(ctx context.Context, input store.ReplayInput) (store.ReplayReport, error) {
+	limit := input.Limit
+	if limit <= 0 {
+		limit = store.DefaultReplayLimit
 	}
-	if holidayExists {
-		return models.Ticket{}, store.ErrHolidayClosed
+	if limit > store.MaxReplayLimit {
+		limit = store.MaxReplayLimit
 	}
 
-	_, err = tx.Exec(ctx, `
-		UPDATE appointments
-		SET status = 'checked_in'
-		WHERE appointment_id = $1
-	`, appointmentID)
-	if err != nil {
-		return models.Ticket{}, err
+	conditions := []string{"tenant_id = $1"}
+	args := []interface{}{input.TenantID}
+	addFilter := func(clause string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(clause, len(args)))
 	}
-
-	serviceCode, err := lookupServiceCode(ctx, tx, store.CreateTicketInput{
-		TenantID:  tenantID,
-		BranchID:  branchID,
-		ServiceID: serviceID,
-	})
-	if err != nil {
-		return models.Ticket{}, err
+	if input.TicketID != "" {
+		addFilter("ticket_id = $%d", input.TicketID)
 	}
-	seq, err := nextTicketNumber(ctx, tx, branchID, serviceID)
-	if err != nil {
-		return models.Ticket{}, err
+	if input.ServiceID != "" {
+		addFilter("service_id = $%d", input.ServiceID)
 	}
-	formattedNumber := fmt.Sprintf("%s-%0*d", serviceCode, ticketNumberPad, seq)
-	ticketID := uuid.NewString()
-	createdAt := time.Now().UTC()
-
-	var ticket models.Ticket
-	row = tx.QueryRow(ctx, `
-		INSERT INTO tickets (
-			ticket_id, request_id, ticket_number, tenant_id, branch_id, service_id, status, channel, priority_class, created_at, appointment_id
-		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
-		RETURNING ticket_id, ticket_number, status, created_at, request_id
-	`, ticketID, requestID, formattedNumber, tenantID, branchID, serviceID, models.StatusWaiting, "kiosk", "regular", createdAt, appointmentID)
-	if err = row.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.CreatedAt, &ticket.RequestID); err != nil {
-		return models.Ticket{}, err
+	if !input.From.IsZero() {
+		addFilter("created_at >= $%d", input.From)
 	}
-	ticket.TenantID = tenantID
-	ticket.BranchID = branchID
-	ticket.ServiceID = serviceID
-
-	if err = insertOutboxEvent(ctx, tx, tenantID, ticket); err != nil {
-		return models.Ticket{}, err
+	if !input.To.IsZero() {
+		addFilter("created_at < $%d", input.To)
 	}
+	args = append(args, limit+1)
+	query := fmt.Sprintf(`
+		SELECT ticket_id
+		FROM tickets
+		WHERE %s
+		ORDER BY created_at ASC, ticket_id ASC
+		LIMIT $%d
+	`, strings.Join(conditions, " AND "), len(args))
 
-	if err = tx.Commit(ctx); err != nil {
-		return models.Ticket{}, err
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return store.ReplayReport{}, err
+	}
+	var ticketIDs []string
+	for rows.Next() {
+		var ticketID string
+		if err := rows.Scan(&ticketID); err != nil {
+			rows.Close()
+			return store.ReplayReport{}, err
+		}
+		ticketIDs = append(ticketIDs, ticketID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return store.ReplayReport{}, err
+	}
+
+	report := store.ReplayReport{TenantID: input.TenantID, Tickets: []store.TicketDrift{}}
+	if len(ticketIDs) > limit {
+		ticketIDs = ticketIDs[:limit]
+		report.Truncated = true
+	}
+	for _, ticketID := range ticketIDs {
+		drift, err := s.replayTicket(ctx, input.TenantID, ticketID, input.Repair)
+		if err != nil {
+			return report, err
+		}
+		report.TicketsChecked++
+		if !drift.NoEvents && len(drift.Fields) == 0 {
+			continue
+		}
+		report.Drifted++
+		if drift.Repaired {
+			report.Repaired++
+		}
+		report.Tickets = append(report.Tickets, drift)
+	}
+	return report, nil
+}
+
+func (s *Store) replayTicket(ctx context.Context, tenantID, ticketID string, repair bool) (store.TicketDrift, error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return store.TicketDrift{}, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+		}
+	}()
+
+	var projection models.Ticket
+	var calledAtNull sql.NullTime
+	var servedAtNull sql.NullTime
+	var completedAtNull sql.NullTime
+	var counterIDNull sql.NullString
+	row := tx.QueryRow(ctx, `
+		SELECT ticket_id, ticket_number, status, service_id, created_at, called_at, served_at, completed_at, counter_id
+		FROM tickets
+		WHERE ticket_id = $1 AND tenant_id = $2
+		FOR UPDATE
+	`, ticketID, tenantID)
+	if err = row.Scan(&projection.TicketID, &projection.TicketNumber, &projection.Status, &projection.ServiceID, &projection.CreatedAt,
+		&calledAtNull, &servedAtNull, &completedAtNull, &counterIDNull); err != nil {
+		return store.TicketDrift{}, err
+	}
+	projection.CalledAt = nullTimePtr(calledAtNull)
+	projection.ServedAt = nullTimePtr(servedAtNull)
+	projection.CompletedAt = nullTimePtr(completedAtNull)
+	projection.CounterID = nullStringPtr(counterIDNull)
+
+	var rows pgx.Rows
+	rows, err = tx.Query(ctx, `
+		SELECT ticket_id, ticket_seq, type, payload, created_at
+		FROM ticket_events
+		WHERE ticket_id = $1
+		ORDER BY ticket_seq ASC
+	`, ticketID)
+	if err != nil {
+		return store.TicketDrift{}, err
+	}
+	var events []store.TicketEvent
+	for rows.Next() {
+		var event store.TicketEvent
+		if err = rows.Scan(&event.TicketID, &event.TicketSeq, &event.Type, &event.Payload, &event.CreatedAt); err != nil {
+			rows.Close()
+			return store.TicketDrift{}, err
+		}
+		events = append(events, event)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return store.TicketDrift{}, err
+	}
+
+	drift := store.TicketDrift{TicketID: ticketID, TicketNumber: projection.TicketNumber}
+	if len(events) == 0 {
+		drift.NoEvents = true
+	} else {
+		var rebuilt models.Ticket
+		rebuilt, err = store.RehydrateTicket(events)
+		if err != nil {
+			return store.TicketDrift{}, err
+		}
+		drift.Fields = store.CompareProjection(projection, rebuilt)
+		if repair && len(drift.Fields) > 0 {
+			if err = repairProjection(ctx, tx, ticketID, rebuilt, drift.Fields); err != nil {
+				return store.TicketDrift{}, err
+			}
+			drift.Repaired = true
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return store.TicketDrift{}, err
+	}
+	return drift, nil
+}
+
+// repairProjection overwrites only the drifted columns with replayed values.
+func repairProjection(ctx context.Context, tx pgx.Tx, ticketID string, rebuilt models.Ticket, fields []store.FieldDrift) error {
+	values := map[string]interface{}{
+		"status":       rebuilt.Status,
+		"service_id":   rebuilt.ServiceID,
+		"created_at":   rebuilt.CreatedAt,
+		"called_at":    rebuilt.CalledAt,
+		"served_at":    rebuilt.ServedAt,
+		"completed_at": rebuilt.CompletedAt,
+		"counter_id":   rebuilt.CounterID,
+	}
+	var sets []string
+	args := []interface{}{ticketID}
+	for _, field := range fields {
+		value, ok := values[field.Field]
+		if !ok {
+			continue
+		}
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", field.Field, len(args)))
+	}
+	if len(sets) == 0 {
+		return nil
+	}
+	_, err := tx.Exec(ctx, fmt.Sprintf(`UPDATE tickets SET %s WHERE ticket_id = $1`, strings.Join(sets, ", ")), args...)
+	return err
+}
+
+func (s *Store) ListCounters(ctx context.Context, tenantID, branchID string) ([]models.Counter, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT c.counter_id, c.branch_id, c.name, c.status,
+			GREATEST(COALESCE((SELECT SUM(r.capacity) FROM resources r WHERE r.counter_id = c.counter_id AND r.active = TRUE), 0), 1),
+			(SELECT COUNT(1) FROM tickets t WHERE t.counter_id = c.counter_id AND t.status IN ('called', 'serving'))
+		FROM counters c
+		JOIN branches b ON b.branch_id = c.branch_id
+		WHERE b.tenant_id = $1 AND c.branch_id = $2
+		ORDER BY c.name ASC
+	`, tenantID, branchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counters []models.Counter
+	for rows.Next() {
+		var counter models.Counter
+		if err := rows.Scan(&counter.CounterID, &counter.BranchID, &counter.Name, &counter.Status, &counter.Capacity, &counter.InUse); err != nil {
+			return nil, err
+		}
+		counters = append(counters, counter)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return counters, nil
+}
+
+func (s *Store) UpdateCounterStatus(ctx context.Context, tenantID, branchID, counterID, status string) error {
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE counters c
+		SET status = $1
+		FROM branches b
+		WHERE c.counter_id = $2 AND c.branch_id = $3 AND b.branch_id = c.branch_id AND b.tenant_id = $4
+	`, status, counterID, branchID, tenantID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return store.ErrCounterNotFound
+	}
+	return nil
+}
+
+func (s *Store) BranchLocation(ctx context.Context, tenantID, branchID string) (*time.Location, error) {
+	var name string
+	err := s.pool.QueryRow(ctx, `
+		SELECT timezone
+		FROM branches
+		WHERE branch_id = $1 AND tenant_id = $2
+	`, branchID, tenantID).Scan(&name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.UTC, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return time.LoadLocation(name)
+}
+
+func (s *Store) ListServices(ctx context.Context, tenantID, branchID string) ([]models.Service, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT s.service_id, s.branch_id, s.name, s.code, s.sla_minutes, s.duration_minutes, s.priority_policy, COALESCE(s.hours_json::text, ''),
+			(SELECT COALESCE(SUM(GREATEST(COALESCE((SELECT SUM(r.capacity) FROM resources r WHERE r.counter_id = c.counter_id AND r.active = TRUE), 0), 1)), 0)
+				FROM counters c
+				JOIN counter_services cs ON cs.counter_id = c.counter_id
+				WHERE cs.service_id = s.service_id AND c.status IN ('active', 'available', 'busy'))
+		FROM services s
+		JOIN branches b ON b.branch_id = s.branch_id
+		WHERE b.tenant_id = $1 AND s.branch_id = $2 AND s.active = TRUE
+		ORDER BY s.name ASC
+	`, tenantID, branchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var services []models.Service
+	for rows.Next() {
+		var svc models.Service
+		if err := rows.Scan(&svc.ServiceID, &svc.BranchID, &svc.Name, &svc.Code, &svc.SLAMinutes, &svc.DurationMinutes, &svc.PriorityPolicy, &svc.HoursJSON, &svc.ParallelCapacity); err != nil {
+			return nil, err
+		}
+		if svc.ParallelCapacity < 1 {
+			svc.ParallelCapacity = 1
+		}
+		services = append(services, svc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return services, nil
+}
+
+func (s *Store) CheckInAppointment(ctx context.Context, requestID, tenantID, branchID, appointmentID string) (models.Ticket, error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return models.Ticket{}, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+		}
+	}()
+
+	existing, found, err := findTicketByRequestID(ctx, tx, requestID)
+	if err != nil {
+		return models.Ticket{}, err
+	}
+	if found {
+		if err = tx.Commit(ctx); err != nil {
+			return models.Ticket{}, err
+		}
+		return existing, nil
+	}
+
+	var serviceID string
+	var scheduledAt, scheduledDate time.Time
+	var refTypeNull sql.NullString
+	var refHashNull sql.NullString
+	var refEnc []byte
+	row := tx.QueryRow(ctx, `
+		SELECT service_id, scheduled_at, scheduled_at::date, customer_ref_type, customer_ref_hash, customer_ref_enc
+		FROM appointments
+		WHERE appointment_id = $1 AND tenant_id = $2 AND branch_id = $3 AND status = 'scheduled'
+	`, appointmentID, tenantID, branchID)
+	if err = row.Scan(&serviceID, &scheduledAt, &scheduledDate, &refTypeNull, &refHashNull, &refEnc); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Ticket{}, store.ErrTicketNotFound
+		}
+		return models.Ticket{}, err
+	}
+
+	var holidayExists bool
+	row = tx.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM holidays
+			WHERE tenant_id = $1 AND branch_id = $2 AND date = $3
+		)
+	`, tenantID, branchID, scheduledDate)
+	if err = row.Scan(&holidayExists); err != nil {
+		return models.Ticket{}, err
+	}
+	if holidayExists {
+		return models.Ticket{}, store.ErrHolidayClosed
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE appointments
+		SET status = 'checked_in'
+		WHERE appointment_id = $1
+	`, appointmentID)
+	if err != nil {
+		return models.Ticket{}, err
+	}
+
+	serviceCode, err := lookupServiceCode(ctx, tx, store.CreateTicketInput{
+		TenantID:  tenantID,
+		BranchID:  branchID,
+		ServiceID: serviceID,
+	})
+	if err != nil {
+		return models.Ticket{}, err
+	}
+	seq, err := nextTicketNumber(ctx, tx, branchID, serviceID)
+	if err != nil {
+		return models.Ticket{}, err
+	}
+	formattedNumber := fmt.Sprintf("%s-%0*d", serviceCode, ticketNumberPad, seq)
+
+	ticketID := uuid.NewString()
+	createdAt := time.Now().UTC()
+
+	var ticket models.Ticket
+	row = tx.QueryRow(ctx, `
+		INSERT INTO tickets (
+			ticket_id, request_id, ticket_number, tenant_id, branch_id, service_id, status, channel, priority_class, created_at, queued_at, appointment_id,
+			customer_ref_type, customer_ref_hash, customer_ref_enc
+		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$10,$11,$12,$13,$14)
+		RETURNING ticket_id, ticket_number, status, created_at, request_id
+	`, ticketID, requestID, formattedNumber, tenantID, branchID, serviceID, models.StatusWaiting, "kiosk", "regular", createdAt, appointmentID,
+		refTypeNull, refHashNull, refEnc)
+	if err = row.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.CreatedAt, &ticket.RequestID); err != nil {
+		return models.Ticket{}, err
+	}
+	ticket.PartySize = 1
+	ticket.TenantID = tenantID
+	ticket.BranchID = branchID
+	ticket.ServiceID = serviceID
+	ticket.CustomerRefType = refTypeNull.String
+	ticket.PriorityClass = "regular"
+
+	if err = insertOutboxEvent(ctx, tx, tenantID, ticket, &scheduledAt); err != nil {
+		return models.Ticket{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return models.Ticket{}, err
 	}
 	return ticket, nil
 }
@@ -824,23 +1460,1344 @@ func (s *Store) CompleteTicket(ctx context.Context, input store.TicketActionInpu
 }
 
 func (s *Store) CancelTicket(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
-	return s.updateTicketStatus(ctx, input, "cancel", models.StatusWaiting, models.StatusCancelled, "ticket.cancelled", "", false)
+	ticket, created, err := s.updateTicketStatus(ctx, input, "cancel", models.StatusWaiting, models.StatusCancelled, "ticket.cancelled", "cancelled_at", false)
+	if errors.Is(err, store.ErrInvalidState) {
+		// Remote tickets that never arrived can be cancelled as well.
+		return s.updateTicketStatus(ctx, input, "cancel", models.StatusRemote, models.StatusCancelled, "ticket.cancelled", "cancelled_at", false)
+	}
+	return ticket, created, err
 }
 
-func (s *Store) HoldTicket(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
-	return s.updateTicketStatus(ctx, input, "hold", models.StatusWaiting, models.StatusHeld, "ticket.held", "", false)
-}
+// PostponeTicket lets a waiting customer defer their own ticket, either by a
+// number of places or by joining the queue as if they arrived after the delay.
+// Only queued_at moves; the previous value is kept in the ticket.postponed
+// event. A queued_at in the future keeps the ticket from being called before
+// then.
+func (s *Store) PostponeTicket(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return models.Ticket{}, false, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+		}
+	}()
+
+	existing, found, empty, err := findActionRequest(ctx, tx, "postpone", input.RequestID)
+	if err != nil {
+		return models.Ticket{}, false, err
+	}
+	if found {
+		if err = tx.Commit(ctx); err != nil {
+			return models.Ticket{}, false, err
+		}
+		if empty {
+			return models.Ticket{}, false, store.ErrInvalidState
+		}
+		return existing, false, nil
+	}
+
+	var status string
+	var serviceID string
+	var queuedAt time.Time
+	var postponeCount int
+	row := tx.QueryRow(ctx, `
+		SELECT status, service_id, queued_at, postpone_count
+		FROM tickets
+		WHERE ticket_id = $1 AND tenant_id = $2 AND branch_id = $3
+		FOR UPDATE
+	`, input.TicketID, input.TenantID, input.BranchID)
+	if err = row.Scan(&status, &serviceID, &queuedAt, &postponeCount); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Ticket{}, false, store.ErrTicketNotFound
+		}
+		return models.Ticket{}, false, err
+	}
+	if !store.ValidTransition("postpone", status) {
+		return models.Ticket{}, false, store.ErrInvalidState
+	}
+
+	policy, found, err := getServicePolicy(ctx, tx, input.TenantID, input.BranchID, serviceID)
+	if err != nil {
+		return models.Ticket{}, false, err
+	}
+	if !found {
+		policy.MaxPostpones = defaultMaxPostpones
+		policy.MaxPostponePlaces = defaultMaxPostponePlaces
+		policy.MaxPostponeMinutes = defaultMaxPostponeMinutes
+	}
+	if postponeCount >= policy.MaxPostpones {
+		return models.Ticket{}, false, store.ErrPostponeLimit
+	}
+
+	now := input.OccurredAt
+	if now.IsZero() {
+		now = time.Now().UTC()
+	}
+	newQueuedAt := queuedAt
+	places := 0
+	var delay time.Duration
+	if input.PostponePlaces > 0 {
+		places = input.PostponePlaces
+		if places > policy.MaxPostponePlaces {
+			places = policy.MaxPostponePlaces
+		}
+		if places <= 0 {
+			return models.Ticket{}, false, store.ErrPostponeLimit
+		}
+		var behind []time.Time
+		var rows pgx.Rows
+		rows, err = tx.Query(ctx, `
+			SELECT queued_at
+			FROM tickets
+			WHERE tenant_id = $1 AND branch_id = $2 AND service_id = $3 AND status = 'waiting'
+				AND queued_at > $4 AND ticket_id <> $5
+			ORDER BY queued_at ASC
+			LIMIT $6
+		`, input.TenantID, input.BranchID, serviceID, queuedAt, input.TicketID, places)
+		if err != nil {
+			return models.Ticket{}, false, err
+		}
+		for rows.Next() {
+			var aheadAt time.Time
+			if err = rows.Scan(&aheadAt); err != nil {
+				rows.Close()
+				return models.Ticket{}, false, err
+			}
+			behind = append(behind, aheadAt)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return models.Ticket{}, false, err
+		}
+		places = len(behind)
+		if places == 0 {
+			return models.Ticket{}, false, store.ErrNothingToPostpone
+		}
+		// Slot in right after the last ticket we let ahead.
+		newQueuedAt = behind[places-1].Add(time.Microsecond)
+	} else {
+		delay = input.PostponeDelay
+		maxDelay := time.Duration(policy.MaxPostponeMinutes) * time.Minute
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+		if delay <= 0 {
+			return models.Ticket{}, false, store.ErrPostponeLimit
+		}
+		newQueuedAt = now.Add(delay)
+	}
+
+	if err = tx.QueryRow(ctx, `
+		UPDATE tickets
+		SET queued_at = $1,
+			postpone_count = postpone_count + 1
+		WHERE ticket_id = $2
+		RETURNING postpone_count
+	`, newQueuedAt, input.TicketID).Scan(&postponeCount); err != nil {
+		return models.Ticket{}, false, err
+	}
+
+	ticket, err := getTicketByID(ctx, tx, input.TicketID, input.TenantID, input.BranchID)
+	if err != nil {
+		return models.Ticket{}, false, err
+	}
+	ticket.RequestID = input.RequestID
+	ticket.PostponeCount = postponeCount
+
+	if err = insertActionRequest(ctx, tx, "postpone", input.RequestID, input.TenantID, input.BranchID, serviceID, "", ticket.TicketID); err != nil {
+		return models.Ticket{}, false, err
+	}
+	if err = insertOutboxEventPostponed(ctx, tx, input.TenantID, ticket, queuedAt, newQueuedAt, places, delay); err != nil {
+		return models.Ticket{}, false, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return models.Ticket{}, false, err
+	}
+	return ticket, true, nil
+}
+
+func (s *Store) HoldTicket(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return models.Ticket{}, false, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+		}
+	}()
+
+	existing, found, empty, err := findActionRequest(ctx, tx, "hold", input.RequestID)
+	if err != nil {
+		return models.Ticket{}, false, err
+	}
+	if found {
+		if err = tx.Commit(ctx); err != nil {
+			return models.Ticket{}, false, err
+		}
+		if empty {
+			return models.Ticket{}, false, store.ErrInvalidState
+		}
+		return existing, false, nil
+	}
+
+	current, err := getTicketByID(ctx, tx, input.TicketID, input.TenantID, input.BranchID)
+	if err != nil {
+		return models.Ticket{}, false, err
+	}
+	if !store.ValidTransition("hold", current.Status) {
+		return models.Ticket{}, false, store.ErrInvalidState
+	}
+
+	policy, found, err := getServicePolicy(ctx, tx, input.TenantID, input.BranchID, current.ServiceID)
+	if err != nil {
+		return models.Ticket{}, false, err
+	}
+	maxDuration := s.holdDuration
+	if found && policy.HoldMaxSeconds > 0 {
+		maxDuration = time.Duration(policy.HoldMaxSeconds) * time.Second
+	}
+	duration := input.HoldDuration
+	if duration <= 0 || duration > maxDuration {
+		duration = maxDuration
+	}
+
+	heldAt := input.OccurredAt
+	if heldAt.IsZero() {
+		heldAt = time.Now().UTC()
+	}
+	expiresAt := heldAt.Add(duration)
+
+	holdCounterID := input.CounterID
+	if holdCounterID == "" && current.CounterID != nil {
+		holdCounterID = *current.CounterID
+	}
+
+	var ticket models.Ticket
+	var areaIDNull sql.NullString
+	var holdReasonNull sql.NullString
+	var heldAtNull sql.NullTime
+	var holdExpiresAtNull sql.NullTime
+	var holdCounterIDNull sql.NullString
+	row := tx.QueryRow(ctx, `
+		UPDATE tickets
+		SET status = 'held',
+			counter_id = NULL,
+			called_at = NULL,
+			hold_reason = $5,
+			held_at = $6,
+			hold_expires_at = $7,
+			hold_counter_id = $8
+		WHERE ticket_id = $1 AND tenant_id = $2 AND branch_id = $3 AND status = $4
+		RETURNING ticket_id, ticket_number, status, created_at, branch_id, service_id, area_id, tenant_id, hold_reason, held_at, hold_expires_at, hold_counter_id
+	`, input.TicketID, input.TenantID, input.BranchID, current.Status, nullIfEmpty(input.Reason), heldAt, expiresAt, nullIfEmpty(holdCounterID))
+	if err = row.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.CreatedAt, &ticket.BranchID, &ticket.ServiceID, &areaIDNull, &ticket.TenantID, &holdReasonNull, &heldAtNull, &holdExpiresAtNull, &holdCounterIDNull); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Ticket{}, false, store.ErrInvalidState
+		}
+		return models.Ticket{}, false, err
+	}
+	ticket.RequestID = input.RequestID
+	if areaIDNull.Valid {
+		ticket.AreaID = areaIDNull.String
+	}
+	applyHoldFields(&ticket, holdReasonNull, heldAtNull, holdExpiresAtNull, holdCounterIDNull)
+
+	if err = insertActionRequest(ctx, tx, "hold", input.RequestID, input.TenantID, input.BranchID, ticket.ServiceID, holdCounterID, ticket.TicketID); err != nil {
+		return models.Ticket{}, false, err
+	}
+
+	if err = insertOutboxEventHold(ctx, tx, input.TenantID, "ticket.held", ticket, ""); err != nil {
+		return models.Ticket{}, false, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return models.Ticket{}, false, err
+	}
+
+	return ticket, true, nil
+}
+
+func (s *Store) UnholdTicket(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return models.Ticket{}, false, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+		}
+	}()
+
+	existing, found, empty, err := findActionRequest(ctx, tx, "unhold", input.RequestID)
+	if err != nil {
+		return models.Ticket{}, false, err
+	}
+	if found {
+		if err = tx.Commit(ctx); err != nil {
+			return models.Ticket{}, false, err
+		}
+		if empty {
+			return models.Ticket{}, false, store.ErrInvalidState
+		}
+		return existing, false, nil
+	}
+
+	ticket, err := releaseHold(ctx, tx, input.TicketID, input.TenantID, input.BranchID, models.StatusWaiting)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			if _, _, exists, lookupErr := loadTicketState(ctx, tx, input.TicketID, input.TenantID, input.BranchID); lookupErr != nil {
+				err = lookupErr
+				return models.Ticket{}, false, err
+			} else if !exists {
+				return models.Ticket{}, false, store.ErrTicketNotFound
+			}
+			return models.Ticket{}, false, store.ErrInvalidState
+		}
+		return models.Ticket{}, false, err
+	}
+	ticket.RequestID = input.RequestID
+
+	if err = insertActionRequest(ctx, tx, "unhold", input.RequestID, input.TenantID, input.BranchID, ticket.ServiceID, input.CounterID, ticket.TicketID); err != nil {
+		return models.Ticket{}, false, err
+	}
+
+	if err = insertOutboxEventHold(ctx, tx, input.TenantID, "ticket.unheld", ticket, ""); err != nil {
+		return models.Ticket{}, false, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return models.Ticket{}, false, err
+	}
+
+	return ticket, true, nil
+}
+
+func (s *Store) ListHeldTickets(ctx context.Context, tenantID, branchID, counterID string) ([]models.Ticket, error) {
+	query := `
+		SELECT ticket_id, ticket_number, status, created_at, branch_id, service_id, area_id, tenant_id, hold_reason, held_at, hold_expires_at, hold_counter_id
+		FROM tickets
+		WHERE tenant_id = $1 AND branch_id = $2 AND status = 'held'
+	`
+	args := []interface{}{tenantID, branchID}
+	if counterID != "" {
+		query += " AND hold_counter_id = $3"
+		args = append(args, counterID)
+	}
+	query += " ORDER BY hold_expires_at ASC NULLS LAST, queued_at ASC"
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tickets []models.Ticket
+	for rows.Next() {
+		var ticket models.Ticket
+		var areaIDNull sql.NullString
+		var holdReasonNull sql.NullString
+		var heldAtNull sql.NullTime
+		var holdExpiresAtNull sql.NullTime
+		var holdCounterIDNull sql.NullString
+		if err := rows.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.CreatedAt, &ticket.BranchID, &ticket.ServiceID, &areaIDNull, &ticket.TenantID, &holdReasonNull, &heldAtNull, &holdExpiresAtNull, &holdCounterIDNull); err != nil {
+			return nil, err
+		}
+		if areaIDNull.Valid {
+			ticket.AreaID = areaIDNull.String
+		}
+		applyHoldFields(&ticket, holdReasonNull, heldAtNull, holdExpiresAtNull, holdCounterIDNull)
+		tickets = append(tickets, ticket)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tickets, nil
+}
+
+// SearchTickets pages through ticket history newest first using a keyset
+// cursor on (created_at, ticket_id). Phone and customer reference are
+// matched on their hashes; raw values are never stored on tickets.
+func (s *Store) SearchTickets(ctx context.Context, input store.TicketSearchInput) (store.TicketSearchPage, error) {
+	limit := input.Limit
+	if limit <= 0 {
+		limit = store.DefaultSearchLimit
+	}
+	if limit > store.MaxSearchLimit {
+		limit = store.MaxSearchLimit
+	}
+
+	query := `
+		SELECT t.ticket_id, t.ticket_number, t.status, t.channel, t.priority_class, t.created_at, t.called_at, t.counter_id, t.served_at, t.completed_at,
+			t.cancelled_at, t.branch_id, t.service_id, t.area_id, t.tenant_id, t.party_size, t.recall_count
+		FROM tickets t
+		WHERE t.tenant_id = $1 AND t.branch_id = $2
+	`
+	args := []interface{}{input.TenantID, input.BranchID}
+	addFilter := func(clause string, value interface{}) {
+		args = append(args, value)
+		query += fmt.Sprintf(" AND "+clause, len(args))
+	}
+	if len(input.ServiceIDs) > 0 {
+		addFilter("t.service_id = ANY($%d::uuid[])", input.ServiceIDs)
+	}
+	if input.TicketNumber != "" {
+		addFilter("t.ticket_number = $%d", input.TicketNumber)
+	}
+	if len(input.Statuses) > 0 {
+		addFilter("t.status = ANY($%d)", input.Statuses)
+	}
+	if input.Channel != "" {
+		addFilter("t.channel = $%d", input.Channel)
+	}
+	if input.PriorityClass != "" {
+		addFilter("t.priority_class = $%d", input.PriorityClass)
+	}
+	if input.CounterID != "" {
+		addFilter("t.counter_id = $%d", input.CounterID)
+	}
+	if !input.From.IsZero() {
+		addFilter("t.created_at >= $%d", input.From)
+	}
+	if !input.To.IsZero() {
+		addFilter("t.created_at < $%d", input.To)
+	}
+	if phoneHash := hashPhone(input.Phone); phoneHash != nil {
+		addFilter("t.phone_hash = $%d", phoneHash)
+	}
+	if input.CustomerRef != "" {
+		refHash, err := s.customerRefs.Hash(input.CustomerRef)
+		if err != nil {
+			return store.TicketSearchPage{}, store.ErrCustomerRefNoKeys
+		}
+		addFilter("t.customer_ref_hash = $%d", refHash)
+	}
+	if input.Cursor != "" {
+		cursorAt, cursorID, err := store.DecodeSearchCursor(input.Cursor)
+		if err != nil {
+			return store.TicketSearchPage{}, err
+		}
+		args = append(args, cursorAt, cursorID)
+		query += fmt.Sprintf(" AND (t.created_at, t.ticket_id) < ($%d, $%d::uuid)", len(args)-1, len(args))
+	}
+	args = append(args, limit+1)
+	query += fmt.Sprintf(" ORDER BY t.created_at DESC, t.ticket_id DESC LIMIT $%d", len(args))
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return store.TicketSearchPage{}, err
+	}
+	defer rows.Close()
+
+	page := store.TicketSearchPage{Tickets: []models.Ticket{}}
+	for rows.Next() {
+		var ticket models.Ticket
+		var calledAtNull sql.NullTime
+		var counterIDNull sql.NullString
+		var servedAtNull sql.NullTime
+		var completedAtNull sql.NullTime
+		var cancelledAtNull sql.NullTime
+		var areaIDNull sql.NullString
+		if err := rows.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.Channel, &ticket.PriorityClass, &ticket.CreatedAt, &calledAtNull, &counterIDNull, &servedAtNull, &completedAtNull,
+			&cancelledAtNull, &ticket.BranchID, &ticket.ServiceID, &areaIDNull, &ticket.TenantID, &ticket.PartySize, &ticket.RecallCount); err != nil {
+			return store.TicketSearchPage{}, err
+		}
+		ticket.CalledAt = nullTimePtr(calledAtNull)
+		ticket.CounterID = nullStringPtr(counterIDNull)
+		ticket.ServedAt = nullTimePtr(servedAtNull)
+		ticket.CompletedAt = nullTimePtr(completedAtNull)
+		ticket.CancelledAt = nullTimePtr(cancelledAtNull)
+		if areaIDNull.Valid {
+			ticket.AreaID = areaIDNull.String
+		}
+		page.Tickets = append(page.Tickets, ticket)
+	}
+	if err := rows.Err(); err != nil {
+		return store.TicketSearchPage{}, err
+	}
+	if len(page.Tickets) > limit {
+		page.Tickets = page.Tickets[:limit]
+		last := page.Tickets[limit-1]
+		page.NextCursor = store.EncodeSearchCursor(last.CreatedAt, last.TicketID)
+	}
+	return page, nil
+}
+
+// ExpireHolds releases held tickets whose hold has lapsed, either back into the
+// queue at their original position or by cancelling them, per service policy.
+func (s *Store) ExpireHolds(ctx context.Context, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+		}
+	}()
+
+	rows, err := tx.Query(ctx, `
+		SELECT ticket_id, tenant_id, branch_id, service_id
+		FROM tickets
+		WHERE status = 'held' AND hold_expires_at IS NOT NULL AND hold_expires_at <= $1
+		ORDER BY hold_expires_at ASC
+		FOR UPDATE SKIP LOCKED
+		LIMIT $2
+	`, time.Now().UTC(), batchSize)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	type expiredHold struct {
+		ticketID  string
+		tenantID  string
+		branchID  string
+		serviceID string
+	}
+	var items []expiredHold
+	for rows.Next() {
+		var item expiredHold
+		if err = rows.Scan(&item.ticketID, &item.tenantID, &item.branchID, &item.serviceID); err != nil {
+			return 0, err
+		}
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	rows.Close()
+
+	var (
+		policy servicePolicy
+		found  bool
+		ticket models.Ticket
+	)
+	processed := 0
+	for _, item := range items {
+		policy, found, err = getServicePolicy(ctx, tx, item.tenantID, item.branchID, item.serviceID)
+		if err != nil {
+			return 0, err
+		}
+		action := s.holdExpiryAction
+		if found && policy.HoldExpiryAction != "" {
+			action = normalizeHoldExpiryAction(policy.HoldExpiryAction)
+		}
+		toStatus := models.StatusWaiting
+		if action == models.HoldExpiryCancel {
+			toStatus = models.StatusCancelled
+		}
+
+		ticket, err = releaseHold(ctx, tx, item.ticketID, item.tenantID, item.branchID, toStatus)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				err = nil
+				continue
+			}
+			return 0, err
+		}
+		if err = insertOutboxEventHold(ctx, tx, item.tenantID, "ticket.hold_expired", ticket, action); err != nil {
+			return 0, err
+		}
+		processed++
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return processed, nil
+}
+
+func (s *Store) NoShowTicket(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
+	return s.applyNoShow(ctx, input, input.ReturnToQueue)
+}
+
+// ReopenTicket reverses a mistaken complete or cancel while the terminal event is
+// still inside the reopen window. The ticket goes back to the status it held
+// before the terminal event; waiting tickets keep their queued_at and so their
+// original queue position.
+func (s *Store) ReopenTicket(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return models.Ticket{}, false, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+		}
+	}()
+
+	existing, found, empty, err := findActionRequest(ctx, tx, "reopen", input.RequestID)
+	if err != nil {
+		return models.Ticket{}, false, err
+	}
+	if found {
+		if err = tx.Commit(ctx); err != nil {
+			return models.Ticket{}, false, err
+		}
+		if empty {
+			return models.Ticket{}, false, store.ErrInvalidState
+		}
+		return existing, false, nil
+	}
+
+	current, err := lockTicketByID(ctx, tx, input.TicketID, input.TenantID, input.BranchID)
+	if err != nil {
+		return models.Ticket{}, false, err
+	}
+	if !store.ValidTransition("reopen", current.Status) {
+		return models.Ticket{}, false, store.ErrInvalidState
+	}
+
+	terminalAt, previousStatus, err := lastTerminalEvent(ctx, tx, current.TicketID, current.Status)
+	if err != nil {
+		return models.Ticket{}, false, err
+	}
+	occurredAt := input.OccurredAt
+	if occurredAt.IsZero() {
+		occurredAt = time.Now().UTC()
+	}
+	if terminalAt.IsZero() || occurredAt.Sub(terminalAt) > s.reopenWindow {
+		return models.Ticket{}, false, store.ErrReopenExpired
+	}
+
+	// A ticket goes back to its counter only while that counter can still
+	// take it; otherwise it rejoins the queue to be called again.
+	status, vacate, resourceID := previousStatus, false, ""
+	if previousStatus == models.StatusServing {
+		held := false
+		if current.CounterID != nil {
+			resourceID, held, err = reopenCounterSlot(ctx, tx, *current.CounterID, input.BranchID, current.TicketID)
+			if err != nil {
+				return models.Ticket{}, false, err
+			}
+		}
+		if !held {
+			status, vacate = models.StatusWaiting, true
+		}
+	}
+
+	var ticket models.Ticket
+	var calledAtNull sql.NullTime
+	var counterIDNull sql.NullString
+	var servedAtNull sql.NullTime
+	var areaIDNull sql.NullString
+	var reopenedAtNull sql.NullTime
+	row := tx.QueryRow(ctx, `
+		UPDATE tickets
+		SET status = $5,
+			completed_at = NULL,
+			cancelled_at = NULL,
+			reopened_at = $6,
+			reopen_count = reopen_count + 1,
+			counter_id = CASE WHEN $7 THEN NULL ELSE counter_id END,
+			called_at = CASE WHEN $7 THEN NULL ELSE called_at END,
+			served_at = CASE WHEN $7 THEN NULL ELSE served_at END,
+			resource_id = CASE WHEN $7 OR $5 = 'serving' THEN $8::uuid ELSE resource_id END
+		WHERE ticket_id = $1 AND tenant_id = $2 AND branch_id = $3 AND status = $4
+		RETURNING ticket_id, ticket_number, status, created_at, called_at, counter_id, served_at, branch_id, service_id, area_id, tenant_id, reopened_at
+	`, input.TicketID, input.TenantID, input.BranchID, current.Status, status, occurredAt, vacate, nullIfEmpty(resourceID))
+	if err = row.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.CreatedAt, &calledAtNull, &counterIDNull, &servedAtNull, &ticket.BranchID, &ticket.ServiceID, &areaIDNull, &ticket.TenantID, &reopenedAtNull); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Ticket{}, false, store.ErrInvalidState
+		}
+		return models.Ticket{}, false, err
+	}
+	ticket.RequestID = input.RequestID
+	ticket.CalledAt = nullTimePtr(calledAtNull)
+	ticket.CounterID = nullStringPtr(counterIDNull)
+	ticket.ServedAt = nullTimePtr(servedAtNull)
+	ticket.ReopenedAt = nullTimePtr(reopenedAtNull)
+	if resourceID != "" {
+		ticket.ResourceID = &resourceID
+	}
+	if areaIDNull.Valid {
+		ticket.AreaID = areaIDNull.String
+	}
+
+	if err = insertActionRequest(ctx, tx, "reopen", input.RequestID, input.TenantID, input.BranchID, ticket.ServiceID, input.CounterID, ticket.TicketID); err != nil {
+		return models.Ticket{}, false, err
+	}
+
+	if err = insertOutboxEventReopened(ctx, tx, input.TenantID, ticket, current.Status, input.Reason, input.ActorID); err != nil {
+		return models.Ticket{}, false, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return models.Ticket{}, false, err
+	}
+
+	return ticket, true, nil
+}
+
+// lastTerminalEvent returns when the ticket entered terminalStatus and the
+// status recorded by the event before it.
+func lastTerminalEvent(ctx context.Context, tx pgx.Tx, ticketID, terminalStatus string) (time.Time, string, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT type, payload, created_at
+		FROM ticket_events
+		WHERE ticket_id = $1
+		ORDER BY ticket_seq DESC
+		LIMIT 2
+	`, ticketID)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	defer rows.Close()
+
+	var statuses []string
+	var terminalAt time.Time
+	for rows.Next() {
+		var eventType string
+		var payload []byte
+		var createdAt time.Time
+		if err := rows.Scan(&eventType, &payload, &createdAt); err != nil {
+			return time.Time{}, "", err
+		}
+		var decoded struct {
+			Status string `json:"status"`
+		}
+		_ = json.Unmarshal(payload, &decoded)
+		if terminalAt.IsZero() {
+			if decoded.Status != terminalStatus {
+				return time.Time{}, "", nil
+			}
+			terminalAt = createdAt
+			continue
+		}
+		statuses = append(statuses, decoded.Status)
+	}
+	if err := rows.Err(); err != nil {
+		return time.Time{}, "", err
+	}
+
+	previous := ""
+	if len(statuses) > 0 {
+		previous = statuses[0]
+	}
+	switch previous {
+	case models.StatusServing, models.StatusWaiting:
+		return terminalAt, previous, nil
+	}
+	if terminalStatus == models.StatusDone {
+		return terminalAt, models.StatusServing, nil
+	}
+	return terminalAt, models.StatusWaiting, nil
+}
+
+// ConfirmArrival moves a remote ticket into the live queue once the customer
+// is on site. Arrivals inside the policy keep-place window (or any arrival when
+// no window is set) keep their original position; later arrivals queue behind
+// everyone already waiting.
+func (s *Store) ConfirmArrival(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return models.Ticket{}, false, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+		}
+	}()
+
+	existing, found, empty, err := findActionRequest(ctx, tx, "confirm_arrival", input.RequestID)
+	if err != nil {
+		return models.Ticket{}, false, err
+	}
+	if found {
+		if err = tx.Commit(ctx); err != nil {
+			return models.Ticket{}, false, err
+		}
+		if empty {
+			return models.Ticket{}, false, store.ErrInvalidState
+		}
+		return existing, false, nil
+	}
+
+	var status string
+	var serviceID string
+	var joinedAt time.Time
+	var expiresAt sql.NullTime
+	row := tx.QueryRow(ctx, `
+		SELECT status, service_id, created_at, remote_expires_at
+		FROM tickets
+		WHERE ticket_id = $1 AND tenant_id = $2 AND branch_id = $3
+		FOR UPDATE
+	`, input.TicketID, input.TenantID, input.BranchID)
+	if err = row.Scan(&status, &serviceID, &joinedAt, &expiresAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Ticket{}, false, store.ErrTicketNotFound
+		}
+		return models.Ticket{}, false, err
+	}
+	if !store.ValidTransition("confirm_arrival", status) {
+		return models.Ticket{}, false, store.ErrInvalidState
+	}
+
+	arrivedAt := input.OccurredAt
+	if arrivedAt.IsZero() {
+		arrivedAt = time.Now().UTC()
+	}
+	if expiresAt.Valid && arrivedAt.After(expiresAt.Time) {
+		return models.Ticket{}, false, store.ErrArrivalExpired
+	}
+
+	policy, _, err := getServicePolicy(ctx, tx, input.TenantID, input.BranchID, serviceID)
+	if err != nil {
+		return models.Ticket{}, false, err
+	}
+	keptPlace := policy.RemoteKeepPlaceSeconds <= 0 || arrivedAt.Sub(joinedAt) <= time.Duration(policy.RemoteKeepPlaceSeconds)*time.Second
+	queuedAt := joinedAt
+	if !keptPlace {
+		queuedAt = arrivedAt
+	}
+
+	if _, err = tx.Exec(ctx, `
+		UPDATE tickets
+		SET status = 'waiting',
+			arrival_confirmed_at = $1,
+			queued_at = $2,
+			remote_expires_at = NULL
+		WHERE ticket_id = $3
+	`, arrivedAt, queuedAt, input.TicketID); err != nil {
+		return models.Ticket{}, false, err
+	}
+
+	ticket, err := getTicketByID(ctx, tx, input.TicketID, input.TenantID, input.BranchID)
+	if err != nil {
+		return models.Ticket{}, false, err
+	}
+	ticket.RequestID = input.RequestID
+	ticket.ArrivalConfirmedAt = &arrivedAt
+
+	if err = insertActionRequest(ctx, tx, "confirm_arrival", input.RequestID, input.TenantID, input.BranchID, serviceID, input.CounterID, ticket.TicketID); err != nil {
+		return models.Ticket{}, false, err
+	}
+	if err = insertOutboxEventArrived(ctx, tx, input.TenantID, ticket, queuedAt, input.Method, keptPlace); err != nil {
+		return models.Ticket{}, false, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return models.Ticket{}, false, err
+	}
+	return ticket, true, nil
+}
+
+// ExpireRemoteTickets cancels remote tickets whose arrival was never
+// confirmed within the service's confirmation window.
+func (s *Store) ExpireRemoteTickets(ctx context.Context, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+		}
+	}()
+
+	now := time.Now().UTC()
+	rows, err := tx.Query(ctx, `
+		SELECT ticket_id, tenant_id, branch_id
+		FROM tickets
+		WHERE status = 'remote' AND remote_expires_at IS NOT NULL AND remote_expires_at <= $1
+		ORDER BY remote_expires_at ASC
+		FOR UPDATE SKIP LOCKED
+		LIMIT $2
+	`, now, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	type expiredRemote struct {
+		ticketID string
+		tenantID string
+		branchID string
+	}
+	var items []expiredRemote
+	for rows.Next() {
+		var item expiredRemote
+		if err := rows.Scan(&item.ticketID, &item.tenantID, &item.branchID); err != nil {
+			return 0, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	rows.Close()
+
+	processed := 0
+	for _, item := range items {
+		tag, err := tx.Exec(ctx, `
+			UPDATE tickets
+			SET status = 'cancelled', cancelled_at = $1
+			WHERE ticket_id = $2 AND status = 'remote'
+		`, now, item.ticketID)
+		if err != nil {
+			return 0, err
+		}
+		if tag.RowsAffected() == 0 {
+			continue
+		}
+		ticket, err := getTicketByID(ctx, tx, item.ticketID, item.tenantID, item.branchID)
+		if err != nil {
+			return 0, err
+		}
+		if err = insertOutboxEventGeneric(ctx, tx, item.tenantID, "ticket.remote_expired", ticket); err != nil {
+			return 0, err
+		}
+		processed++
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return processed, nil
+}
+
+func (s *Store) remoteConfirmWindow(ctx context.Context, tx pgx.Tx, tenantID, branchID, serviceID string) (time.Duration, error) {
+	policy, found, err := getServicePolicy(ctx, tx, tenantID, branchID, serviceID)
+	if err != nil {
+		return 0, err
+	}
+	if found && policy.RemoteConfirmSeconds > 0 {
+		return time.Duration(policy.RemoteConfirmSeconds) * time.Second, nil
+	}
+	return s.remoteWindow, nil
+}
+
+type tokenisedRef struct {
+	refType string
+	hash    string
+	enc     []byte
+}
+
+// tokeniseCustomerRef applies the tenant's collection mode and returns the
+// hash and encrypted copy to store. The plain value is never persisted.
+func (s *Store) tokeniseCustomerRef(ctx context.Context, tx pgx.Tx, tenantID, refType, value string) (tokenisedRef, error) {
+	mode, err := getCustomerRefMode(ctx, tx, tenantID)
+	if err != nil {
+		return tokenisedRef{}, err
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		if mode == customerRefRequired {
+			return tokenisedRef{}, store.ErrCustomerRefMissing
+		}
+		return tokenisedRef{}, nil
+	}
+	if mode == customerRefOff {
+		return tokenisedRef{}, store.ErrCustomerRefOff
+	}
+	normalizedType, err := customerref.NormalizeType(refType)
+	if err != nil {
+		return tokenisedRef{}, store.ErrCustomerRefInvalid
+	}
+	if customerref.Normalize(value) == "" {
+		return tokenisedRef{}, store.ErrCustomerRefInvalid
+	}
+	hash, err := s.customerRefs.Hash(value)
+	if err != nil {
+		return tokenisedRef{}, store.ErrCustomerRefNoKeys
+	}
+	enc, err := s.customerRefs.Seal(value)
+	if err != nil {
+		if errors.Is(err, customerref.ErrDisabled) {
+			return tokenisedRef{}, store.ErrCustomerRefNoKeys
+		}
+		return tokenisedRef{}, err
+	}
+	return tokenisedRef{refType: normalizedType, hash: hash, enc: enc}, nil
+}
+
+// GetCustomerRef decrypts a ticket's customer reference for display. Tickets
+// without a reference return an empty value.
+func (s *Store) GetCustomerRef(ctx context.Context, tenantID, branchID, ticketID string) (store.CustomerRef, error) {
+	var refTypeNull sql.NullString
+	var refEnc []byte
+	row := s.pool.QueryRow(ctx, `
+		SELECT customer_ref_type, customer_ref_enc
+		FROM tickets
+		WHERE ticket_id = $1 AND tenant_id = $2 AND branch_id = $3
+	`, ticketID, tenantID, branchID)
+	if err := row.Scan(&refTypeNull, &refEnc); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return store.CustomerRef{}, store.ErrTicketNotFound
+		}
+		return store.CustomerRef{}, err
+	}
+	ref := store.CustomerRef{TicketID: ticketID, Type: refTypeNull.String}
+	if len(refEnc) == 0 {
+		return ref, nil
+	}
+	value, err := s.customerRefs.Open(refEnc)
+	if err != nil {
+		if errors.Is(err, customerref.ErrDisabled) {
+			return store.CustomerRef{}, store.ErrCustomerRefNoKeys
+		}
+		return store.CustomerRef{}, err
+	}
+	ref.Value = value
+	return ref, nil
+}
+
+// PurgeCustomerRef erases every stored copy of a reference for the tenant,
+// including legacy plain appointment values, and returns the rows touched.
+func (s *Store) RecordAudit(ctx context.Context, entry store.AuditEntry) error {
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO audit_logs (audit_id, tenant_id, actor_user_id, action_type, target_type, target_id, detail, ip, user_agent)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, uuid.NewString(), entry.TenantID, nullIfEmpty(entry.ActorUserID), entry.ActionType, entry.TargetType, nullIfEmpty(entry.TargetID),
+		nullIfEmpty(entry.Detail), nullIfEmpty(entry.IP), nullIfEmpty(entry.UserAgent))
+	return err
+}
+
+func (s *Store) PurgeCustomerRef(ctx context.Context, tenantID, value string) (int, error) {
+	value = strings.TrimSpace(value)
+	hash, err := s.customerRefs.Hash(value)
+	if err != nil {
+		return 0, store.ErrCustomerRefNoKeys
+	}
+
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+		}
+	}()
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE tickets
+		SET customer_ref_type = NULL, customer_ref_hash = NULL, customer_ref_enc = NULL
+		WHERE tenant_id = $1 AND customer_ref_hash = $2
+	`, tenantID, hash)
+	if err != nil {
+		return 0, err
+	}
+	purged := int(tag.RowsAffected())
+	tag, err = tx.Exec(ctx, `
+		UPDATE appointments
+		SET customer_ref = NULL, customer_ref_type = NULL, customer_ref_hash = NULL, customer_ref_enc = NULL
+		WHERE tenant_id = $1 AND (customer_ref_hash = $2 OR customer_ref = $3)
+	`, tenantID, hash, value)
+	if err != nil {
+		return 0, err
+	}
+	purged += int(tag.RowsAffected())
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+// PurgeExpiredCustomerRefs tokenises legacy plain appointment references and
+// clears references older than the tenant's retention period. Only finished
+// tickets and appointments that are no longer scheduled are cleared.
+func (s *Store) PurgeExpiredCustomerRefs(ctx context.Context, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+		}
+	}()
+
+	processed := 0
+	if s.customerRefs != nil {
+		var migrated int
+		migrated, err = s.tokeniseLegacyAppointmentRefs(ctx, tx, batchSize)
+		if err != nil {
+			return 0, err
+		}
+		processed += migrated
+	}
+
+	now := time.Now().UTC()
+	tag, err := tx.Exec(ctx, `
+		UPDATE tickets
+		SET customer_ref_type = NULL, customer_ref_hash = NULL, customer_ref_enc = NULL
+		WHERE ticket_id IN (
+			SELECT t.ticket_id
+			FROM tickets t
+			JOIN tenant_privacy_prefs p ON p.tenant_id = t.tenant_id
+			WHERE p.customer_ref_retention_days > 0
+				AND t.customer_ref_hash IS NOT NULL
+				AND t.status IN ('done', 'cancelled', 'no_show')
+				AND t.created_at < $1 - make_interval(days => p.customer_ref_retention_days)
+			LIMIT $2
+		)
+	`, now, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	processed += int(tag.RowsAffected())
+
+	tag, err = tx.Exec(ctx, `
+		UPDATE appointments
+		SET customer_ref_type = NULL, customer_ref_hash = NULL, customer_ref_enc = NULL
+		WHERE appointment_id IN (
+			SELECT a.appointment_id
+			FROM appointments a
+			JOIN tenant_privacy_prefs p ON p.tenant_id = a.tenant_id
+			WHERE p.customer_ref_retention_days > 0
+				AND a.customer_ref_hash IS NOT NULL
+				AND a.status <> 'scheduled'
+				AND a.scheduled_at < $1 - make_interval(days => p.customer_ref_retention_days)
+			LIMIT $2
+		)
+	`, now, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	processed += int(tag.RowsAffected())
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return processed, nil
+}
+
+func (s *Store) tokeniseLegacyAppointmentRefs(ctx context.Context, tx pgx.Tx, batchSize int) (int, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT appointment_id, customer_ref
+		FROM appointments
+		WHERE customer_ref IS NOT NULL
+		FOR UPDATE SKIP LOCKED
+		LIMIT $1
+	`, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	type legacyRef struct {
+		appointmentID string
+		value         string
+	}
+	var items []legacyRef
+	for rows.Next() {
+		var item legacyRef
+		if err := rows.Scan(&item.appointmentID, &item.value); err != nil {
+			return 0, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	rows.Close()
+
+	for _, item := range items {
+		var ref tokenisedRef
+		if customerref.Normalize(strings.TrimSpace(item.value)) != "" {
+			ref.refType = customerref.TypeOther
+			if ref.hash, err = s.customerRefs.Hash(item.value); err != nil {
+				return 0, err
+			}
+			if ref.enc, err = s.customerRefs.Seal(item.value); err != nil {
+				return 0, err
+			}
+		}
+		if _, err = tx.Exec(ctx, `
+			UPDATE appointments
+			SET customer_ref = NULL, customer_ref_type = $1, customer_ref_hash = $2, customer_ref_enc = $3
+			WHERE appointment_id = $4
+		`, nullIfEmpty(ref.refType), nullIfEmpty(ref.hash), ref.enc, item.appointmentID); err != nil {
+			return 0, err
+		}
+	}
+	return len(items), nil
+}
+
+// RecallTicket announces a called ticket again. Recalls are counted per ticket
+// and limited by the service policy; once the limit is reached the ticket is
+// treated as a no-show, honouring the policy's return-to-queue setting.
+func (s *Store) RecallTicket(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return models.Ticket{}, false, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+		}
+	}()
+
+	existing, found, empty, err := findActionRequest(ctx, tx, "recall", input.RequestID)
+	if err != nil {
+		return models.Ticket{}, false, err
+	}
+	if found {
+		if err = tx.Commit(ctx); err != nil {
+			return models.Ticket{}, false, err
+		}
+		if empty {
+			return models.Ticket{}, false, store.ErrInvalidState
+		}
+		return existing, false, nil
+	}
+
+	// The lock makes concurrent recalls check the limit and interval one
+	// after the other, against the count the previous one wrote.
+	current, err := lockTicketByID(ctx, tx, input.TicketID, input.TenantID, input.BranchID)
+	if err != nil {
+		return models.Ticket{}, false, err
+	}
+	if !store.ValidTransition("recall", current.Status) {
+		return models.Ticket{}, false, store.ErrInvalidState
+	}
+
+	policy, found, err := getServicePolicy(ctx, tx, input.TenantID, input.BranchID, current.ServiceID)
+	if err != nil {
+		return models.Ticket{}, false, err
+	}
+	maxRecalls := s.maxRecalls
+	minInterval := s.minRecallInterval
+	returnToQueue := s.noShowReturnToQueue
+	if found {
+		if policy.MaxRecalls > 0 {
+			maxRecalls = policy.MaxRecalls
+		}
+		minInterval = time.Duration(policy.MinRecallIntervalSeconds) * time.Second
+		returnToQueue = policy.ReturnToQueue
+	}
+
+	occurredAt := input.OccurredAt
+	if occurredAt.IsZero() {
+		occurredAt = time.Now().UTC()
+	}
+	lastAnnounced := current.LastRecalledAt
+	if lastAnnounced == nil {
+		lastAnnounced = current.CalledAt
+	}
+	if minInterval > 0 && lastAnnounced != nil && occurredAt.Sub(*lastAnnounced) < minInterval {
+		return models.Ticket{}, false, store.ErrRecallTooSoon
+	}
+
+	var ticket models.Ticket
+	if current.RecallCount >= maxRecalls {
+		ticket, err = recallLimitNoShow(ctx, tx, current, returnToQueue)
+		if err != nil {
+			return models.Ticket{}, false, err
+		}
+		ticket.RequestID = input.RequestID
+		if err = insertActionRequest(ctx, tx, "recall", input.RequestID, input.TenantID, input.BranchID, ticket.ServiceID, input.CounterID, ticket.TicketID); err != nil {
+			return models.Ticket{}, false, err
+		}
+		if err = insertOutboxEventNoShow(ctx, tx, input.TenantID, ticket, returnToQueue); err != nil {
+			return models.Ticket{}, false, err
+		}
+		if err = tx.Commit(ctx); err != nil {
+			return models.Ticket{}, false, err
+		}
+		return ticket, true, nil
+	}
+
+	var calledAtNull sql.NullTime
+	var counterIDNull sql.NullString
+	var areaIDNull sql.NullString
+	var lastRecalledNull sql.NullTime
+	row := tx.QueryRow(ctx, `
+		UPDATE tickets
+		SET recall_count = recall_count + 1,
+			last_recalled_at = $4
+		WHERE ticket_id = $1 AND tenant_id = $2 AND branch_id = $3 AND status = 'called'
+		RETURNING ticket_id, ticket_number, status, created_at, called_at, counter_id, branch_id, service_id, area_id, tenant_id, recall_count, last_recalled_at
+	`, input.TicketID, input.TenantID, input.BranchID, occurredAt)
+	if err = row.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.CreatedAt, &calledAtNull, &counterIDNull, &ticket.BranchID, &ticket.ServiceID, &areaIDNull, &ticket.TenantID, &ticket.RecallCount, &lastRecalledNull); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Ticket{}, false, store.ErrInvalidState
+		}
+		return models.Ticket{}, false, err
+	}
+	ticket.RequestID = input.RequestID
+	ticket.CalledAt = nullTimePtr(calledAtNull)
+	ticket.CounterID = nullStringPtr(counterIDNull)
+	ticket.LastRecalledAt = nullTimePtr(lastRecalledNull)
+	if areaIDNull.Valid {
+		ticket.AreaID = areaIDNull.String
+	}
+
+	if err = insertActionRequest(ctx, tx, "recall", input.RequestID, input.TenantID, input.BranchID, ticket.ServiceID, input.CounterID, ticket.TicketID); err != nil {
+		return models.Ticket{}, false, err
+	}
+
+	if err = insertOutboxEventRecalled(ctx, tx, input.TenantID, ticket, maxRecalls); err != nil {
+		return models.Ticket{}, false, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return models.Ticket{}, false, err
+	}
 
-func (s *Store) UnholdTicket(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
-	return s.updateTicketStatus(ctx, input, "unhold", models.StatusHeld, models.StatusWaiting, "ticket.unheld", "", false)
+	return ticket, true, nil
 }
 
-func (s *Store) NoShowTicket(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
-	return s.applyNoShow(ctx, input, input.ReturnToQueue)
-}
+func recallLimitNoShow(ctx context.Context, tx pgx.Tx, current models.Ticket, returnToQueue bool) (models.Ticket, error) {
+	query := `
+		UPDATE tickets
+		SET status = 'no_show'
+		WHERE ticket_id = $1 AND status = 'called'
+		RETURNING ticket_id, ticket_number, status, created_at, called_at, counter_id, service_id, branch_id, area_id, tenant_id, recall_count
+	`
+	if returnToQueue {
+		query = `
+			UPDATE tickets
+			SET status = 'waiting',
+				counter_id = NULL,
+				called_at = NULL,
+				returned = TRUE,
+				recall_count = 0,
+				last_recalled_at = NULL
+			WHERE ticket_id = $1 AND status = 'called'
+			RETURNING ticket_id, ticket_number, status, created_at, called_at, counter_id, service_id, branch_id, area_id, tenant_id, recall_count
+		`
+	}
 
-func (s *Store) RecallTicket(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
-	return s.emitTicketEvent(ctx, input, "recall", models.StatusCalled, "ticket.recalled")
+	var ticket models.Ticket
+	var calledAtNull sql.NullTime
+	var counterIDNull sql.NullString
+	var areaIDNull sql.NullString
+	row := tx.QueryRow(ctx, query, current.TicketID)
+	if err := row.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.CreatedAt, &calledAtNull, &counterIDNull, &ticket.ServiceID, &ticket.BranchID, &areaIDNull, &ticket.TenantID, &ticket.RecallCount); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Ticket{}, store.ErrInvalidState
+		}
+		return models.Ticket{}, err
+	}
+	ticket.CalledAt = nullTimePtr(calledAtNull)
+	ticket.CounterID = nullStringPtr(counterIDNull)
+	if ticket.CounterID == nil {
+		// Keep the counter on the event so displays can clear the right call.
+		ticket.CounterID = current.CounterID
+	}
+	if areaIDNull.Valid {
+		ticket.AreaID = areaIDNull.String
+	}
+	return ticket, nil
 }
 
 func (s *Store) TransferTicket(ctx context.Context, input store.TicketActionInput) (models.Ticket, bool, error) {
@@ -941,6 +2898,61 @@ func lookupServiceCode(ctx context.Context, tx pgx.Tx, input store.CreateTicketI
 	return code, nil
 }
 
+// checkPartyCapacity enforces the service policy's party size cap (or
+// defaultMaxPartySize when the service has no policy) and, when configured,
+// the maximum number of people waiting for the service.
+func checkPartyCapacity(ctx context.Context, tx pgx.Tx, input store.CreateTicketInput, partySize int) error {
+	policy, found, err := getServicePolicy(ctx, tx, input.TenantID, input.BranchID, input.ServiceID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		policy.MaxPartySize = defaultMaxPartySize
+	}
+	if policy.MaxPartySize > 0 && partySize > policy.MaxPartySize {
+		return store.ErrPartyTooLarge
+	}
+	if policy.MaxWaitingPeople <= 0 {
+		return nil
+	}
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, "capacity:"+input.ServiceID); err != nil {
+		return err
+	}
+	var waitingPeople int
+	row := tx.QueryRow(ctx, `
+		SELECT COALESCE(SUM(party_size), 0)
+		FROM tickets
+		WHERE tenant_id = $1 AND branch_id = $2 AND service_id = $3 AND status IN ('waiting', 'held', 'remote')
+	`, input.TenantID, input.BranchID, input.ServiceID)
+	if err := row.Scan(&waitingPeople); err != nil {
+		return err
+	}
+	if waitingPeople+partySize > policy.MaxWaitingPeople {
+		return store.ErrCapacityExceeded
+	}
+	return nil
+}
+
+func ensureLinkedTicket(ctx context.Context, tx pgx.Tx, input store.CreateTicketInput) error {
+	var status string
+	row := tx.QueryRow(ctx, `
+		SELECT status
+		FROM tickets
+		WHERE ticket_id = $1 AND tenant_id = $2 AND branch_id = $3
+	`, input.LinkedTicketID, input.TenantID, input.BranchID)
+	if err := row.Scan(&status); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return store.ErrTicketNotFound
+		}
+		return err
+	}
+	switch status {
+	case models.StatusDone, models.StatusCancelled, models.StatusNoShow:
+		return store.ErrInvalidState
+	}
+	return nil
+}
+
 func ensureServiceExists(ctx context.Context, tx pgx.Tx, input store.CallNextInput) error {
 	var serviceID string
 	row := tx.QueryRow(ctx, `
@@ -1086,8 +3098,8 @@ func updateNextAppointmentTicketWithFilter(ctx context.Context, tx pgx.Tx, input
 			FROM tickets t
 			JOIN appointments a ON a.appointment_id = t.appointment_id
 			WHERE t.tenant_id = $1 AND t.branch_id = $2 AND t.service_id = $3 AND t.status = 'waiting'
-				AND t.appointment_id IS NOT NULL ` + filter + cutoffFilter + `
-			ORDER BY a.scheduled_at ASC, t.created_at ASC
+				AND t.appointment_id IS NOT NULL AND t.queued_at <= $5 ` + filter + cutoffFilter + `
+			ORDER BY a.scheduled_at ASC, t.queued_at ASC
 			FOR UPDATE SKIP LOCKED
 			LIMIT 1
 		)
@@ -1097,10 +3109,10 @@ func updateNextAppointmentTicketWithFilter(ctx context.Context, tx pgx.Tx, input
 			called_at = $5
 		FROM next_ticket
 		WHERE tickets.ticket_id = next_ticket.ticket_id
-		RETURNING tickets.ticket_id, tickets.ticket_number, tickets.status, tickets.created_at, tickets.called_at, tickets.counter_id, tickets.priority_class, tickets.branch_id, tickets.service_id, tickets.area_id, tickets.tenant_id
+		RETURNING tickets.ticket_id, tickets.ticket_number, tickets.status, tickets.created_at, tickets.called_at, tickets.counter_id, tickets.priority_class, tickets.branch_id, tickets.service_id, tickets.area_id, tickets.tenant_id, tickets.party_size
 	`
 	row := tx.QueryRow(ctx, query, args...)
-	if err := row.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.CreatedAt, &calledAtNull, &counterIDNull, &priorityClass, &ticket.BranchID, &ticket.ServiceID, &areaIDNull, &ticket.TenantID); err != nil {
+	if err := row.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.CreatedAt, &calledAtNull, &counterIDNull, &priorityClass, &ticket.BranchID, &ticket.ServiceID, &areaIDNull, &ticket.TenantID, &ticket.PartySize); err != nil {
 		return models.Ticket{}, "", err
 	}
 	ticket.CalledAt = nullTimePtr(calledAtNull)
@@ -1141,8 +3153,8 @@ func updateNextWalkinTicketWithFilter(ctx context.Context, tx pgx.Tx, input stor
 			SELECT ticket_id
 			FROM tickets
 			WHERE tenant_id = $1 AND branch_id = $2 AND service_id = $3 AND status = 'waiting'
-				AND appointment_id IS NULL ` + filter + `
-			ORDER BY created_at ASC
+				AND appointment_id IS NULL AND queued_at <= $5 ` + filter + `
+			ORDER BY queued_at ASC
 			FOR UPDATE SKIP LOCKED
 			LIMIT 1
 		)
@@ -1152,10 +3164,10 @@ func updateNextWalkinTicketWithFilter(ctx context.Context, tx pgx.Tx, input stor
 			called_at = $5
 		FROM next_ticket
 		WHERE tickets.ticket_id = next_ticket.ticket_id
-		RETURNING tickets.ticket_id, tickets.ticket_number, tickets.status, tickets.created_at, tickets.called_at, tickets.counter_id, tickets.priority_class, tickets.branch_id, tickets.service_id, tickets.area_id, tickets.tenant_id
+		RETURNING tickets.ticket_id, tickets.ticket_number, tickets.status, tickets.created_at, tickets.called_at, tickets.counter_id, tickets.priority_class, tickets.branch_id, tickets.service_id, tickets.area_id, tickets.tenant_id, tickets.party_size
 	`
 	row := tx.QueryRow(ctx, query, input.TenantID, input.BranchID, input.ServiceID, input.CounterID, calledAt)
-	if err := row.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.CreatedAt, &calledAtNull, &counterIDNull, &priorityClass, &ticket.BranchID, &ticket.ServiceID, &areaIDNull, &ticket.TenantID); err != nil {
+	if err := row.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.CreatedAt, &calledAtNull, &counterIDNull, &priorityClass, &ticket.BranchID, &ticket.ServiceID, &areaIDNull, &ticket.TenantID, &ticket.PartySize); err != nil {
 		return models.Ticket{}, "", err
 	}
 	ticket.CalledAt = nullTimePtr(calledAtNull)
@@ -1210,6 +3222,82 @@ func counterAllowsService(ctx context.Context, tx pgx.Tx, counterID, serviceID s
 	return count > 0, nil
 }
 
+// reserveCounterResource picks the active resource at a counter with the most
+// free places. Counters without resources keep the single-desk behaviour and
+// return an empty resource ID. The counter row is locked so concurrent
+// call-next requests cannot overbook the same chairs.
+func reserveCounterResource(ctx context.Context, tx pgx.Tx, counterID string) (string, error) {
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM counters WHERE counter_id = $1 FOR UPDATE`, counterID); err != nil {
+		return "", err
+	}
+	var resources int
+	row := tx.QueryRow(ctx, `
+		SELECT COUNT(1)
+		FROM resources
+		WHERE counter_id = $1 AND active = TRUE
+	`, counterID)
+	if err := row.Scan(&resources); err != nil {
+		return "", err
+	}
+	if resources == 0 {
+		return "", nil
+	}
+	var resourceID string
+	row = tx.QueryRow(ctx, `
+		SELECT r.resource_id
+		FROM resources r
+		LEFT JOIN tickets t ON t.resource_id = r.resource_id AND t.status IN ('called', 'serving')
+		WHERE r.counter_id = $1 AND r.active = TRUE
+		GROUP BY r.resource_id, r.capacity, r.name
+		HAVING COUNT(t.ticket_id) < r.capacity
+		ORDER BY r.capacity - COUNT(t.ticket_id) DESC, r.name ASC
+		LIMIT 1
+	`, counterID)
+	if err := row.Scan(&resourceID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", store.ErrCounterAtCapacity
+		}
+		return "", err
+	}
+	return resourceID, nil
+}
+
+// reopenCounterSlot reports whether a reopened ticket can go back to serving
+// at counterID, and on which resource. The counter must still be open and have
+// a free place: a resource below capacity or, without resources, no other
+// ticket called or being served there.
+func reopenCounterSlot(ctx context.Context, tx pgx.Tx, counterID, branchID, ticketID string) (string, bool, error) {
+	status, err := getCounterStatus(ctx, tx, counterID, branchID)
+	if errors.Is(err, store.ErrCounterNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if !isCounterAvailable(status) {
+		return "", false, nil
+	}
+	resourceID, err := reserveCounterResource(ctx, tx, counterID)
+	if errors.Is(err, store.ErrCounterAtCapacity) {
+		return "", false, nil
+	}
+	if err != nil || resourceID != "" {
+		return resourceID, err == nil, err
+	}
+	var occupied bool
+	row := tx.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM tickets
+			WHERE counter_id = $1 AND ticket_id <> $2 AND status IN ('called', 'serving')
+		)
+	`, counterID, ticketID)
+	if err := row.Scan(&occupied); err != nil {
+		return "", false, err
+	}
+	return "", !occupied, nil
+}
+
 func getCounterStatus(ctx context.Context, tx pgx.Tx, counterID, branchID string) (string, error) {
 	var status string
 	row := tx.QueryRow(ctx, `
@@ -1235,22 +3323,39 @@ func isCounterAvailable(status string) bool {
 	}
 }
 
+// servicePolicy is a service_policies row. HoldMaxSeconds and
+// HoldExpiryAction are zero when the row leaves them to the store options.
 type servicePolicy struct {
-	NoShowGraceSeconds      int
-	ReturnToQueue           bool
-	AppointmentRatioPercent int
-	AppointmentWindowSize   int
-	AppointmentBoostMinutes int
+	NoShowGraceSeconds       int
+	ReturnToQueue            bool
+	AppointmentRatioPercent  int
+	AppointmentWindowSize    int
+	AppointmentBoostMinutes  int
+	HoldMaxSeconds           int
+	HoldExpiryAction         string
+	MaxRecalls               int
+	MinRecallIntervalSeconds int
+	MaxPartySize             int
+	MaxWaitingPeople         int
+	RemoteConfirmSeconds     int
+	RemoteKeepPlaceSeconds   int
+	MaxPostpones             int
+	MaxPostponePlaces        int
+	MaxPostponeMinutes       int
 }
 
 func getServicePolicy(ctx context.Context, tx pgx.Tx, tenantID, branchID, serviceID string) (servicePolicy, bool, error) {
 	var policy servicePolicy
 	row := tx.QueryRow(ctx, `
-		SELECT no_show_grace_seconds, return_to_queue, appointment_ratio_percent, appointment_window_size, appointment_boost_minutes
+		SELECT no_show_grace_seconds, return_to_queue, appointment_ratio_percent, appointment_window_size, appointment_boost_minutes,
+			COALESCE(hold_max_seconds, 0), COALESCE(hold_expiry_action, ''), max_recalls, min_recall_interval_seconds, max_party_size, max_waiting_people,
+			remote_confirm_seconds, remote_keep_place_seconds, max_postpones, max_postpone_places, max_postpone_minutes
 		FROM service_policies
 		WHERE tenant_id = $1 AND branch_id = $2 AND service_id = $3
 	`, tenantID, branchID, serviceID)
-	if err := row.Scan(&policy.NoShowGraceSeconds, &policy.ReturnToQueue, &policy.AppointmentRatioPercent, &policy.AppointmentWindowSize, &policy.AppointmentBoostMinutes); err != nil {
+	if err := row.Scan(&policy.NoShowGraceSeconds, &policy.ReturnToQueue, &policy.AppointmentRatioPercent, &policy.AppointmentWindowSize, &policy.AppointmentBoostMinutes,
+		&policy.HoldMaxSeconds, &policy.HoldExpiryAction, &policy.MaxRecalls, &policy.MinRecallIntervalSeconds, &policy.MaxPartySize, &policy.MaxWaitingPeople,
+		&policy.RemoteConfirmSeconds, &policy.RemoteKeepPlaceSeconds, &policy.MaxPostpones, &policy.MaxPostponePlaces, &policy.MaxPostponeMinutes); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return servicePolicy{}, false, nil
 		}
@@ -1259,6 +3364,30 @@ func getServicePolicy(ctx context.Context, tx pgx.Tx, tenantID, branchID, servic
 	return policy, true, nil
 }
 
+const (
+	customerRefOff      = "off"
+	customerRefOptional = "optional"
+	customerRefRequired = "required"
+)
+
+// getCustomerRefMode returns the tenant's customer reference collection
+// mode. Tenants without privacy preferences do not collect references.
+func getCustomerRefMode(ctx context.Context, tx pgx.Tx, tenantID string) (string, error) {
+	var mode string
+	row := tx.QueryRow(ctx, `
+		SELECT customer_ref_mode
+		FROM tenant_privacy_prefs
+		WHERE tenant_id = $1
+	`, tenantID)
+	if err := row.Scan(&mode); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return customerRefOff, nil
+		}
+		return "", err
+	}
+	return mode, nil
+}
+
 func normalizeAppointmentWindow(value int) int {
 	if value <= 0 {
 		return 10
@@ -1266,6 +3395,13 @@ func normalizeAppointmentWindow(value int) int {
 	return value
 }
 
+func normalizeHoldExpiryAction(value string) string {
+	if strings.ToLower(strings.TrimSpace(value)) == models.HoldExpiryCancel {
+		return models.HoldExpiryCancel
+	}
+	return models.HoldExpiryReturn
+}
+
 func appointmentTargetCount(ratioPercent int, window int) int {
 	if ratioPercent <= 0 || window <= 0 {
 		return 0
@@ -1288,18 +3424,58 @@ func nextTicketNumber(ctx context.Context, tx pgx.Tx, branchID, serviceID string
 	return next, nil
 }
 
-func insertOutboxEvent(ctx context.Context, tx pgx.Tx, tenantID string, ticket models.Ticket) error {
+// insertOutboxEvent emits ticket.created. scheduledAt is the appointment
+// time of a checked-in appointment, nil for walk-ins; displays order the
+// queue by it as CallNext does.
+func insertOutboxEvent(ctx context.Context, tx pgx.Tx, tenantID string, ticket models.Ticket, scheduledAt *time.Time) error {
+	payload := map[string]interface{}{
+		"ticket_id":      ticket.TicketID,
+		"ticket_number":  ticket.TicketNumber,
+		"status":         ticket.Status,
+		"created_at":     ticket.CreatedAt,
+		"request_id":     ticket.RequestID,
+		"tenant_id":      ticket.TenantID,
+		"branch_id":      ticket.BranchID,
+		"service_id":     ticket.ServiceID,
+		"area_id":        ticket.AreaID,
+		"phone":          ticket.Phone,
+		"party_size":     ticket.PartySize,
+		"priority_class": ticket.PriorityClass,
+	}
+	if ticket.LinkedTicketID != nil {
+		payload["linked_ticket_id"] = *ticket.LinkedTicketID
+	}
+	if ticket.RemoteExpiresAt != nil {
+		payload["remote_expires_at"] = ticket.RemoteExpiresAt
+	}
+	if scheduledAt != nil {
+		payload["appointment_scheduled_at"] = scheduledAt
+	}
+
+	payloadJSON, err := jsonBytes(payload)
+	if err != nil {
+		return err
+	}
+
+	return appendOutboxEvent(ctx, tx, tenantID, "ticket.created", ticket.TicketID, payloadJSON)
+}
+
+func insertOutboxEventCalled(ctx context.Context, tx pgx.Tx, tenantID string, ticket models.Ticket) error {
 	payload := map[string]interface{}{
 		"ticket_id":     ticket.TicketID,
 		"ticket_number": ticket.TicketNumber,
 		"status":        ticket.Status,
-		"created_at":    ticket.CreatedAt,
+		"called_at":     ticket.CalledAt,
+		"counter_id":    ticket.CounterID,
 		"request_id":    ticket.RequestID,
 		"tenant_id":     ticket.TenantID,
 		"branch_id":     ticket.BranchID,
 		"service_id":    ticket.ServiceID,
 		"area_id":       ticket.AreaID,
-		"phone":         ticket.Phone,
+		"party_size":    ticket.PartySize,
+	}
+	if ticket.ResourceID != nil {
+		payload["resource_id"] = *ticket.ResourceID
 	}
 
 	payloadJSON, err := jsonBytes(payload)
@@ -1307,24 +3483,19 @@ func insertOutboxEvent(ctx context.Context, tx pgx.Tx, tenantID string, ticket m
 		return err
 	}
 
-	_, err = tx.Exec(ctx, `
-		INSERT INTO outbox_events (event_id, tenant_id, type, payload_json, created_at)
-		VALUES ($1, $2, $3, $4, $5)
-	`, uuid.NewString(), tenantID, "ticket.created", payloadJSON, time.Now().UTC())
-	if err != nil {
-		return err
-	}
-	return insertTicketEvent(ctx, tx, ticket.TicketID, "ticket.created", payloadJSON)
+	return appendOutboxEvent(ctx, tx, tenantID, "ticket.called", ticket.TicketID, payloadJSON)
 }
 
-func insertOutboxEventCalled(ctx context.Context, tx pgx.Tx, tenantID string, ticket models.Ticket) error {
+func insertOutboxEventGeneric(ctx context.Context, tx pgx.Tx, tenantID, eventType string, ticket models.Ticket) error {
 	payload := map[string]interface{}{
 		"ticket_id":     ticket.TicketID,
 		"ticket_number": ticket.TicketNumber,
 		"status":        ticket.Status,
+		"request_id":    ticket.RequestID,
 		"called_at":     ticket.CalledAt,
+		"served_at":     ticket.ServedAt,
+		"completed_at":  ticket.CompletedAt,
 		"counter_id":    ticket.CounterID,
-		"request_id":    ticket.RequestID,
 		"tenant_id":     ticket.TenantID,
 		"branch_id":     ticket.BranchID,
 		"service_id":    ticket.ServiceID,
@@ -1336,45 +3507,61 @@ func insertOutboxEventCalled(ctx context.Context, tx pgx.Tx, tenantID string, ti
 		return err
 	}
 
-	_, err = tx.Exec(ctx, `
-		INSERT INTO outbox_events (event_id, tenant_id, type, payload_json, created_at)
-		VALUES ($1, $2, $3, $4, $5)
-	`, uuid.NewString(), tenantID, "ticket.called", payloadJSON, time.Now().UTC())
+	return appendOutboxEvent(ctx, tx, tenantID, eventType, ticket.TicketID, payloadJSON)
+}
+
+func insertOutboxEventRecalled(ctx context.Context, tx pgx.Tx, tenantID string, ticket models.Ticket, maxRecalls int) error {
+	payload := map[string]interface{}{
+		"ticket_id":        ticket.TicketID,
+		"ticket_number":    ticket.TicketNumber,
+		"status":           ticket.Status,
+		"request_id":       ticket.RequestID,
+		"called_at":        ticket.CalledAt,
+		"counter_id":       ticket.CounterID,
+		"recall_count":     ticket.RecallCount,
+		"max_recalls":      maxRecalls,
+		"last_recalled_at": ticket.LastRecalledAt,
+		"tenant_id":        ticket.TenantID,
+		"branch_id":        ticket.BranchID,
+		"service_id":       ticket.ServiceID,
+		"area_id":          ticket.AreaID,
+	}
+
+	payloadJSON, err := jsonBytes(payload)
 	if err != nil {
 		return err
 	}
-	return insertTicketEvent(ctx, tx, ticket.TicketID, "ticket.called", payloadJSON)
+
+	return appendOutboxEvent(ctx, tx, tenantID, "ticket.recalled", ticket.TicketID, payloadJSON)
 }
 
-func insertOutboxEventGeneric(ctx context.Context, tx pgx.Tx, tenantID, eventType string, ticket models.Ticket) error {
+func insertOutboxEventReopened(ctx context.Context, tx pgx.Tx, tenantID string, ticket models.Ticket, fromStatus, reason, actorID string) error {
 	payload := map[string]interface{}{
 		"ticket_id":     ticket.TicketID,
 		"ticket_number": ticket.TicketNumber,
 		"status":        ticket.Status,
+		"from_status":   fromStatus,
 		"request_id":    ticket.RequestID,
+		"reason":        reason,
+		"reopened_at":   ticket.ReopenedAt,
 		"called_at":     ticket.CalledAt,
 		"served_at":     ticket.ServedAt,
-		"completed_at":  ticket.CompletedAt,
 		"counter_id":    ticket.CounterID,
 		"tenant_id":     ticket.TenantID,
 		"branch_id":     ticket.BranchID,
 		"service_id":    ticket.ServiceID,
 		"area_id":       ticket.AreaID,
 	}
+	if actorID != "" {
+		payload["reopened_by"] = actorID
+	}
 
 	payloadJSON, err := jsonBytes(payload)
 	if err != nil {
 		return err
 	}
 
-	_, err = tx.Exec(ctx, `
-		INSERT INTO outbox_events (event_id, tenant_id, type, payload_json, created_at)
-		VALUES ($1, $2, $3, $4, $5)
-	`, uuid.NewString(), tenantID, eventType, payloadJSON, time.Now().UTC())
-	if err != nil {
-		return err
-	}
-	return insertTicketEvent(ctx, tx, ticket.TicketID, eventType, payloadJSON)
+	return appendOutboxEvent(ctx, tx, tenantID, "ticket.reopened", ticket.TicketID, payloadJSON)
 }
 
 func insertOutboxEventTransfer(ctx context.Context, tx pgx.Tx, tenantID string, ticket models.Ticket, fromServiceID, toServiceID, reason string) error {
@@ -1399,14 +3586,7 @@ func insertOutboxEventTransfer(ctx context.Context, tx pgx.Tx, tenantID string,
 		return err
 	}
 
-	_, err = tx.Exec(ctx, `
-		INSERT INTO outbox_events (event_id, tenant_id, type, payload_json, created_at)
-		VALUES ($1, $2, $3, $4, $5)
-	`, uuid.NewString(), tenantID, "ticket.transferred", payloadJSON, time.Now().UTC())
-	if err != nil {
-		return err
-	}
-	return insertTicketEvent(ctx, tx, ticket.TicketID, "ticket.transferred", payloadJSON)
+	return appendOutboxEvent(ctx, tx, tenantID, "ticket.transferred", ticket.TicketID, payloadJSON)
 }
 
 func insertOutboxEventNoShow(ctx context.Context, tx pgx.Tx, tenantID string, ticket models.Ticket, returned bool) error {
@@ -1418,6 +3598,7 @@ func insertOutboxEventNoShow(ctx context.Context, tx pgx.Tx, tenantID string, ti
 		"called_at":     ticket.CalledAt,
 		"counter_id":    ticket.CounterID,
 		"returned":      returned,
+		"recall_count":  ticket.RecallCount,
 		"tenant_id":     ticket.TenantID,
 		"branch_id":     ticket.BranchID,
 		"service_id":    ticket.ServiceID,
@@ -1429,20 +3610,142 @@ func insertOutboxEventNoShow(ctx context.Context, tx pgx.Tx, tenantID string, ti
 		return err
 	}
 
-	_, err = tx.Exec(ctx, `
-		INSERT INTO outbox_events (event_id, tenant_id, type, payload_json, created_at)
-		VALUES ($1, $2, $3, $4, $5)
-	`, uuid.NewString(), tenantID, "ticket.no_show", payloadJSON, time.Now().UTC())
+	return appendOutboxEvent(ctx, tx, tenantID, "ticket.no_show", ticket.TicketID, payloadJSON)
+}
+
+func insertOutboxEventArrived(ctx context.Context, tx pgx.Tx, tenantID string, ticket models.Ticket, queuedAt time.Time, method string, keptPlace bool) error {
+	payload := map[string]interface{}{
+		"ticket_id":            ticket.TicketID,
+		"ticket_number":        ticket.TicketNumber,
+		"status":               ticket.Status,
+		"request_id":           ticket.RequestID,
+		"created_at":           ticket.CreatedAt,
+		"queued_at":            queuedAt,
+		"arrival_confirmed_at": ticket.ArrivalConfirmedAt,
+		"arrival_method":       method,
+		"kept_place":           keptPlace,
+		"tenant_id":            ticket.TenantID,
+		"branch_id":            ticket.BranchID,
+		"service_id":           ticket.ServiceID,
+		"area_id":              ticket.AreaID,
+	}
+
+	payloadJSON, err := jsonBytes(payload)
+	if err != nil {
+		return err
+	}
+
+	return appendOutboxEvent(ctx, tx, tenantID, "ticket.arrived", ticket.TicketID, payloadJSON)
+}
+
+func insertOutboxEventPostponed(ctx context.Context, tx pgx.Tx, tenantID string, ticket models.Ticket, previousQueuedAt, queuedAt time.Time, places int, delay time.Duration) error {
+	payload := map[string]interface{}{
+		"ticket_id":          ticket.TicketID,
+		"ticket_number":      ticket.TicketNumber,
+		"status":             ticket.Status,
+		"request_id":         ticket.RequestID,
+		"created_at":         ticket.CreatedAt,
+		"queued_at":          queuedAt,
+		"previous_queued_at": previousQueuedAt,
+		"postpone_places":    places,
+		"postpone_minutes":   int(delay / time.Minute),
+		"postpone_count":     ticket.PostponeCount,
+		"tenant_id":          ticket.TenantID,
+		"branch_id":          ticket.BranchID,
+		"service_id":         ticket.ServiceID,
+		"area_id":            ticket.AreaID,
+	}
+
+	payloadJSON, err := jsonBytes(payload)
+	if err != nil {
+		return err
+	}
+
+	return appendOutboxEvent(ctx, tx, tenantID, "ticket.postponed", ticket.TicketID, payloadJSON)
+}
+
+func insertOutboxEventHold(ctx context.Context, tx pgx.Tx, tenantID, eventType string, ticket models.Ticket, expiryAction string) error {
+	payload := map[string]interface{}{
+		"ticket_id":       ticket.TicketID,
+		"ticket_number":   ticket.TicketNumber,
+		"status":          ticket.Status,
+		"request_id":      ticket.RequestID,
+		"hold_reason":     ticket.HoldReason,
+		"held_at":         ticket.HeldAt,
+		"hold_expires_at": ticket.HoldExpiresAt,
+		"hold_counter_id": ticket.HoldCounterID,
+		"tenant_id":       ticket.TenantID,
+		"branch_id":       ticket.BranchID,
+		"service_id":      ticket.ServiceID,
+		"area_id":         ticket.AreaID,
+	}
+	if expiryAction != "" {
+		payload["expiry_action"] = expiryAction
+	}
+
+	payloadJSON, err := jsonBytes(payload)
 	if err != nil {
 		return err
 	}
-	return insertTicketEvent(ctx, tx, ticket.TicketID, "ticket.no_show", payloadJSON)
+
+	return appendOutboxEvent(ctx, tx, tenantID, eventType, ticket.TicketID, payloadJSON)
 }
 
+// outboxChannel is the NOTIFY channel realtime and notification consumers
+// LISTEN on.
+const outboxChannel = "outbox_events"
+
 func jsonBytes(value interface{}) ([]byte, error) {
 	return json.Marshal(value)
 }
 
+// appendOutboxEvent writes an outbox event and the matching ticket_events
+// entry. The event is stored without a seq and takes no shared lock;
+// sequenceOutbox numbers it once it has committed. The NOTIFY is delivered
+// on commit and only wakes listening consumers.
+func appendOutboxEvent(ctx context.Context, tx pgx.Tx, tenantID, eventType, ticketID string, payloadJSON []byte) error {
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO outbox_events (event_id, tenant_id, type, payload_json, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, uuid.NewString(), tenantID, eventType, payloadJSON, time.Now().UTC()); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `SELECT pg_notify('`+outboxChannel+`', '')`); err != nil {
+		return err
+	}
+	return insertTicketEvent(ctx, tx, ticketID, eventType, payloadJSON)
+}
+
+// outboxSequencerLock is the advisory lock held while numbering outbox
+// events. Realtime and notification consumers take the same key.
+const outboxSequencerLock = "outbox:sequencer"
+
+// sequenceOutbox gives every committed outbox event without a seq the next
+// values from outbox_sequence, in write order. Only one transaction numbers
+// events at a time and it only sees committed rows, so seq values become
+// visible strictly in order: a reader that has seen seq N never later finds
+// a committed event below N.
+func sequenceOutbox(ctx context.Context, tx pgx.Tx) error {
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, outboxSequencerLock); err != nil {
+		return err
+	}
+	tag, err := tx.Exec(ctx, `
+		UPDATE outbox_events o
+		SET seq = q.last_seq + p.n
+		FROM (
+			SELECT event_id, ROW_NUMBER() OVER (ORDER BY write_order ASC) AS n
+			FROM outbox_events
+			WHERE seq IS NULL
+		) p, outbox_sequence q
+		WHERE q.id = 1 AND o.event_id = p.event_id
+	`)
+	if err != nil || tag.RowsAffected() == 0 {
+		return err
+	}
+	_, err = tx.Exec(ctx, `UPDATE outbox_sequence SET last_seq = last_seq + $1 WHERE id = 1`, tag.RowsAffected())
+	return err
+}
+
 func insertTicketEvent(ctx context.Context, tx pgx.Tx, ticketID, eventType string, payload []byte) error {
 	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, ticketID); err != nil {
 		return err
@@ -1466,8 +3769,14 @@ func insertTicketEvent(ctx context.Context, tx pgx.Tx, ticketID, eventType strin
 	if prevHash.Valid {
 		prev = prevHash.String
 	}
-	createdAt := time.Now().UTC()
-	hash := store.ComputeTicketEventHash(prev, ticketID, eventType, payload, createdAt, nextSeq)
+	// Hash the payload and timestamp as PostgreSQL will store them (jsonb
+	// text form, microsecond precision) so the chain can be re-verified.
+	var stored string
+	if err := tx.QueryRow(ctx, `SELECT $1::jsonb::text`, string(payload)).Scan(&stored); err != nil {
+		return err
+	}
+	createdAt := time.Now().UTC().Truncate(time.Microsecond)
+	hash := store.ComputeTicketEventHash(prev, ticketID, eventType, json.RawMessage(stored), createdAt, nextSeq)
 
 	_, err := tx.Exec(ctx, `
 		INSERT INTO ticket_events (ticket_id, ticket_seq, type, payload, created_at, prev_hash, hash)
@@ -1480,11 +3789,11 @@ func findTicketByRequestID(ctx context.Context, tx pgx.Tx, requestID string) (mo
 	var ticket models.Ticket
 	var areaIDNull sql.NullString
 	row := tx.QueryRow(ctx, `
-		SELECT ticket_id, ticket_number, status, created_at, request_id, area_id, branch_id, service_id, tenant_id
+		SELECT ticket_id, ticket_number, status, created_at, request_id, area_id, branch_id, service_id, tenant_id, party_size
 		FROM tickets
 		WHERE request_id = $1
 	`, requestID)
-	if err := row.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.CreatedAt, &ticket.RequestID, &areaIDNull, &ticket.BranchID, &ticket.ServiceID, &ticket.TenantID); err != nil {
+	if err := row.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.CreatedAt, &ticket.RequestID, &areaIDNull, &ticket.BranchID, &ticket.ServiceID, &ticket.TenantID, &ticket.PartySize); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return models.Ticket{}, false, nil
 		}
@@ -1709,6 +4018,57 @@ func insertActionRequest(ctx context.Context, tx pgx.Tx, action, requestID, tena
 	return err
 }
 
+// releaseHold moves a held ticket to toStatus and clears its hold metadata. The
+// returned ticket still carries the hold reason and counter for event payloads.
+func releaseHold(ctx context.Context, tx pgx.Tx, ticketID, tenantID, branchID, toStatus string) (models.Ticket, error) {
+	var ticket models.Ticket
+	var areaIDNull sql.NullString
+	var holdReasonNull sql.NullString
+	var heldAtNull sql.NullTime
+	var holdExpiresAtNull sql.NullTime
+	var holdCounterIDNull sql.NullString
+	row := tx.QueryRow(ctx, `
+		WITH current AS (
+			SELECT ticket_id, hold_reason, held_at, hold_expires_at, hold_counter_id
+			FROM tickets
+			WHERE ticket_id = $1 AND tenant_id = $2 AND branch_id = $3 AND status = 'held'
+			FOR UPDATE
+		), updated AS (
+			UPDATE tickets
+			SET status = $4,
+				hold_reason = NULL,
+				held_at = NULL,
+				hold_expires_at = NULL,
+				hold_counter_id = NULL,
+				cancelled_at = CASE WHEN $4 = 'cancelled' THEN NOW() ELSE tickets.cancelled_at END
+			FROM current
+			WHERE tickets.ticket_id = current.ticket_id
+			RETURNING tickets.ticket_id, tickets.ticket_number, tickets.status, tickets.created_at, tickets.branch_id, tickets.service_id, tickets.area_id, tickets.tenant_id
+		)
+		SELECT updated.ticket_id, updated.ticket_number, updated.status, updated.created_at, updated.branch_id, updated.service_id, updated.area_id, updated.tenant_id,
+			current.hold_reason, current.held_at, current.hold_expires_at, current.hold_counter_id
+		FROM updated
+		JOIN current ON current.ticket_id = updated.ticket_id
+	`, ticketID, tenantID, branchID, toStatus)
+	if err := row.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.CreatedAt, &ticket.BranchID, &ticket.ServiceID, &areaIDNull, &ticket.TenantID, &holdReasonNull, &heldAtNull, &holdExpiresAtNull, &holdCounterIDNull); err != nil {
+		return models.Ticket{}, err
+	}
+	if areaIDNull.Valid {
+		ticket.AreaID = areaIDNull.String
+	}
+	applyHoldFields(&ticket, holdReasonNull, heldAtNull, holdExpiresAtNull, holdCounterIDNull)
+	return ticket, nil
+}
+
+func applyHoldFields(ticket *models.Ticket, reason sql.NullString, heldAt, expiresAt sql.NullTime, counterID sql.NullString) {
+	if reason.Valid {
+		ticket.HoldReason = reason.String
+	}
+	ticket.HeldAt = nullTimePtr(heldAt)
+	ticket.HoldExpiresAt = nullTimePtr(expiresAt)
+	ticket.HoldCounterID = nullStringPtr(counterID)
+}
+
 func loadTicketState(ctx context.Context, tx pgx.Tx, ticketID, tenantID, branchID string) (string, string, bool, error) {
 	var status string
 	var counterID sql.NullString
@@ -1730,18 +4090,31 @@ func loadTicketState(ctx context.Context, tx pgx.Tx, ticketID, tenantID, branchI
 }
 
 func getTicketByID(ctx context.Context, tx pgx.Tx, ticketID, tenantID, branchID string) (models.Ticket, error) {
+	return selectTicketByID(ctx, tx, "", ticketID, tenantID, branchID)
+}
+
+// lockTicketByID is getTicketByID holding the row lock until tx ends, for
+// checks that the following UPDATE relies on.
+func lockTicketByID(ctx context.Context, tx pgx.Tx, ticketID, tenantID, branchID string) (models.Ticket, error) {
+	return selectTicketByID(ctx, tx, "FOR UPDATE", ticketID, tenantID, branchID)
+}
+
+func selectTicketByID(ctx context.Context, tx pgx.Tx, lock, ticketID, tenantID, branchID string) (models.Ticket, error) {
 	var ticket models.Ticket
 	var calledAtNull sql.NullTime
 	var counterIDNull sql.NullString
 	var servedAtNull sql.NullTime
 	var completedAtNull sql.NullTime
 	var areaIDNull sql.NullString
+	var lastRecalledNull sql.NullTime
 	row := tx.QueryRow(ctx, `
-		SELECT ticket_id, ticket_number, status, created_at, called_at, counter_id, served_at, completed_at, branch_id, service_id, area_id, tenant_id
+		SELECT ticket_id, ticket_number, status, created_at, called_at, counter_id, served_at, completed_at, branch_id, service_id, area_id, tenant_id,
+			recall_count, last_recalled_at
 		FROM tickets
 		WHERE ticket_id = $1 AND tenant_id = $2 AND branch_id = $3
-	`, ticketID, tenantID, branchID)
-	if err := row.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.CreatedAt, &calledAtNull, &counterIDNull, &servedAtNull, &completedAtNull, &ticket.BranchID, &ticket.ServiceID, &areaIDNull, &ticket.TenantID); err != nil {
+		`+lock, ticketID, tenantID, branchID)
+	if err := row.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.CreatedAt, &calledAtNull, &counterIDNull, &servedAtNull, &completedAtNull, &ticket.BranchID, &ticket.ServiceID, &areaIDNull, &ticket.TenantID,
+		&ticket.RecallCount, &lastRecalledNull); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return models.Ticket{}, store.ErrTicketNotFound
 		}
@@ -1751,6 +4124,7 @@ func getTicketByID(ctx context.Context, tx pgx.Tx, ticketID, tenantID, branchID
 	ticket.CounterID = nullStringPtr(counterIDNull)
 	ticket.ServedAt = nullTimePtr(servedAtNull)
 	ticket.CompletedAt = nullTimePtr(completedAtNull)
+	ticket.LastRecalledAt = nullTimePtr(lastRecalledNull)
 	if areaIDNull.Valid {
 		ticket.AreaID = areaIDNull.String
 	}
@@ -1852,3 +4226,34 @@ func (s *Store) GetAccess(ctx context.Context, userID string) ([]string, []strin
 
 	return branches, services, nil
 }
+
+// AcquireLease takes or renews the named lease for holder. It fails while
+// another holder's lease is unexpired.
+func (s *Store) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	var current string
+	err := s.pool.QueryRow(ctx, `
+		INSERT INTO job_leases (name, holder, acquired_at, expires_at)
+		VALUES ($1, $2, NOW(), NOW() + make_interval(secs => $3))
+		ON CONFLICT (name) DO UPDATE
+		SET holder = EXCLUDED.holder,
+			acquired_at = CASE WHEN job_leases.holder = EXCLUDED.holder THEN job_leases.acquired_at ELSE NOW() END,
+			expires_at = EXCLUDED.expires_at
+		WHERE job_leases.holder = EXCLUDED.holder OR job_leases.expires_at < NOW()
+		RETURNING holder
+	`, name, holder, ttl.Seconds()).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *Store) ReleaseLease(ctx context.Context, name, holder string) error {
+	_, err := s.pool.Exec(ctx, `
+		DELETE FROM job_leases
+		WHERE name = $1 AND holder = $2
+	`, name, holder)
+	return err
+}
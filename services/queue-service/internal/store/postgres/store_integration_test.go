@@ -11,6 +11,7 @@ import (
 	"testing"
 	"time"
 
+	"qms/queue-service/internal/customerref"
 	"qms/queue-service/internal/models"
 	"qms/queue-service/internal/store"
 
@@ -318,6 +319,700 @@ func TestTicketEventHashAndRehydrate(t *testing.T) {
 	}
 }
 
+func TestHoldExpiryPolicy(t *testing.T) {
+	ctx := context.Background()
+	st, pool, cleanup := setupTestStore(t, ctx)
+	t.Cleanup(cleanup)
+
+	tenantID := uuid.NewString()
+	branchID := uuid.NewString()
+	serviceID := uuid.NewString()
+	counterID := uuid.NewString()
+
+	seedBaseData(t, ctx, pool, tenantID, branchID, serviceID, counterID, uuid.NewString())
+
+	if _, err := pool.Exec(ctx, `
+		INSERT INTO service_policies (tenant_id, branch_id, service_id, no_show_grace_seconds, return_to_queue, appointment_ratio_percent, appointment_window_size, appointment_boost_minutes, hold_max_seconds, hold_expiry_action)
+		VALUES ($1, $2, $3, 300, false, 0, 5, 0, 60, 'cancel')
+	`, tenantID, branchID, serviceID); err != nil {
+		t.Fatalf("insert policy: %v", err)
+	}
+
+	ticket := createTicket(t, ctx, st, tenantID, branchID, serviceID, uuid.NewString())
+	held, _, err := st.HoldTicket(ctx, store.TicketActionInput{
+		RequestID:    uuid.NewString(),
+		TenantID:     tenantID,
+		BranchID:     branchID,
+		TicketID:     ticket.TicketID,
+		CounterID:    counterID,
+		Reason:       "missing documents",
+		HoldDuration: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("hold: %v", err)
+	}
+	if held.HoldExpiresAt == nil || held.HeldAt == nil || held.HoldExpiresAt.Sub(*held.HeldAt) != time.Minute {
+		t.Fatalf("expected hold capped at policy maximum, got %+v", held)
+	}
+
+	held2, err := st.ListHeldTickets(ctx, tenantID, branchID, counterID)
+	if err != nil {
+		t.Fatalf("list held: %v", err)
+	}
+	if len(held2) != 1 || held2[0].HoldReason != "missing documents" {
+		t.Fatalf("unexpected held tickets: %+v", held2)
+	}
+
+	if _, err := pool.Exec(ctx, `UPDATE tickets SET hold_expires_at = now() - interval '1 second' WHERE ticket_id = $1`, ticket.TicketID); err != nil {
+		t.Fatalf("expire hold: %v", err)
+	}
+	count, err := st.ExpireHolds(ctx, 10)
+	if err != nil {
+		t.Fatalf("expire holds: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 expired hold, got %d", count)
+	}
+
+	current, _, err := st.GetTicket(ctx, tenantID, branchID, ticket.TicketID)
+	if err != nil {
+		t.Fatalf("get ticket: %v", err)
+	}
+	if current.Status != models.StatusCancelled || current.HoldExpiresAt != nil {
+		t.Fatalf("expected cancelled ticket without hold, got %+v", current)
+	}
+}
+
+func TestRecallLimitConvertsToNoShow(t *testing.T) {
+	ctx := context.Background()
+	st, pool, cleanup := setupTestStore(t, ctx)
+	t.Cleanup(cleanup)
+
+	tenantID := uuid.NewString()
+	branchID := uuid.NewString()
+	serviceID := uuid.NewString()
+	counterID := uuid.NewString()
+
+	seedBaseData(t, ctx, pool, tenantID, branchID, serviceID, counterID, uuid.NewString())
+
+	if _, err := pool.Exec(ctx, `
+		INSERT INTO service_policies (tenant_id, branch_id, service_id, no_show_grace_seconds, return_to_queue, appointment_ratio_percent, appointment_window_size, appointment_boost_minutes, max_recalls, min_recall_interval_seconds)
+		VALUES ($1, $2, $3, 300, false, 0, 5, 0, 1, 0)
+	`, tenantID, branchID, serviceID); err != nil {
+		t.Fatalf("insert policy: %v", err)
+	}
+
+	ticket := createTicket(t, ctx, st, tenantID, branchID, serviceID, uuid.NewString())
+	if _, _, err := st.CallNext(ctx, store.CallNextInput{
+		RequestID: uuid.NewString(),
+		TenantID:  tenantID,
+		BranchID:  branchID,
+		ServiceID: serviceID,
+		CounterID: counterID,
+	}); err != nil {
+		t.Fatalf("call next: %v", err)
+	}
+
+	recalled, _, err := st.RecallTicket(ctx, store.TicketActionInput{
+		RequestID: uuid.NewString(),
+		TenantID:  tenantID,
+		BranchID:  branchID,
+		TicketID:  ticket.TicketID,
+		CounterID: counterID,
+	})
+	if err != nil {
+		t.Fatalf("recall: %v", err)
+	}
+	if recalled.RecallCount != 1 || recalled.Status != models.StatusCalled {
+		t.Fatalf("expected first recall to be counted, got %+v", recalled)
+	}
+
+	limited, _, err := st.RecallTicket(ctx, store.TicketActionInput{
+		RequestID: uuid.NewString(),
+		TenantID:  tenantID,
+		BranchID:  branchID,
+		TicketID:  ticket.TicketID,
+		CounterID: counterID,
+	})
+	if err != nil {
+		t.Fatalf("recall over limit: %v", err)
+	}
+	if limited.Status != models.StatusNoShow {
+		t.Fatalf("expected no_show after recall limit, got %s", limited.Status)
+	}
+}
+
+func TestReopenCompletedTicket(t *testing.T) {
+	ctx := context.Background()
+	st, pool, cleanup := setupTestStore(t, ctx)
+	t.Cleanup(cleanup)
+
+	tenantID := uuid.NewString()
+	branchID := uuid.NewString()
+	serviceID := uuid.NewString()
+	counterID := uuid.NewString()
+
+	seedBaseData(t, ctx, pool, tenantID, branchID, serviceID, counterID, uuid.NewString())
+
+	ticket := createTicket(t, ctx, st, tenantID, branchID, serviceID, uuid.NewString())
+	if _, _, err := st.CallNext(ctx, store.CallNextInput{
+		RequestID: uuid.NewString(),
+		TenantID:  tenantID,
+		BranchID:  branchID,
+		ServiceID: serviceID,
+		CounterID: counterID,
+	}); err != nil {
+		t.Fatalf("call next: %v", err)
+	}
+	if _, _, err := st.StartServing(ctx, store.TicketActionInput{
+		RequestID: uuid.NewString(),
+		TenantID:  tenantID,
+		BranchID:  branchID,
+		TicketID:  ticket.TicketID,
+		CounterID: counterID,
+	}); err != nil {
+		t.Fatalf("start serving: %v", err)
+	}
+	if _, _, err := st.CompleteTicket(ctx, store.TicketActionInput{
+		RequestID: uuid.NewString(),
+		TenantID:  tenantID,
+		BranchID:  branchID,
+		TicketID:  ticket.TicketID,
+	}); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+
+	reopened, _, err := st.ReopenTicket(ctx, store.TicketActionInput{
+		RequestID: uuid.NewString(),
+		TenantID:  tenantID,
+		BranchID:  branchID,
+		TicketID:  ticket.TicketID,
+		Reason:    "completed by mistake",
+	})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if reopened.Status != models.StatusServing {
+		t.Fatalf("expected serving after reopen, got %s", reopened.Status)
+	}
+
+	current, _, err := st.GetTicket(ctx, tenantID, branchID, ticket.TicketID)
+	if err != nil {
+		t.Fatalf("get ticket: %v", err)
+	}
+	if current.CompletedAt != nil {
+		t.Fatalf("expected completed_at to be cleared")
+	}
+
+	_, _, err = st.ReopenTicket(ctx, store.TicketActionInput{
+		RequestID: uuid.NewString(),
+		TenantID:  tenantID,
+		BranchID:  branchID,
+		TicketID:  ticket.TicketID,
+		Reason:    "again",
+	})
+	if !errors.Is(err, store.ErrInvalidState) {
+		t.Fatalf("expected invalid state for non-terminal ticket, got %v", err)
+	}
+}
+
+func TestPartySizeCapacity(t *testing.T) {
+	ctx := context.Background()
+	st, pool, cleanup := setupTestStore(t, ctx)
+	t.Cleanup(cleanup)
+
+	tenantID := uuid.NewString()
+	branchID := uuid.NewString()
+	serviceID := uuid.NewString()
+	counterID := uuid.NewString()
+
+	seedBaseData(t, ctx, pool, tenantID, branchID, serviceID, counterID, uuid.NewString())
+	if _, err := pool.Exec(ctx, `
+		INSERT INTO service_policies (tenant_id, branch_id, service_id, no_show_grace_seconds, return_to_queue, appointment_ratio_percent, appointment_window_size, appointment_boost_minutes, max_party_size, max_waiting_people)
+		VALUES ($1, $2, $3, 300, false, 0, 5, 0, 4, 5)
+	`, tenantID, branchID, serviceID); err != nil {
+		t.Fatalf("insert policy: %v", err)
+	}
+
+	input := store.CreateTicketInput{
+		RequestID:     uuid.NewString(),
+		TenantID:      tenantID,
+		BranchID:      branchID,
+		ServiceID:     serviceID,
+		Channel:       "kiosk",
+		PriorityClass: "regular",
+		PartySize:     5,
+		CreatedAt:     time.Now().UTC(),
+	}
+	if _, _, err := st.CreateTicket(ctx, input); !errors.Is(err, store.ErrPartyTooLarge) {
+		t.Fatalf("expected party too large, got %v", err)
+	}
+
+	input.RequestID = uuid.NewString()
+	input.PartySize = 3
+	family, _, err := st.CreateTicket(ctx, input)
+	if err != nil {
+		t.Fatalf("create family ticket: %v", err)
+	}
+	if family.PartySize != 3 {
+		t.Fatalf("expected party size 3, got %d", family.PartySize)
+	}
+
+	input.RequestID = uuid.NewString()
+	input.LinkedTicketID = family.TicketID
+	companion, _, err := st.CreateTicket(ctx, input)
+	if !errors.Is(err, store.ErrCapacityExceeded) {
+		t.Fatalf("expected capacity exceeded, got %v (%s)", err, companion.TicketID)
+	}
+
+	input.RequestID = uuid.NewString()
+	input.PartySize = 2
+	companion, _, err = st.CreateTicket(ctx, input)
+	if err != nil {
+		t.Fatalf("create companion ticket: %v", err)
+	}
+	if companion.LinkedTicketID == nil || *companion.LinkedTicketID != family.TicketID {
+		t.Fatalf("expected companion to link to %s", family.TicketID)
+	}
+}
+
+func TestCallNextRespectsResourceCapacity(t *testing.T) {
+	ctx := context.Background()
+	st, pool, cleanup := setupTestStore(t, ctx)
+	t.Cleanup(cleanup)
+
+	tenantID := uuid.NewString()
+	branchID := uuid.NewString()
+	serviceID := uuid.NewString()
+	counterID := uuid.NewString()
+
+	seedBaseData(t, ctx, pool, tenantID, branchID, serviceID, counterID, uuid.NewString())
+	if _, err := pool.Exec(ctx, `
+		INSERT INTO resources (resource_id, branch_id, counter_id, name, kind, capacity)
+		VALUES ($1, $2, $3, 'Room 1', 'room', 2)
+	`, uuid.NewString(), branchID, counterID); err != nil {
+		t.Fatalf("insert resource: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		createTicket(t, ctx, st, tenantID, branchID, serviceID, uuid.NewString())
+	}
+
+	callNext := func() (models.Ticket, error) {
+		ticket, _, err := st.CallNext(ctx, store.CallNextInput{
+			RequestID: uuid.NewString(),
+			TenantID:  tenantID,
+			BranchID:  branchID,
+			ServiceID: serviceID,
+			CounterID: counterID,
+		})
+		return ticket, err
+	}
+
+	first, err := callNext()
+	if err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+	if first.ResourceID == nil {
+		t.Fatalf("expected resource to be assigned")
+	}
+	if _, err := callNext(); err != nil {
+		t.Fatalf("second call: %v", err)
+	}
+	if _, err := callNext(); !errors.Is(err, store.ErrCounterAtCapacity) {
+		t.Fatalf("expected counter at capacity, got %v", err)
+	}
+
+	active, err := st.ListActiveTickets(ctx, tenantID, branchID, counterID)
+	if err != nil {
+		t.Fatalf("list active: %v", err)
+	}
+	if len(active) != 2 {
+		t.Fatalf("expected 2 active tickets, got %d", len(active))
+	}
+}
+
+func TestRemoteTicketSkippedUntilArrival(t *testing.T) {
+	ctx := context.Background()
+	st, pool, cleanup := setupTestStore(t, ctx)
+	t.Cleanup(cleanup)
+
+	tenantID := uuid.NewString()
+	branchID := uuid.NewString()
+	serviceID := uuid.NewString()
+	counterID := uuid.NewString()
+
+	seedBaseData(t, ctx, pool, tenantID, branchID, serviceID, counterID, uuid.NewString())
+
+	remote, _, err := st.CreateTicket(ctx, store.CreateTicketInput{
+		RequestID:     uuid.NewString(),
+		TenantID:      tenantID,
+		BranchID:      branchID,
+		ServiceID:     serviceID,
+		Channel:       "web",
+		PriorityClass: "regular",
+		Remote:        true,
+		CreatedAt:     time.Now().UTC().Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("create remote ticket: %v", err)
+	}
+	if remote.Status != models.StatusRemote || remote.RemoteExpiresAt == nil {
+		t.Fatalf("expected remote ticket with expiry, got %+v", remote)
+	}
+	walkIn := createTicket(t, ctx, st, tenantID, branchID, serviceID, uuid.NewString())
+
+	callNext := func() (models.Ticket, error) {
+		ticket, _, err := st.CallNext(ctx, store.CallNextInput{
+			RequestID: uuid.NewString(),
+			TenantID:  tenantID,
+			BranchID:  branchID,
+			ServiceID: serviceID,
+			CounterID: counterID,
+		})
+		return ticket, err
+	}
+
+	called, err := callNext()
+	if err != nil {
+		t.Fatalf("call next: %v", err)
+	}
+	if called.TicketID != walkIn.TicketID {
+		t.Fatalf("expected walk-in to be called before unconfirmed remote ticket")
+	}
+	if _, err := callNext(); !errors.Is(err, store.ErrNoTicket) {
+		t.Fatalf("expected no ticket while remote is unconfirmed, got %v", err)
+	}
+
+	arrived, _, err := st.ConfirmArrival(ctx, store.TicketActionInput{
+		RequestID: uuid.NewString(),
+		TenantID:  tenantID,
+		BranchID:  branchID,
+		TicketID:  remote.TicketID,
+		Method:    models.ArrivalQR,
+	})
+	if err != nil {
+		t.Fatalf("confirm arrival: %v", err)
+	}
+	if arrived.Status != models.StatusWaiting {
+		t.Fatalf("expected waiting after arrival, got %s", arrived.Status)
+	}
+
+	called, err = callNext()
+	if err != nil {
+		t.Fatalf("call next after arrival: %v", err)
+	}
+	if called.TicketID != remote.TicketID {
+		t.Fatalf("expected remote ticket to be called after arrival")
+	}
+}
+
+func TestPostponeTicketByPlaces(t *testing.T) {
+	ctx := context.Background()
+	st, pool, cleanup := setupTestStore(t, ctx)
+	t.Cleanup(cleanup)
+
+	tenantID := uuid.NewString()
+	branchID := uuid.NewString()
+	serviceID := uuid.NewString()
+	counterID := uuid.NewString()
+
+	seedBaseData(t, ctx, pool, tenantID, branchID, serviceID, counterID, uuid.NewString())
+
+	first := createTicket(t, ctx, st, tenantID, branchID, serviceID, uuid.NewString())
+	second := createTicket(t, ctx, st, tenantID, branchID, serviceID, uuid.NewString())
+	createTicket(t, ctx, st, tenantID, branchID, serviceID, uuid.NewString())
+
+	postpone := store.TicketActionInput{
+		RequestID:      uuid.NewString(),
+		TenantID:       tenantID,
+		BranchID:       branchID,
+		TicketID:       first.TicketID,
+		PostponePlaces: 1,
+	}
+	postponed, _, err := st.PostponeTicket(ctx, postpone)
+	if err != nil {
+		t.Fatalf("postpone: %v", err)
+	}
+	if postponed.PostponeCount != 1 {
+		t.Fatalf("expected postpone count 1, got %d", postponed.PostponeCount)
+	}
+	if _, created, err := st.PostponeTicket(ctx, postpone); err != nil || created {
+		t.Fatalf("expected idempotent replay, got created=%v err=%v", created, err)
+	}
+	postpone.RequestID = uuid.NewString()
+	if _, _, err := st.PostponeTicket(ctx, postpone); !errors.Is(err, store.ErrPostponeLimit) {
+		t.Fatalf("expected postpone limit, got %v", err)
+	}
+
+	for _, want := range []string{second.TicketID, first.TicketID} {
+		called, _, err := st.CallNext(ctx, store.CallNextInput{
+			RequestID: uuid.NewString(),
+			TenantID:  tenantID,
+			BranchID:  branchID,
+			ServiceID: serviceID,
+			CounterID: counterID,
+		})
+		if err != nil {
+			t.Fatalf("call next: %v", err)
+		}
+		if called.TicketID != want {
+			t.Fatalf("expected %s to be called, got %s", want, called.TicketID)
+		}
+	}
+}
+
+func TestSearchTicketsPaginates(t *testing.T) {
+	ctx := context.Background()
+	st, pool, cleanup := setupTestStore(t, ctx)
+	t.Cleanup(cleanup)
+
+	tenantID := uuid.NewString()
+	branchID := uuid.NewString()
+	serviceID := uuid.NewString()
+	counterID := uuid.NewString()
+
+	seedBaseData(t, ctx, pool, tenantID, branchID, serviceID, counterID, uuid.NewString())
+
+	var created []models.Ticket
+	for i := 0; i < 3; i++ {
+		created = append(created, createTicket(t, ctx, st, tenantID, branchID, serviceID, uuid.NewString()))
+	}
+
+	input := store.TicketSearchInput{
+		TenantID: tenantID,
+		BranchID: branchID,
+		Statuses: []string{models.StatusWaiting},
+		Limit:    2,
+	}
+	first, err := st.SearchTickets(ctx, input)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(first.Tickets) != 2 || first.NextCursor == "" {
+		t.Fatalf("expected first page of 2 with cursor, got %d %q", len(first.Tickets), first.NextCursor)
+	}
+	if first.Tickets[0].TicketID != created[2].TicketID {
+		t.Fatalf("expected newest ticket first")
+	}
+
+	input.Cursor = first.NextCursor
+	second, err := st.SearchTickets(ctx, input)
+	if err != nil {
+		t.Fatalf("search page 2: %v", err)
+	}
+	if len(second.Tickets) != 1 || second.NextCursor != "" || second.Tickets[0].TicketID != created[0].TicketID {
+		t.Fatalf("unexpected second page: %+v", second)
+	}
+
+	byNumber, err := st.SearchTickets(ctx, store.TicketSearchInput{TenantID: tenantID, BranchID: branchID, TicketNumber: created[1].TicketNumber})
+	if err != nil {
+		t.Fatalf("search by number: %v", err)
+	}
+	if len(byNumber.Tickets) != 1 || byNumber.Tickets[0].TicketID != created[1].TicketID {
+		t.Fatalf("unexpected search by number: %+v", byNumber)
+	}
+}
+
+func TestCustomerRefTokenisedAndPurged(t *testing.T) {
+	ctx := context.Background()
+	st, pool, cleanup := setupTestStore(t, ctx)
+	t.Cleanup(cleanup)
+
+	tokenizer, err := customerref.New("hash-secret", "enc-secret")
+	if err != nil {
+		t.Fatalf("tokenizer: %v", err)
+	}
+	st.customerRefs = tokenizer
+
+	tenantID := uuid.NewString()
+	branchID := uuid.NewString()
+	serviceID := uuid.NewString()
+	counterID := uuid.NewString()
+
+	seedBaseData(t, ctx, pool, tenantID, branchID, serviceID, counterID, uuid.NewString())
+
+	ticket, _, err := st.CreateTicket(ctx, store.CreateTicketInput{
+		RequestID:       uuid.NewString(),
+		TenantID:        tenantID,
+		BranchID:        branchID,
+		ServiceID:       serviceID,
+		Channel:         "kiosk",
+		PriorityClass:   "regular",
+		CustomerRef:     "cif-0042 17",
+		CustomerRefType: "cif",
+		CreatedAt:       time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatalf("create ticket: %v", err)
+	}
+
+	var stored []byte
+	if err := pool.QueryRow(ctx, `SELECT customer_ref_enc FROM tickets WHERE ticket_id = $1`, ticket.TicketID).Scan(&stored); err != nil {
+		t.Fatalf("load ref: %v", err)
+	}
+	if strings.Contains(string(stored), "0042") {
+		t.Fatalf("customer ref stored in plain text")
+	}
+
+	page, err := st.SearchTickets(ctx, store.TicketSearchInput{TenantID: tenantID, BranchID: branchID, CustomerRef: "CIF004217"})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(page.Tickets) != 1 || page.Tickets[0].TicketID != ticket.TicketID {
+		t.Fatalf("expected ticket found by normalised ref, got %+v", page.Tickets)
+	}
+
+	ref, err := st.GetCustomerRef(ctx, tenantID, branchID, ticket.TicketID)
+	if err != nil {
+		t.Fatalf("get ref: %v", err)
+	}
+	if ref.Value != "cif-0042 17" || ref.Type != "cif" {
+		t.Fatalf("unexpected ref: %+v", ref)
+	}
+
+	purged, err := st.PurgeCustomerRef(ctx, tenantID, "CIF-0042-17")
+	if err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if purged != 1 {
+		t.Fatalf("expected 1 purged row, got %d", purged)
+	}
+	ref, err = st.GetCustomerRef(ctx, tenantID, branchID, ticket.TicketID)
+	if err != nil {
+		t.Fatalf("get ref after purge: %v", err)
+	}
+	if ref.Value != "" {
+		t.Fatalf("expected ref cleared, got %+v", ref)
+	}
+
+	if _, err := pool.Exec(ctx, `INSERT INTO tenant_privacy_prefs (tenant_id, customer_ref_mode) VALUES ($1, 'required')`, tenantID); err != nil {
+		t.Fatalf("set privacy prefs: %v", err)
+	}
+	_, _, err = st.CreateTicket(ctx, store.CreateTicketInput{
+		RequestID:     uuid.NewString(),
+		TenantID:      tenantID,
+		BranchID:      branchID,
+		ServiceID:     serviceID,
+		Channel:       "kiosk",
+		PriorityClass: "regular",
+		CreatedAt:     time.Now().UTC(),
+	})
+	if !errors.Is(err, store.ErrCustomerRefMissing) {
+		t.Fatalf("expected missing customer ref error, got %v", err)
+	}
+}
+
+func TestVerifyTicketChainsDetectsTampering(t *testing.T) {
+	ctx := context.Background()
+	st, pool, cleanup := setupTestStore(t, ctx)
+	t.Cleanup(cleanup)
+
+	tenantID := uuid.NewString()
+	branchID := uuid.NewString()
+	serviceID := uuid.NewString()
+	counterID := uuid.NewString()
+
+	seedBaseData(t, ctx, pool, tenantID, branchID, serviceID, counterID, uuid.NewString())
+
+	ticket := createTicket(t, ctx, st, tenantID, branchID, serviceID, uuid.NewString())
+	if _, _, err := st.CancelTicket(ctx, store.TicketActionInput{
+		RequestID: uuid.NewString(),
+		TenantID:  tenantID,
+		BranchID:  branchID,
+		TicketID:  ticket.TicketID,
+	}); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+
+	report, err := st.VerifyTicketChains(ctx, store.ChainVerifyInput{TenantID: tenantID, TicketID: ticket.TicketID})
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if len(report.Issues) != 0 || report.EventsChecked < 2 {
+		t.Fatalf("expected intact chain, got %+v", report)
+	}
+
+	today := time.Now().UTC()
+	sealed, err := st.SealEventDigests(ctx, today)
+	if err != nil {
+		t.Fatalf("seal digests: %v", err)
+	}
+	if len(sealed) != 1 || sealed[0].TenantID != tenantID || sealed[0].ChainIssues != 0 {
+		t.Fatalf("unexpected sealed digests: %+v", sealed)
+	}
+
+	if _, err := pool.Exec(ctx, `
+		UPDATE ticket_events SET payload = jsonb_set(payload, '{status}', '"done"')
+		WHERE ticket_id = $1 AND ticket_seq = 1
+	`, ticket.TicketID); err != nil {
+		t.Fatalf("tamper: %v", err)
+	}
+
+	report, err = st.VerifyTicketChains(ctx, store.ChainVerifyInput{TenantID: tenantID, Day: today})
+	if err != nil {
+		t.Fatalf("verify day: %v", err)
+	}
+	if len(report.Issues) != 1 || report.Issues[0].Kind != store.ChainHashMismatch || report.Issues[0].TicketSeq != 1 {
+		t.Fatalf("expected hash mismatch at seq 1, got %+v", report.Issues)
+	}
+	if report.DigestMatches == nil || !*report.DigestMatches {
+		t.Fatalf("expected sealed root to still match stored hashes, got %+v", report)
+	}
+}
+
+func TestReplayTicketsRepairsDrift(t *testing.T) {
+	ctx := context.Background()
+	st, pool, cleanup := setupTestStore(t, ctx)
+	t.Cleanup(cleanup)
+
+	tenantID := uuid.NewString()
+	branchID := uuid.NewString()
+	serviceID := uuid.NewString()
+	counterID := uuid.NewString()
+
+	seedBaseData(t, ctx, pool, tenantID, branchID, serviceID, counterID, uuid.NewString())
+
+	ticket := createTicket(t, ctx, st, tenantID, branchID, serviceID, uuid.NewString())
+	if _, _, err := st.CallNext(ctx, store.CallNextInput{
+		RequestID: uuid.NewString(),
+		TenantID:  tenantID,
+		BranchID:  branchID,
+		ServiceID: serviceID,
+		CounterID: counterID,
+	}); err != nil {
+		t.Fatalf("call next: %v", err)
+	}
+
+	report, err := st.ReplayTickets(ctx, store.ReplayInput{TenantID: tenantID, ServiceID: serviceID})
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if report.TicketsChecked != 1 || report.Drifted != 0 {
+		t.Fatalf("expected clean projection, got %+v", report)
+	}
+
+	if _, err := pool.Exec(ctx, `UPDATE tickets SET status = 'waiting', called_at = NULL WHERE ticket_id = $1`, ticket.TicketID); err != nil {
+		t.Fatalf("corrupt projection: %v", err)
+	}
+
+	report, err = st.ReplayTickets(ctx, store.ReplayInput{TenantID: tenantID, TicketID: ticket.TicketID, Repair: true})
+	if err != nil {
+		t.Fatalf("replay repair: %v", err)
+	}
+	if report.Drifted != 1 || report.Repaired != 1 || len(report.Tickets[0].Fields) != 2 {
+		t.Fatalf("expected status and called_at drift repaired, got %+v", report)
+	}
+
+	repaired, _, err := st.GetTicket(ctx, tenantID, branchID, ticket.TicketID)
+	if err != nil {
+		t.Fatalf("get ticket: %v", err)
+	}
+	if repaired.Status != models.StatusCalled || repaired.CalledAt == nil {
+		t.Fatalf("expected projection restored, got %+v", repaired)
+	}
+}
+
 type callResult struct {
 	ticketID string
 	ok       bool
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"time"
+
+	"qms/queue-service/internal/models"
+)
+
+const (
+	DefaultReplayLimit = 500
+	MaxReplayLimit     = 5000
+)
+
+// ReplayInput scopes an event replay to one ticket, or to the tenant's
+// tickets (optionally one service) created within [From, To). Repair writes
+// the state rebuilt from ticket_events back to the tickets projection.
+type ReplayInput struct {
+	TenantID  string
+	TicketID  string
+	ServiceID string
+	From      time.Time
+	To        time.Time
+	Limit     int
+	Repair    bool
+}
+
+// FieldDrift is a projection column that disagrees with the replayed events.
+type FieldDrift struct {
+	Field      string `json:"field"`
+	Projection string `json:"projection"`
+	Events     string `json:"events"`
+}
+
+type TicketDrift struct {
+	TicketID     string       `json:"ticket_id"`
+	TicketNumber string       `json:"ticket_number"`
+	NoEvents     bool         `json:"no_events,omitempty"`
+	Fields       []FieldDrift `json:"fields,omitempty"`
+	Repaired     bool         `json:"repaired,omitempty"`
+}
+
+type ReplayReport struct {
+	TenantID       string        `json:"tenant_id"`
+	TicketsChecked int           `json:"tickets_checked"`
+	Drifted        int           `json:"drifted"`
+	Repaired       int           `json:"repaired"`
+	Truncated      bool          `json:"truncated"`
+	Tickets        []TicketDrift `json:"tickets"`
+}
+
+// CompareProjection lists the fields where the stored projection differs
+// from the ticket rebuilt by RehydrateTicket. Timestamps only count when the
+// events carry them, and counter_id only while the ticket is at a counter,
+// since earlier events keep the last counter after a ticket is requeued.
+func CompareProjection(projection, rebuilt models.Ticket) []FieldDrift {
+	var drift []FieldDrift
+	if rebuilt.Status != "" && projection.Status != rebuilt.Status {
+		drift = append(drift, FieldDrift{Field: "status", Projection: projection.Status, Events: rebuilt.Status})
+	}
+	if rebuilt.ServiceID != "" && projection.ServiceID != rebuilt.ServiceID {
+		drift = append(drift, FieldDrift{Field: "service_id", Projection: projection.ServiceID, Events: rebuilt.ServiceID})
+	}
+	if !rebuilt.CreatedAt.IsZero() && !sameTime(&projection.CreatedAt, &rebuilt.CreatedAt) {
+		drift = append(drift, FieldDrift{Field: "created_at", Projection: formatTime(&projection.CreatedAt), Events: formatTime(&rebuilt.CreatedAt)})
+	}
+	for _, pair := range []struct {
+		field      string
+		projection *time.Time
+		rebuilt    *time.Time
+	}{
+		{"called_at", projection.CalledAt, rebuilt.CalledAt},
+		{"served_at", projection.ServedAt, rebuilt.ServedAt},
+		{"completed_at", projection.CompletedAt, rebuilt.CompletedAt},
+	} {
+		if pair.rebuilt != nil && !sameTime(pair.projection, pair.rebuilt) {
+			drift = append(drift, FieldDrift{Field: pair.field, Projection: formatTime(pair.projection), Events: formatTime(pair.rebuilt)})
+		}
+	}
+	if rebuilt.Status == models.StatusCalled || rebuilt.Status == models.StatusServing {
+		if rebuilt.CounterID != nil && (projection.CounterID == nil || *projection.CounterID != *rebuilt.CounterID) {
+			current := ""
+			if projection.CounterID != nil {
+				current = *projection.CounterID
+			}
+			drift = append(drift, FieldDrift{Field: "counter_id", Projection: current, Events: *rebuilt.CounterID})
+		}
+	}
+	return drift
+}
+
+// sameTime compares at microsecond precision, which is what PostgreSQL keeps.
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Truncate(time.Microsecond).Equal(b.Truncate(time.Microsecond))
+}
+
+func formatTime(value *time.Time) string {
+	if value == nil {
+		return ""
+	}
+	return value.UTC().Format(time.RFC3339Nano)
+}
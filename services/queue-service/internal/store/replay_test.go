@@ -0,0 +1,48 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"qms/queue-service/internal/models"
+)
+
+func TestCompareProjection(t *testing.T) {
+	createdAt := time.Date(2024, 3, 1, 9, 0, 0, 123456789, time.UTC)
+	calledAt := createdAt.Add(5 * time.Minute)
+	counterID := "counter-1"
+	rebuilt := models.Ticket{
+		Status:    models.StatusCalled,
+		ServiceID: "service-1",
+		CreatedAt: createdAt,
+		CalledAt:  &calledAt,
+		CounterID: &counterID,
+	}
+
+	storedCreated := createdAt.Truncate(time.Microsecond)
+	storedCalled := calledAt.Truncate(time.Microsecond)
+	projection := models.Ticket{
+		Status:    models.StatusCalled,
+		ServiceID: "service-1",
+		CreatedAt: storedCreated,
+		CalledAt:  &storedCalled,
+		CounterID: &counterID,
+	}
+	if drift := CompareProjection(projection, rebuilt); len(drift) != 0 {
+		t.Fatalf("expected no drift, got %+v", drift)
+	}
+
+	projection.Status = models.StatusWaiting
+	projection.CalledAt = nil
+	drift := CompareProjection(projection, rebuilt)
+	if len(drift) != 2 || drift[0].Field != "status" || drift[1].Field != "called_at" {
+		t.Fatalf("expected status and called_at drift, got %+v", drift)
+	}
+
+	rebuilt.Status = models.StatusWaiting
+	projection.CalledAt = &storedCalled
+	projection.CounterID = nil
+	if drift := CompareProjection(projection, rebuilt); len(drift) != 0 {
+		t.Fatalf("counter_id should be ignored once requeued, got %+v", drift)
+	}
+}
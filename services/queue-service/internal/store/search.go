@@ -0,0 +1,85 @@
+package store
+
+import (
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"qms/queue-service/internal/models"
+)
+
+const (
+	DefaultSearchLimit = 50
+	MaxSearchLimit     = 200
+)
+
+// TicketSearchInput filters the ticket history. Empty fields are ignored.
+// ServiceIDs scopes the search to the services the caller may see; an empty
+// slice means every service in the branch.
+type TicketSearchInput struct {
+	TenantID      string
+	BranchID      string
+	ServiceIDs    []string
+	TicketNumber  string
+	Statuses      []string
+	Channel       string
+	PriorityClass string
+	CounterID     string
+	From          time.Time
+	To            time.Time
+	Phone         string
+	CustomerRef   string
+	Cursor        string
+	Limit         int
+}
+
+// TicketSearchPage is one page of search results, newest first. NextCursor
+// is empty on the last page.
+type TicketSearchPage struct {
+	Tickets    []models.Ticket `json:"tickets"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// EncodeSearchCursor builds an opaque keyset cursor from the last ticket of a
+// page. Tickets are ordered by created_at then ticket_id, both descending.
+func EncodeSearchCursor(createdAt time.Time, ticketID string) string {
+	raw := createdAt.UTC().Format(time.RFC3339Nano) + "|" + ticketID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeSearchCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	return createdAt, parts[1], nil
+}
+
+// ParseSearchTime accepts RFC3339 or a plain date, which is read as midnight
+// in loc. A plain date used as the upper bound covers the whole day. Empty
+// input gives the zero time.
+func ParseSearchTime(raw string, endOfDay bool, loc *time.Location) (time.Time, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, true
+	}
+	if parsed, err := time.Parse(time.RFC3339, raw); err == nil {
+		return parsed.UTC(), true
+	}
+	parsed, err := time.ParseInLocation("2006-01-02", raw, loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if endOfDay {
+		parsed = parsed.AddDate(0, 0, 1)
+	}
+	return parsed.UTC(), true
+}
@@ -0,0 +1,26 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSearchCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2024, 3, 1, 9, 30, 15, 123456000, time.UTC)
+	cursor := EncodeSearchCursor(createdAt, "ticket-1")
+
+	gotAt, gotID, err := DecodeSearchCursor(cursor)
+	if err != nil {
+		t.Fatalf("decode cursor: %v", err)
+	}
+	if !gotAt.Equal(createdAt) || gotID != "ticket-1" {
+		t.Fatalf("unexpected cursor values: %v %s", gotAt, gotID)
+	}
+
+	for _, bad := range []string{"not base64!", EncodeSearchCursor(time.Time{}, "")} {
+		if _, _, err := DecodeSearchCursor(bad); !errors.Is(err, ErrInvalidCursor) {
+			t.Fatalf("expected invalid cursor for %q, got %v", bad, err)
+		}
+	}
+}
@@ -9,15 +9,20 @@ import (
 )
 
 type CreateTicketInput struct {
-	RequestID     string
-	TenantID      string
-	BranchID      string
-	ServiceID     string
-	AreaID        string
-	Channel       string
-	PriorityClass string
-	Phone         string
-	CreatedAt     time.Time
+	RequestID       string
+	TenantID        string
+	BranchID        string
+	ServiceID       string
+	AreaID          string
+	Channel         string
+	PriorityClass   string
+	Phone           string
+	CustomerRef     string
+	CustomerRefType string
+	PartySize       int
+	LinkedTicketID  string
+	Remote          bool
+	CreatedAt       time.Time
 }
 
 type CallNextInput struct {
@@ -39,6 +44,13 @@ type TicketActionInput struct {
 	Reason        string
 	OccurredAt    time.Time
 	ReturnToQueue bool
+	HoldDuration  time.Duration
+	ActorID       string
+	Method        string
+	// PostponePlaces and PostponeDelay defer a waiting ticket; only one is
+	// set. Both are capped by the service policy.
+	PostponePlaces int
+	PostponeDelay  time.Duration
 }
 
 type TicketStore interface {
@@ -49,23 +61,59 @@ type TicketStore interface {
 	StartServing(ctx context.Context, input TicketActionInput) (models.Ticket, bool, error)
 	CompleteTicket(ctx context.Context, input TicketActionInput) (models.Ticket, bool, error)
 	CancelTicket(ctx context.Context, input TicketActionInput) (models.Ticket, bool, error)
+	PostponeTicket(ctx context.Context, input TicketActionInput) (models.Ticket, bool, error)
 	RecallTicket(ctx context.Context, input TicketActionInput) (models.Ticket, bool, error)
 	HoldTicket(ctx context.Context, input TicketActionInput) (models.Ticket, bool, error)
 	UnholdTicket(ctx context.Context, input TicketActionInput) (models.Ticket, bool, error)
+	ListHeldTickets(ctx context.Context, tenantID, branchID, counterID string) ([]models.Ticket, error)
 	TransferTicket(ctx context.Context, input TicketActionInput) (models.Ticket, bool, error)
 	NoShowTicket(ctx context.Context, input TicketActionInput) (models.Ticket, bool, error)
+	ReopenTicket(ctx context.Context, input TicketActionInput) (models.Ticket, bool, error)
+	ConfirmArrival(ctx context.Context, input TicketActionInput) (models.Ticket, bool, error)
 	SnapshotTickets(ctx context.Context, tenantID, branchID, serviceID string) ([]models.Ticket, error)
 	GetActiveTicket(ctx context.Context, tenantID, branchID, counterID string) (models.Ticket, bool, error)
-	ListOutboxEvents(ctx context.Context, tenantID string, after time.Time, limit int) ([]OutboxEvent, error)
+	ListActiveTickets(ctx context.Context, tenantID, branchID, counterID string) ([]models.Ticket, error)
+	SearchTickets(ctx context.Context, input TicketSearchInput) (TicketSearchPage, error)
+	ListOutboxEvents(ctx context.Context, tenantID string, afterSeq int64, limit int) ([]OutboxEvent, error)
+	ListOutboxConsumers(ctx context.Context) ([]OutboxConsumer, error)
 	ListTicketEvents(ctx context.Context, tenantID, ticketID string) ([]TicketEvent, error)
+	VerifyTicketChains(ctx context.Context, input ChainVerifyInput) (ChainReport, error)
+	ListEventDigests(ctx context.Context, tenantID string, from, to time.Time) ([]EventDigest, error)
+	ReplayTickets(ctx context.Context, input ReplayInput) (ReplayReport, error)
 	ListCounters(ctx context.Context, tenantID, branchID string) ([]models.Counter, error)
 	UpdateCounterStatus(ctx context.Context, tenantID, branchID, counterID, status string) error
 	ListServices(ctx context.Context, tenantID, branchID string) ([]models.Service, error)
+	// BranchLocation returns the branch's time zone, UTC when the branch is
+	// unknown.
+	BranchLocation(ctx context.Context, tenantID, branchID string) (*time.Location, error)
 	CheckInAppointment(ctx context.Context, requestID, tenantID, branchID, appointmentID string) (models.Ticket, error)
+	GetCustomerRef(ctx context.Context, tenantID, branchID, ticketID string) (CustomerRef, error)
+	PurgeCustomerRef(ctx context.Context, tenantID, value string) (int, error)
+	RecordAudit(ctx context.Context, entry AuditEntry) error
 	GetSession(ctx context.Context, sessionID string) (Session, error)
 	GetAccess(ctx context.Context, userID string) ([]string, []string, error)
 }
 
+// CustomerRef is a decrypted customer reference for authorised display.
+type CustomerRef struct {
+	TicketID string `json:"ticket_id"`
+	Type     string `json:"type"`
+	Value    string `json:"value"`
+}
+
+// AuditEntry is an audit_logs row for a privileged action. Detail carries
+// context such as a reference type, never the personal data itself.
+type AuditEntry struct {
+	TenantID    string
+	ActorUserID string
+	ActionType  string
+	TargetType  string
+	TargetID    string
+	Detail      string
+	IP          string
+	UserAgent   string
+}
+
 type Session struct {
 	SessionID string
 	UserID    string
@@ -74,10 +122,24 @@ type Session struct {
 	ExpiresAt time.Time
 }
 
+// OutboxEvent is a published ticket event. Seq is assigned in commit order
+// across all tenants and is the cursor consumers page by.
 type OutboxEvent struct {
+	Seq       int64           `json:"seq"`
 	EventID   string          `json:"event_id"`
 	TenantID  string          `json:"tenant_id"`
 	Type      string          `json:"type"`
 	Payload   json.RawMessage `json:"payload"`
 	CreatedAt time.Time       `json:"created_at"`
 }
+
+// OutboxConsumer is a registered outbox reader and how far it lags behind
+// the newest event. OldestPendingAt is nil when the consumer is caught up.
+type OutboxConsumer struct {
+	Name            string     `json:"name"`
+	LastSeq         int64      `json:"last_seq"`
+	HeadSeq         int64      `json:"head_seq"`
+	Lag             int64      `json:"lag"`
+	OldestPendingAt *time.Time `json:"oldest_pending_at,omitempty"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,1125 @@
+// Package storetest is a conformance suite for store.TicketStore
+// implementations. Each backend supplies a Harness that seeds reference data
+// its own way; the suite then drives the store only through its interface, so
+// the PostgreSQL and in-memory stores are held to the same behaviour.
+package storetest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"qms/queue-service/internal/models"
+	"qms/queue-service/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// Store is the ticket store plus the background jobs the service runs
+// against it.
+type Store interface {
+	store.TicketStore
+	AutoNoShow(ctx context.Context, grace time.Duration, batchSize int) (int, error)
+	ExpireHolds(ctx context.Context, batchSize int) (int, error)
+	ExpireRemoteTickets(ctx context.Context, batchSize int) (int, error)
+	SealEventDigests(ctx context.Context, day time.Time) ([]store.EventDigest, error)
+}
+
+// Fixture is the reference data created by Harness.Seed: one branch with a
+// service coded "SV" and two active counters mapped to it.
+type Fixture struct {
+	TenantID  string
+	BranchID  string
+	ServiceID string
+	CounterA  string
+	CounterB  string
+}
+
+// Policy is a service_policies row. Every field is written as given, so a
+// zero value means zero rather than the column default, except the hold
+// fields, which are left unset when zero.
+type Policy struct {
+	NoShowGraceSeconds       int
+	ReturnToQueue            bool
+	AppointmentRatioPercent  int
+	AppointmentWindowSize    int
+	AppointmentBoostMinutes  int
+	HoldMaxSeconds           int
+	HoldExpiryAction         string
+	MaxRecalls               int
+	MinRecallIntervalSeconds int
+	MaxPartySize             int
+	MaxWaitingPeople         int
+	RemoteConfirmSeconds     int
+	RemoteKeepPlaceSeconds   int
+	MaxPostpones             int
+	MaxPostponePlaces        int
+	MaxPostponeMinutes       int
+}
+
+// Harness wraps a fresh, empty store configured with
+// NoShowReturnToQueue=false and PriorityStreakLimit=3.
+type Harness interface {
+	Store() Store
+	Seed(t *testing.T) Fixture
+	// AddService adds an active service to the fixture branch that no
+	// counter is mapped to, and returns its ID.
+	AddService(t *testing.T, fx Fixture, code string) string
+	SetPolicy(t *testing.T, fx Fixture, serviceID string, policy Policy)
+	AddAppointment(t *testing.T, fx Fixture, serviceID string, scheduledAt time.Time) string
+	AddResource(t *testing.T, fx Fixture, counterID string, capacity int)
+}
+
+// Run runs every conformance case in its own subtest with a new harness.
+func Run(t *testing.T, newHarness func(t *testing.T) Harness) {
+	cases := []struct {
+		name string
+		run  func(t *testing.T, h Harness)
+	}{
+		{"CreateTicketIdempotent", testCreateTicketIdempotent},
+		{"TicketNumbersPerService", testTicketNumbersPerService},
+		{"CallNextOrderAndIdempotency", testCallNextOrderAndIdempotency},
+		{"CallNextSkillMismatch", testCallNextSkillMismatch},
+		{"CallNextCounterUnavailable", testCallNextCounterUnavailable},
+		{"CallNextPriorityStreak", testCallNextPriorityStreak},
+		{"CallNextAppointmentRatio", testCallNextAppointmentRatio},
+		{"CallNextAppointmentBoost", testCallNextAppointmentBoost},
+		{"CallNextResourceCapacity", testCallNextResourceCapacity},
+		{"TransitionRules", testTransitionRules},
+		{"HoldExpiryCancels", testHoldExpiryCancels},
+		{"HoldPolicyFallsBackToDefaults", testHoldPolicyFallsBackToDefaults},
+		{"RecallLimitNoShow", testRecallLimitNoShow},
+		{"AutoNoShow", testAutoNoShow},
+		{"ReopenCompleted", testReopenCompleted},
+		{"ReopenOccupiedCounter", testReopenOccupiedCounter},
+		{"PartySizeCapacity", testPartySizeCapacity},
+		{"RemoteArrivalAndExpiry", testRemoteArrivalAndExpiry},
+		{"LateArrivalQueuesBehind", testLateArrivalQueuesBehind},
+		{"PostponeByPlaces", testPostponeByPlaces},
+		{"PostponeByMinutes", testPostponeByMinutes},
+		{"TransferTicket", testTransferTicket},
+		{"SearchPaginates", testSearchPaginates},
+		{"EventChainAndReplay", testEventChainAndReplay},
+		{"OutboxSequence", testOutboxSequence},
+		{"OutboxConcurrentWriters", testOutboxConcurrentWriters},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, newHarness(t))
+		})
+	}
+}
+
+func createTicket(t *testing.T, st Store, fx Fixture, serviceID, priorityClass string, createdAt time.Time) models.Ticket {
+	t.Helper()
+	ticket, _, err := st.CreateTicket(context.Background(), store.CreateTicketInput{
+		RequestID:     uuid.NewString(),
+		TenantID:      fx.TenantID,
+		BranchID:      fx.BranchID,
+		ServiceID:     serviceID,
+		Channel:       "kiosk",
+		PriorityClass: priorityClass,
+		CreatedAt:     createdAt,
+	})
+	if err != nil {
+		t.Fatalf("create ticket: %v", err)
+	}
+	return ticket
+}
+
+func callNext(st Store, fx Fixture, serviceID, counterID string) (models.Ticket, error) {
+	ticket, _, err := st.CallNext(context.Background(), store.CallNextInput{
+		RequestID: uuid.NewString(),
+		TenantID:  fx.TenantID,
+		BranchID:  fx.BranchID,
+		ServiceID: serviceID,
+		CounterID: counterID,
+	})
+	return ticket, err
+}
+
+func action(fx Fixture, ticketID, counterID string) store.TicketActionInput {
+	return store.TicketActionInput{
+		RequestID: uuid.NewString(),
+		TenantID:  fx.TenantID,
+		BranchID:  fx.BranchID,
+		TicketID:  ticketID,
+		CounterID: counterID,
+	}
+}
+
+func getTicket(t *testing.T, st Store, fx Fixture, ticketID string) models.Ticket {
+	t.Helper()
+	ticket, ok, err := st.GetTicket(context.Background(), fx.TenantID, fx.BranchID, ticketID)
+	if err != nil || !ok {
+		t.Fatalf("get ticket: ok=%v err=%v", ok, err)
+	}
+	return ticket
+}
+
+func expectCalled(t *testing.T, st Store, fx Fixture, want string) {
+	t.Helper()
+	called, err := callNext(st, fx, fx.ServiceID, fx.CounterA)
+	if err != nil {
+		t.Fatalf("call next: %v", err)
+	}
+	if called.TicketID != want {
+		t.Fatalf("expected %s to be called, got %s", want, called.TicketID)
+	}
+}
+
+func testCreateTicketIdempotent(t *testing.T, h Harness) {
+	ctx := context.Background()
+	st := h.Store()
+	fx := h.Seed(t)
+
+	input := store.CreateTicketInput{
+		RequestID:     uuid.NewString(),
+		TenantID:      fx.TenantID,
+		BranchID:      fx.BranchID,
+		ServiceID:     fx.ServiceID,
+		Channel:       "kiosk",
+		PriorityClass: "regular",
+		CreatedAt:     time.Now().UTC(),
+	}
+	first, created, err := st.CreateTicket(ctx, input)
+	if err != nil || !created {
+		t.Fatalf("create ticket: created=%v err=%v", created, err)
+	}
+	second, created, err := st.CreateTicket(ctx, input)
+	if err != nil || created {
+		t.Fatalf("expected idempotent replay, created=%v err=%v", created, err)
+	}
+	if first.TicketID != second.TicketID || second.Status != models.StatusWaiting {
+		t.Fatalf("expected same waiting ticket, got %+v and %+v", first, second)
+	}
+
+	events, err := st.ListOutboxEvents(ctx, fx.TenantID, 0, 100)
+	if err != nil {
+		t.Fatalf("list outbox: %v", err)
+	}
+	if len(events) != 1 || events[0].Type != "ticket.created" {
+		t.Fatalf("expected one ticket.created event, got %+v", events)
+	}
+	var payload struct {
+		TicketID string `json:"ticket_id"`
+		Status   string `json:"status"`
+	}
+	if err := json.Unmarshal(events[0].Payload, &payload); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if payload.TicketID != first.TicketID || payload.Status != models.StatusWaiting {
+		t.Fatalf("unexpected payload: %+v", payload)
+	}
+
+	if _, _, err := st.CreateTicket(ctx, store.CreateTicketInput{
+		RequestID: uuid.NewString(),
+		TenantID:  fx.TenantID,
+		BranchID:  fx.BranchID,
+		ServiceID: uuid.NewString(),
+		Channel:   "kiosk",
+	}); !errors.Is(err, store.ErrServiceNotFound) {
+		t.Fatalf("expected service not found, got %v", err)
+	}
+}
+
+func testTicketNumbersPerService(t *testing.T, h Harness) {
+	st := h.Store()
+	fx := h.Seed(t)
+	other := h.AddService(t, fx, "OT")
+
+	base := time.Now().UTC().Add(-time.Minute)
+	first := createTicket(t, st, fx, fx.ServiceID, "regular", base)
+	second := createTicket(t, st, fx, fx.ServiceID, "regular", base.Add(time.Second))
+	third := createTicket(t, st, fx, other, "regular", base.Add(2*time.Second))
+	if first.TicketNumber != "SV-001" || second.TicketNumber != "SV-002" || third.TicketNumber != "OT-001" {
+		t.Fatalf("unexpected numbers: %s %s %s", first.TicketNumber, second.TicketNumber, third.TicketNumber)
+	}
+}
+
+func testCallNextOrderAndIdempotency(t *testing.T, h Harness) {
+	ctx := context.Background()
+	st := h.Store()
+	fx := h.Seed(t)
+
+	base := time.Now().UTC().Add(-time.Minute)
+	first := createTicket(t, st, fx, fx.ServiceID, "regular", base)
+	second := createTicket(t, st, fx, fx.ServiceID, "regular", base.Add(time.Second))
+
+	input := store.CallNextInput{
+		RequestID: uuid.NewString(),
+		TenantID:  fx.TenantID,
+		BranchID:  fx.BranchID,
+		ServiceID: fx.ServiceID,
+		CounterID: fx.CounterA,
+	}
+	called, created, err := st.CallNext(ctx, input)
+	if err != nil || !created {
+		t.Fatalf("call next: created=%v err=%v", created, err)
+	}
+	if called.TicketID != first.TicketID || called.Status != models.StatusCalled {
+		t.Fatalf("expected oldest ticket called, got %+v", called)
+	}
+	if called.CounterID == nil || *called.CounterID != fx.CounterA || called.CalledAt == nil {
+		t.Fatalf("expected counter and called_at set, got %+v", called)
+	}
+	replay, created, err := st.CallNext(ctx, input)
+	if err != nil || created || replay.TicketID != first.TicketID {
+		t.Fatalf("expected idempotent replay, got %s created=%v err=%v", replay.TicketID, created, err)
+	}
+
+	expectCalled(t, st, fx, second.TicketID)
+	if _, err := callNext(st, fx, fx.ServiceID, fx.CounterA); !errors.Is(err, store.ErrNoTicket) {
+		t.Fatalf("expected no ticket, got %v", err)
+	}
+
+	active, err := st.ListActiveTickets(ctx, fx.TenantID, fx.BranchID, fx.CounterA)
+	if err != nil {
+		t.Fatalf("list active: %v", err)
+	}
+	if len(active) != 2 {
+		t.Fatalf("expected 2 active tickets, got %d", len(active))
+	}
+	queue, err := st.ListQueue(ctx, fx.TenantID, fx.BranchID, fx.ServiceID)
+	if err != nil {
+		t.Fatalf("list queue: %v", err)
+	}
+	if len(queue) != 0 {
+		t.Fatalf("expected empty queue, got %d", len(queue))
+	}
+}
+
+func testCallNextSkillMismatch(t *testing.T, h Harness) {
+	st := h.Store()
+	fx := h.Seed(t)
+	other := h.AddService(t, fx, "SB")
+
+	createTicket(t, st, fx, other, "regular", time.Now().UTC())
+	if _, err := callNext(st, fx, other, fx.CounterA); !errors.Is(err, store.ErrAccessDenied) {
+		t.Fatalf("expected access denied, got %v", err)
+	}
+}
+
+func testCallNextCounterUnavailable(t *testing.T, h Harness) {
+	ctx := context.Background()
+	st := h.Store()
+	fx := h.Seed(t)
+
+	createTicket(t, st, fx, fx.ServiceID, "regular", time.Now().UTC())
+	if err := st.UpdateCounterStatus(ctx, fx.TenantID, fx.BranchID, fx.CounterA, "paused"); err != nil {
+		t.Fatalf("update counter: %v", err)
+	}
+	if _, err := callNext(st, fx, fx.ServiceID, fx.CounterA); !errors.Is(err, store.ErrCounterUnavailable) {
+		t.Fatalf("expected counter unavailable, got %v", err)
+	}
+	if _, err := callNext(st, fx, fx.ServiceID, fx.CounterB); err != nil {
+		t.Fatalf("call next at counter B: %v", err)
+	}
+}
+
+func testCallNextPriorityStreak(t *testing.T, h Harness) {
+	st := h.Store()
+	fx := h.Seed(t)
+
+	base := time.Now().UTC().Add(-time.Hour)
+	regular := createTicket(t, st, fx, fx.ServiceID, "regular", base)
+	var priority []models.Ticket
+	for i := 1; i <= 4; i++ {
+		priority = append(priority, createTicket(t, st, fx, fx.ServiceID, "priority", base.Add(time.Duration(i)*time.Second)))
+	}
+
+	// Three priority calls reach the streak limit, so the regular ticket is
+	// served next before priority resumes.
+	for _, want := range []string{priority[0].TicketID, priority[1].TicketID, priority[2].TicketID, regular.TicketID, priority[3].TicketID} {
+		expectCalled(t, st, fx, want)
+	}
+}
+
+func testCallNextAppointmentRatio(t *testing.T, h Harness) {
+	st := h.Store()
+	fx := h.Seed(t)
+	h.SetPolicy(t, fx, fx.ServiceID, Policy{NoShowGraceSeconds: 300, AppointmentRatioPercent: 50, AppointmentWindowSize: 2})
+
+	base := time.Now().UTC().Add(-time.Hour)
+	walkIn := createTicket(t, st, fx, fx.ServiceID, "regular", base)
+	walkIn2 := createTicket(t, st, fx, fx.ServiceID, "regular", base.Add(time.Second))
+	apptID := h.AddAppointment(t, fx, fx.ServiceID, time.Now().Add(2*time.Hour))
+	appt, err := st.CheckInAppointment(context.Background(), uuid.NewString(), fx.TenantID, fx.BranchID, apptID)
+	if err != nil {
+		t.Fatalf("check in appointment: %v", err)
+	}
+
+	// One appointment in every two calls: the appointment goes first even
+	// though both walk-ins joined earlier.
+	for _, want := range []string{appt.TicketID, walkIn.TicketID, walkIn2.TicketID} {
+		expectCalled(t, st, fx, want)
+	}
+}
+
+func testCallNextAppointmentBoost(t *testing.T, h Harness) {
+	st := h.Store()
+	fx := h.Seed(t)
+	h.SetPolicy(t, fx, fx.ServiceID, Policy{NoShowGraceSeconds: 300, AppointmentWindowSize: 5, AppointmentBoostMinutes: 60})
+
+	later := h.AddAppointment(t, fx, fx.ServiceID, time.Now().Add(3*time.Hour))
+	soon := h.AddAppointment(t, fx, fx.ServiceID, time.Now().Add(20*time.Minute))
+	laterTicket, err := st.CheckInAppointment(context.Background(), uuid.NewString(), fx.TenantID, fx.BranchID, later)
+	if err != nil {
+		t.Fatalf("check in later appointment: %v", err)
+	}
+	soonTicket, err := st.CheckInAppointment(context.Background(), uuid.NewString(), fx.TenantID, fx.BranchID, soon)
+	if err != nil {
+		t.Fatalf("check in soon appointment: %v", err)
+	}
+	walkIn := createTicket(t, st, fx, fx.ServiceID, "regular", time.Now().UTC().Add(-time.Hour))
+
+	// Only the appointment inside the boost window jumps the walk-in; the
+	// later one waits until the walk-ins are done.
+	for _, want := range []string{soonTicket.TicketID, walkIn.TicketID, laterTicket.TicketID} {
+		expectCalled(t, st, fx, want)
+	}
+}
+
+func testCallNextResourceCapacity(t *testing.T, h Harness) {
+	ctx := context.Background()
+	st := h.Store()
+	fx := h.Seed(t)
+	h.AddResource(t, fx, fx.CounterA, 2)
+
+	base := time.Now().UTC().Add(-time.Minute)
+	for i := 0; i < 3; i++ {
+		createTicket(t, st, fx, fx.ServiceID, "regular", base.Add(time.Duration(i)*time.Second))
+	}
+	first, err := callNext(st, fx, fx.ServiceID, fx.CounterA)
+	if err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+	if first.ResourceID == nil {
+		t.Fatalf("expected resource to be assigned")
+	}
+	if _, err := callNext(st, fx, fx.ServiceID, fx.CounterA); err != nil {
+		t.Fatalf("second call: %v", err)
+	}
+	if _, err := callNext(st, fx, fx.ServiceID, fx.CounterA); !errors.Is(err, store.ErrCounterAtCapacity) {
+		t.Fatalf("expected counter at capacity, got %v", err)
+	}
+
+	if _, _, err := st.StartServing(ctx, action(fx, first.TicketID, fx.CounterA)); err != nil {
+		t.Fatalf("start serving: %v", err)
+	}
+	if _, _, err := st.CompleteTicket(ctx, action(fx, first.TicketID, "")); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if _, err := callNext(st, fx, fx.ServiceID, fx.CounterA); err != nil {
+		t.Fatalf("call after release: %v", err)
+	}
+}
+
+func testTransitionRules(t *testing.T, h Harness) {
+	ctx := context.Background()
+	st := h.Store()
+	fx := h.Seed(t)
+
+	ticket := createTicket(t, st, fx, fx.ServiceID, "regular", time.Now().UTC())
+	if _, _, err := st.StartServing(ctx, action(fx, ticket.TicketID, fx.CounterA)); !errors.Is(err, store.ErrInvalidState) {
+		t.Fatalf("expected invalid state serving a waiting ticket, got %v", err)
+	}
+	if _, _, err := st.CompleteTicket(ctx, action(fx, uuid.NewString(), "")); !errors.Is(err, store.ErrTicketNotFound) {
+		t.Fatalf("expected ticket not found, got %v", err)
+	}
+
+	expectCalled(t, st, fx, ticket.TicketID)
+	if _, _, err := st.StartServing(ctx, action(fx, ticket.TicketID, fx.CounterB)); !errors.Is(err, store.ErrCounterMismatch) {
+		t.Fatalf("expected counter mismatch, got %v", err)
+	}
+	serve := action(fx, ticket.TicketID, fx.CounterA)
+	serving, created, err := st.StartServing(ctx, serve)
+	if err != nil || !created || serving.Status != models.StatusServing || serving.ServedAt == nil {
+		t.Fatalf("start serving: %+v created=%v err=%v", serving, created, err)
+	}
+	if _, created, err := st.StartServing(ctx, serve); err != nil || created {
+		t.Fatalf("expected idempotent replay, created=%v err=%v", created, err)
+	}
+
+	done, _, err := st.CompleteTicket(ctx, action(fx, ticket.TicketID, ""))
+	if err != nil || done.Status != models.StatusDone || done.CompletedAt == nil {
+		t.Fatalf("complete: %+v err=%v", done, err)
+	}
+	if _, _, err := st.CancelTicket(ctx, action(fx, ticket.TicketID, "")); !errors.Is(err, store.ErrInvalidState) {
+		t.Fatalf("expected invalid state cancelling a done ticket, got %v", err)
+	}
+
+	waiting := createTicket(t, st, fx, fx.ServiceID, "regular", time.Now().UTC())
+	cancelled, _, err := st.CancelTicket(ctx, action(fx, waiting.TicketID, ""))
+	if err != nil || cancelled.Status != models.StatusCancelled {
+		t.Fatalf("cancel waiting ticket: %+v err=%v", cancelled, err)
+	}
+}
+
+func testHoldExpiryCancels(t *testing.T, h Harness) {
+	ctx := context.Background()
+	st := h.Store()
+	fx := h.Seed(t)
+	h.SetPolicy(t, fx, fx.ServiceID, Policy{NoShowGraceSeconds: 300, AppointmentWindowSize: 5, HoldMaxSeconds: 60, HoldExpiryAction: models.HoldExpiryCancel})
+
+	ticket := createTicket(t, st, fx, fx.ServiceID, "regular", time.Now().UTC().Add(-time.Hour))
+	hold := action(fx, ticket.TicketID, fx.CounterA)
+	hold.Reason = "missing documents"
+	hold.HoldDuration = time.Hour
+	hold.OccurredAt = time.Now().UTC().Add(-10 * time.Minute)
+	held, _, err := st.HoldTicket(ctx, hold)
+	if err != nil {
+		t.Fatalf("hold: %v", err)
+	}
+	if held.Status != models.StatusHeld || held.HeldAt == nil || held.HoldExpiresAt == nil || held.HoldExpiresAt.Sub(*held.HeldAt) != time.Minute {
+		t.Fatalf("expected hold capped at policy maximum, got %+v", held)
+	}
+	list, err := st.ListHeldTickets(ctx, fx.TenantID, fx.BranchID, fx.CounterA)
+	if err != nil {
+		t.Fatalf("list held: %v", err)
+	}
+	if len(list) != 1 || list[0].HoldReason != "missing documents" {
+		t.Fatalf("unexpected held tickets: %+v", list)
+	}
+	if _, err := callNext(st, fx, fx.ServiceID, fx.CounterA); !errors.Is(err, store.ErrNoTicket) {
+		t.Fatalf("expected held ticket skipped by call next, got %v", err)
+	}
+
+	count, err := st.ExpireHolds(ctx, 10)
+	if err != nil {
+		t.Fatalf("expire holds: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 expired hold, got %d", count)
+	}
+	current := getTicket(t, st, fx, ticket.TicketID)
+	if current.Status != models.StatusCancelled || current.HoldExpiresAt != nil || current.CancelledAt == nil {
+		t.Fatalf("expected cancelled ticket without hold, got %+v", current)
+	}
+}
+
+func testHoldPolicyFallsBackToDefaults(t *testing.T, h Harness) {
+	ctx := context.Background()
+	st := h.Store()
+	fx := h.Seed(t)
+	h.SetPolicy(t, fx, fx.ServiceID, Policy{NoShowGraceSeconds: 300, AppointmentWindowSize: 5})
+
+	ticket := createTicket(t, st, fx, fx.ServiceID, "regular", time.Now().UTC().Add(-time.Hour))
+	hold := action(fx, ticket.TicketID, fx.CounterA)
+	hold.HoldDuration = time.Hour
+	hold.OccurredAt = time.Now().UTC().Add(-20 * time.Minute)
+	held, _, err := st.HoldTicket(ctx, hold)
+	if err != nil {
+		t.Fatalf("hold: %v", err)
+	}
+	if held.HoldExpiresAt == nil || held.HoldExpiresAt.Sub(*held.HeldAt) != 15*time.Minute {
+		t.Fatalf("expected hold capped at the default maximum, got %+v", held)
+	}
+	if count, err := st.ExpireHolds(ctx, 10); err != nil || count != 1 {
+		t.Fatalf("expire holds: count=%d err=%v", count, err)
+	}
+	if current := getTicket(t, st, fx, ticket.TicketID); current.Status != models.StatusWaiting || current.CancelledAt != nil {
+		t.Fatalf("expected the default action to return the ticket, got %+v", current)
+	}
+}
+
+func testRecallLimitNoShow(t *testing.T, h Harness) {
+	ctx := context.Background()
+	st := h.Store()
+	fx := h.Seed(t)
+	h.SetPolicy(t, fx, fx.ServiceID, Policy{NoShowGraceSeconds: 300, AppointmentWindowSize: 5, MaxRecalls: 1})
+
+	ticket := createTicket(t, st, fx, fx.ServiceID, "regular", time.Now().UTC())
+	if _, _, err := st.RecallTicket(ctx, action(fx, ticket.TicketID, fx.CounterA)); !errors.Is(err, store.ErrInvalidState) {
+		t.Fatalf("expected a waiting ticket not to be recalled, got %v", err)
+	}
+	expectCalled(t, st, fx, ticket.TicketID)
+
+	recalled, _, err := st.RecallTicket(ctx, action(fx, ticket.TicketID, fx.CounterA))
+	if err != nil {
+		t.Fatalf("recall: %v", err)
+	}
+	if recalled.RecallCount != 1 || recalled.Status != models.StatusCalled {
+		t.Fatalf("expected first recall to be counted, got %+v", recalled)
+	}
+	limited, _, err := st.RecallTicket(ctx, action(fx, ticket.TicketID, fx.CounterA))
+	if err != nil {
+		t.Fatalf("recall over limit: %v", err)
+	}
+	if limited.Status != models.StatusNoShow {
+		t.Fatalf("expected no_show after recall limit, got %s", limited.Status)
+	}
+}
+
+func testAutoNoShow(t *testing.T, h Harness) {
+	ctx := context.Background()
+	st := h.Store()
+	fx := h.Seed(t)
+
+	stale := createTicket(t, st, fx, fx.ServiceID, "regular", time.Now().UTC().Add(-time.Hour))
+	fresh := createTicket(t, st, fx, fx.ServiceID, "regular", time.Now().UTC().Add(-time.Minute))
+	if _, _, err := st.CallNext(ctx, store.CallNextInput{
+		RequestID: uuid.NewString(),
+		TenantID:  fx.TenantID,
+		BranchID:  fx.BranchID,
+		ServiceID: fx.ServiceID,
+		CounterID: fx.CounterA,
+		CalledAt:  time.Now().UTC().Add(-10 * time.Minute),
+	}); err != nil {
+		t.Fatalf("call stale: %v", err)
+	}
+	expectCalled(t, st, fx, fresh.TicketID)
+
+	count, err := st.AutoNoShow(ctx, 5*time.Minute, 10)
+	if err != nil {
+		t.Fatalf("auto no-show: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 no-show, got %d", count)
+	}
+	if got := getTicket(t, st, fx, stale.TicketID); got.Status != models.StatusNoShow {
+		t.Fatalf("expected stale ticket no_show, got %s", got.Status)
+	}
+	if got := getTicket(t, st, fx, fresh.TicketID); got.Status != models.StatusCalled {
+		t.Fatalf("expected fresh ticket still called, got %s", got.Status)
+	}
+}
+
+func testReopenCompleted(t *testing.T, h Harness) {
+	ctx := context.Background()
+	st := h.Store()
+	fx := h.Seed(t)
+
+	ticket := createTicket(t, st, fx, fx.ServiceID, "regular", time.Now().UTC())
+	expectCalled(t, st, fx, ticket.TicketID)
+	if _, _, err := st.StartServing(ctx, action(fx, ticket.TicketID, fx.CounterA)); err != nil {
+		t.Fatalf("start serving: %v", err)
+	}
+	if _, _, err := st.CompleteTicket(ctx, action(fx, ticket.TicketID, "")); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+
+	reopen := action(fx, ticket.TicketID, "")
+	reopen.Reason = "completed by mistake"
+	reopened, _, err := st.ReopenTicket(ctx, reopen)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if reopened.Status != models.StatusServing {
+		t.Fatalf("expected serving after reopen, got %s", reopened.Status)
+	}
+	if current := getTicket(t, st, fx, ticket.TicketID); current.CompletedAt != nil {
+		t.Fatalf("expected completed_at to be cleared")
+	}
+	if _, _, err := st.ReopenTicket(ctx, action(fx, ticket.TicketID, "")); !errors.Is(err, store.ErrInvalidState) {
+		t.Fatalf("expected invalid state for non-terminal ticket, got %v", err)
+	}
+}
+
+func testReopenOccupiedCounter(t *testing.T, h Harness) {
+	ctx := context.Background()
+	st := h.Store()
+	fx := h.Seed(t)
+
+	first := createTicket(t, st, fx, fx.ServiceID, "regular", time.Now().UTC().Add(-time.Minute))
+	second := createTicket(t, st, fx, fx.ServiceID, "regular", time.Now().UTC())
+	expectCalled(t, st, fx, first.TicketID)
+	if _, _, err := st.StartServing(ctx, action(fx, first.TicketID, fx.CounterA)); err != nil {
+		t.Fatalf("start serving: %v", err)
+	}
+	if _, _, err := st.CompleteTicket(ctx, action(fx, first.TicketID, "")); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	expectCalled(t, st, fx, second.TicketID)
+
+	reopened, _, err := st.ReopenTicket(ctx, action(fx, first.TicketID, ""))
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if reopened.Status != models.StatusWaiting || reopened.CounterID != nil {
+		t.Fatalf("expected the ticket back in the queue while its counter is busy, got %s at %v", reopened.Status, reopened.CounterID)
+	}
+}
+
+func testPartySizeCapacity(t *testing.T, h Harness) {
+	ctx := context.Background()
+	st := h.Store()
+	fx := h.Seed(t)
+	h.SetPolicy(t, fx, fx.ServiceID, Policy{NoShowGraceSeconds: 300, AppointmentWindowSize: 5, MaxPartySize: 4, MaxWaitingPeople: 5})
+
+	input := store.CreateTicketInput{
+		RequestID:     uuid.NewString(),
+		TenantID:      fx.TenantID,
+		BranchID:      fx.BranchID,
+		ServiceID:     fx.ServiceID,
+		Channel:       "kiosk",
+		PriorityClass: "regular",
+		PartySize:     5,
+		CreatedAt:     time.Now().UTC(),
+	}
+	if _, _, err := st.CreateTicket(ctx, input); !errors.Is(err, store.ErrPartyTooLarge) {
+		t.Fatalf("expected party too large, got %v", err)
+	}
+
+	input.RequestID = uuid.NewString()
+	input.PartySize = 3
+	family, _, err := st.CreateTicket(ctx, input)
+	if err != nil {
+		t.Fatalf("create family ticket: %v", err)
+	}
+
+	input.RequestID = uuid.NewString()
+	input.LinkedTicketID = family.TicketID
+	if _, _, err := st.CreateTicket(ctx, input); !errors.Is(err, store.ErrCapacityExceeded) {
+		t.Fatalf("expected capacity exceeded, got %v", err)
+	}
+	input.RequestID = uuid.NewString()
+	input.PartySize = 2
+	companion, _, err := st.CreateTicket(ctx, input)
+	if err != nil {
+		t.Fatalf("create companion ticket: %v", err)
+	}
+	if companion.LinkedTicketID == nil || *companion.LinkedTicketID != family.TicketID {
+		t.Fatalf("expected companion to link to %s", family.TicketID)
+	}
+
+	unlimited := store.CreateTicketInput{
+		RequestID:     uuid.NewString(),
+		TenantID:      fx.TenantID,
+		BranchID:      fx.BranchID,
+		ServiceID:     h.AddService(t, fx, "NP"),
+		Channel:       "kiosk",
+		PriorityClass: "regular",
+		PartySize:     1000,
+		CreatedAt:     time.Now().UTC(),
+	}
+	if _, _, err := st.CreateTicket(ctx, unlimited); !errors.Is(err, store.ErrPartyTooLarge) {
+		t.Fatalf("expected the default cap without a policy, got %v", err)
+	}
+}
+
+func testRemoteArrivalAndExpiry(t *testing.T, h Harness) {
+	ctx := context.Background()
+	st := h.Store()
+	fx := h.Seed(t)
+
+	remoteInput := func(createdAt time.Time) store.CreateTicketInput {
+		return store.CreateTicketInput{
+			RequestID:     uuid.NewString(),
+			TenantID:      fx.TenantID,
+			BranchID:      fx.BranchID,
+			ServiceID:     fx.ServiceID,
+			Channel:       "web",
+			PriorityClass: "regular",
+			Remote:        true,
+			CreatedAt:     createdAt,
+		}
+	}
+	remote, _, err := st.CreateTicket(ctx, remoteInput(time.Now().UTC().Add(-time.Minute)))
+	if err != nil {
+		t.Fatalf("create remote ticket: %v", err)
+	}
+	if remote.Status != models.StatusRemote || remote.RemoteExpiresAt == nil {
+		t.Fatalf("expected remote ticket with expiry, got %+v", remote)
+	}
+	stale, _, err := st.CreateTicket(ctx, remoteInput(time.Now().UTC().Add(-3*time.Hour)))
+	if err != nil {
+		t.Fatalf("create stale remote ticket: %v", err)
+	}
+	walkIn := createTicket(t, st, fx, fx.ServiceID, "regular", time.Now().UTC())
+
+	expectCalled(t, st, fx, walkIn.TicketID)
+	if _, err := callNext(st, fx, fx.ServiceID, fx.CounterA); !errors.Is(err, store.ErrNoTicket) {
+		t.Fatalf("expected no ticket while remote is unconfirmed, got %v", err)
+	}
+
+	arrive := action(fx, remote.TicketID, "")
+	arrive.Method = models.ArrivalQR
+	arrived, _, err := st.ConfirmArrival(ctx, arrive)
+	if err != nil {
+		t.Fatalf("confirm arrival: %v", err)
+	}
+	if arrived.Status != models.StatusWaiting {
+		t.Fatalf("expected waiting after arrival, got %s", arrived.Status)
+	}
+	expectCalled(t, st, fx, remote.TicketID)
+
+	count, err := st.ExpireRemoteTickets(ctx, 10)
+	if err != nil {
+		t.Fatalf("expire remote: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 expired remote ticket, got %d", count)
+	}
+	if got := getTicket(t, st, fx, stale.TicketID); got.Status != models.StatusCancelled {
+		t.Fatalf("expected stale remote ticket cancelled, got %s", got.Status)
+	}
+}
+
+func testLateArrivalQueuesBehind(t *testing.T, h Harness) {
+	ctx := context.Background()
+	st := h.Store()
+	fx := h.Seed(t)
+	h.SetPolicy(t, fx, fx.ServiceID, Policy{NoShowGraceSeconds: 300, AppointmentWindowSize: 5, RemoteConfirmSeconds: 7200, RemoteKeepPlaceSeconds: 60, MaxPostpones: 1, MaxPostponePlaces: 5, MaxPostponeMinutes: 30})
+
+	joinedAt := time.Now().UTC().Add(-10 * time.Minute).Truncate(time.Microsecond)
+	remote, _, err := st.CreateTicket(ctx, store.CreateTicketInput{
+		RequestID:     uuid.NewString(),
+		TenantID:      fx.TenantID,
+		BranchID:      fx.BranchID,
+		ServiceID:     fx.ServiceID,
+		Channel:       "web",
+		PriorityClass: "regular",
+		Remote:        true,
+		CreatedAt:     joinedAt,
+	})
+	if err != nil {
+		t.Fatalf("create remote ticket: %v", err)
+	}
+	walkIn := createTicket(t, st, fx, fx.ServiceID, "regular", time.Now().UTC().Add(-time.Minute))
+
+	arrived, _, err := st.ConfirmArrival(ctx, action(fx, remote.TicketID, ""))
+	if err != nil {
+		t.Fatalf("confirm arrival: %v", err)
+	}
+	if !arrived.CreatedAt.Equal(joinedAt) {
+		t.Fatalf("expected created_at to stay %s, got %s", joinedAt, arrived.CreatedAt)
+	}
+	expectCalled(t, st, fx, walkIn.TicketID)
+	expectCalled(t, st, fx, remote.TicketID)
+}
+
+func testPostponeByPlaces(t *testing.T, h Harness) {
+	ctx := context.Background()
+	st := h.Store()
+	fx := h.Seed(t)
+
+	base := time.Now().UTC().Add(-time.Hour)
+	first := createTicket(t, st, fx, fx.ServiceID, "regular", base)
+	second := createTicket(t, st, fx, fx.ServiceID, "regular", base.Add(time.Minute))
+	third := createTicket(t, st, fx, fx.ServiceID, "regular", base.Add(2*time.Minute))
+
+	postpone := action(fx, first.TicketID, "")
+	postpone.PostponePlaces = 1
+	postponed, _, err := st.PostponeTicket(ctx, postpone)
+	if err != nil {
+		t.Fatalf("postpone: %v", err)
+	}
+	if postponed.PostponeCount != 1 {
+		t.Fatalf("expected postpone count 1, got %d", postponed.PostponeCount)
+	}
+	if !postponed.CreatedAt.Equal(first.CreatedAt) {
+		t.Fatalf("expected created_at to stay %s, got %s", first.CreatedAt, postponed.CreatedAt)
+	}
+	if _, created, err := st.PostponeTicket(ctx, postpone); err != nil || created {
+		t.Fatalf("expected idempotent replay, got created=%v err=%v", created, err)
+	}
+	postpone.RequestID = uuid.NewString()
+	if _, _, err := st.PostponeTicket(ctx, postpone); !errors.Is(err, store.ErrPostponeLimit) {
+		t.Fatalf("expected postpone limit, got %v", err)
+	}
+
+	for _, want := range []string{second.TicketID, first.TicketID, third.TicketID} {
+		expectCalled(t, st, fx, want)
+	}
+}
+
+func testPostponeByMinutes(t *testing.T, h Harness) {
+	ctx := context.Background()
+	st := h.Store()
+	fx := h.Seed(t)
+	h.SetPolicy(t, fx, fx.ServiceID, Policy{NoShowGraceSeconds: 300, AppointmentWindowSize: 5, MaxPostpones: 3, MaxPostponePlaces: 5, MaxPostponeMinutes: 30})
+
+	now := time.Now().UTC()
+	first := createTicket(t, st, fx, fx.ServiceID, "regular", now.Add(-18*time.Minute))
+	second := createTicket(t, st, fx, fx.ServiceID, "regular", now.Add(-time.Minute))
+
+	// Nobody is behind second, so there is no place to give up.
+	places := action(fx, second.TicketID, "")
+	places.PostponePlaces = 2
+	if _, _, err := st.PostponeTicket(ctx, places); !errors.Is(err, store.ErrNothingToPostpone) {
+		t.Fatalf("expected nothing to postpone, got %v", err)
+	}
+	if current := getTicket(t, st, fx, second.TicketID); current.PostponeCount != 0 {
+		t.Fatalf("expected postpone count to stay 0, got %d", current.PostponeCount)
+	}
+
+	// Twenty minutes count from now, not from when the ticket was taken.
+	minutes := action(fx, first.TicketID, "")
+	minutes.PostponeDelay = 20 * time.Minute
+	if _, _, err := st.PostponeTicket(ctx, minutes); err != nil {
+		t.Fatalf("postpone: %v", err)
+	}
+	expectCalled(t, st, fx, second.TicketID)
+	if _, err := callNext(st, fx, fx.ServiceID, fx.CounterA); !errors.Is(err, store.ErrNoTicket) {
+		t.Fatalf("expected the postponed ticket to wait out its delay, got %v", err)
+	}
+}
+
+func testTransferTicket(t *testing.T, h Harness) {
+	ctx := context.Background()
+	st := h.Store()
+	fx := h.Seed(t)
+	other := h.AddService(t, fx, "OT")
+
+	ticket := createTicket(t, st, fx, fx.ServiceID, "regular", time.Now().UTC())
+	expectCalled(t, st, fx, ticket.TicketID)
+
+	transfer := action(fx, ticket.TicketID, fx.CounterA)
+	transfer.ServiceID = other
+	transfer.Reason = "wrong desk"
+	moved, _, err := st.TransferTicket(ctx, transfer)
+	if err != nil {
+		t.Fatalf("transfer: %v", err)
+	}
+	if moved.ServiceID != other || moved.Status != models.StatusWaiting {
+		t.Fatalf("expected waiting ticket in %s, got %+v", other, moved)
+	}
+	queue, err := st.ListQueue(ctx, fx.TenantID, fx.BranchID, other)
+	if err != nil {
+		t.Fatalf("list queue: %v", err)
+	}
+	if len(queue) != 1 || queue[0].TicketID != ticket.TicketID {
+		t.Fatalf("expected ticket queued for %s, got %+v", other, queue)
+	}
+}
+
+func testSearchPaginates(t *testing.T, h Harness) {
+	ctx := context.Background()
+	st := h.Store()
+	fx := h.Seed(t)
+
+	base := time.Now().UTC().Add(-time.Hour)
+	var created []models.Ticket
+	for i := 0; i < 3; i++ {
+		created = append(created, createTicket(t, st, fx, fx.ServiceID, "regular", base.Add(time.Duration(i)*time.Minute)))
+	}
+
+	input := store.TicketSearchInput{
+		TenantID: fx.TenantID,
+		BranchID: fx.BranchID,
+		Statuses: []string{models.StatusWaiting},
+		Limit:    2,
+	}
+	first, err := st.SearchTickets(ctx, input)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(first.Tickets) != 2 || first.NextCursor == "" || first.Tickets[0].TicketID != created[2].TicketID {
+		t.Fatalf("expected newest two tickets with cursor, got %+v", first)
+	}
+	input.Cursor = first.NextCursor
+	second, err := st.SearchTickets(ctx, input)
+	if err != nil {
+		t.Fatalf("search page 2: %v", err)
+	}
+	if len(second.Tickets) != 1 || second.NextCursor != "" || second.Tickets[0].TicketID != created[0].TicketID {
+		t.Fatalf("unexpected second page: %+v", second)
+	}
+
+	input.Cursor = "not-a-cursor"
+	if _, err := st.SearchTickets(ctx, input); !errors.Is(err, store.ErrInvalidCursor) {
+		t.Fatalf("expected invalid cursor, got %v", err)
+	}
+}
+
+func testOutboxSequence(t *testing.T, h Harness) {
+	ctx := context.Background()
+	st := h.Store()
+	fx := h.Seed(t)
+
+	// Backdated tickets must still be paged in write order, not by time.
+	base := time.Now().UTC()
+	first := createTicket(t, st, fx, fx.ServiceID, "regular", base)
+	createTicket(t, st, fx, fx.ServiceID, "regular", base.Add(-time.Hour))
+	if _, err := callNext(st, fx, fx.ServiceID, fx.CounterA); err != nil {
+		t.Fatalf("call next: %v", err)
+	}
+
+	events, err := st.ListOutboxEvents(ctx, fx.TenantID, 0, 100)
+	if err != nil {
+		t.Fatalf("list outbox: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %+v", events)
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].Seq <= events[i-1].Seq {
+			t.Fatalf("expected increasing seq, got %d after %d", events[i].Seq, events[i-1].Seq)
+		}
+	}
+	if events[2].Type != "ticket.called" || !strings.Contains(string(events[0].Payload), first.TicketID) {
+		t.Fatalf("expected write order, got %+v", events)
+	}
+
+	rest, err := st.ListOutboxEvents(ctx, fx.TenantID, events[0].Seq, 1)
+	if err != nil {
+		t.Fatalf("list outbox after seq: %v", err)
+	}
+	if len(rest) != 1 || rest[0].Seq != events[1].Seq {
+		t.Fatalf("expected event after seq %d, got %+v", events[0].Seq, rest)
+	}
+	tail, err := st.ListOutboxEvents(ctx, fx.TenantID, events[2].Seq, 100)
+	if err != nil {
+		t.Fatalf("list outbox tail: %v", err)
+	}
+	if len(tail) != 0 {
+		t.Fatalf("expected no events after last seq, got %+v", tail)
+	}
+}
+
+// testOutboxConcurrentWriters pages the outbox while several writers emit
+// events at once: a writer that commits late must not leave its event below
+// a seq the reader has already passed.
+func testOutboxConcurrentWriters(t *testing.T, h Harness) {
+	ctx := context.Background()
+	st := h.Store()
+	fx := h.Seed(t)
+
+	const writers, perWriter = 8, 5
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				_, _, err := st.CreateTicket(ctx, store.CreateTicketInput{
+					RequestID:     uuid.NewString(),
+					TenantID:      fx.TenantID,
+					BranchID:      fx.BranchID,
+					ServiceID:     fx.ServiceID,
+					Channel:       "kiosk",
+					PriorityClass: "regular",
+					CreatedAt:     time.Now().UTC(),
+				})
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	type result struct {
+		events []store.OutboxEvent
+		err    error
+	}
+	stop := make(chan struct{})
+	read := make(chan result, 1)
+	go func() {
+		var got []store.OutboxEvent
+		var after int64
+		stopping := false
+		for {
+			select {
+			case <-stop:
+				stopping = true
+			default:
+			}
+			events, err := st.ListOutboxEvents(ctx, fx.TenantID, after, 10)
+			if err != nil {
+				read <- result{err: err}
+				return
+			}
+			if len(events) > 0 {
+				got = append(got, events...)
+				after = events[len(events)-1].Seq
+				continue
+			}
+			if stopping {
+				read <- result{events: got}
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("create ticket: %v", err)
+	}
+	close(stop)
+	res := <-read
+	if res.err != nil {
+		t.Fatalf("list outbox: %v", res.err)
+	}
+
+	if len(res.events) != writers*perWriter {
+		t.Fatalf("expected %d events, got %d", writers*perWriter, len(res.events))
+	}
+	seen := map[string]bool{}
+	for i, event := range res.events {
+		if i > 0 && event.Seq <= res.events[i-1].Seq {
+			t.Fatalf("expected increasing seq, got %d after %d", event.Seq, res.events[i-1].Seq)
+		}
+		if seen[event.EventID] {
+			t.Fatalf("event %s read twice", event.EventID)
+		}
+		seen[event.EventID] = true
+	}
+}
+
+func testEventChainAndReplay(t *testing.T, h Harness) {
+	ctx := context.Background()
+	st := h.Store()
+	fx := h.Seed(t)
+
+	ticket := createTicket(t, st, fx, fx.ServiceID, "regular", time.Now().UTC())
+	expectCalled(t, st, fx, ticket.TicketID)
+	if _, _, err := st.StartServing(ctx, action(fx, ticket.TicketID, fx.CounterA)); err != nil {
+		t.Fatalf("start serving: %v", err)
+	}
+	done, _, err := st.CompleteTicket(ctx, action(fx, ticket.TicketID, ""))
+	if err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+
+	events, err := st.ListTicketEvents(ctx, fx.TenantID, ticket.TicketID)
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	if len(events) != 4 {
+		t.Fatalf("expected 4 ticket events, got %d", len(events))
+	}
+	if issues := store.VerifyTicketChain(events); len(issues) != 0 {
+		t.Fatalf("expected intact chain, got %+v", issues)
+	}
+	rehydrated, err := store.RehydrateTicket(events)
+	if err != nil {
+		t.Fatalf("rehydrate: %v", err)
+	}
+	if rehydrated.Status != done.Status || rehydrated.CompletedAt == nil {
+		t.Fatalf("unexpected rehydrated ticket: %+v", rehydrated)
+	}
+
+	today := time.Now().UTC()
+	sealed, err := st.SealEventDigests(ctx, today)
+	if err != nil {
+		t.Fatalf("seal digests: %v", err)
+	}
+	if len(sealed) != 1 || sealed[0].TenantID != fx.TenantID || sealed[0].EventCount != 4 {
+		t.Fatalf("unexpected sealed digests: %+v", sealed)
+	}
+	report, err := st.VerifyTicketChains(ctx, store.ChainVerifyInput{TenantID: fx.TenantID, Day: today})
+	if err != nil {
+		t.Fatalf("verify day: %v", err)
+	}
+	if len(report.Issues) != 0 || report.DigestMatches == nil || !*report.DigestMatches {
+		t.Fatalf("expected clean day matching its digest, got %+v", report)
+	}
+
+	replay, err := st.ReplayTickets(ctx, store.ReplayInput{TenantID: fx.TenantID})
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if replay.TicketsChecked != 1 || replay.Drifted != 0 {
+		t.Fatalf("expected clean projection, got %+v", replay)
+	}
+}
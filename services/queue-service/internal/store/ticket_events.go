@@ -20,19 +20,22 @@ type TicketEvent struct {
 }
 
 type eventPayload struct {
-	TicketID      string     `json:"ticket_id"`
-	TicketNumber  string     `json:"ticket_number"`
-	Status        string     `json:"status"`
-	TenantID      string     `json:"tenant_id"`
-	BranchID      string     `json:"branch_id"`
-	ServiceID     string     `json:"service_id"`
-	FromServiceID string     `json:"from_service_id"`
-	ToServiceID   string     `json:"to_service_id"`
-	CreatedAt     *time.Time `json:"created_at"`
-	CalledAt      *time.Time `json:"called_at"`
-	ServedAt      *time.Time `json:"served_at"`
-	CompletedAt   *time.Time `json:"completed_at"`
-	CounterID     *string    `json:"counter_id"`
+	TicketID           string     `json:"ticket_id"`
+	TicketNumber       string     `json:"ticket_number"`
+	Status             string     `json:"status"`
+	TenantID           string     `json:"tenant_id"`
+	BranchID           string     `json:"branch_id"`
+	ServiceID          string     `json:"service_id"`
+	FromServiceID      string     `json:"from_service_id"`
+	ToServiceID        string     `json:"to_service_id"`
+	CreatedAt          *time.Time `json:"created_at"`
+	CalledAt           *time.Time `json:"called_at"`
+	ServedAt           *time.Time `json:"served_at"`
+	CompletedAt        *time.Time `json:"completed_at"`
+	CounterID          *string    `json:"counter_id"`
+	ArrivalConfirmedAt *time.Time `json:"arrival_confirmed_at"`
+	RemoteExpiresAt    *time.Time `json:"remote_expires_at"`
+	PostponeCount      int        `json:"postpone_count"`
 }
 
 func ComputeTicketEventHash(prevHash, ticketID, eventType string, payload json.RawMessage, createdAt time.Time, seq int) string {
@@ -84,9 +87,22 @@ func RehydrateTicket(events []TicketEvent) (models.Ticket, error) {
 		if payload.CompletedAt != nil {
 			ticket.CompletedAt = payload.CompletedAt
 		}
+		if event.Type == "ticket.reopened" {
+			ticket.CompletedAt = nil
+		}
+		if payload.RemoteExpiresAt != nil {
+			ticket.RemoteExpiresAt = payload.RemoteExpiresAt
+		}
+		if payload.ArrivalConfirmedAt != nil {
+			ticket.ArrivalConfirmedAt = payload.ArrivalConfirmedAt
+			ticket.RemoteExpiresAt = nil
+		}
 		if payload.CounterID != nil {
 			ticket.CounterID = payload.CounterID
 		}
+		if payload.PostponeCount > 0 {
+			ticket.PostponeCount = payload.PostponeCount
+		}
 	}
 	return ticket, nil
 }
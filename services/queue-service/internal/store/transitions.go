@@ -3,15 +3,20 @@ package store
 import "qms/queue-service/internal/models"
 
 var transitionMap = map[string][]string{
-	"call_next":     {models.StatusWaiting},
-	"start_serving": {models.StatusCalled},
-	"complete":      {models.StatusServing},
-	"cancel":        {models.StatusWaiting},
-	"hold":          {models.StatusWaiting},
-	"unhold":        {models.StatusHeld},
-	"recall":        {models.StatusCalled},
-	"transfer":      {models.StatusWaiting, models.StatusCalled, models.StatusServing},
-	"no_show":       {models.StatusCalled},
+	"call_next":       {models.StatusWaiting},
+	"start_serving":   {models.StatusCalled},
+	"complete":        {models.StatusServing},
+	"cancel":          {models.StatusWaiting, models.StatusRemote},
+	"hold":            {models.StatusWaiting, models.StatusCalled},
+	"unhold":          {models.StatusHeld},
+	"expire_hold":     {models.StatusHeld},
+	"recall":          {models.StatusCalled},
+	"transfer":        {models.StatusWaiting, models.StatusCalled, models.StatusServing},
+	"no_show":         {models.StatusCalled},
+	"reopen":          {models.StatusDone, models.StatusCancelled},
+	"confirm_arrival": {models.StatusRemote},
+	"expire_remote":   {models.StatusRemote},
+	"postpone":        {models.StatusWaiting},
 }
 
 func ValidTransition(action, fromStatus string) bool {
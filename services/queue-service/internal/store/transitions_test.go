@@ -17,9 +17,12 @@ func TestValidTransition(t *testing.T) {
 		{"cancel", "waiting", true},
 		{"cancel", "called", false},
 		{"hold", "waiting", true},
+		{"hold", "called", true},
 		{"hold", "serving", false},
 		{"unhold", "held", true},
 		{"unhold", "waiting", false},
+		{"expire_hold", "held", true},
+		{"expire_hold", "waiting", false},
 		{"recall", "called", true},
 		{"recall", "done", false},
 		{"transfer", "waiting", true},
@@ -27,6 +30,17 @@ func TestValidTransition(t *testing.T) {
 		{"transfer", "done", false},
 		{"no_show", "called", true},
 		{"no_show", "waiting", false},
+		{"reopen", "done", true},
+		{"reopen", "cancelled", true},
+		{"reopen", "no_show", false},
+		{"cancel", "remote", true},
+		{"confirm_arrival", "remote", true},
+		{"confirm_arrival", "waiting", false},
+		{"expire_remote", "remote", true},
+		{"postpone", "waiting", true},
+		{"postpone", "called", false},
+		{"postpone", "remote", false},
+		{"call_next", "remote", false},
 		{"unknown", "waiting", false},
 	}
 
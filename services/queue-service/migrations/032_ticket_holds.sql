@@ -0,0 +1,11 @@
+ALTER TABLE tickets
+ADD COLUMN hold_reason TEXT NULL,
+ADD COLUMN held_at TIMESTAMPTZ NULL,
+ADD COLUMN hold_expires_at TIMESTAMPTZ NULL,
+ADD COLUMN hold_counter_id UUID NULL;
+
+CREATE INDEX idx_tickets_hold_expiry ON tickets (hold_expires_at) WHERE status = 'held';
+
+ALTER TABLE service_policies
+ADD COLUMN hold_max_seconds INT NOT NULL DEFAULT 900,
+ADD COLUMN hold_expiry_action TEXT NOT NULL DEFAULT 'return';
@@ -0,0 +1,7 @@
+ALTER TABLE tickets
+ADD COLUMN recall_count INT NOT NULL DEFAULT 0,
+ADD COLUMN last_recalled_at TIMESTAMPTZ NULL;
+
+ALTER TABLE service_policies
+ADD COLUMN max_recalls INT NOT NULL DEFAULT 3,
+ADD COLUMN min_recall_interval_seconds INT NOT NULL DEFAULT 15;
@@ -0,0 +1,4 @@
+ALTER TABLE tickets
+ADD COLUMN cancelled_at TIMESTAMPTZ NULL,
+ADD COLUMN reopened_at TIMESTAMPTZ NULL,
+ADD COLUMN reopen_count INT NOT NULL DEFAULT 0;
@@ -0,0 +1,9 @@
+ALTER TABLE tickets
+ADD COLUMN party_size INT NOT NULL DEFAULT 1 CHECK (party_size >= 1),
+ADD COLUMN linked_ticket_id UUID NULL REFERENCES tickets(ticket_id);
+
+CREATE INDEX idx_tickets_linked_ticket ON tickets (linked_ticket_id) WHERE linked_ticket_id IS NOT NULL;
+
+ALTER TABLE service_policies
+ADD COLUMN max_party_size INT NOT NULL DEFAULT 10,
+ADD COLUMN max_waiting_people INT NOT NULL DEFAULT 0;
@@ -0,0 +1,20 @@
+CREATE TABLE resources (
+  resource_id UUID PRIMARY KEY,
+  branch_id UUID NOT NULL REFERENCES branches(branch_id),
+  counter_id UUID NOT NULL REFERENCES counters(counter_id),
+  name TEXT NOT NULL,
+  kind TEXT NOT NULL DEFAULT 'chair' CHECK (kind IN ('room', 'chair')),
+  capacity INT NOT NULL DEFAULT 1 CHECK (capacity >= 1),
+  active BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+CREATE INDEX idx_resources_counter ON resources (counter_id) WHERE active = TRUE;
+
+ALTER TABLE tickets
+ADD COLUMN resource_id UUID NULL REFERENCES resources(resource_id);
+
+CREATE INDEX idx_tickets_resource_active ON tickets (resource_id)
+WHERE status IN ('called', 'serving');
+
+ALTER TABLE services
+ADD COLUMN duration_minutes INT NOT NULL DEFAULT 0 CHECK (duration_minutes >= 0);
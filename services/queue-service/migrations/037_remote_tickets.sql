@@ -0,0 +1,21 @@
+ALTER TABLE tickets
+ADD COLUMN arrival_confirmed_at TIMESTAMPTZ NULL,
+ADD COLUMN remote_expires_at TIMESTAMPTZ NULL;
+
+CREATE INDEX idx_tickets_remote_expiry ON tickets (remote_expires_at) WHERE status = 'remote';
+
+ALTER TABLE service_policies
+ADD COLUMN remote_confirm_seconds INT NOT NULL DEFAULT 7200,
+ADD COLUMN remote_keep_place_seconds INT NOT NULL DEFAULT 0;
+
+ALTER TABLE notifications
+ADD COLUMN ticket_id UUID NULL;
+
+CREATE INDEX idx_notifications_ticket ON notifications (tenant_id, ticket_id) WHERE ticket_id IS NOT NULL;
+
+INSERT INTO notification_templates (template_id, tenant_id, lang, channel, body)
+VALUES
+  ('ticket_remote_joined', '11111111-1111-1111-1111-111111111111', 'id', 'sms', 'Tiket {ticket_number} tercatat. Konfirmasi kedatangan di kiosk sebelum {remote_expires_at}.'),
+  ('ticket_arrived', '11111111-1111-1111-1111-111111111111', 'id', 'sms', 'Kedatangan tiket {ticket_number} dikonfirmasi. Silakan menunggu panggilan.'),
+  ('ticket_remote_expired', '11111111-1111-1111-1111-111111111111', 'id', 'sms', 'Tiket {ticket_number} dibatalkan karena kedatangan tidak dikonfirmasi.')
+ON CONFLICT DO NOTHING;
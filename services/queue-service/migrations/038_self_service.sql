@@ -0,0 +1,7 @@
+ALTER TABLE tickets
+ADD COLUMN postpone_count INT NOT NULL DEFAULT 0;
+
+ALTER TABLE service_policies
+ADD COLUMN max_postpones INT NOT NULL DEFAULT 1,
+ADD COLUMN max_postpone_places INT NOT NULL DEFAULT 5,
+ADD COLUMN max_postpone_minutes INT NOT NULL DEFAULT 30;
@@ -0,0 +1,5 @@
+CREATE INDEX idx_tickets_search ON tickets (tenant_id, branch_id, created_at DESC, ticket_id DESC);
+
+CREATE INDEX idx_tickets_number ON tickets (tenant_id, branch_id, ticket_number);
+
+CREATE INDEX idx_tickets_phone_hash ON tickets (tenant_id, phone_hash) WHERE phone_hash IS NOT NULL;
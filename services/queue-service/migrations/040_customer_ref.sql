@@ -0,0 +1,21 @@
+ALTER TABLE tickets
+ADD COLUMN customer_ref_type TEXT NULL,
+ADD COLUMN customer_ref_hash TEXT NULL,
+ADD COLUMN customer_ref_enc BYTEA NULL;
+
+CREATE INDEX idx_tickets_customer_ref ON tickets (tenant_id, customer_ref_hash) WHERE customer_ref_hash IS NOT NULL;
+
+-- appointments.customer_ref stays for legacy rows until the queue-service
+-- purge job tokenises them and clears the plain value.
+ALTER TABLE appointments
+ADD COLUMN customer_ref_type TEXT NULL,
+ADD COLUMN customer_ref_hash TEXT NULL,
+ADD COLUMN customer_ref_enc BYTEA NULL;
+
+CREATE INDEX idx_appointments_customer_ref ON appointments (tenant_id, customer_ref_hash) WHERE customer_ref_hash IS NOT NULL;
+
+CREATE TABLE tenant_privacy_prefs (
+  tenant_id UUID PRIMARY KEY,
+  customer_ref_mode TEXT NOT NULL DEFAULT 'optional' CHECK (customer_ref_mode IN ('off', 'optional', 'required')),
+  customer_ref_retention_days INT NOT NULL DEFAULT 0 CHECK (customer_ref_retention_days >= 0)
+);
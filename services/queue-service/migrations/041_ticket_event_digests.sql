@@ -0,0 +1,13 @@
+-- Daily Merkle root over each tenant's ticket event hashes. Rows are written
+-- once by the queue-service audit job and never updated.
+CREATE TABLE ticket_event_digests (
+  tenant_id UUID NOT NULL,
+  digest_date DATE NOT NULL,
+  event_count INT NOT NULL,
+  merkle_root TEXT NOT NULL,
+  chain_issues INT NOT NULL DEFAULT 0,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (tenant_id, digest_date)
+);
+
+CREATE INDEX IF NOT EXISTS ticket_events_created_at_idx ON ticket_events (created_at);
@@ -0,0 +1,42 @@
+-- Consumers page the outbox by seq instead of created_at. Writers take the
+-- next value from outbox_sequence with a row lock that is held until their
+-- transaction ends, so seq values become visible strictly in order and a
+-- rolled-back value is reused: a reader that has seen seq N never later
+-- finds a committed event below N.
+CREATE TABLE outbox_sequence (
+  id INTEGER PRIMARY KEY,
+  last_seq BIGINT NOT NULL
+);
+
+ALTER TABLE outbox_events ADD COLUMN seq BIGINT;
+
+WITH ordered AS (
+  SELECT event_id, ROW_NUMBER() OVER (ORDER BY created_at ASC, event_id ASC) AS seq
+  FROM outbox_events
+)
+UPDATE outbox_events o
+SET seq = ordered.seq
+FROM ordered
+WHERE o.event_id = ordered.event_id;
+
+INSERT INTO outbox_sequence (id, last_seq)
+SELECT 1, COALESCE(MAX(seq), 0) FROM outbox_events;
+
+ALTER TABLE outbox_events ALTER COLUMN seq SET NOT NULL;
+CREATE UNIQUE INDEX outbox_events_seq_idx ON outbox_events (seq);
+CREATE INDEX outbox_events_tenant_seq_idx ON outbox_events (tenant_id, seq);
+
+-- Carry existing consumer positions over to seq.
+ALTER TABLE realtime_offsets ADD COLUMN last_seq BIGINT NOT NULL DEFAULT 0;
+UPDATE realtime_offsets r
+SET last_seq = COALESCE((
+  SELECT MAX(o.seq) FROM outbox_events o
+  WHERE o.created_at < r.last_event_time
+    OR (o.created_at = r.last_event_time AND o.event_id <= r.last_event_id)
+), 0);
+
+ALTER TABLE notification_offsets ADD COLUMN last_seq BIGINT NOT NULL DEFAULT 0;
+UPDATE notification_offsets n
+SET last_seq = COALESCE((
+  SELECT MAX(o.seq) FROM outbox_events o WHERE o.created_at <= n.last_event_time
+), 0);
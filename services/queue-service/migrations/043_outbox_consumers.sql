@@ -0,0 +1,32 @@
+-- Every outbox reader registers here under its own name and advances its
+-- own last_seq. Cleanup only removes events at or below the lowest
+-- last_seq, so a registered consumer never loses unread events.
+CREATE TABLE outbox_consumers (
+  name TEXT PRIMARY KEY,
+  last_seq BIGINT NOT NULL DEFAULT 0,
+  registered_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO outbox_consumers (name, last_seq)
+SELECT 'realtime', last_seq FROM realtime_offsets WHERE id = 1;
+
+INSERT INTO outbox_consumers (name, last_seq)
+SELECT 'notification', last_seq FROM notification_offsets WHERE id = 1;
+
+DROP TABLE realtime_offsets;
+DROP TABLE notification_offsets;
+
+-- Acknowledged events move here instead of being deleted when cleanup runs
+-- in archive mode.
+CREATE TABLE outbox_events_archive (
+  seq BIGINT PRIMARY KEY,
+  event_id UUID NOT NULL,
+  tenant_id UUID NOT NULL,
+  type TEXT NOT NULL,
+  payload_json JSONB NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL,
+  archived_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX outbox_events_archive_tenant_created_idx ON outbox_events_archive (tenant_id, created_at);
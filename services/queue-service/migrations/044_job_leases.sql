@@ -0,0 +1,9 @@
+-- Leader leases for background jobs. A replica holds a lease until
+-- expires_at and renews it while alive; an expired lease may be taken
+-- over by any other replica. Times come from the database clock.
+CREATE TABLE job_leases (
+  name TEXT PRIMARY KEY,
+  holder TEXT NOT NULL,
+  acquired_at TIMESTAMPTZ NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,6 @@
+-- Device credentials for realtime connections. Only the SHA-256 of the
+-- token secret is stored; admin-service returns the token once when it
+-- issues it, and issuing a new one revokes the old.
+ALTER TABLE devices
+ADD COLUMN token_hash TEXT NULL,
+ADD COLUMN token_issued_at TIMESTAMPTZ NULL;
@@ -0,0 +1,12 @@
+-- Queue position, separate from when the ticket was issued. It starts at
+-- created_at and moves when a late remote arrival joins the back of the
+-- queue or a customer postpones, so created_at never changes.
+ALTER TABLE tickets
+ADD COLUMN queued_at TIMESTAMPTZ NULL;
+
+UPDATE tickets SET queued_at = created_at;
+
+ALTER TABLE tickets
+ALTER COLUMN queued_at SET NOT NULL;
+
+CREATE INDEX idx_tickets_queue ON tickets (tenant_id, branch_id, service_id, queued_at) WHERE status = 'waiting';
@@ -0,0 +1,4 @@
+-- Context for an audit entry that has no column of its own, such as the
+-- type of a revealed customer reference. Never the reference itself.
+ALTER TABLE audit_logs
+ADD COLUMN detail TEXT NULL;
@@ -0,0 +1,4 @@
+-- Tenants that never chose a privacy mode should not start collecting
+-- customer references that are kept forever. Existing rows keep their mode.
+ALTER TABLE tenant_privacy_prefs
+ALTER COLUMN customer_ref_mode SET DEFAULT 'off';
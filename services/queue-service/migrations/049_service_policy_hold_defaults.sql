@@ -0,0 +1,11 @@
+-- A NULL hold setting falls back to HOLD_DEFAULT_SECONDS and
+-- HOLD_EXPIRY_ACTION. Rows still at the old column defaults were never set
+-- on purpose, so they follow the environment from now on too.
+ALTER TABLE service_policies
+ALTER COLUMN hold_max_seconds DROP NOT NULL,
+ALTER COLUMN hold_max_seconds DROP DEFAULT,
+ALTER COLUMN hold_expiry_action DROP NOT NULL,
+ALTER COLUMN hold_expiry_action DROP DEFAULT;
+
+UPDATE service_policies SET hold_max_seconds = NULL WHERE hold_max_seconds = 900;
+UPDATE service_policies SET hold_expiry_action = NULL WHERE hold_expiry_action = 'return';
@@ -0,0 +1,3 @@
+-- IANA zone the branch keeps its days in, so a date means a local day.
+ALTER TABLE branches
+ADD COLUMN timezone TEXT NOT NULL DEFAULT 'UTC';
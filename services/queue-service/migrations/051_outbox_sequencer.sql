@@ -0,0 +1,13 @@
+-- Writers no longer number outbox events themselves. Taking the next seq
+-- from the outbox_sequence row locked that row until the writer's
+-- transaction ended, so every transaction that emitted an event queued
+-- behind it and could deadlock against it on ticket rows. Events are now
+-- inserted without a seq, in write_order, and readers number them while
+-- holding an advisory lock: each pass gives every committed event that has
+-- no seq yet the next values from outbox_sequence. An event only gets a seq
+-- once it is visible, so seq values still become visible strictly in order
+-- and a reader that has seen seq N never later finds a committed event
+-- below N.
+ALTER TABLE outbox_events ADD COLUMN write_order BIGSERIAL;
+ALTER TABLE outbox_events ALTER COLUMN seq DROP NOT NULL;
+CREATE INDEX outbox_events_unsequenced_idx ON outbox_events (write_order) WHERE seq IS NULL;
@@ -0,0 +1,20 @@
+-- Outbox events the notification worker could not process. The consumer
+-- offset moves past a failed event so later events are not held back; the
+-- event is kept here and retried with backoff until next_attempt_at is
+-- cleared after the last attempt.
+CREATE TABLE notification_event_failures (
+  event_id UUID PRIMARY KEY,
+  seq BIGINT NOT NULL,
+  tenant_id UUID NOT NULL,
+  type TEXT NOT NULL,
+  payload_json JSONB NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 1,
+  last_error TEXT NOT NULL,
+  next_attempt_at TIMESTAMPTZ NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX notification_event_failures_due_idx
+  ON notification_event_failures (next_attempt_at)
+  WHERE next_attempt_at IS NOT NULL;
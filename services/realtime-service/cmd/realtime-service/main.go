@@ -2,38 +2,27 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"expvar"
-	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
-	"strings"
-	"sync/atomic"
 	"syscall"
 	"time"
 
+	"qms/realtime-service/internal/board"
 	"qms/realtime-service/internal/config"
 	"qms/realtime-service/internal/httpapi"
 	"qms/realtime-service/internal/hub"
+	"qms/realtime-service/internal/names"
+	"qms/realtime-service/internal/pgnotify"
 	"qms/realtime-service/internal/store/postgres"
 	"qms/realtime-service/internal/telemetry"
 
-	"github.com/google/uuid"
-	"github.com/igm/sockjs-go/sockjs"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
-type eventEnvelope struct {
-	Type      string          `json:"type"`
-	Payload   json.RawMessage `json:"payload"`
-	CreatedAt time.Time       `json:"created_at"`
-}
-
-const zeroUUID = "00000000-0000-0000-0000-000000000000"
-
 func main() {
 	cfg := config.Load()
 	shutdownTelemetry := telemetry.Setup("realtime-service")
@@ -50,7 +39,27 @@ func main() {
 	defer pool.Close()
 
 	store := postgres.NewStore(pool)
-	h := hub.New()
+	switch cfg.OutboxCleanup {
+	case "delete", "archive", "off":
+	default:
+		log.Fatalf("unknown REALTIME_OUTBOX_CLEANUP %q", cfg.OutboxCleanup)
+	}
+	if err := store.RegisterConsumer(context.Background(), cfg.ConsumerName); err != nil {
+		log.Fatalf("register outbox consumer: %v", err)
+	}
+	// The offset is saved only after a batch has been broadcast, so a
+	// restart replays at most the last batch rather than losing it.
+	offset, err := store.GetOffset(context.Background(), cfg.ConsumerName)
+	if err != nil {
+		log.Printf("load offset error: %v", err)
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+
+	// The replay buffer starts at the offset: earlier events were broadcast
+	// by a previous process, so resuming before it requires a resync.
+	h := hub.New(hub.Options{ReplaySize: cfg.ReplaySize, StartSeq: offset, MaxDrops: cfg.SlowClientMaxDrops})
 	limiter := httpapi.NewRateLimiter(httpapi.RateLimitConfig{
 		IPPerMinute: cfg.RateLimitPerMinute,
 		IPBurst:     cfg.RateLimitBurst,
@@ -65,59 +74,13 @@ func main() {
 		}
 		w.WriteHeader(http.StatusOK)
 	})
-	sockjsHandler := sockjs.NewHandler("/realtime", sockjs.DefaultOptions, func(session sockjs.Session) {
-		req := session.Request()
-		sessionID := sessionIDFromRequest(req)
-		if sessionID == "" {
-			_ = session.Close(4001, "missing session")
-			return
-		}
-		authSession, err := store.GetSession(context.Background(), sessionID)
-		if err != nil {
-			_ = session.Close(4002, "invalid session")
-			return
-		}
-		branches, services, err := store.GetAccess(context.Background(), authSession.UserID)
-		if err != nil {
-			_ = session.Close(4003, "access lookup failed")
-			return
-		}
-
-		client := &hub.Client{ID: uuid.NewString(), Send: make(chan []byte, 16)}
-		h.Register(client)
-		defer h.Unregister(client)
-
-		go func() {
-			for msg := range client.Send {
-				_ = session.Send(string(msg))
-			}
-		}()
-
-		for {
-			msg, err := session.Recv()
-			if err != nil {
-				return
-			}
-			parsed, ok := hub.ParseSubscribe([]byte(msg))
-			if ok {
-				if parsed.Action == "unsubscribe" {
-					h.UpdateSubscription(client, hub.Subscription{})
-				} else {
-					if !isAllowed(parsed.BranchID, parsed.ServiceID, branches, services) {
-						_ = session.Close(4003, "access denied")
-						return
-					}
-					h.UpdateSubscription(client, hub.Subscription{
-						TenantID:  authSession.TenantID,
-						BranchID:  parsed.BranchID,
-						ServiceID: parsed.ServiceID,
-					})
-				}
-				continue
-			}
-		}
-	})
-	mux.Handle("/realtime/", sockjsHandler)
+	boards := board.New(store, h)
+	resolver := names.New(store, 5*time.Minute)
+	realtime := httpapi.NewRealtime(store, h, boards)
+	realtime.Register(mux)
+	// Sessions and device tokens are checked at connect; revalidation
+	// catches expiry, deactivation and access changes on open connections.
+	go realtime.Revalidate(context.Background(), cfg.RevalidateInterval)
 
 	otelHandler := otelhttp.NewHandler(httpapi.LoggingMiddleware(limiter.Middleware(mux)), "realtime-service")
 	server := &http.Server{
@@ -128,21 +91,6 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
-	offset, err := store.GetOffset(context.Background())
-	if err != nil {
-		log.Printf("load offset error: %v", err)
-	}
-	if offset.LastEventTime.IsZero() {
-		offset.LastEventTime = time.Unix(0, 0).UTC()
-	}
-	if offset.LastEventID == "" {
-		offset.LastEventID = zeroUUID
-	}
-	if cfg.PollInterval <= 0 {
-		cfg.PollInterval = time.Second
-	}
-	var running int32
-
 	go func() {
 		log.Printf("realtime-service listening on %s", server.Addr)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -150,47 +98,65 @@ func main() {
 		}
 	}()
 
+	// poll broadcasts the next batch and reports how many events it read.
+	poll := func() int {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		events, err := store.ListOutboxEvents(ctx, offset, cfg.BatchSize)
+		if err != nil {
+			log.Printf("list outbox error: %v", err)
+			return 0
+		}
+		for _, event := range events {
+			event = resolver.Resolve(ctx, event)
+			h.Broadcast(hub.EventMessage(event))
+			boards.Apply(event)
+			offset = event.Seq
+		}
+		if len(events) > 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := store.UpdateOffset(ctx, cfg.ConsumerName, offset); err != nil {
+				log.Printf("update offset error: %v", err)
+			}
+			if cfg.OutboxCleanup != "off" {
+				if _, err := store.CleanupOutbox(ctx, cfg.OutboxCleanup == "archive"); err != nil {
+					log.Printf("cleanup outbox error: %v", err)
+				}
+			}
+			cancel()
+		}
+		return len(events)
+	}
+
+	// NOTIFY from queue-service wakes the poller as soon as an event
+	// commits; the ticker is the fallback when notifications are missed
+	// or LISTEN is disabled.
+	var wake <-chan struct{}
+	if cfg.Listen {
+		listener := pgnotify.New(pool, pgnotify.OutboxChannel)
+		go listener.Run(context.Background())
+		wake = listener.C()
+
+		// A logout closes the session's sockets at once instead of at the
+		// next revalidation.
+		revocations := pgnotify.NewHandler(pool, pgnotify.SessionRevokedChannel, func(sessionID string) {
+			if n := realtime.RevokeSession(sessionID); n > 0 {
+				log.Printf("revoked %d connections of a logged out session", n)
+			}
+		})
+		go revocations.Run(context.Background())
+	}
 	go func() {
 		ticker := time.NewTicker(cfg.PollInterval)
 		defer ticker.Stop()
-		for range ticker.C {
-			if !atomic.CompareAndSwapInt32(&running, 0, 1) {
-				continue
+		for {
+			select {
+			case <-ticker.C:
+			case <-wake:
 			}
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			events, err := store.ListOutboxEvents(ctx, offset, cfg.BatchSize)
-			cancel()
-			if err == nil {
-				for _, event := range events {
-					offset.LastEventTime = event.CreatedAt
-					offset.LastEventID = event.EventID
-					meta := extractMeta(event.Payload)
-					meta.TenantID = event.TenantID
-					env := eventEnvelope{Type: event.Type, Payload: event.Payload, CreatedAt: event.CreatedAt}
-					payload, _ := json.Marshal(env)
-					h.Broadcast(payload, meta)
-				}
-				if len(events) > 0 {
-					ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-					if err := store.UpdateOffset(ctx, offset); err != nil {
-						log.Printf("update offset error: %v", err)
-					}
-					notifyOffset, err := store.GetNotificationOffset(ctx)
-					if err != nil {
-						log.Printf("notification offset error: %v", err)
-					} else if !notifyOffset.IsZero() {
-						cleanupBefore := offset.LastEventTime
-						if !notifyOffset.IsZero() && notifyOffset.Before(cleanupBefore) {
-							cleanupBefore = notifyOffset
-						}
-						if err := store.CleanupOutbox(ctx, cleanupBefore); err != nil {
-							log.Printf("cleanup outbox error: %v", err)
-						}
-					}
-					cancel()
-				}
+			// Keep reading while batches come back full.
+			for poll() == cfg.BatchSize {
 			}
-			atomic.StoreInt32(&running, 0)
 		}
 	}()
 
@@ -204,72 +170,3 @@ func main() {
 		log.Printf("shutdown error: %v", err)
 	}
 }
-
-func extractMeta(payload []byte) hub.Subscription {
-	var data map[string]interface{}
-	if err := json.Unmarshal(payload, &data); err != nil {
-		return hub.Subscription{}
-	}
-	return hub.Subscription{
-		TenantID:  str(data["tenant_id"]),
-		BranchID:  str(data["branch_id"]),
-		ServiceID: str(data["service_id"]),
-	}
-}
-
-func str(value interface{}) string {
-	if value == nil {
-		return ""
-	}
-	if v, ok := value.(string); ok {
-		return v
-	}
-	return fmt.Sprint(value)
-}
-
-func sessionIDFromRequest(r *http.Request) string {
-	if r == nil {
-		return ""
-	}
-	if token := bearerToken(r.Header.Get("Authorization")); token != "" {
-		return token
-	}
-	return strings.TrimSpace(r.URL.Query().Get("session_id"))
-}
-
-func bearerToken(header string) string {
-	if header == "" {
-		return ""
-	}
-	parts := strings.Fields(header)
-	if len(parts) != 2 {
-		return ""
-	}
-	if strings.ToLower(parts[0]) != "bearer" {
-		return ""
-	}
-	return parts[1]
-}
-
-func isAllowed(branchID, serviceID string, branches, services []string) bool {
-	if len(branches) > 0 {
-		if branchID == "" || !contains(branches, branchID) {
-			return false
-		}
-	}
-	if len(services) > 0 {
-		if serviceID == "" || !contains(services, serviceID) {
-			return false
-		}
-	}
-	return true
-}
-
-func contains(values []string, value string) bool {
-	for _, item := range values {
-		if item == value {
-			return true
-		}
-	}
-	return false
-}
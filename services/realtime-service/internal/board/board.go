@@ -0,0 +1,706 @@
+// Package board projects outbox events into display board state: who is
+// being called at each counter, the latest calls, who is next and how long
+// each queue is. A branch is loaded from the database when a display first
+// subscribes to it and is then kept current from the event stream, so every
+// display of the same view sees the same board.
+package board
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"qms/realtime-service/internal/hub"
+	"qms/realtime-service/internal/store"
+)
+
+const (
+	RecentLimit = 10
+	NextUpLimit = 5
+	// recentKeep is how many calls a branch remembers, so views filtered
+	// by area or service still fill RecentLimit.
+	recentKeep = 50
+	// defaultServiceSeconds estimates service time before any ticket of
+	// the service has completed recently.
+	defaultServiceSeconds = 300
+)
+
+type Loader interface {
+	LoadBoard(ctx context.Context, tenantID, branchID string, recent int) (store.BoardSnapshot, error)
+}
+
+type Call struct {
+	TicketID     string    `json:"ticket_id"`
+	TicketNumber string    `json:"ticket_number"`
+	CounterID    string    `json:"counter_id"`
+	ServiceID    string    `json:"service_id"`
+	CounterName  string    `json:"counter_name,omitempty"`
+	ServiceName  string    `json:"service_name,omitempty"`
+	CalledAt     time.Time `json:"called_at"`
+	RecallCount  int       `json:"recall_count"`
+}
+
+type NextUp struct {
+	TicketID     string `json:"ticket_id"`
+	TicketNumber string `json:"ticket_number"`
+	ServiceID    string `json:"service_id"`
+	ServiceName  string `json:"service_name,omitempty"`
+	ETASeconds   int    `json:"eta_seconds"`
+}
+
+// Queue is one service's waiting line. ETASeconds estimates the wait of a
+// ticket taken now.
+type Queue struct {
+	WaitingCount int `json:"waiting_count"`
+	ETASeconds   int `json:"eta_seconds"`
+}
+
+type State struct {
+	// NowCalling is the called or serving ticket by counter.
+	NowCalling   map[string]Call  `json:"now_calling"`
+	Recent       []Call           `json:"recent"`
+	NextUp       []NextUp         `json:"next_up"`
+	WaitingCount int              `json:"waiting_count"`
+	Services     map[string]Queue `json:"services"`
+}
+
+// Changes holds only the parts of a State that changed. A null map entry
+// removes that counter or service.
+type Changes struct {
+	NowCalling   map[string]*Call  `json:"now_calling,omitempty"`
+	Recent       *[]Call           `json:"recent,omitempty"`
+	NextUp       *[]NextUp         `json:"next_up,omitempty"`
+	WaitingCount *int              `json:"waiting_count,omitempty"`
+	Services     map[string]*Queue `json:"services,omitempty"`
+}
+
+type View struct {
+	BranchID  string `json:"branch_id"`
+	AreaID    string `json:"area_id,omitempty"`
+	ServiceID string `json:"service_id,omitempty"`
+}
+
+// snapshotMessage and diffMessage are the board messages sent to clients.
+// Version is the seq of the last event that changed the view; a diff
+// applies only to a board at version From, and a client that sees a gap
+// subscribes again for a fresh snapshot.
+type snapshotMessage struct {
+	Type    string `json:"type"`
+	Board   View   `json:"board"`
+	Version int64  `json:"version"`
+	State   State  `json:"state"`
+}
+
+type diffMessage struct {
+	Type    string  `json:"type"`
+	Board   View    `json:"board"`
+	From    int64   `json:"from"`
+	Version int64   `json:"version"`
+	Changes Changes `json:"changes"`
+}
+
+// The display variants drop ticket, counter and service ids, as the hub's
+// ShapeDisplay does for events. Counters and services are keyed by
+// displayKey instead, which is stable, so diffs still apply.
+type displayCall struct {
+	TicketNumber string    `json:"ticket_number"`
+	CounterName  string    `json:"counter_name,omitempty"`
+	ServiceName  string    `json:"service_name,omitempty"`
+	CalledAt     time.Time `json:"called_at"`
+	RecallCount  int       `json:"recall_count"`
+}
+
+type displayNextUp struct {
+	TicketNumber string `json:"ticket_number"`
+	ServiceName  string `json:"service_name,omitempty"`
+	ETASeconds   int    `json:"eta_seconds"`
+}
+
+type displayStateFields struct {
+	NowCalling   map[string]displayCall `json:"now_calling"`
+	Recent       []displayCall          `json:"recent"`
+	NextUp       []displayNextUp        `json:"next_up"`
+	WaitingCount int                    `json:"waiting_count"`
+	Services     map[string]Queue       `json:"services"`
+}
+
+type displayChangeFields struct {
+	NowCalling   map[string]*displayCall `json:"now_calling,omitempty"`
+	Recent       *[]displayCall          `json:"recent,omitempty"`
+	NextUp       *[]displayNextUp        `json:"next_up,omitempty"`
+	WaitingCount *int                    `json:"waiting_count,omitempty"`
+	Services     map[string]*Queue       `json:"services,omitempty"`
+}
+
+type displaySnapshotMessage struct {
+	Type    string             `json:"type"`
+	Board   View               `json:"board"`
+	Version int64              `json:"version"`
+	State   displayStateFields `json:"state"`
+}
+
+type displayDiffMessage struct {
+	Type    string              `json:"type"`
+	Board   View                `json:"board"`
+	From    int64               `json:"from"`
+	Version int64               `json:"version"`
+	Changes displayChangeFields `json:"changes"`
+}
+
+// displayKey stands in for a counter or service id on display boards.
+func displayKey(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:8])
+}
+
+func toDisplayCall(call Call) displayCall {
+	return displayCall{TicketNumber: call.TicketNumber, CounterName: call.CounterName, ServiceName: call.ServiceName, CalledAt: call.CalledAt, RecallCount: call.RecallCount}
+}
+
+func toDisplayCalls(calls []Call) []displayCall {
+	shown := make([]displayCall, 0, len(calls))
+	for _, call := range calls {
+		shown = append(shown, toDisplayCall(call))
+	}
+	return shown
+}
+
+func toDisplayNextUp(next []NextUp) []displayNextUp {
+	shown := make([]displayNextUp, 0, len(next))
+	for _, n := range next {
+		shown = append(shown, displayNextUp{TicketNumber: n.TicketNumber, ServiceName: n.ServiceName, ETASeconds: n.ETASeconds})
+	}
+	return shown
+}
+
+func displayState(state State) displayStateFields {
+	shown := displayStateFields{
+		NowCalling:   make(map[string]displayCall, len(state.NowCalling)),
+		Recent:       toDisplayCalls(state.Recent),
+		NextUp:       toDisplayNextUp(state.NextUp),
+		WaitingCount: state.WaitingCount,
+		Services:     make(map[string]Queue, len(state.Services)),
+	}
+	for counterID, call := range state.NowCalling {
+		shown.NowCalling[displayKey(counterID)] = toDisplayCall(call)
+	}
+	for serviceID, queue := range state.Services {
+		shown.Services[displayKey(serviceID)] = queue
+	}
+	return shown
+}
+
+func displayChanges(changes Changes) displayChangeFields {
+	shown := displayChangeFields{WaitingCount: changes.WaitingCount}
+	if changes.NowCalling != nil {
+		shown.NowCalling = make(map[string]*displayCall, len(changes.NowCalling))
+		for counterID, call := range changes.NowCalling {
+			var entry *displayCall
+			if call != nil {
+				c := toDisplayCall(*call)
+				entry = &c
+			}
+			shown.NowCalling[displayKey(counterID)] = entry
+		}
+	}
+	if changes.Recent != nil {
+		recent := toDisplayCalls(*changes.Recent)
+		shown.Recent = &recent
+	}
+	if changes.NextUp != nil {
+		next := toDisplayNextUp(*changes.NextUp)
+		shown.NextUp = &next
+	}
+	if changes.Services != nil {
+		shown.Services = make(map[string]*Queue, len(changes.Services))
+		for serviceID, queue := range changes.Services {
+			shown.Services[displayKey(serviceID)] = queue
+		}
+	}
+	return shown
+}
+
+type Projection struct {
+	loader Loader
+	hub    *hub.Hub
+
+	mu       sync.Mutex
+	branches map[string]*branch
+}
+
+type branch struct {
+	seq     int64
+	tickets map[string]*store.Ticket
+	recent  []store.Ticket
+	avg     map[string]float64
+	routing map[string]store.Routing
+	views   map[string]*view
+}
+
+type view struct {
+	filter  View
+	version int64
+	state   State
+}
+
+func New(loader Loader, h *hub.Hub) *Projection {
+	return &Projection{loader: loader, hub: h, branches: make(map[string]*branch)}
+}
+
+// Attach sends client a snapshot of the board view of sub, loading the
+// branch first if no one is watching it yet. The client must already hold
+// sub, so no diff after the snapshot is missed.
+func (p *Projection) Attach(ctx context.Context, client *hub.Client, sub hub.Subscription) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Loading under the lock keeps events from being applied to a branch
+	// that is half loaded.
+	key := sub.TenantID + "/" + sub.BranchID
+	b := p.branches[key]
+	if b == nil {
+		snapshot, err := p.loader.LoadBoard(ctx, sub.TenantID, sub.BranchID, recentKeep)
+		if err != nil {
+			return err
+		}
+		b = newBranch(snapshot)
+		p.branches[key] = b
+	}
+	v := b.views[sub.BoardKey()]
+	if v == nil {
+		v = &view{filter: View{BranchID: sub.BranchID, AreaID: sub.AreaID, ServiceID: sub.ServiceID}, version: b.seq}
+		v.state = b.render(v.filter, time.Now())
+		b.views[sub.BoardKey()] = v
+	}
+	data, _ := json.Marshal(snapshotMessage{Type: "board.snapshot", Board: v.filter, Version: v.version, State: v.state})
+	display, _ := json.Marshal(displaySnapshotMessage{Type: "board.snapshot", Board: v.filter, Version: v.version, State: displayState(v.state)})
+	p.hub.Deliver(client, hub.BoardMessage(v.version, data, display))
+	return nil
+}
+
+// Apply updates the branch of a ticket event and sends a diff for each
+// view it changed. It must see events in seq order. Views nobody is
+// subscribed to any more are dropped, and so are branches without views.
+func (p *Projection) Apply(event store.OutboxEvent) {
+	if !strings.HasPrefix(event.Type, "ticket.") {
+		return
+	}
+	var ticket payload
+	if err := json.Unmarshal(event.Payload, &ticket); err != nil || ticket.TicketID == "" {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := event.TenantID + "/" + ticket.BranchID
+	b := p.branches[key]
+	if b == nil || event.Seq <= b.seq {
+		return
+	}
+	b.seq = event.Seq
+	b.apply(event.Type, ticket, event.CreatedAt)
+
+	now := time.Now()
+	for viewKey, v := range b.views {
+		next := b.render(v.filter, now)
+		changes, changed := diff(v.state, next)
+		if !changed {
+			continue
+		}
+		msg := diffMessage{Type: "board.diff", Board: v.filter, From: v.version, Version: event.Seq, Changes: changes}
+		v.state, v.version = next, event.Seq
+		data, _ := json.Marshal(msg)
+		display, _ := json.Marshal(displayDiffMessage{Type: msg.Type, Board: msg.Board, From: msg.From, Version: msg.Version, Changes: displayChanges(changes)})
+		if !p.hub.BroadcastBoard(viewKey, hub.BoardMessage(event.Seq, data, display)) {
+			delete(b.views, viewKey)
+		}
+	}
+	if len(b.views) == 0 {
+		delete(p.branches, key)
+		log.Printf("board %s unloaded", key)
+	}
+}
+
+// payload is the subset of ticket event payloads the projection reads.
+// Not every event type carries every field.
+type payload struct {
+	TicketID      string     `json:"ticket_id"`
+	TicketNumber  string     `json:"ticket_number"`
+	Status        string     `json:"status"`
+	BranchID      string     `json:"branch_id"`
+	ServiceID     string     `json:"service_id"`
+	AreaID        string     `json:"area_id"`
+	CounterID     *string    `json:"counter_id"`
+	CounterName   string     `json:"counter_name"`
+	ServiceName   string     `json:"service_name"`
+	CreatedAt     *time.Time `json:"created_at"`
+	CalledAt      *time.Time `json:"called_at"`
+	ServedAt      *time.Time `json:"served_at"`
+	CompletedAt   *time.Time `json:"completed_at"`
+	RecallCount   *int       `json:"recall_count"`
+	QueuedAt      *time.Time `json:"queued_at"`
+	PriorityClass string     `json:"priority_class"`
+	ScheduledAt   *time.Time `json:"appointment_scheduled_at"`
+	PartySize     *int       `json:"party_size"`
+}
+
+func newBranch(snapshot store.BoardSnapshot) *branch {
+	b := &branch{
+		seq:     snapshot.Seq,
+		tickets: make(map[string]*store.Ticket, len(snapshot.Tickets)),
+		recent:  snapshot.Recent,
+		avg:     snapshot.AvgServiceSeconds,
+		routing: snapshot.Routing,
+		views:   make(map[string]*view),
+	}
+	if b.avg == nil {
+		b.avg = map[string]float64{}
+	}
+	for i := range snapshot.Tickets {
+		ticket := snapshot.Tickets[i]
+		if ticket.QueuedAt.IsZero() {
+			ticket.QueuedAt = ticket.CreatedAt
+		}
+		b.tickets[ticket.TicketID] = &ticket
+	}
+	return b
+}
+
+func isOpen(status string) bool {
+	switch status {
+	case "remote", "waiting", "held", "called", "serving":
+		return true
+	}
+	return false
+}
+
+func isAtCounter(status string) bool {
+	return status == "called" || status == "serving"
+}
+
+func (b *branch) apply(eventType string, p payload, at time.Time) {
+	if eventType == "ticket.done" && p.ServedAt != nil && p.CompletedAt != nil {
+		people := 1
+		if t := b.tickets[p.TicketID]; t != nil {
+			people = partySize(t.PartySize)
+		}
+		seconds := p.CompletedAt.Sub(*p.ServedAt).Seconds() / float64(people)
+		if avg, ok := b.avg[p.ServiceID]; ok {
+			b.avg[p.ServiceID] = 0.8*avg + 0.2*seconds
+		} else {
+			b.avg[p.ServiceID] = seconds
+		}
+	}
+
+	if !isOpen(p.Status) {
+		delete(b.tickets, p.TicketID)
+		return
+	}
+	t := b.tickets[p.TicketID]
+	if t == nil {
+		t = &store.Ticket{TicketID: p.TicketID, CreatedAt: at}
+		b.tickets[p.TicketID] = t
+	}
+	if p.CreatedAt != nil {
+		t.CreatedAt = *p.CreatedAt
+	}
+	if p.QueuedAt != nil {
+		t.QueuedAt = *p.QueuedAt
+	} else if t.QueuedAt.IsZero() {
+		t.QueuedAt = t.CreatedAt
+	}
+	if p.PriorityClass != "" {
+		t.PriorityClass = p.PriorityClass
+	}
+	if p.ScheduledAt != nil {
+		t.ScheduledAt = p.ScheduledAt
+	}
+	if p.PartySize != nil {
+		t.PartySize = *p.PartySize
+	}
+	if p.TicketNumber != "" {
+		t.TicketNumber = p.TicketNumber
+	}
+	if p.ServiceID != "" {
+		t.ServiceID = p.ServiceID
+	}
+	if p.ServiceName != "" {
+		t.ServiceName = p.ServiceName
+	}
+	t.Status = p.Status
+	t.AreaID = p.AreaID
+	if p.RecallCount != nil {
+		t.RecallCount = *p.RecallCount
+	}
+	switch {
+	case !isAtCounter(p.Status):
+		t.CounterID, t.CounterName, t.CalledAt = "", "", nil
+	case p.CounterID != nil:
+		t.CounterID, t.CounterName = *p.CounterID, p.CounterName
+	}
+	if isAtCounter(p.Status) && p.CalledAt != nil {
+		t.CalledAt = p.CalledAt
+	}
+
+	if eventType == "ticket.called" || eventType == "ticket.recalled" {
+		call := *t
+		if call.CalledAt == nil {
+			call.CalledAt = &at
+		}
+		recent := []store.Ticket{call}
+		for _, item := range b.recent {
+			if item.TicketID != call.TicketID && len(recent) < recentKeep {
+				recent = append(recent, item)
+			}
+		}
+		b.recent = recent
+	}
+}
+
+func (b *branch) render(filter View, now time.Time) State {
+	matches := func(t *store.Ticket) bool {
+		return (filter.AreaID == "" || t.AreaID == filter.AreaID) &&
+			(filter.ServiceID == "" || t.ServiceID == filter.ServiceID)
+	}
+	state := State{
+		NowCalling: map[string]Call{},
+		Recent:     []Call{},
+		NextUp:     []NextUp{},
+		Services:   map[string]Queue{},
+	}
+	counters := map[string]map[string]bool{}
+	var waiting []*store.Ticket
+	for _, t := range b.tickets {
+		if !matches(t) {
+			continue
+		}
+		switch {
+		case t.Status == "waiting":
+			waiting = append(waiting, t)
+		case isAtCounter(t.Status) && t.CounterID != "":
+			call := toCall(*t)
+			if current, ok := state.NowCalling[t.CounterID]; !ok || call.CalledAt.After(current.CalledAt) {
+				state.NowCalling[t.CounterID] = call
+			}
+			if counters[t.ServiceID] == nil {
+				counters[t.ServiceID] = map[string]bool{}
+			}
+			counters[t.ServiceID][t.CounterID] = true
+		}
+	}
+
+	sort.Slice(waiting, func(i, j int) bool {
+		return b.callsBefore(waiting[i], waiting[j], now)
+	})
+	state.WaitingCount = len(waiting)
+	count := map[string]int{}
+	people := map[string]int{}
+	for i, t := range waiting {
+		count[t.ServiceID]++
+		people[t.ServiceID] += partySize(t.PartySize)
+		if i < NextUpLimit {
+			state.NextUp = append(state.NextUp, NextUp{
+				TicketID:     t.TicketID,
+				TicketNumber: t.TicketNumber,
+				ServiceID:    t.ServiceID,
+				ServiceName:  t.ServiceName,
+				ETASeconds:   b.eta(t.ServiceID, people[t.ServiceID], len(counters[t.ServiceID])),
+			})
+		}
+	}
+	for serviceID, n := range count {
+		state.Services[serviceID] = Queue{
+			WaitingCount: n,
+			ETASeconds:   b.eta(serviceID, people[serviceID]+1, len(counters[serviceID])),
+		}
+	}
+
+	for i := range b.recent {
+		if len(state.Recent) == RecentLimit {
+			break
+		}
+		if matches(&b.recent[i]) {
+			state.Recent = append(state.Recent, toCall(b.recent[i]))
+		}
+	}
+	return state
+}
+
+// callRank places a waiting ticket among the groups CallNext tries in turn
+// for a service with no priority streak or appointment debt: appointments
+// within the boost window, appointments owed by a blending ratio, walk-ins,
+// the remaining appointments and, last, tickets postponed past now. The
+// returned time orders tickets within a group.
+func (b *branch) callRank(t *store.Ticket, now time.Time) (int, time.Time) {
+	if t.QueuedAt.After(now) {
+		return 4, t.QueuedAt
+	}
+	if t.ScheduledAt == nil {
+		return 2, t.QueuedAt
+	}
+	routing := b.routing[t.ServiceID]
+	switch {
+	case routing.AppointmentBoostMinutes > 0 && !t.ScheduledAt.After(now.Add(time.Duration(routing.AppointmentBoostMinutes)*time.Minute)):
+		return 0, *t.ScheduledAt
+	case routing.AppointmentRatioPercent > 0:
+		return 1, *t.ScheduledAt
+	}
+	return 3, *t.ScheduledAt
+}
+
+// callsBefore reports whether x is called before y. Within a group CallNext
+// takes priority classes before regular tickets, then goes by time.
+func (b *branch) callsBefore(x, y *store.Ticket, now time.Time) bool {
+	xRank, xAt := b.callRank(x, now)
+	yRank, yAt := b.callRank(y, now)
+	if xRank != yRank {
+		return xRank < yRank
+	}
+	if xPriority, yPriority := isPriority(x.PriorityClass), isPriority(y.PriorityClass); xPriority != yPriority {
+		return xPriority
+	}
+	if !xAt.Equal(yAt) {
+		return xAt.Before(yAt)
+	}
+	if !x.QueuedAt.Equal(y.QueuedAt) {
+		return x.QueuedAt.Before(y.QueuedAt)
+	}
+	return x.TicketID < y.TicketID
+}
+
+// isPriority reports whether class is served ahead of regular tickets.
+// Tickets from before the class was recorded count as regular.
+func isPriority(class string) bool {
+	return class != "" && class != "regular"
+}
+
+// partySize counts a ticket without a recorded party size as one person.
+func partySize(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// eta estimates the wait until people people, counted through the ticket
+// in question, have been served in a service queue worked by counters
+// counters. The average service time is per person.
+func (b *branch) eta(serviceID string, people, counters int) int {
+	avg, ok := b.avg[serviceID]
+	if !ok || avg <= 0 {
+		avg = defaultServiceSeconds
+	}
+	if counters < 1 {
+		counters = 1
+	}
+	return int(math.Ceil(float64(people) * avg / float64(counters)))
+}
+
+func toCall(t store.Ticket) Call {
+	call := Call{
+		TicketID:     t.TicketID,
+		TicketNumber: t.TicketNumber,
+		CounterID:    t.CounterID,
+		ServiceID:    t.ServiceID,
+		CounterName:  t.CounterName,
+		ServiceName:  t.ServiceName,
+		RecallCount:  t.RecallCount,
+	}
+	if t.CalledAt != nil {
+		call.CalledAt = t.CalledAt.UTC()
+	}
+	return call
+}
+
+func diff(old, next State) (Changes, bool) {
+	var changes Changes
+	changed := false
+	for counterID, call := range next.NowCalling {
+		if current, ok := old.NowCalling[counterID]; !ok || !sameCall(current, call) {
+			if changes.NowCalling == nil {
+				changes.NowCalling = map[string]*Call{}
+			}
+			call := call
+			changes.NowCalling[counterID] = &call
+			changed = true
+		}
+	}
+	for counterID := range old.NowCalling {
+		if _, ok := next.NowCalling[counterID]; !ok {
+			if changes.NowCalling == nil {
+				changes.NowCalling = map[string]*Call{}
+			}
+			changes.NowCalling[counterID] = nil
+			changed = true
+		}
+	}
+	if !sameCalls(old.Recent, next.Recent) {
+		changes.Recent = &next.Recent
+		changed = true
+	}
+	if !sameNextUp(old.NextUp, next.NextUp) {
+		changes.NextUp = &next.NextUp
+		changed = true
+	}
+	if old.WaitingCount != next.WaitingCount {
+		count := next.WaitingCount
+		changes.WaitingCount = &count
+		changed = true
+	}
+	for serviceID, queue := range next.Services {
+		if current, ok := old.Services[serviceID]; !ok || current != queue {
+			if changes.Services == nil {
+				changes.Services = map[string]*Queue{}
+			}
+			queue := queue
+			changes.Services[serviceID] = &queue
+			changed = true
+		}
+	}
+	for serviceID := range old.Services {
+		if _, ok := next.Services[serviceID]; !ok {
+			if changes.Services == nil {
+				changes.Services = map[string]*Queue{}
+			}
+			changes.Services[serviceID] = nil
+			changed = true
+		}
+	}
+	return changes, changed
+}
+
+func sameCall(a, b Call) bool {
+	return a.TicketID == b.TicketID && a.TicketNumber == b.TicketNumber && a.CounterID == b.CounterID &&
+		a.ServiceID == b.ServiceID && a.RecallCount == b.RecallCount && a.CalledAt.Equal(b.CalledAt)
+}
+
+func sameCalls(a, b []Call) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !sameCall(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameNextUp(a, b []NextUp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
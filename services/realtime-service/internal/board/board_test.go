@@ -0,0 +1,284 @@
+package board
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"qms/realtime-service/internal/hub"
+	"qms/realtime-service/internal/store"
+)
+
+type fakeLoader struct {
+	snapshot store.BoardSnapshot
+	loads    int
+}
+
+func (l *fakeLoader) LoadBoard(ctx context.Context, tenantID, branchID string, recent int) (store.BoardSnapshot, error) {
+	l.loads++
+	return l.snapshot, nil
+}
+
+var base = time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+
+func waiting(id, number, serviceID string, minute int) store.Ticket {
+	return store.Ticket{TicketID: id, TicketNumber: number, Status: "waiting", ServiceID: serviceID, AreaID: "a1", CreatedAt: base.Add(time.Duration(minute) * time.Minute)}
+}
+
+func subscribe(t *testing.T, h *hub.Hub, sub hub.Subscription) *hub.Client {
+	t.Helper()
+	client := hub.NewClient(sub.ID, sub.TenantID)
+	h.Register(client)
+	h.SetSubscriptions(client, []hub.Subscription{sub})
+	return client
+}
+
+func receive(t *testing.T, client *hub.Client, into any) hub.Message {
+	t.Helper()
+	select {
+	case msg := <-client.Send:
+		if !msg.Board {
+			t.Fatalf("expected board message, got %s", msg.Data)
+		}
+		if err := json.Unmarshal(msg.Data, into); err != nil {
+			t.Fatalf("decode %s: %v", msg.Data, err)
+		}
+		return msg
+	default:
+		t.Fatal("expected a board message")
+		return hub.Message{}
+	}
+}
+
+func TestAttachSendsSnapshotThenDiffs(t *testing.T) {
+	loader := &fakeLoader{snapshot: store.BoardSnapshot{
+		Seq:     5,
+		Tickets: []store.Ticket{waiting("t2", "A002", "s1", 2), waiting("t1", "A001", "s1", 1)},
+	}}
+	h := hub.New(hub.Options{})
+	p := New(loader, h)
+	sub := hub.Subscription{ID: "d1", TenantID: "ten", BranchID: "b1", Board: true}
+	client := subscribe(t, h, sub)
+
+	if err := p.Attach(context.Background(), client, sub); err != nil {
+		t.Fatalf("attach: %v", err)
+	}
+	var snapshot snapshotMessage
+	receive(t, client, &snapshot)
+	if snapshot.Type != "board.snapshot" || snapshot.Version != 5 || snapshot.State.WaitingCount != 2 {
+		t.Fatalf("unexpected snapshot %+v", snapshot)
+	}
+	if len(snapshot.State.NextUp) != 2 || snapshot.State.NextUp[0].TicketNumber != "A001" {
+		t.Fatalf("expected A001 next, got %+v", snapshot.State.NextUp)
+	}
+
+	calledAt := base.Add(10 * time.Minute)
+	p.Apply(store.OutboxEvent{Seq: 4, TenantID: "ten", Type: "ticket.called",
+		Payload: []byte(`{"ticket_id":"t2","status":"called","branch_id":"b1","counter_id":"c1"}`)})
+	p.Apply(store.OutboxEvent{Seq: 6, TenantID: "ten", Type: "ticket.called", CreatedAt: calledAt,
+		Payload: []byte(`{"ticket_id":"t1","ticket_number":"A001","status":"called","branch_id":"b1","service_id":"s1","area_id":"a1","counter_id":"c1","counter_name":"Counter 1","called_at":"2026-01-05T09:10:00Z"}`)})
+
+	var changes diffMessage
+	receive(t, client, &changes)
+	if changes.Type != "board.diff" || changes.From != 5 || changes.Version != 6 {
+		t.Fatalf("unexpected diff header %+v", changes)
+	}
+	call := changes.Changes.NowCalling["c1"]
+	if call == nil || call.TicketNumber != "A001" || call.CounterName != "Counter 1" || !call.CalledAt.Equal(calledAt) {
+		t.Fatalf("expected A001 at c1, got %+v", changes.Changes.NowCalling)
+	}
+	if changes.Changes.WaitingCount == nil || *changes.Changes.WaitingCount != 1 {
+		t.Fatalf("expected waiting count 1, got %+v", changes.Changes.WaitingCount)
+	}
+	if changes.Changes.Recent == nil || len(*changes.Changes.Recent) != 1 {
+		t.Fatalf("expected one recent call, got %+v", changes.Changes.Recent)
+	}
+	select {
+	case msg := <-client.Send:
+		t.Fatalf("stale event produced a message: %s", msg.Data)
+	default:
+	}
+
+	p.Apply(store.OutboxEvent{Seq: 7, TenantID: "ten", Type: "ticket.done",
+		Payload: []byte(`{"ticket_id":"t1","status":"done","branch_id":"b1","service_id":"s1","served_at":"2026-01-05T09:11:00Z","completed_at":"2026-01-05T09:13:00Z"}`)})
+	var done diffMessage
+	receive(t, client, &done)
+	if done.From != 6 || done.Version != 7 {
+		t.Fatalf("unexpected diff header %+v", done)
+	}
+	if call, ok := done.Changes.NowCalling["c1"]; !ok || call != nil {
+		t.Fatalf("expected c1 to be cleared, got %+v", done.Changes.NowCalling)
+	}
+	if queue := done.Changes.Services["s1"]; queue == nil || queue.ETASeconds != 240 {
+		t.Fatalf("expected ETA from the 120s service time, got %+v", done.Changes.Services)
+	}
+}
+
+func TestRenderFiltersAndEstimates(t *testing.T) {
+	calledAt := base.Add(5 * time.Minute)
+	b := newBranch(store.BoardSnapshot{
+		Tickets: []store.Ticket{
+			waiting("t1", "A001", "s1", 1),
+			waiting("t2", "A002", "s1", 2),
+			waiting("t3", "B001", "s2", 3),
+			{TicketID: "t4", TicketNumber: "A000", Status: "serving", ServiceID: "s1", AreaID: "a1", CounterID: "c1", CalledAt: &calledAt},
+			{TicketID: "t5", TicketNumber: "A009", Status: "called", ServiceID: "s1", AreaID: "a1", CounterID: "c2", CalledAt: &calledAt},
+		},
+		AvgServiceSeconds: map[string]float64{"s1": 120},
+	})
+
+	state := b.render(View{BranchID: "b1", ServiceID: "s1"}, base.Add(time.Hour))
+	if state.WaitingCount != 2 || len(state.NowCalling) != 2 {
+		t.Fatalf("unexpected state %+v", state)
+	}
+	if state.NextUp[0].ETASeconds != 60 || state.NextUp[1].ETASeconds != 120 {
+		t.Fatalf("expected ETAs over two counters, got %+v", state.NextUp)
+	}
+	if queue := state.Services["s1"]; queue.WaitingCount != 2 || queue.ETASeconds != 180 {
+		t.Fatalf("unexpected queue %+v", queue)
+	}
+	if _, ok := state.Services["s2"]; ok {
+		t.Fatal("service filter leaked s2")
+	}
+
+	all := b.render(View{BranchID: "b1"}, base.Add(time.Hour))
+	if queue := all.Services["s2"]; queue.ETASeconds != 2*defaultServiceSeconds {
+		t.Fatalf("expected default service time without counters, got %+v", queue)
+	}
+}
+
+func TestRenderOrdersLikeCallNext(t *testing.T) {
+	now := base.Add(time.Hour)
+	soon, later := now.Add(10*time.Minute), now.Add(2*time.Hour)
+	walkin := waiting("w1", "A001", "s1", 1)
+	walkin.PriorityClass = "regular"
+	priority := waiting("w2", "A002", "s1", 5)
+	priority.PriorityClass = "senior"
+	postponed := waiting("w3", "A003", "s1", 0)
+	postponed.QueuedAt = now.Add(30 * time.Minute)
+	boosted := waiting("a1", "A004", "s1", 20)
+	boosted.ScheduledAt = &soon
+	appointment := waiting("a2", "A005", "s1", 10)
+	appointment.ScheduledAt = &later
+	b := newBranch(store.BoardSnapshot{
+		Tickets: []store.Ticket{walkin, priority, postponed, boosted, appointment},
+		Routing: map[string]store.Routing{"s1": {AppointmentBoostMinutes: 15}},
+	})
+
+	state := b.render(View{BranchID: "b1"}, now)
+	var order []string
+	for _, next := range state.NextUp {
+		order = append(order, next.TicketNumber)
+	}
+	if got := strings.Join(order, ","); got != "A004,A002,A001,A005,A003" {
+		t.Fatalf("expected call order A004,A002,A001,A005,A003, got %s", got)
+	}
+}
+
+func TestETACountsPartySize(t *testing.T) {
+	family := waiting("t1", "A001", "s1", 1)
+	family.PartySize = 3
+	b := newBranch(store.BoardSnapshot{
+		Tickets:           []store.Ticket{family, waiting("t2", "A002", "s1", 2)},
+		AvgServiceSeconds: map[string]float64{"s1": 60},
+	})
+
+	state := b.render(View{BranchID: "b1"}, base.Add(time.Hour))
+	if state.NextUp[0].ETASeconds != 180 || state.NextUp[1].ETASeconds != 240 {
+		t.Fatalf("expected ETAs of 3 and 4 people, got %+v", state.NextUp)
+	}
+	if queue := state.Services["s1"]; queue.WaitingCount != 2 || queue.ETASeconds != 300 {
+		t.Fatalf("expected a new ticket behind 4 people, got %+v", queue)
+	}
+}
+
+func TestApplyUnloadsUnwatchedBranch(t *testing.T) {
+	loader := &fakeLoader{snapshot: store.BoardSnapshot{Seq: 1}}
+	h := hub.New(hub.Options{})
+	p := New(loader, h)
+	sub := hub.Subscription{ID: "d1", TenantID: "ten", BranchID: "b1", Board: true}
+	client := subscribe(t, h, sub)
+	if err := p.Attach(context.Background(), client, sub); err != nil {
+		t.Fatalf("attach: %v", err)
+	}
+	h.Unregister(client)
+
+	p.Apply(store.OutboxEvent{Seq: 2, TenantID: "ten", Type: "ticket.created",
+		Payload: []byte(`{"ticket_id":"t1","ticket_number":"A001","status":"waiting","branch_id":"b1","service_id":"s1"}`)})
+	if len(p.branches) != 0 {
+		t.Fatalf("expected branch to be unloaded, got %d", len(p.branches))
+	}
+
+	again := subscribe(t, h, sub)
+	if err := p.Attach(context.Background(), again, sub); err != nil {
+		t.Fatalf("attach: %v", err)
+	}
+	if loader.loads != 2 {
+		t.Fatalf("expected a reload, got %d loads", loader.loads)
+	}
+}
+
+func TestDisplayBoardsLeaveOutIDs(t *testing.T) {
+	loader := &fakeLoader{snapshot: store.BoardSnapshot{
+		Seq:     5,
+		Tickets: []store.Ticket{waiting("ticket-1", "A001", "service-1", 1), waiting("ticket-2", "A002", "service-1", 2)},
+	}}
+	h := hub.New(hub.Options{})
+	p := New(loader, h)
+	sub := hub.Subscription{ID: "d1", TenantID: "ten", BranchID: "b1", Board: true}
+	staff := subscribe(t, h, hub.Subscription{ID: "s1", TenantID: "ten", BranchID: "b1", Board: true})
+	display := hub.NewClient(sub.ID, sub.TenantID)
+	display.Shape = hub.ShapeDisplay
+	h.Register(display)
+	h.SetSubscriptions(display, []hub.Subscription{sub})
+
+	for _, client := range []*hub.Client{staff, display} {
+		if err := p.Attach(context.Background(), client, sub); err != nil {
+			t.Fatalf("attach: %v", err)
+		}
+	}
+	var full snapshotMessage
+	receive(t, staff, &full)
+	if full.State.NextUp[0].TicketID != "ticket-1" {
+		t.Fatalf("expected staff to get ticket ids, got %+v", full.State.NextUp)
+	}
+	var shown struct {
+		State struct {
+			NextUp   []map[string]any `json:"next_up"`
+			Services map[string]Queue `json:"services"`
+		} `json:"state"`
+	}
+	msg := receive(t, display, &shown)
+	assertNoIDs(t, msg.Data)
+	if len(shown.State.NextUp) != 2 || shown.State.NextUp[0]["ticket_number"] != "A001" {
+		t.Fatalf("expected A001 next on the display, got %+v", shown.State.NextUp)
+	}
+	if queue, ok := shown.State.Services[displayKey("service-1")]; !ok || queue.WaitingCount != 2 {
+		t.Fatalf("expected the service keyed by its display key, got %+v", shown.State.Services)
+	}
+
+	p.Apply(store.OutboxEvent{Seq: 6, TenantID: "ten", Type: "ticket.called", CreatedAt: base.Add(10 * time.Minute),
+		Payload: []byte(`{"ticket_id":"ticket-1","ticket_number":"A001","status":"called","branch_id":"b1","service_id":"service-1","area_id":"a1","counter_id":"counter-1","counter_name":"Counter 1","called_at":"2026-01-05T09:10:00Z"}`)})
+	receive(t, staff, &diffMessage{})
+	var changed struct {
+		Changes struct {
+			NowCalling map[string]map[string]any `json:"now_calling"`
+		} `json:"changes"`
+	}
+	msg = receive(t, display, &changed)
+	assertNoIDs(t, msg.Data)
+	if call := changed.Changes.NowCalling[displayKey("counter-1")]; call["ticket_number"] != "A001" || call["counter_name"] != "Counter 1" {
+		t.Fatalf("expected A001 at Counter 1 on the display, got %+v", changed.Changes.NowCalling)
+	}
+}
+
+func assertNoIDs(t *testing.T, data []byte) {
+	t.Helper()
+	for _, id := range []string{"ticket_id", "counter_id", "service_id", "ticket-1", "counter-1", "service-1"} {
+		if strings.Contains(string(data), id) {
+			t.Fatalf("expected no %q on a display board, got %s", id, data)
+		}
+	}
+}
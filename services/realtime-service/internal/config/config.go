@@ -13,6 +13,12 @@ type Config struct {
 	BatchSize   int
 	RateLimitPerMinute int
 	RateLimitBurst int
+	ConsumerName string
+	OutboxCleanup string
+	Listen bool
+	ReplaySize int
+	SlowClientMaxDrops int
+	RevalidateInterval time.Duration
 }
 
 func Load() Config {
@@ -24,10 +30,16 @@ func Load() Config {
 	return Config{
 		Port:        port,
 		DatabaseURL: os.Getenv("DB_DSN"),
-		PollInterval: readDurationSeconds("REALTIME_POLL_SECONDS", 1),
+		PollInterval: readDurationSeconds("REALTIME_POLL_SECONDS", 10),
 		BatchSize:   readInt("REALTIME_BATCH_SIZE", 100),
 		RateLimitPerMinute: readInt("REALTIME_RATE_LIMIT_PER_MIN", 120),
 		RateLimitBurst: readInt("REALTIME_RATE_LIMIT_BURST", 30),
+		ConsumerName: readString("REALTIME_CONSUMER_NAME", "realtime"),
+		OutboxCleanup: readString("REALTIME_OUTBOX_CLEANUP", "delete"),
+		Listen: readBool("REALTIME_LISTEN", true),
+		ReplaySize: readInt("REALTIME_REPLAY_SIZE", 500),
+		SlowClientMaxDrops: readInt("REALTIME_SLOW_CLIENT_MAX_DROPS", 100),
+		RevalidateInterval: readDurationSeconds("REALTIME_REVALIDATE_SECONDS", 60),
 	}
 }
 
@@ -39,6 +51,26 @@ func readDurationSeconds(key string, fallback int) time.Duration {
 	return time.Duration(value) * time.Second
 }
 
+func readBool(key string, fallback bool) bool {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func readString(key, fallback string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
 func readInt(key string, fallback int) int {
 	raw := os.Getenv(key)
 	if raw == "" {
@@ -0,0 +1,143 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"qms/realtime-service/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// deviceSeenInterval is how often last_seen is refreshed while a device
+// stays connected.
+const deviceSeenInterval = time.Minute
+
+// deviceTokenFromRequest reads a device token from "Authorization: Device
+// <token>" or, for SockJS and EventSource, the device_token query param.
+func deviceTokenFromRequest(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	if parts := strings.Fields(r.Header.Get("Authorization")); len(parts) == 2 && strings.EqualFold(parts[0], "device") {
+		return parts[1]
+	}
+	return strings.TrimSpace(r.URL.Query().Get("device_token"))
+}
+
+// authorizeDevice checks a "<device_id>.<secret>" token issued by
+// admin-service. A device sees its own branch only.
+func (rt *Realtime) authorizeDevice(token string) (viewer, *denial) {
+	deviceID, secret, ok := strings.Cut(token, ".")
+	if !ok || secret == "" {
+		return viewer{}, errInvalidDevice
+	}
+	if _, err := uuid.Parse(deviceID); err != nil {
+		return viewer{}, errInvalidDevice
+	}
+	device, err := rt.store.GetDevice(context.Background(), deviceID)
+	if errors.Is(err, store.ErrDeviceNotFound) {
+		return viewer{}, errInvalidDevice
+	}
+	if err != nil {
+		return viewer{}, errAccessLookup
+	}
+	sum := sha256.Sum256([]byte(secret))
+	if device.TokenHash == "" || subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(device.TokenHash)) != 1 {
+		return viewer{}, errInvalidDevice
+	}
+	return viewer{tenantID: device.TenantID, device: &device, branches: []string{device.BranchID}}, nil
+}
+
+// deviceState tracks one device's connections to this replica. conns is
+// guarded by devicesMu; mu serialises the device's status writes so they
+// need not hold devicesMu, and guards seen, the last_seen this replica wrote.
+type deviceState struct {
+	conns int
+	mu    sync.Mutex
+	seen  time.Time
+}
+
+// deviceConnected marks a device online and returns the func that marks it
+// offline again once its last connection has closed. While connected,
+// last_seen is refreshed every deviceSeenInterval.
+func (rt *Realtime) deviceConnected(deviceID string) func() {
+	rt.devicesMu.Lock()
+	device := rt.devices[deviceID]
+	if device == nil {
+		// Entries are kept once made: a replica only ever sees the
+		// devices of the branches it serves.
+		device = &deviceState{}
+		rt.devices[deviceID] = device
+	}
+	device.conns++
+	first := device.conns == 1
+	rt.devicesMu.Unlock()
+	if first {
+		rt.syncDeviceStatus(deviceID, device)
+	}
+
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(deviceSeenInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				rt.syncDeviceStatus(deviceID, device)
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		rt.devicesMu.Lock()
+		device.conns--
+		last := device.conns == 0
+		rt.devicesMu.Unlock()
+		if last {
+			rt.syncDeviceStatus(deviceID, device)
+		}
+	}
+}
+
+// syncDeviceStatus writes the device's current state rather than the change
+// that triggered it, so writes that queue up on device.mu still end with the
+// latest one. Another replica may hold a connection of the same device, so
+// offline is only written if nobody has seen the device since this replica
+// last did; that replica's next refresh puts it back online otherwise.
+func (rt *Realtime) syncDeviceStatus(deviceID string, device *deviceState) {
+	device.mu.Lock()
+	defer device.mu.Unlock()
+	rt.devicesMu.Lock()
+	online := device.conns > 0
+	rt.devicesMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if online {
+		seen, err := rt.store.SetDeviceOnline(ctx, deviceID)
+		if err != nil {
+			log.Printf("set device %s online: %v", deviceID, err)
+			return
+		}
+		device.seen = seen
+		return
+	}
+	if device.seen.IsZero() {
+		return
+	}
+	if err := rt.store.SetDeviceOffline(ctx, deviceID, device.seen); err != nil {
+		log.Printf("set device %s offline: %v", deviceID, err)
+	}
+}
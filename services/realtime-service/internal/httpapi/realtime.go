@@ -0,0 +1,702 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"qms/realtime-service/internal/board"
+	"qms/realtime-service/internal/hub"
+	"qms/realtime-service/internal/store"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/igm/sockjs-go/sockjs"
+)
+
+// keepaliveInterval keeps idle WebSocket and SSE connections open through
+// proxies that drop silent streams.
+const keepaliveInterval = 25 * time.Second
+
+// snapshotLimit bounds the open tickets sent in a subscribe snapshot.
+const snapshotLimit = 1000
+
+// Realtime serves the hub over SockJS (/realtime), plain WebSocket (/ws)
+// and Server-Sent Events (/sse). All three authenticate the same way and
+// route events through the same subscriptions.
+type Realtime struct {
+	store    store.Store
+	hub      *hub.Hub
+	boards   *board.Projection
+	upgrader websocket.Upgrader
+
+	devicesMu sync.Mutex
+	devices   map[string]*deviceState
+
+	watchMu  sync.Mutex
+	watching map[*watched]struct{}
+}
+
+func NewRealtime(store store.Store, h *hub.Hub, boards *board.Projection) *Realtime {
+	return &Realtime{
+		store:  store,
+		hub:    h,
+		boards: boards,
+		// Auth is by session token rather than cookie, so cross-origin
+		// display hardware and integrations are allowed, as with SockJS.
+		upgrader: websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }},
+		devices:  make(map[string]*deviceState),
+		watching: make(map[*watched]struct{}),
+	}
+}
+
+func (rt *Realtime) Register(mux *http.ServeMux) {
+	mux.Handle("/realtime/", sockjs.NewHandler("/realtime", sockjs.DefaultOptions, func(session sockjs.Session) {
+		rt.serveConn(session, session.Request())
+	}))
+	mux.HandleFunc("/ws", rt.serveWebSocket)
+	mux.HandleFunc("/sse", rt.serveSSE)
+}
+
+// conn is the bidirectional transport shared by SockJS and WebSocket;
+// sockjs.Session satisfies it directly.
+type conn interface {
+	Send(msg string) error
+	Recv() (string, error)
+	Close(status uint32, reason string) error
+}
+
+type viewer struct {
+	tenantID string
+	session  store.Session
+	// device is set instead of session for a device connection; its
+	// subscriptions are pinned to the device's branch and area.
+	device   *store.Device
+	branches []string
+	services []string
+}
+
+// fullPayloadRoles see event payloads as written to the outbox. Other roles
+// and every device get hub.ShapeDisplay.
+var fullPayloadRoles = map[string]bool{"admin": true, "supervisor": true, "agent": true}
+
+func (v viewer) shape() hub.Shape {
+	if v.device == nil && fullPayloadRoles[strings.ToLower(strings.TrimSpace(v.session.Role))] {
+		return hub.ShapeFull
+	}
+	return hub.ShapeDisplay
+}
+
+// denial is an authorization failure. Code is the close code for SockJS and
+// WebSocket clients, status the HTTP status for SSE clients.
+type denial struct {
+	code   uint32
+	status int
+	reason string
+}
+
+var (
+	errMissingSession = &denial{code: 4001, status: http.StatusUnauthorized, reason: "missing session"}
+	errInvalidSession = &denial{code: 4002, status: http.StatusUnauthorized, reason: "invalid session"}
+	errInvalidDevice  = &denial{code: 4002, status: http.StatusUnauthorized, reason: "invalid device token"}
+	errAccessLookup   = &denial{code: 4003, status: http.StatusInternalServerError, reason: "access lookup failed"}
+	errAccessDenied   = &denial{code: 4003, status: http.StatusForbidden, reason: "access denied"}
+
+	errTooManySubscriptions = &denial{code: 4004, status: http.StatusBadRequest, reason: "too many subscriptions"}
+	errInvalidBoard         = &denial{code: 4005, status: http.StatusBadRequest, reason: "board requires branch_id"}
+	errBoardUnavailable     = &denial{code: 1011, status: http.StatusServiceUnavailable, reason: "board unavailable"}
+	errSnapshotUnavailable  = &denial{code: 1011, status: http.StatusServiceUnavailable, reason: "snapshot unavailable"}
+	errSlowConsumer         = &denial{code: 4008, reason: "slow consumer"}
+
+	// Revalidation and revocation close connections that are already
+	// streaming, so they have no HTTP status.
+	errSessionEnded   = &denial{code: 4006, reason: "session ended"}
+	errDeviceRevoked  = &denial{code: 4006, reason: "device token revoked"}
+	errAccessRevoked  = &denial{code: 4007, reason: "access revoked"}
+	errSessionRevoked = &denial{code: 4009, reason: "session revoked"}
+)
+
+func (rt *Realtime) authorize(r *http.Request) (viewer, *denial) {
+	if token := deviceTokenFromRequest(r); token != "" {
+		return rt.authorizeDevice(token)
+	}
+	sessionID := sessionIDFromRequest(r)
+	if sessionID == "" {
+		return viewer{}, errMissingSession
+	}
+	session, err := rt.store.GetSession(context.Background(), sessionID)
+	if err != nil {
+		return viewer{}, errInvalidSession
+	}
+	branches, services, err := rt.store.GetAccess(context.Background(), session.UserID)
+	if err != nil {
+		return viewer{}, errAccessLookup
+	}
+	return viewer{tenantID: session.TenantID, session: session, branches: branches, services: services}, nil
+}
+
+// serveConn runs the subscribe/unsubscribe protocol on a SockJS or
+// WebSocket connection until the client goes away.
+func (rt *Realtime) serveConn(c conn, r *http.Request) {
+	v, denied := rt.authorize(r)
+	if denied != nil {
+		_ = c.Close(denied.code, denied.reason)
+		return
+	}
+	if v.device != nil {
+		defer rt.deviceConnected(v.device.DeviceID)()
+	}
+
+	client := hub.NewClient(uuid.NewString(), v.tenantID)
+	client.Shape = v.shape()
+	rt.hub.Register(client)
+	defer rt.hub.Unregister(client)
+	watch, unwatch := rt.watch(client, v)
+	defer unwatch()
+
+	go func() {
+		write := func(msg hub.Message) error { return c.Send(string(msg.Data)) }
+		out := &sender{
+			client:   client,
+			write:    write,
+			snapshot: write,
+			resync:   func(from int64) error { return c.Send(string(resyncMessage(from))) },
+		}
+		for {
+			select {
+			case <-client.Evicted():
+				_ = c.Close(errSlowConsumer.code, errSlowConsumer.reason)
+				return
+			case denied := <-watch.closed:
+				_ = c.Close(denied.code, denied.reason)
+				return
+			case replay := <-client.Replay:
+				_ = out.replay(replay)
+			case msg, ok := <-client.Send:
+				if !ok {
+					return
+				}
+				_ = out.live(msg)
+			}
+		}
+	}()
+
+	for {
+		msg, err := c.Recv()
+		if err != nil {
+			return
+		}
+		parsed, ok := hub.ParseSubscribe([]byte(msg))
+		if !ok {
+			continue
+		}
+		switch parsed.Action {
+		case "unsubscribe":
+			rt.hub.SetSubscriptions(client, nil)
+		case "remove":
+			rt.hub.RemoveSubscription(client, parsed.ID)
+		case "add":
+			sub, denied := rt.subscription(watch.current(), parsed.Filters()[0])
+			if denied != nil {
+				_ = c.Close(denied.code, denied.reason)
+				return
+			}
+			if !rt.hub.AddSubscription(client, sub) {
+				_ = c.Close(errTooManySubscriptions.code, errTooManySubscriptions.reason)
+				return
+			}
+			if denied := rt.attachBoards(client, []hub.Subscription{sub}); denied != nil {
+				_ = c.Close(denied.code, denied.reason)
+				return
+			}
+		case "subscribe":
+			filters := parsed.Filters()
+			if len(filters) > hub.MaxSubscriptions {
+				_ = c.Close(errTooManySubscriptions.code, errTooManySubscriptions.reason)
+				return
+			}
+			v := watch.current()
+			subs := make([]hub.Subscription, 0, len(filters))
+			for _, filter := range filters {
+				sub, denied := rt.subscription(v, filter)
+				if denied != nil {
+					_ = c.Close(denied.code, denied.reason)
+					return
+				}
+				subs = append(subs, sub)
+			}
+			if parsed.ResumeFrom > 0 {
+				rt.hub.Resume(client, subs, parsed.ResumeFrom)
+			} else if denied := rt.subscribeWithSnapshot(client, v, subs); denied != nil {
+				_ = c.Close(denied.code, denied.reason)
+				return
+			}
+			if denied := rt.attachBoards(client, subs); denied != nil {
+				_ = c.Close(denied.code, denied.reason)
+				return
+			}
+		}
+	}
+}
+
+// subscribeWithSnapshot sets client's subscriptions and sends it the open
+// tickets in their scope, so events that follow apply on top of a known
+// state. Board subscriptions get their own snapshot from attachBoards.
+func (rt *Realtime) subscribeWithSnapshot(client *hub.Client, v viewer, subs []hub.Subscription) *denial {
+	var branchIDs []string
+	scoped := false
+	for _, sub := range subs {
+		if sub.Board {
+			continue
+		}
+		scoped = true
+		if sub.BranchID == "" {
+			// One subscription spans all branches, so load them all.
+			branchIDs = nil
+			break
+		}
+		if !contains(branchIDs, sub.BranchID) {
+			branchIDs = append(branchIDs, sub.BranchID)
+		}
+	}
+	if !scoped {
+		rt.hub.SetSubscriptions(client, subs)
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	snapshot, err := rt.store.LoadTickets(ctx, v.tenantID, branchIDs, snapshotLimit)
+	if err != nil {
+		log.Printf("load snapshot for tenant %s: %v", v.tenantID, err)
+		return errSnapshotUnavailable
+	}
+	rt.hub.Snapshot(client, subs, hub.SnapshotMessage(snapshot, subs))
+	return nil
+}
+
+// subscription scopes filter to the viewer's tenant and checks it against
+// their branch and service access; a device's branch and area fill in
+// missing filters and may not be changed. A subscription without an id is
+// keyed by its filters, so it can be removed by repeating them.
+func (rt *Realtime) subscription(v viewer, filter hub.FilterInput) (hub.Subscription, *denial) {
+	sub := hub.Subscription{
+		ID:        filter.ID,
+		TenantID:  v.tenantID,
+		BranchID:  strings.TrimSpace(filter.BranchID),
+		ServiceID: strings.TrimSpace(filter.ServiceID),
+		AreaID:    strings.TrimSpace(filter.AreaID),
+		Types:     filter.Types,
+		Board:     filter.Board,
+	}
+	if v.device != nil {
+		if sub.BranchID == "" {
+			sub.BranchID = v.device.BranchID
+		}
+		if sub.AreaID == "" {
+			sub.AreaID = v.device.AreaID
+		}
+		if v.device.AreaID != "" && sub.AreaID != v.device.AreaID {
+			return hub.Subscription{}, errAccessDenied
+		}
+	}
+	if sub.ID == "" {
+		sub.ID = strings.Join([]string{sub.BranchID, sub.ServiceID, sub.AreaID, strings.Join(sub.Types, ","), strconv.FormatBool(sub.Board)}, "/")
+	}
+	if sub.Board && (sub.BranchID == "" || rt.boards == nil) {
+		return hub.Subscription{}, errInvalidBoard
+	}
+	if !isAllowed(sub.BranchID, sub.ServiceID, v.branches, v.services) {
+		return hub.Subscription{}, errAccessDenied
+	}
+	return sub, nil
+}
+
+// attachBoards sends the board snapshot of each board subscription. The
+// subscriptions must already be in the hub.
+func (rt *Realtime) attachBoards(client *hub.Client, subs []hub.Subscription) *denial {
+	for _, sub := range subs {
+		if !sub.Board {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := rt.boards.Attach(ctx, client, sub)
+		cancel()
+		if err != nil {
+			log.Printf("board attach %s: %v", sub.BoardKey(), err)
+			return errBoardUnavailable
+		}
+	}
+	return nil
+}
+
+// sender writes one client's stream. A replay queued by Resume is written
+// before any live message broadcast after it, and seq never goes
+// backwards, so events resent by the replay are not delivered twice. After
+// a snapshot, events it already reflects are skipped the same way.
+type sender struct {
+	client   *hub.Client
+	sent     int64
+	write    func(hub.Message) error
+	snapshot func(hub.Message) error
+	resync   func(from int64) error
+}
+
+func (s *sender) replay(replay hub.Replay) error {
+	if replay.Lagged {
+		// The hub queues no events after the lag starts, so what is left
+		// in Send comes before the gap. Deliver it, then ask the client to
+		// resume from the last event it got.
+		for len(s.client.Send) > 0 {
+			msg, ok := <-s.client.Send
+			if !ok {
+				break
+			}
+			if err := s.send(msg); err != nil {
+				return err
+			}
+		}
+		return s.resync(s.sent)
+	}
+	s.sent = replay.From
+	if replay.Resync {
+		return s.resync(replay.From)
+	}
+	if replay.Snapshot != nil {
+		if err := s.snapshot(*replay.Snapshot); err != nil {
+			return err
+		}
+	}
+	for _, msg := range replay.Messages {
+		if err := s.send(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sender) live(msg hub.Message) error {
+	select {
+	case replay := <-s.client.Replay:
+		if err := s.replay(replay); err != nil {
+			return err
+		}
+	default:
+	}
+	return s.send(msg)
+}
+
+func (s *sender) send(msg hub.Message) error {
+	if msg.Board {
+		return s.write(msg)
+	}
+	if msg.Seq <= s.sent {
+		return nil
+	}
+	if err := s.write(msg); err != nil {
+		return err
+	}
+	s.sent = msg.Seq
+	return nil
+}
+
+// resyncMessage tells a resuming client that events after from are no
+// longer buffered and it must reload its snapshot.
+func resyncMessage(from int64) []byte {
+	return []byte(fmt.Sprintf(`{"type":"resync_required","resume_from":%d}`, from))
+}
+
+// revokedMessage tells an SSE client why its stream ended; SockJS and
+// WebSocket clients get the same code and reason as the close frame.
+func revokedMessage(denied *denial) []byte {
+	return []byte(fmt.Sprintf(`{"type":"revoked","code":%d,"reason":%q}`, denied.code, denied.reason))
+}
+
+func (rt *Realtime) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	ws, err := rt.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already written the error response.
+		return
+	}
+	c := &wsConn{ws: ws, done: make(chan struct{})}
+	go c.keepalive()
+	defer c.Close(websocket.CloseNormalClosure, "")
+	rt.serveConn(c, r)
+}
+
+// wsConn adapts a gorilla connection to conn. Writes come from the send
+// pump only; close and ping frames go through WriteControl, which is safe
+// to call concurrently with it.
+type wsConn struct {
+	ws   *websocket.Conn
+	done chan struct{}
+	once sync.Once
+}
+
+func (c *wsConn) Send(msg string) error {
+	_ = c.ws.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return c.ws.WriteMessage(websocket.TextMessage, []byte(msg))
+}
+
+func (c *wsConn) Recv() (string, error) {
+	for {
+		kind, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return "", err
+		}
+		if kind == websocket.TextMessage {
+			return string(data), nil
+		}
+	}
+}
+
+func (c *wsConn) Close(status uint32, reason string) error {
+	var err error
+	c.once.Do(func() {
+		close(c.done)
+		deadline := time.Now().Add(time.Second)
+		_ = c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(int(status), reason), deadline)
+		err = c.ws.Close()
+	})
+	return err
+}
+
+// keepalive pings the client and drops the connection when pongs stop.
+func (c *wsConn) keepalive() {
+	_ = c.ws.SetReadDeadline(time.Now().Add(2 * keepaliveInterval))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(2 * keepaliveInterval))
+	})
+	ticker := time.NewTicker(keepaliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// serveSSE streams events as text/event-stream. EventSource cannot send
+// messages, so subscriptions come from the query: branch_id, area_id and
+// types (comma-separated) apply to each service_id, which may repeat for
+// one subscription per service. Each event id is its outbox seq; on reconnect the
+// browser sends it back as Last-Event-ID, which resumes like resume_from.
+// With board=true the stream carries "board" events for the branch instead.
+func (rt *Realtime) serveSSE(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	v, denied := rt.authorize(r)
+	if denied != nil {
+		http.Error(w, denied.reason, denied.status)
+		return
+	}
+	if v.device != nil {
+		defer rt.deviceConnected(v.device.DeviceID)()
+	}
+	subs, denied := rt.sseSubscriptions(v, r.URL.Query())
+	if denied != nil {
+		http.Error(w, denied.reason, denied.status)
+		return
+	}
+	lastID, err := lastEventID(r)
+	if err != nil {
+		http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+		return
+	}
+
+	client := hub.NewClient(uuid.NewString(), v.tenantID)
+	client.Shape = v.shape()
+	rt.hub.Register(client)
+	defer rt.hub.Unregister(client)
+	watch, unwatch := rt.watch(client, v)
+	defer unwatch()
+	if lastID > 0 {
+		rt.hub.Resume(client, subs, lastID)
+	} else if denied := rt.subscribeWithSnapshot(client, v, subs); denied != nil {
+		http.Error(w, denied.reason, denied.status)
+		return
+	}
+	if denied := rt.attachBoards(client, subs); denied != nil {
+		http.Error(w, denied.reason, denied.status)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// The server's WriteTimeout would otherwise end the stream.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("sse clear write deadline: %v", err)
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := fmt.Fprint(w, "retry: 3000\n\n"); err != nil {
+		return
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+	out := &sender{
+		client: client,
+		write:  func(msg hub.Message) error { return writeSSE(w, msg) },
+		snapshot: func(msg hub.Message) error {
+			_, err := fmt.Fprintf(w, "id: %d\nevent: snapshot\ndata: %s\n\n", msg.Seq, msg.Data)
+			return err
+		},
+		resync: func(from int64) error {
+			_, err := fmt.Fprintf(w, "event: resync\ndata: %s\n\n", resyncMessage(from))
+			return err
+		},
+	}
+	ticker := time.NewTicker(keepaliveInterval)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-client.Evicted():
+			// EventSource reconnects with Last-Event-ID and resumes.
+			return
+		case denied := <-watch.closed:
+			// The reconnect fails authorization, which stops EventSource.
+			_, _ = fmt.Fprintf(w, "event: revoked\ndata: %s\n\n", revokedMessage(denied))
+			_ = rc.Flush()
+			return
+		case replay := <-client.Replay:
+			err = out.replay(replay)
+		case msg, ok := <-client.Send:
+			if !ok {
+				return
+			}
+			err = out.live(msg)
+		case <-ticker.C:
+			_, err = fmt.Fprint(w, ": ping\n\n")
+		}
+		if err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (rt *Realtime) sseSubscriptions(v viewer, query url.Values) ([]hub.Subscription, *denial) {
+	var types []string
+	for _, item := range strings.Split(query.Get("types"), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			types = append(types, item)
+		}
+	}
+	serviceIDs := query["service_id"]
+	if len(serviceIDs) == 0 {
+		serviceIDs = []string{""}
+	}
+	if len(serviceIDs) > hub.MaxSubscriptions {
+		return nil, errTooManySubscriptions
+	}
+	subs := make([]hub.Subscription, 0, len(serviceIDs))
+	for _, serviceID := range serviceIDs {
+		sub, denied := rt.subscription(v, hub.FilterInput{
+			BranchID:  query.Get("branch_id"),
+			ServiceID: serviceID,
+			AreaID:    query.Get("area_id"),
+			Types:     types,
+			Board:     query.Get("board") == "true",
+		})
+		if denied != nil {
+			return nil, denied
+		}
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+// writeSSE writes an event with its seq as the id. Board messages are a
+// separate event type without an id, so they do not move Last-Event-ID.
+func writeSSE(w http.ResponseWriter, msg hub.Message) error {
+	if msg.Board {
+		_, err := fmt.Fprintf(w, "event: board\ndata: %s\n\n", msg.Data)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "id: %d\ndata: %s\n\n", msg.Seq, msg.Data)
+	return err
+}
+
+// lastEventID reads the browser's Last-Event-ID header, or the
+// last_event_id query parameter for clients that cannot set headers.
+func lastEventID(r *http.Request) (int64, error) {
+	raw := strings.TrimSpace(r.Header.Get("Last-Event-ID"))
+	if raw == "" {
+		raw = strings.TrimSpace(r.URL.Query().Get("last_event_id"))
+	}
+	if raw == "" {
+		return 0, nil
+	}
+	seq, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || seq < 0 {
+		return 0, fmt.Errorf("invalid event id %q", raw)
+	}
+	return seq, nil
+}
+
+func sessionIDFromRequest(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	if token := bearerToken(r.Header.Get("Authorization")); token != "" {
+		return token
+	}
+	return strings.TrimSpace(r.URL.Query().Get("session_id"))
+}
+
+func bearerToken(header string) string {
+	if header == "" {
+		return ""
+	}
+	parts := strings.Fields(header)
+	if len(parts) != 2 {
+		return ""
+	}
+	if strings.ToLower(parts[0]) != "bearer" {
+		return ""
+	}
+	return parts[1]
+}
+
+func isAllowed(branchID, serviceID string, branches, services []string) bool {
+	if len(branches) > 0 {
+		if branchID == "" || !contains(branches, branchID) {
+			return false
+		}
+	}
+	if len(services) > 0 {
+		if serviceID == "" || !contains(services, serviceID) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,507 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"qms/realtime-service/internal/board"
+	"qms/realtime-service/internal/hub"
+	"qms/realtime-service/internal/store"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestIsAllowed(t *testing.T) {
+	tests := []struct {
+		name      string
+		branchID  string
+		serviceID string
+		branches  []string
+		services  []string
+		want      bool
+	}{
+		{"no restrictions", "b1", "s1", nil, nil, true},
+		{"branch allowed", "b1", "s1", []string{"b1"}, nil, true},
+		{"branch denied", "b2", "s1", []string{"b1"}, nil, false},
+		{"service allowed", "b1", "s1", nil, []string{"s1"}, true},
+		{"service denied", "b1", "s2", nil, []string{"s1"}, false},
+		{"both allowed", "b1", "s1", []string{"b1"}, []string{"s1"}, true},
+		{"missing branch", "", "s1", []string{"b1"}, nil, false},
+		{"missing service", "b1", "", nil, []string{"s1"}, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isAllowed(tc.branchID, tc.serviceID, tc.branches, tc.services); got != tc.want {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+type fakeStore struct {
+	store.Store
+
+	mu       sync.Mutex
+	statuses []string
+	// ended and branches change what revalidation finds.
+	ended    bool
+	branches []string
+}
+
+const testDeviceID = "0b5d2c1e-7f7a-4a43-9a55-6a7c1f0e2d11"
+
+func (f *fakeStore) GetDevice(ctx context.Context, deviceID string) (store.Device, error) {
+	if deviceID != testDeviceID {
+		return store.Device{}, store.ErrDeviceNotFound
+	}
+	sum := sha256.Sum256([]byte("secret"))
+	return store.Device{DeviceID: deviceID, TenantID: "t1", BranchID: "b1", AreaID: "a1", Type: "display", TokenHash: hex.EncodeToString(sum[:])}, nil
+}
+
+func (f *fakeStore) SetDeviceOnline(ctx context.Context, deviceID string) (time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statuses = append(f.statuses, "online")
+	return time.Now(), nil
+}
+
+func (f *fakeStore) SetDeviceOffline(ctx context.Context, deviceID string, seenAt time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statuses = append(f.statuses, "offline")
+	return nil
+}
+
+func (f *fakeStore) GetSession(ctx context.Context, sessionID string) (store.Session, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if sessionID != "s1" || f.ended {
+		return store.Session{}, store.ErrSessionNotFound
+	}
+	return store.Session{SessionID: "s1", UserID: "u1", TenantID: "t1", Role: "agent"}, nil
+}
+
+func (f *fakeStore) GetAccess(ctx context.Context, userID string) ([]string, []string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.branches != nil {
+		return f.branches, nil, nil
+	}
+	return []string{"b1"}, nil, nil
+}
+
+func (f *fakeStore) LoadBoard(ctx context.Context, tenantID, branchID string, recent int) (store.BoardSnapshot, error) {
+	return store.BoardSnapshot{Seq: 7, Tickets: []store.Ticket{{TicketID: "x1", TicketNumber: "A001", Status: "waiting", ServiceID: "svc"}}}, nil
+}
+
+func (f *fakeStore) LoadTickets(ctx context.Context, tenantID string, branchIDs []string, limit int) (store.TicketSnapshot, error) {
+	return store.TicketSnapshot{Seq: 5, Tickets: []store.Ticket{
+		{TicketID: "k1", TicketNumber: "A001", Status: "waiting", BranchID: "b1", ServiceID: "svc"},
+		{TicketID: "k2", TicketNumber: "A002", Status: "waiting", BranchID: "b2", ServiceID: "svc"},
+	}}, nil
+}
+
+func broadcast(h *hub.Hub, seq int64, tenantID, branchID string) {
+	payload := []byte(`{"branch_id":"` + branchID + `"}`)
+	h.Broadcast(hub.EventMessage(store.OutboxEvent{Seq: seq, TenantID: tenantID, Type: "ticket.called", Payload: payload}))
+}
+
+func readSSE(t *testing.T, server *httptest.Server, query, lastID string, want int) []string {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/sse?"+query, nil)
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return []string{resp.Status}
+	}
+	var lines []string
+	scanner := bufio.NewScanner(resp.Body)
+	for len(lines) < want && scanner.Scan() {
+		if line := scanner.Text(); line != "" && !strings.HasPrefix(line, "retry:") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func TestSSEReplaysFromLastEventID(t *testing.T) {
+	h := hub.New(hub.Options{ReplaySize: 2})
+	broadcast(h, 1, "t1", "b1")
+	broadcast(h, 2, "t2", "b1")
+	broadcast(h, 3, "t1", "b2")
+	broadcast(h, 4, "t1", "b1")
+	mux := http.NewServeMux()
+	NewRealtime(&fakeStore{}, h, nil).Register(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	lines := readSSE(t, server, "session_id=s1&branch_id=b1", "1", 2)
+	if len(lines) != 2 || lines[0] != "id: 4" || !strings.Contains(lines[1], `"seq":4`) {
+		t.Fatalf("expected only seq 4 to be replayed, got %q", lines)
+	}
+
+	broadcast(h, 5, "t1", "b2")
+	lines = readSSE(t, server, "session_id=s1&branch_id=b1", "1", 2)
+	if len(lines) != 2 || lines[0] != "event: resync" || !strings.Contains(lines[1], `"resume_from":1`) {
+		t.Fatalf("expected resync once seq 3 left the buffer, got %q", lines)
+	}
+
+	lines = readSSE(t, server, "session_id=s1&branch_id=b1", "", 3)
+	if len(lines) != 3 || lines[0] != "id: 5" || lines[1] != "event: snapshot" || !strings.Contains(lines[2], `"ticket_id":"k1"`) {
+		t.Fatalf("expected a snapshot without Last-Event-ID, got %q", lines)
+	}
+
+	if lines := readSSE(t, server, "session_id=s1&branch_id=b2x", "", 1); lines[0] != "403 Forbidden" {
+		t.Fatalf("expected forbidden branch to be rejected, got %q", lines)
+	}
+	if lines := readSSE(t, server, "session_id=bad", "", 1); lines[0] != "401 Unauthorized" {
+		t.Fatalf("expected invalid session to be rejected, got %q", lines)
+	}
+}
+
+func TestWebSocketSubscribeAndBroadcast(t *testing.T) {
+	h := hub.New(hub.Options{ReplaySize: 10})
+	mux := http.NewServeMux()
+	NewRealtime(&fakeStore{}, h, nil).Register(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?session_id=s1"
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer ws.Close()
+	if err := ws.WriteMessage(websocket.TextMessage, []byte(`{"action":"subscribe","branch_id":"b1"}`)); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	_ = ws.SetReadDeadline(time.Now().Add(time.Second))
+	_, data, err := ws.ReadMessage()
+	if err != nil || !strings.Contains(string(data), `"type":"snapshot","tickets":[{"ticket_id":"k1"`) || strings.Contains(string(data), "k2") {
+		t.Fatalf("expected a snapshot of the b1 tickets, got %s (%v)", data, err)
+	}
+
+	// Seq 4 is already in the snapshot taken at seq 5.
+	broadcast(h, 4, "t1", "b1")
+	broadcast(h, 7, "t1", "b1")
+	if _, data, err := ws.ReadMessage(); err != nil || !strings.Contains(string(data), `"seq":7`) {
+		t.Fatalf("expected the event after the snapshot, got %s (%v)", data, err)
+	}
+}
+
+func TestWebSocketRejectsInvalidSession(t *testing.T) {
+	mux := http.NewServeMux()
+	NewRealtime(&fakeStore{}, hub.New(hub.Options{}), nil).Register(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?session_id=bad"
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer ws.Close()
+	_, _, err = ws.ReadMessage()
+	if !websocket.IsCloseError(err, 4002) {
+		t.Fatalf("expected close code 4002, got %v", err)
+	}
+}
+
+func TestWebSocketResumeReplaysBeforeLive(t *testing.T) {
+	h := hub.New(hub.Options{ReplaySize: 10})
+	for seq := int64(1); seq <= 3; seq++ {
+		broadcast(h, seq, "t1", "b1")
+	}
+	mux := http.NewServeMux()
+	NewRealtime(&fakeStore{}, h, nil).Register(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?session_id=s1"
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer ws.Close()
+	if err := ws.WriteMessage(websocket.TextMessage, []byte(`{"action":"subscribe","branch_id":"b1","resume_from":1}`)); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	_ = ws.SetReadDeadline(time.Now().Add(time.Second))
+	for _, want := range []string{`"seq":2`, `"seq":3`} {
+		_, data, err := ws.ReadMessage()
+		if err != nil || !strings.Contains(string(data), want) {
+			t.Fatalf("expected %s, got %s (%v)", want, data, err)
+		}
+	}
+	broadcast(h, 4, "t1", "b1")
+	if _, data, err := ws.ReadMessage(); err != nil || !strings.Contains(string(data), `"seq":4`) {
+		t.Fatalf("expected live seq 4 after the replay, got %s (%v)", data, err)
+	}
+}
+
+func TestWebSocketAddAndRemoveSubscriptions(t *testing.T) {
+	h := hub.New(hub.Options{ReplaySize: 10})
+	mux := http.NewServeMux()
+	NewRealtime(&fakeStore{}, h, nil).Register(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?session_id=s1"
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer ws.Close()
+	for _, msg := range []string{
+		`{"action":"add","id":"floor1","branch_id":"b1","area_id":"a1"}`,
+		`{"action":"add","id":"calls","branch_id":"b1","types":["ticket.called"]}`,
+		`{"action":"remove","id":"floor1"}`,
+	} {
+		if err := ws.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	h.Broadcast(hub.EventMessage(store.OutboxEvent{Seq: 2, TenantID: "t1", Type: "ticket.created", Payload: []byte(`{"branch_id":"b1","area_id":"a1"}`)}))
+	h.Broadcast(hub.EventMessage(store.OutboxEvent{Seq: 3, TenantID: "t1", Type: "ticket.called", Payload: []byte(`{"branch_id":"b1","area_id":"a2"}`)}))
+	_ = ws.SetReadDeadline(time.Now().Add(time.Second))
+	if _, data, err := ws.ReadMessage(); err != nil || !strings.Contains(string(data), `"seq":3`) {
+		t.Fatalf("expected only the ticket.called event, got %s (%v)", data, err)
+	}
+
+	if err := ws.WriteMessage(websocket.TextMessage, []byte(`{"action":"add","branch_id":"b2"}`)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, _, err := ws.ReadMessage(); !websocket.IsCloseError(err, 4003) {
+		t.Fatalf("expected close code 4003 for a branch outside access, got %v", err)
+	}
+}
+
+func TestWebSocketBoardSnapshotThenDiff(t *testing.T) {
+	h := hub.New(hub.Options{ReplaySize: 10})
+	boards := board.New(&fakeStore{}, h)
+	mux := http.NewServeMux()
+	NewRealtime(&fakeStore{}, h, boards).Register(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?session_id=s1"
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer ws.Close()
+	if err := ws.WriteMessage(websocket.TextMessage, []byte(`{"action":"subscribe","subscriptions":[{"id":"board","branch_id":"b1","board":true}]}`)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	_ = ws.SetReadDeadline(time.Now().Add(time.Second))
+	if _, data, err := ws.ReadMessage(); err != nil || !strings.Contains(string(data), `"type":"board.snapshot"`) || !strings.Contains(string(data), `"waiting_count":1`) {
+		t.Fatalf("expected a board snapshot, got %s (%v)", data, err)
+	}
+
+	event := store.OutboxEvent{Seq: 8, TenantID: "t1", Type: "ticket.called", Payload: []byte(`{"ticket_id":"x1","status":"called","branch_id":"b1","service_id":"svc","counter_id":"c1"}`)}
+	h.Broadcast(hub.EventMessage(event))
+	boards.Apply(event)
+	if _, data, err := ws.ReadMessage(); err != nil || !strings.Contains(string(data), `"type":"board.diff"`) || !strings.Contains(string(data), `"from":7`) {
+		t.Fatalf("expected a board diff from version 7, got %s (%v)", data, err)
+	}
+
+	if err := ws.WriteMessage(websocket.TextMessage, []byte(`{"action":"add","board":true}`)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, _, err := ws.ReadMessage(); !websocket.IsCloseError(err, 4005) {
+		t.Fatalf("expected close code 4005 for a board without branch, got %v", err)
+	}
+}
+
+func TestSenderFlushesQueueBeforeLagResync(t *testing.T) {
+	client := hub.NewClient("c1", "t1")
+	client.Send <- hub.Message{Seq: 3, Data: []byte("3")}
+	client.Send <- hub.Message{Seq: 4, Data: []byte("4")}
+	var written []string
+	out := &sender{
+		client: client,
+		sent:   2,
+		write: func(msg hub.Message) error {
+			written = append(written, string(msg.Data))
+			return nil
+		},
+		resync: func(from int64) error {
+			written = append(written, string(resyncMessage(from)))
+			return nil
+		},
+	}
+	if err := out.replay(hub.Replay{Lagged: true}); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if len(written) != 3 || written[0] != "3" || written[1] != "4" || !strings.Contains(written[2], `"resume_from":4`) {
+		t.Fatalf("expected queued events then a resync from 4, got %q", written)
+	}
+}
+
+func TestDeviceConnectionIsScopedAndTracked(t *testing.T) {
+	h := hub.New(hub.Options{ReplaySize: 10})
+	fs := &fakeStore{}
+	mux := http.NewServeMux()
+	NewRealtime(fs, h, nil).Register(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	base := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?device_token="
+	if ws, _, err := websocket.DefaultDialer.Dial(base+testDeviceID+".wrong", nil); err == nil {
+		if _, _, err := ws.ReadMessage(); !websocket.IsCloseError(err, 4002) {
+			t.Fatalf("expected close code 4002 for a wrong secret, got %v", err)
+		}
+		ws.Close()
+	}
+
+	ws, _, err := websocket.DefaultDialer.Dial(base+testDeviceID+".secret", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if err := ws.WriteMessage(websocket.TextMessage, []byte(`{"action":"subscribe","types":["ticket.called"]}`)); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	_ = ws.SetReadDeadline(time.Now().Add(time.Second))
+	if _, data, err := ws.ReadMessage(); err != nil || !strings.Contains(string(data), `"type":"snapshot"`) {
+		t.Fatalf("expected a snapshot, got %s (%v)", data, err)
+	}
+	h.Broadcast(hub.EventMessage(store.OutboxEvent{Seq: 6, TenantID: "t1", Type: "ticket.called", Payload: []byte(`{"branch_id":"b1","area_id":"a2"}`)}))
+	h.Broadcast(hub.EventMessage(store.OutboxEvent{Seq: 7, TenantID: "t1", Type: "ticket.called", Payload: []byte(`{"branch_id":"b1","area_id":"a1"}`)}))
+	if _, data, err := ws.ReadMessage(); err != nil || !strings.Contains(string(data), `"seq":7`) {
+		t.Fatalf("expected only the event of the device's area, got %s (%v)", data, err)
+	}
+
+	if err := ws.WriteMessage(websocket.TextMessage, []byte(`{"action":"add","branch_id":"b1","area_id":"a2"}`)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, _, err := ws.ReadMessage(); !websocket.IsCloseError(err, 4003) {
+		t.Fatalf("expected close code 4003 outside the device's area, got %v", err)
+	}
+	ws.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		fs.mu.Lock()
+		statuses := strings.Join(fs.statuses, ",")
+		fs.mu.Unlock()
+		if statuses == "online,offline" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the device to go online then offline, got %q", statuses)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// slowDeviceStore blocks status writes for one device until release closes.
+type slowDeviceStore struct {
+	store.Store
+	slow    string
+	release chan struct{}
+}
+
+func (s *slowDeviceStore) SetDeviceOnline(ctx context.Context, deviceID string) (time.Time, error) {
+	if deviceID == s.slow {
+		<-s.release
+	}
+	return time.Now(), nil
+}
+
+func (s *slowDeviceStore) SetDeviceOffline(ctx context.Context, deviceID string, seenAt time.Time) error {
+	return nil
+}
+
+func TestSlowDeviceStatusWriteDoesNotBlockOtherDevices(t *testing.T) {
+	st := &slowDeviceStore{slow: "d1", release: make(chan struct{})}
+	defer close(st.release)
+	rt := NewRealtime(st, hub.New(hub.Options{}), nil)
+
+	go rt.deviceConnected("d1")
+	done := make(chan struct{})
+	go func() {
+		rt.deviceConnected("d2")()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected d2 to connect and disconnect while d1's write is pending")
+	}
+}
+
+func TestOpenConnectionsAreRevalidatedAndRevoked(t *testing.T) {
+	fs := &fakeStore{}
+	rt := NewRealtime(fs, hub.New(hub.Options{ReplaySize: 10}), nil)
+	mux := http.NewServeMux()
+	rt.Register(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	dial := func() *websocket.Conn {
+		t.Helper()
+		ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?session_id=s1", nil)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		if err := ws.WriteMessage(websocket.TextMessage, []byte(`{"action":"subscribe","branch_id":"b1"}`)); err != nil {
+			t.Fatalf("subscribe: %v", err)
+		}
+		_ = ws.SetReadDeadline(time.Now().Add(time.Second))
+		if _, data, err := ws.ReadMessage(); err != nil || !strings.Contains(string(data), `"type":"snapshot"`) {
+			t.Fatalf("expected a snapshot, got %s (%v)", data, err)
+		}
+		return ws
+	}
+	expectClose := func(ws *websocket.Conn, code int) {
+		t.Helper()
+		defer ws.Close()
+		if _, _, err := ws.ReadMessage(); !websocket.IsCloseError(err, code) {
+			t.Fatalf("expected close code %d, got %v", code, err)
+		}
+	}
+
+	ws := dial()
+	rt.revalidate(context.Background())
+	fs.mu.Lock()
+	fs.branches = []string{"b2"}
+	fs.mu.Unlock()
+	rt.revalidate(context.Background())
+	expectClose(ws, 4007)
+
+	fs.mu.Lock()
+	fs.branches = nil
+	fs.mu.Unlock()
+	ws = dial()
+	if n := rt.RevokeSession("other"); n != 0 {
+		t.Fatalf("expected no connections of another session, got %d", n)
+	}
+	if n := rt.RevokeSession("s1"); n != 1 {
+		t.Fatalf("expected one revoked connection, got %d", n)
+	}
+	expectClose(ws, 4009)
+
+	ws = dial()
+	fs.mu.Lock()
+	fs.ended = true
+	fs.mu.Unlock()
+	rt.revalidate(context.Background())
+	expectClose(ws, 4006)
+}
@@ -0,0 +1,180 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"qms/realtime-service/internal/hub"
+	"qms/realtime-service/internal/store"
+)
+
+// watched is an open connection whose credentials are rechecked while it
+// stays open. closed receives the denial the connection must close with.
+type watched struct {
+	client *hub.Client
+	closed chan *denial
+
+	mu     sync.Mutex
+	viewer viewer
+}
+
+// current returns the viewer as of the last revalidation; subscriptions
+// the client asks for later are checked against it.
+func (w *watched) current() viewer {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.viewer
+}
+
+func (w *watched) close(denied *denial) {
+	select {
+	case w.closed <- denied:
+	default:
+	}
+}
+
+// watch registers client's connection for revalidation and revocation.
+// The returned func unregisters it.
+func (rt *Realtime) watch(client *hub.Client, v viewer) (*watched, func()) {
+	w := &watched{client: client, viewer: v, closed: make(chan *denial, 1)}
+	rt.watchMu.Lock()
+	rt.watching[w] = struct{}{}
+	rt.watchMu.Unlock()
+	return w, func() {
+		rt.watchMu.Lock()
+		delete(rt.watching, w)
+		rt.watchMu.Unlock()
+	}
+}
+
+func (rt *Realtime) watchedConns() []*watched {
+	rt.watchMu.Lock()
+	defer rt.watchMu.Unlock()
+	conns := make([]*watched, 0, len(rt.watching))
+	for w := range rt.watching {
+		conns = append(conns, w)
+	}
+	return conns
+}
+
+// RevokeSession closes every connection opened with sessionID and reports
+// how many there were. auth-service triggers it at logout.
+func (rt *Realtime) RevokeSession(sessionID string) int {
+	revoked := 0
+	for _, w := range rt.watchedConns() {
+		if v := w.current(); v.device == nil && v.session.SessionID == sessionID {
+			w.close(errSessionRevoked)
+			revoked++
+		}
+	}
+	return revoked
+}
+
+// Revalidate rechecks every open connection each interval until ctx is
+// done, so an expired session, a deactivated user, a reissued device token
+// or a removed branch or service stops the stream it was granted. A zero
+// interval disables it.
+func (rt *Realtime) Revalidate(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rt.revalidate(ctx)
+		}
+	}
+}
+
+// revalidate runs one pass. Connections sharing a session or device share
+// its lookups; a lookup that fails leaves them open until the next pass.
+func (rt *Realtime) revalidate(ctx context.Context) {
+	type result struct {
+		viewer viewer
+		denied *denial
+		err    error
+	}
+	checked := make(map[string]result)
+	for _, w := range rt.watchedConns() {
+		v := w.current()
+		key := "session:" + v.session.SessionID
+		if v.device != nil {
+			key = "device:" + v.device.DeviceID
+		}
+		res, ok := checked[key]
+		if !ok {
+			lookupCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			res.viewer, res.denied, res.err = rt.recheck(lookupCtx, v)
+			cancel()
+			if res.err != nil {
+				log.Printf("revalidate %s: %v", key, res.err)
+			}
+			checked[key] = res
+		}
+		if res.err != nil {
+			continue
+		}
+		if res.denied != nil {
+			w.close(res.denied)
+			continue
+		}
+		if res.viewer.shape() != w.client.Shape {
+			// A role change alters what the client may see of each event.
+			w.close(errAccessRevoked)
+			continue
+		}
+		for _, sub := range rt.hub.Subscriptions(w.client) {
+			if !isAllowed(sub.BranchID, sub.ServiceID, res.viewer.branches, res.viewer.services) {
+				res.denied = errAccessRevoked
+				break
+			}
+		}
+		if res.denied != nil {
+			w.close(res.denied)
+			continue
+		}
+		w.mu.Lock()
+		w.viewer = res.viewer
+		w.mu.Unlock()
+	}
+}
+
+// recheck loads v's credentials again. It returns a denial when they are
+// no longer valid and an error when they could not be checked.
+func (rt *Realtime) recheck(ctx context.Context, v viewer) (viewer, *denial, error) {
+	if v.device != nil {
+		device, err := rt.store.GetDevice(ctx, v.device.DeviceID)
+		if errors.Is(err, store.ErrDeviceNotFound) {
+			return viewer{}, errDeviceRevoked, nil
+		}
+		if err != nil {
+			return viewer{}, nil, err
+		}
+		if device.TokenHash != v.device.TokenHash || device.BranchID != v.device.BranchID || device.AreaID != v.device.AreaID {
+			return viewer{}, errDeviceRevoked, nil
+		}
+		return v, nil, nil
+	}
+	if !v.session.ExpiresAt.IsZero() && time.Now().After(v.session.ExpiresAt) {
+		return viewer{}, errSessionEnded, nil
+	}
+	session, err := rt.store.GetSession(ctx, v.session.SessionID)
+	if errors.Is(err, store.ErrSessionNotFound) {
+		return viewer{}, errSessionEnded, nil
+	}
+	if err != nil {
+		return viewer{}, nil, err
+	}
+	branches, services, err := rt.store.GetAccess(ctx, session.UserID)
+	if err != nil {
+		return viewer{}, nil, err
+	}
+	return viewer{tenantID: v.tenantID, session: session, branches: branches, services: services}, nil, nil
+}
@@ -0,0 +1,156 @@
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"qms/realtime-service/internal/store"
+)
+
+type envelope struct {
+	Seq       int64           `json:"seq"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// EventMessage builds the client envelope for an outbox event and the
+// metadata used to route it to subscriptions.
+func EventMessage(event store.OutboxEvent) (Message, Meta) {
+	meta := extractMeta(event.Payload)
+	meta.TenantID = event.TenantID
+	meta.Type = event.Type
+	data, _ := json.Marshal(envelope{Seq: event.Seq, Type: event.Type, Payload: event.Payload, CreatedAt: event.CreatedAt})
+	display, _ := json.Marshal(envelope{Seq: event.Seq, Type: event.Type, Payload: displayPayload(event.Payload), CreatedAt: event.CreatedAt})
+	return Message{Seq: event.Seq, Data: data, display: display, createdAt: event.CreatedAt}, meta
+}
+
+// BoardMessage builds a board projection message. display is data as
+// ShapeDisplay clients get it.
+func BoardMessage(seq int64, data, display []byte) Message {
+	return Message{Seq: seq, Data: data, Board: true, display: display}
+}
+
+// displayFields are the payload fields ShapeDisplay clients get.
+var displayFields = []string{"ticket_number", "status", "counter_name", "service_name", "called_at", "recall_count", "party_size"}
+
+func displayPayload(payload []byte) json.RawMessage {
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return json.RawMessage(`{}`)
+	}
+	shown := make(map[string]json.RawMessage, len(displayFields))
+	for _, field := range displayFields {
+		if value, ok := data[field]; ok {
+			shown[field] = value
+		}
+	}
+	out, _ := json.Marshal(shown)
+	return out
+}
+
+type snapshotTicket struct {
+	TicketID     string     `json:"ticket_id"`
+	TicketNumber string     `json:"ticket_number"`
+	Status       string     `json:"status"`
+	BranchID     string     `json:"branch_id"`
+	ServiceID    string     `json:"service_id"`
+	AreaID       string     `json:"area_id,omitempty"`
+	CounterID    string     `json:"counter_id,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	CalledAt     *time.Time `json:"called_at,omitempty"`
+	RecallCount  int        `json:"recall_count"`
+	CounterName  string     `json:"counter_name,omitempty"`
+	ServiceName  string     `json:"service_name,omitempty"`
+	// QueuedAt, PriorityClass and ScheduledAt are what CallNext orders the
+	// queue by.
+	QueuedAt      time.Time  `json:"queued_at"`
+	PriorityClass string     `json:"priority_class,omitempty"`
+	ScheduledAt   *time.Time `json:"appointment_scheduled_at,omitempty"`
+	PartySize     int        `json:"party_size"`
+}
+
+// displayTicket is snapshotTicket as ShapeDisplay clients get it.
+type displayTicket struct {
+	TicketNumber string     `json:"ticket_number"`
+	Status       string     `json:"status"`
+	CounterName  string     `json:"counter_name,omitempty"`
+	ServiceName  string     `json:"service_name,omitempty"`
+	CalledAt     *time.Time `json:"called_at,omitempty"`
+	RecallCount  int        `json:"recall_count"`
+	PartySize    int        `json:"party_size"`
+}
+
+type snapshotEnvelope struct {
+	Seq       int64  `json:"seq"`
+	Type      string `json:"type"`
+	Tickets   any    `json:"tickets"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// SnapshotMessage builds the subscribe snapshot: the open tickets in scope
+// of any of subs, as of outbox seq snapshot.Seq.
+func SnapshotMessage(snapshot store.TicketSnapshot, subs []Subscription) Message {
+	tickets := []snapshotTicket{}
+	shown := []displayTicket{}
+	for _, t := range snapshot.Tickets {
+		meta := Meta{TenantID: subs[0].TenantID, BranchID: t.BranchID, ServiceID: t.ServiceID, AreaID: t.AreaID}
+		if !inScopeAny(subs, meta) {
+			continue
+		}
+		tickets = append(tickets, snapshotTicket{
+			TicketID:      t.TicketID,
+			TicketNumber:  t.TicketNumber,
+			Status:        t.Status,
+			BranchID:      t.BranchID,
+			ServiceID:     t.ServiceID,
+			AreaID:        t.AreaID,
+			CounterID:     t.CounterID,
+			CreatedAt:     t.CreatedAt,
+			CalledAt:      t.CalledAt,
+			RecallCount:   t.RecallCount,
+			CounterName:   t.CounterName,
+			ServiceName:   t.ServiceName,
+			QueuedAt:      t.QueuedAt,
+			PriorityClass: t.PriorityClass,
+			ScheduledAt:   t.ScheduledAt,
+			PartySize:     t.PartySize,
+		})
+		shown = append(shown, displayTicket{
+			TicketNumber: t.TicketNumber,
+			Status:       t.Status,
+			CounterName:  t.CounterName,
+			ServiceName:  t.ServiceName,
+			CalledAt:     t.CalledAt,
+			RecallCount:  t.RecallCount,
+			PartySize:    t.PartySize,
+		})
+	}
+	data, _ := json.Marshal(snapshotEnvelope{Seq: snapshot.Seq, Type: "snapshot", Tickets: tickets, Truncated: snapshot.Truncated})
+	display, _ := json.Marshal(snapshotEnvelope{Seq: snapshot.Seq, Type: "snapshot", Tickets: shown, Truncated: snapshot.Truncated})
+	return Message{Seq: snapshot.Seq, Data: data, display: display}
+}
+
+func extractMeta(payload []byte) Meta {
+	var data map[string]interface{}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return Meta{}
+	}
+	return Meta{
+		TenantID:  str(data["tenant_id"]),
+		BranchID:  str(data["branch_id"]),
+		ServiceID: str(data["service_id"]),
+		AreaID:    str(data["area_id"]),
+	}
+}
+
+func str(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	if v, ok := value.(string); ok {
+		return v
+	}
+	return fmt.Sprint(value)
+}
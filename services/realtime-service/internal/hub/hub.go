@@ -3,41 +3,212 @@ package hub
 import (
 	"encoding/json"
 	"log"
+	"strings"
 	"sync"
+	"time"
 )
 
+// MaxSubscriptions bounds how many subscriptions one client may hold.
+const MaxSubscriptions = 32
+
+// Subscription selects events by tenant and optional branch, service, area
+// and event types. Empty filters match everything. A type ending in ".*"
+// matches by prefix, e.g. "ticket.*". A Board subscription receives the
+// display board projection for its branch, area and service instead of
+// raw events.
 type Subscription struct {
+	ID        string
+	TenantID  string
+	BranchID  string
+	ServiceID string
+	AreaID    string
+	Types     []string
+	Board     bool
+}
+
+// BoardKey identifies the board view a Board subscription receives.
+func (sub Subscription) BoardKey() string {
+	return sub.TenantID + "/" + sub.BranchID + "/" + sub.AreaID + "/" + sub.ServiceID
+}
+
+// Meta describes a broadcast event for routing.
+type Meta struct {
 	TenantID  string
 	BranchID  string
 	ServiceID string
+	AreaID    string
+	Type      string
+}
+
+// Message is one broadcast event. Seq is the outbox sequence of the event,
+// which SSE clients see as the event id. Board messages carry projection
+// state rather than an event; they are not resumable by seq.
+type Message struct {
+	Seq   int64
+	Data  []byte
+	Board bool
+	// display is Data as ShapeDisplay clients get it, when it differs.
+	display []byte
+	// createdAt is when the event entered the outbox, for latency metrics.
+	createdAt time.Time
+}
+
+// Shape is how much of each event a client sees.
+type Shape int
+
+const (
+	// ShapeFull is the payload as written to the outbox, for staff.
+	ShapeFull Shape = iota
+	// ShapeDisplay keeps what a public display shows: ticket number,
+	// status, counter and service names and call details. Phone numbers,
+	// request ids and internal ids are left out.
+	ShapeDisplay
+)
+
+// shaped returns msg as a client of shape receives it.
+func (msg Message) shaped(shape Shape) Message {
+	if shape == ShapeDisplay && msg.display != nil {
+		msg.Data = msg.display
+	}
+	msg.display = nil
+	return msg
+}
+
+// Replay is what Resume queues for a client: the missed events after From,
+// or Resync when some of them are no longer buffered. A Replay queued by
+// Snapshot starts with the snapshot taken at From. Lagged is queued instead
+// when the client's Send filled up: the hub holds back its events until it
+// subscribes again, resuming from the last event it received.
+type Replay struct {
+	From     int64
+	Snapshot *Message
+	Messages []Message
+	Resync   bool
+	Lagged   bool
 }
 
 type Client struct {
-	ID           string
-	Send         chan []byte
-	Subscription Subscription
+	ID            string
+	TenantID      string
+	Send          chan Message
+	Replay        chan Replay
+	Subscriptions []Subscription
+	// Shape is set before the client is registered.
+	Shape Shape
+
+	// lagging is set from the first dropped event until the client
+	// subscribes again; drops counts the events dropped meanwhile. Once
+	// evicted is closed gone is set and the client never leaves the lag.
+	lagging bool
+	drops   int
+	evicted chan struct{}
+	gone    bool
+}
+
+// Options configures the replay buffer. StartSeq is the consumer offset the
+// hub starts broadcasting after; nothing at or before it is buffered.
+// A client that drops more than MaxDrops messages before it catches up is
+// evicted; zero never evicts.
+type Options struct {
+	ReplaySize int
+	StartSeq   int64
+	MaxDrops   int
 }
 
 type Hub struct {
-	mu      sync.RWMutex
-	clients map[string]*Client
+	mu         sync.Mutex
+	clients    map[string]*Client
+	replaySize int
+	startSeq   int64
+	maxDrops   int
+	tenants    map[string]*tenantLog
+}
+
+// tenantLog holds a tenant's most recent events in seq order. Every event
+// of the tenant after floor is still in events.
+type tenantLog struct {
+	floor  int64
+	events []buffered
 }
 
+type buffered struct {
+	msg  Message
+	meta Meta
+}
+
+// SubscribeMessage is a client control message:
+//   - subscribe replaces the client's subscriptions with Subscriptions, or
+//     with the single filter in the top-level fields, and replays from
+//     ResumeFrom when set;
+//   - add adds one subscription, replacing any with the same id;
+//   - remove drops the subscription with the given id;
+//   - unsubscribe drops all of them.
 type SubscribeMessage struct {
-	Action    string `json:"action"`
-	TenantID  string `json:"tenant_id"`
-	BranchID  string `json:"branch_id"`
-	ServiceID string `json:"service_id"`
+	Action        string        `json:"action"`
+	ID            string        `json:"id,omitempty"`
+	TenantID      string        `json:"tenant_id"`
+	BranchID      string        `json:"branch_id"`
+	ServiceID     string        `json:"service_id"`
+	AreaID        string        `json:"area_id,omitempty"`
+	Types         []string      `json:"types,omitempty"`
+	Board         bool          `json:"board,omitempty"`
+	Subscriptions []FilterInput `json:"subscriptions,omitempty"`
+	ResumeFrom    int64         `json:"resume_from,omitempty"`
+}
+
+// FilterInput is one entry of SubscribeMessage.Subscriptions.
+type FilterInput struct {
+	ID        string   `json:"id,omitempty"`
+	BranchID  string   `json:"branch_id"`
+	ServiceID string   `json:"service_id"`
+	AreaID    string   `json:"area_id,omitempty"`
+	Types     []string `json:"types,omitempty"`
+	Board     bool     `json:"board,omitempty"`
+}
+
+// Filters returns the subscriptions a subscribe or add message asks for.
+func (m SubscribeMessage) Filters() []FilterInput {
+	if m.Action == "subscribe" && len(m.Subscriptions) > 0 {
+		return m.Subscriptions
+	}
+	return []FilterInput{{ID: m.ID, BranchID: m.BranchID, ServiceID: m.ServiceID, AreaID: m.AreaID, Types: m.Types, Board: m.Board}}
+}
+
+func New(opts Options) *Hub {
+	if opts.ReplaySize < 0 {
+		opts.ReplaySize = 0
+	}
+	return &Hub{
+		clients:    make(map[string]*Client),
+		replaySize: opts.ReplaySize,
+		startSeq:   opts.StartSeq,
+		maxDrops:   opts.MaxDrops,
+		tenants:    make(map[string]*tenantLog),
+	}
+}
+
+// NewClient returns a client of tenantID with the hub's usual channel sizes.
+func NewClient(id, tenantID string) *Client {
+	return &Client{
+		ID:       id,
+		TenantID: tenantID,
+		Send:     make(chan Message, 16),
+		Replay:   make(chan Replay, 1),
+		evicted:  make(chan struct{}),
+	}
 }
 
-func New() *Hub {
-	return &Hub{clients: make(map[string]*Client)}
+// Evicted is closed when the hub gives up on a slow client; its connection
+// should be closed so it reconnects and resumes.
+func (c *Client) Evicted() <-chan struct{} {
+	return c.evicted
 }
 
 func (h *Hub) Register(client *Client) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	h.clients[client.ID] = client
+	connections.Add(client.TenantID, 1)
 }
 
 func (h *Hub) Unregister(client *Client) {
@@ -45,31 +216,240 @@ func (h *Hub) Unregister(client *Client) {
 	defer h.mu.Unlock()
 	delete(h.clients, client.ID)
 	close(client.Send)
+	connections.Add(client.TenantID, -1)
+}
+
+// SetSubscriptions replaces all of client's subscriptions. Like Resume, it
+// ends a lag: the client has chosen what to receive from here on. An
+// evicted client is left as it is.
+func (h *Hub) SetSubscriptions(client *Client, subs []Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if client.gone {
+		return
+	}
+	client.Subscriptions = subs
+	client.lagging, client.drops = false, 0
 }
 
-func (h *Hub) UpdateSubscription(client *Client, sub Subscription) {
+// AddSubscription adds sub, replacing one with the same ID. It reports
+// false when the client already holds MaxSubscriptions.
+func (h *Hub) AddSubscription(client *Client, sub Subscription) bool {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	client.Subscription = sub
+	for i, existing := range client.Subscriptions {
+		if existing.ID == sub.ID {
+			client.Subscriptions[i] = sub
+			return true
+		}
+	}
+	if len(client.Subscriptions) >= MaxSubscriptions {
+		return false
+	}
+	client.Subscriptions = append(client.Subscriptions, sub)
+	return true
 }
 
-func (h *Hub) Broadcast(payload []byte, meta Subscription) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
+func (h *Hub) RemoveSubscription(client *Client, id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	kept := client.Subscriptions[:0]
+	for _, sub := range client.Subscriptions {
+		if sub.ID != id {
+			kept = append(kept, sub)
+		}
+	}
+	client.Subscriptions = kept
+}
+
+// Subscriptions returns a copy of client's current subscriptions.
+func (h *Hub) Subscriptions(client *Client) []Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Subscription(nil), client.Subscriptions...)
+}
+
+// Resume replaces client's subscriptions and queues the buffered events
+// after from that match any of them. It runs under the same lock as
+// Broadcast, so every later event arrives on Send and every earlier one is
+// in the replay. All subscriptions of a client share its tenant.
+func (h *Hub) Resume(client *Client, subs []Subscription, from int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.resume(client, subs, Replay{From: from})
+}
+
+// Snapshot replaces client's subscriptions and queues snapshot followed by
+// the buffered events after its seq. The snapshot may be older than the
+// latest broadcast, or newer: events up to its seq that are broadcast later
+// are skipped by the client's sender.
+func (h *Hub) Snapshot(client *Client, subs []Subscription, snapshot Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	snapshot = snapshot.shaped(client.Shape)
+	h.resume(client, subs, Replay{From: snapshot.Seq, Snapshot: &snapshot})
+}
+
+func (h *Hub) resume(client *Client, subs []Subscription, replay Replay) {
+	if client.gone {
+		return
+	}
+	client.Subscriptions = subs
+	client.lagging, client.drops = false, 0
+	from := replay.From
+	floor := h.startSeq
+	var tl *tenantLog
+	if len(subs) > 0 {
+		tl = h.tenants[subs[0].TenantID]
+	}
+	if tl != nil && tl.floor > floor {
+		floor = tl.floor
+	}
+	if from < floor {
+		replay.Resync = true
+	} else if tl != nil {
+		for _, event := range tl.events {
+			if event.msg.Seq > from && matchesAny(subs, event.meta) {
+				replay.Messages = append(replay.Messages, event.msg.shaped(client.Shape))
+			}
+		}
+	}
+	queueReplay(client, replay)
+}
+
+// queueReplay replaces any replay the client has not read yet; only the
+// latest one matters.
+func queueReplay(client *Client, replay Replay) {
+	select {
+	case <-client.Replay:
+	default:
+	}
+	client.Replay <- replay
+}
+
+func (h *Hub) Broadcast(msg Message, meta Meta) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.buffer(msg, meta)
 	for _, client := range h.clients {
-		if !match(client.Subscription, meta) {
+		if matchesAny(client.Subscriptions, meta) {
+			h.deliver(client, msg)
+		}
+	}
+	observeBroadcast(meta.TenantID, msg.createdAt)
+}
+
+// deliver queues msg for client. The first event that does not fit puts
+// the client in lag: it is told to resync, and its events are dropped until
+// it subscribes again, so it never sees a stream with holes in it. Board
+// messages carry their own versions and are only counted when dropped.
+func (h *Hub) deliver(client *Client, msg Message) {
+	if client.lagging && !msg.Board {
+		h.drop(client)
+		return
+	}
+	select {
+	case client.Send <- msg.shaped(client.Shape):
+		return
+	default:
+	}
+	if !msg.Board {
+		client.lagging = true
+		queueReplay(client, Replay{Lagged: true})
+		log.Printf("client %s is lagging, resync requested", client.ID)
+	}
+	h.drop(client)
+}
+
+func (h *Hub) drop(client *Client) {
+	client.drops++
+	droppedMessages.Add(client.TenantID, 1)
+	if h.maxDrops > 0 && client.drops > h.maxDrops && !client.gone {
+		client.gone = true
+		close(client.evicted)
+		slowDisconnects.Add(client.TenantID, 1)
+		log.Printf("evict slow client %s after %d dropped messages", client.ID, client.drops)
+	}
+}
+
+// BroadcastBoard sends msg to the clients subscribed to the board view key
+// and reports whether there were any.
+func (h *Hub) BroadcastBoard(key string, msg Message) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	found := false
+	for _, client := range h.clients {
+		if !hasBoard(client.Subscriptions, key) {
 			continue
 		}
-		select {
-		case client.Send <- payload:
-		default:
-			log.Printf("drop message for client %s", client.ID)
+		found = true
+		h.deliver(client, msg)
+	}
+	return found
+}
+
+// Deliver sends msg to one client if it is still registered.
+func (h *Hub) Deliver(client *Client, msg Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.clients[client.ID] != client {
+		return
+	}
+	h.deliver(client, msg)
+}
+
+func hasBoard(subs []Subscription, key string) bool {
+	for _, sub := range subs {
+		if sub.Board && sub.BoardKey() == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Hub) buffer(msg Message, meta Meta) {
+	if meta.TenantID == "" || msg.Seq <= h.startSeq {
+		return
+	}
+	tl := h.tenants[meta.TenantID]
+	if tl == nil {
+		tl = &tenantLog{floor: h.startSeq}
+		h.tenants[meta.TenantID] = tl
+	}
+	if n := len(tl.events); n > 0 && msg.Seq <= tl.events[n-1].msg.Seq {
+		return
+	}
+	tl.events = append(tl.events, buffered{msg: msg, meta: meta})
+	if over := len(tl.events) - h.replaySize; over > 0 {
+		tl.floor = tl.events[over-1].msg.Seq
+		tl.events = tl.events[over:]
+	}
+}
+
+// Matches reports whether an event with meta is visible to sub. Board
+// subscriptions and subscriptions without a tenant match no events.
+func (sub Subscription) Matches(meta Meta) bool {
+	if !sub.InScope(meta) {
+		return false
+	}
+	if len(sub.Types) == 0 {
+		return true
+	}
+	for _, eventType := range sub.Types {
+		if eventType == meta.Type {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(eventType, "*"); ok && strings.HasPrefix(meta.Type, prefix) {
+			return true
 		}
 	}
+	return false
 }
 
-func match(sub Subscription, meta Subscription) bool {
-	if sub.TenantID != "" && meta.TenantID != sub.TenantID {
+// InScope is Matches without the type filter: whether a ticket with meta
+// belongs in sub's snapshot.
+func (sub Subscription) InScope(meta Meta) bool {
+	if sub.Board || sub.TenantID == "" || meta.TenantID != sub.TenantID {
 		return false
 	}
 	if sub.BranchID != "" && meta.BranchID != sub.BranchID {
@@ -78,7 +458,26 @@ func match(sub Subscription, meta Subscription) bool {
 	if sub.ServiceID != "" && meta.ServiceID != sub.ServiceID {
 		return false
 	}
-	return true
+	return sub.AreaID == "" || meta.AreaID == sub.AreaID
+}
+
+func inScopeAny(subs []Subscription, meta Meta) bool {
+	for _, sub := range subs {
+		if sub.InScope(meta) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAny delivers an event once however many subscriptions match it.
+func matchesAny(subs []Subscription, meta Meta) bool {
+	for _, sub := range subs {
+		if sub.Matches(meta) {
+			return true
+		}
+	}
+	return false
 }
 
 func ParseSubscribe(data []byte) (SubscribeMessage, bool) {
@@ -86,7 +485,9 @@ func ParseSubscribe(data []byte) (SubscribeMessage, bool) {
 	if err := json.Unmarshal(data, &msg); err != nil {
 		return SubscribeMessage{}, false
 	}
-	if msg.Action != "subscribe" && msg.Action != "unsubscribe" {
+	switch msg.Action {
+	case "subscribe", "unsubscribe", "add", "remove":
+	default:
 		return SubscribeMessage{}, false
 	}
 	return msg, true
@@ -0,0 +1,244 @@
+package hub
+
+import (
+	"strings"
+	"testing"
+
+	"qms/realtime-service/internal/store"
+)
+
+func seqs(messages []Message) []int64 {
+	var out []int64
+	for _, msg := range messages {
+		out = append(out, msg.Seq)
+	}
+	return out
+}
+
+func TestResumeReplaysTenantEventsInOrder(t *testing.T) {
+	h := New(Options{ReplaySize: 3, StartSeq: 10})
+	h.Broadcast(Message{Seq: 10}, Meta{TenantID: "t1"})
+	for seq := int64(11); seq <= 15; seq++ {
+		tenant := "t1"
+		if seq == 12 {
+			tenant = "t2"
+		}
+		h.Broadcast(Message{Seq: seq}, Meta{TenantID: tenant, BranchID: "b1"})
+	}
+
+	client := NewClient("c1", "t1")
+	sub := []Subscription{{TenantID: "t1", BranchID: "b1"}}
+	h.Resume(client, sub, 13)
+	if replay := <-client.Replay; replay.Resync || len(replay.Messages) != 2 || replay.Messages[0].Seq != 14 || replay.Messages[1].Seq != 15 {
+		t.Fatalf("expected seq 14 and 15, got %+v", seqs(replay.Messages))
+	}
+
+	// t1 has 11, 13, 14, 15; with room for three, 11 was evicted.
+	h.Resume(client, sub, 11)
+	if replay := <-client.Replay; replay.Resync || len(replay.Messages) != 3 {
+		t.Fatalf("expected full replay after 11, got %+v", replay)
+	}
+	h.Resume(client, sub, 10)
+	if replay := <-client.Replay; !replay.Resync {
+		t.Fatalf("expected resync once seq 11 was evicted, got %+v", replay)
+	}
+	h.Resume(client, []Subscription{{TenantID: "t2"}}, 5)
+	if replay := <-client.Replay; !replay.Resync {
+		t.Fatalf("expected resync before the start offset, got %+v", replay)
+	}
+	h.Resume(client, []Subscription{{TenantID: "t3"}}, 10)
+	if replay := <-client.Replay; replay.Resync || len(replay.Messages) != 0 {
+		t.Fatalf("expected empty replay for a quiet tenant, got %+v", replay)
+	}
+}
+
+func TestUnsubscribedClientReceivesNothing(t *testing.T) {
+	h := New(Options{})
+	client := NewClient("c1", "t1")
+	h.Register(client)
+	h.Broadcast(Message{Seq: 1}, Meta{TenantID: "t1"})
+	select {
+	case msg := <-client.Send:
+		t.Fatalf("expected no delivery before subscribe, got %+v", msg)
+	default:
+	}
+}
+
+func TestSubscriptionFilters(t *testing.T) {
+	called := Meta{TenantID: "t1", BranchID: "b1", ServiceID: "s1", AreaID: "a1", Type: "ticket.called"}
+	tests := []struct {
+		name string
+		sub  Subscription
+		want bool
+	}{
+		{"tenant only", Subscription{TenantID: "t1"}, true},
+		{"other tenant", Subscription{TenantID: "t2"}, false},
+		{"area match", Subscription{TenantID: "t1", AreaID: "a1"}, true},
+		{"area mismatch", Subscription{TenantID: "t1", AreaID: "a2"}, false},
+		{"type match", Subscription{TenantID: "t1", Types: []string{"ticket.recalled", "ticket.called"}}, true},
+		{"type prefix", Subscription{TenantID: "t1", Types: []string{"ticket.*"}}, true},
+		{"type mismatch", Subscription{TenantID: "t1", Types: []string{"ticket.created"}}, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.sub.Matches(called); got != tc.want {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestMultipleSubscriptionsDeliverOnce(t *testing.T) {
+	h := New(Options{})
+	client := NewClient("c1", "t1")
+	h.Register(client)
+	h.AddSubscription(client, Subscription{ID: "s1", TenantID: "t1", ServiceID: "s1"})
+	h.AddSubscription(client, Subscription{ID: "s2", TenantID: "t1", ServiceID: "s2"})
+	h.AddSubscription(client, Subscription{ID: "all", TenantID: "t1"})
+
+	h.Broadcast(Message{Seq: 1}, Meta{TenantID: "t1", ServiceID: "s1"})
+	h.RemoveSubscription(client, "all")
+	h.Broadcast(Message{Seq: 2}, Meta{TenantID: "t1", ServiceID: "s2"})
+	h.Broadcast(Message{Seq: 3}, Meta{TenantID: "t1", ServiceID: "s3"})
+	h.Unregister(client)
+
+	var got []int64
+	for msg := range client.Send {
+		got = append(got, msg.Seq)
+	}
+	if len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Fatalf("expected seq 1 and 2 once each, got %v", got)
+	}
+
+	for i := 0; i < MaxSubscriptions; i++ {
+		h.AddSubscription(client, Subscription{ID: string(rune('a' + i)), TenantID: "t1"})
+	}
+	if h.AddSubscription(client, Subscription{ID: "extra", TenantID: "t1"}) {
+		t.Fatalf("expected subscriptions beyond %d to be refused", MaxSubscriptions)
+	}
+}
+
+func TestSnapshotQueuesNewerBufferedEvents(t *testing.T) {
+	h := New(Options{ReplaySize: 10})
+	for seq := int64(1); seq <= 4; seq++ {
+		h.Broadcast(Message{Seq: seq}, Meta{TenantID: "t1", BranchID: "b1"})
+	}
+
+	client := NewClient("c1", "t1")
+	subs := []Subscription{{TenantID: "t1", BranchID: "b1"}}
+	snapshot := SnapshotMessage(store.TicketSnapshot{Seq: 2, Tickets: []store.Ticket{
+		{TicketID: "k1", BranchID: "b1"},
+		{TicketID: "k2", BranchID: "b2"},
+	}}, subs)
+	h.Snapshot(client, subs, snapshot)
+
+	replay := <-client.Replay
+	if replay.Snapshot == nil || replay.From != 2 || !strings.Contains(string(replay.Snapshot.Data), `"k1"`) || strings.Contains(string(replay.Snapshot.Data), `"k2"`) {
+		t.Fatalf("expected the b1 snapshot at seq 2, got %+v", replay)
+	}
+	if got := seqs(replay.Messages); len(got) != 2 || got[0] != 3 || got[1] != 4 {
+		t.Fatalf("expected seq 3 and 4 after the snapshot, got %v", got)
+	}
+}
+
+func TestSlowClientLagsThenIsEvicted(t *testing.T) {
+	h := New(Options{ReplaySize: 100, MaxDrops: 3})
+	client := NewClient("c1", "t1")
+	h.Register(client)
+	subs := []Subscription{{TenantID: "t1"}}
+	h.SetSubscriptions(client, subs)
+
+	for seq := int64(1); seq <= int64(cap(client.Send))+1; seq++ {
+		h.Broadcast(Message{Seq: seq}, Meta{TenantID: "t1"})
+	}
+	if replay := <-client.Replay; !replay.Lagged {
+		t.Fatalf("expected a lagged replay once Send was full, got %+v", replay)
+	}
+
+	// Room in Send does not end the lag; only subscribing again does.
+	<-client.Send
+	h.Broadcast(Message{Seq: 100}, Meta{TenantID: "t1"})
+	if n := len(client.Send); n != cap(client.Send)-1 {
+		t.Fatalf("expected events to be held back while lagging, Send has %d", n)
+	}
+	h.Resume(client, subs, 16)
+	if replay := <-client.Replay; replay.Resync || len(replay.Messages) != 2 {
+		t.Fatalf("expected seq 17 and 100 to be replayed, got %+v", replay)
+	}
+
+	for len(client.Send) < cap(client.Send) {
+		client.Send <- Message{}
+	}
+	for seq := int64(101); seq <= 104; seq++ {
+		h.Broadcast(Message{Seq: seq}, Meta{TenantID: "t1"})
+	}
+	select {
+	case <-client.Evicted():
+	default:
+		t.Fatal("expected the client to be evicted after more than 3 drops")
+	}
+}
+
+func TestEvictedClientStaysEvictedAfterSubscribing(t *testing.T) {
+	h := New(Options{ReplaySize: 100, MaxDrops: 3})
+	client := NewClient("c1", "t1")
+	h.Register(client)
+	subs := []Subscription{{TenantID: "t1"}}
+	h.SetSubscriptions(client, subs)
+
+	seq := int64(0)
+	broadcast := func(n int) {
+		for i := 0; i < n; i++ {
+			seq++
+			h.Broadcast(Message{Seq: seq}, Meta{TenantID: "t1"})
+		}
+	}
+	broadcast(cap(client.Send) + 4)
+	select {
+	case <-client.Evicted():
+	default:
+		t.Fatal("expected the client to be evicted after more than 3 drops")
+	}
+
+	// The connection may still read a subscribe before it is closed; that
+	// must not reset the drop count and evict the client a second time.
+	h.SetSubscriptions(client, subs)
+	broadcast(4)
+	h.Resume(client, subs, seq)
+	broadcast(4)
+	if !client.lagging {
+		t.Fatal("expected an evicted client to stay lagging")
+	}
+}
+
+func TestDisplayClientsGetRedactedPayloads(t *testing.T) {
+	h := New(Options{ReplaySize: 10})
+	sub := []Subscription{{TenantID: "t1", BranchID: "b1"}}
+	staff := NewClient("staff", "t1")
+	display := NewClient("display", "t1")
+	display.Shape = ShapeDisplay
+	for _, client := range []*Client{staff, display} {
+		h.Register(client)
+		h.SetSubscriptions(client, sub)
+	}
+
+	payload := `{"ticket_id":"k1","ticket_number":"A001","status":"called","branch_id":"b1","counter_id":"c1","counter_name":"Counter 1","phone":"+15550100","request_id":"r1"}`
+	h.Broadcast(EventMessage(store.OutboxEvent{Seq: 1, TenantID: "t1", Type: "ticket.called", Payload: []byte(payload)}))
+
+	if msg := <-staff.Send; !strings.Contains(string(msg.Data), `"phone":"+15550100"`) {
+		t.Fatalf("expected staff to get the full payload, got %s", msg.Data)
+	}
+	msg := <-display.Send
+	data := string(msg.Data)
+	if !strings.Contains(data, `"payload":{"counter_name":"Counter 1","status":"called","ticket_number":"A001"}`) {
+		t.Fatalf("expected only display fields, got %s", data)
+	}
+
+	h.Snapshot(display, sub, SnapshotMessage(store.TicketSnapshot{Seq: 1, Tickets: []store.Ticket{
+		{TicketID: "k2", TicketNumber: "A002", Status: "waiting", BranchID: "b1", ServiceID: "s1", ServiceName: "Passports"},
+	}}, sub))
+	replay := <-display.Replay
+	if snapshot := string(replay.Snapshot.Data); strings.Contains(snapshot, "k2") || !strings.Contains(snapshot, `"service_name":"Passports"`) {
+		t.Fatalf("expected a redacted snapshot, got %s", snapshot)
+	}
+}
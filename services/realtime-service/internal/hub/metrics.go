@@ -0,0 +1,25 @@
+package hub
+
+import (
+	"expvar"
+	"time"
+)
+
+// Per-tenant hub metrics, published on /metrics with the other expvars.
+var (
+	connections        = expvar.NewMap("realtime_connections")
+	droppedMessages    = expvar.NewMap("realtime_dropped_messages_total")
+	slowDisconnects    = expvar.NewMap("realtime_slow_disconnects_total")
+	broadcasts         = expvar.NewMap("realtime_broadcasts_total")
+	broadcastLatencyMs = expvar.NewMap("realtime_broadcast_latency_ms_total")
+)
+
+// observeBroadcast records how long an event took from the outbox to the
+// client queues. Divide the latency total by broadcasts for the average.
+func observeBroadcast(tenantID string, createdAt time.Time) {
+	if createdAt.IsZero() {
+		return
+	}
+	broadcasts.Add(tenantID, 1)
+	broadcastLatencyMs.AddFloat(tenantID, float64(time.Since(createdAt).Microseconds())/1000)
+}
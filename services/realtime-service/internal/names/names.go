@@ -0,0 +1,98 @@
+// Package names adds counter and service names to outbox payloads next to
+// their ids, so displays can show them without lookups of their own.
+package names
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"qms/realtime-service/internal/store"
+)
+
+type Loader interface {
+	LoadNames(ctx context.Context, branchID string) (store.Names, error)
+}
+
+// Resolver caches each branch's names for ttl. A renamed counter shows its
+// old name until then.
+type Resolver struct {
+	loader Loader
+	ttl    time.Duration
+
+	mu       sync.Mutex
+	branches map[string]cached
+}
+
+type cached struct {
+	names    store.Names
+	loadedAt time.Time
+}
+
+func New(loader Loader, ttl time.Duration) *Resolver {
+	return &Resolver{loader: loader, ttl: ttl, branches: make(map[string]cached)}
+}
+
+// Resolve returns event with counter_name and service_name set from its
+// counter_id and service_id. Names already in the payload are kept, and
+// the event is returned unchanged when they cannot be loaded.
+func (r *Resolver) Resolve(ctx context.Context, event store.OutboxEvent) store.OutboxEvent {
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return event
+	}
+	branchID := stringField(payload, "branch_id")
+	counterID := stringField(payload, "counter_id")
+	serviceID := stringField(payload, "service_id")
+	if branchID == "" || (counterID == "" && serviceID == "") {
+		return event
+	}
+	names, ok := r.branch(ctx, branchID)
+	if !ok {
+		return event
+	}
+	changed := setName(payload, "counter_name", names.Counters[counterID])
+	changed = setName(payload, "service_name", names.Services[serviceID]) || changed
+	if !changed {
+		return event
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return event
+	}
+	event.Payload = data
+	return event
+}
+
+func (r *Resolver) branch(ctx context.Context, branchID string) (store.Names, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if entry, ok := r.branches[branchID]; ok && time.Since(entry.loadedAt) < r.ttl {
+		return entry.names, true
+	}
+	names, err := r.loader.LoadNames(ctx, branchID)
+	if err != nil {
+		log.Printf("load names of branch %s: %v", branchID, err)
+		return store.Names{}, false
+	}
+	r.branches[branchID] = cached{names: names, loadedAt: time.Now()}
+	return names, true
+}
+
+func stringField(payload map[string]json.RawMessage, key string) string {
+	var value string
+	if raw, ok := payload[key]; ok {
+		_ = json.Unmarshal(raw, &value)
+	}
+	return value
+}
+
+func setName(payload map[string]json.RawMessage, key, name string) bool {
+	if name == "" || stringField(payload, key) != "" {
+		return false
+	}
+	payload[key], _ = json.Marshal(name)
+	return true
+}
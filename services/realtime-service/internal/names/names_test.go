@@ -0,0 +1,45 @@
+package names
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"qms/realtime-service/internal/store"
+)
+
+type fakeLoader struct {
+	loads int
+}
+
+func (l *fakeLoader) LoadNames(ctx context.Context, branchID string) (store.Names, error) {
+	l.loads++
+	return store.Names{
+		Counters: map[string]string{"c1": "Counter 1"},
+		Services: map[string]string{"s1": "Passports"},
+	}, nil
+}
+
+func TestResolveAddsNamesOnce(t *testing.T) {
+	loader := &fakeLoader{}
+	r := New(loader, time.Minute)
+
+	event := r.Resolve(context.Background(), store.OutboxEvent{Type: "ticket.called",
+		Payload: []byte(`{"branch_id":"b1","counter_id":"c1","service_id":"s1","ticket_number":"A001"}`)})
+	var payload map[string]string
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		t.Fatalf("decode %s: %v", event.Payload, err)
+	}
+	if payload["counter_name"] != "Counter 1" || payload["service_name"] != "Passports" || payload["ticket_number"] != "A001" {
+		t.Fatalf("unexpected payload %s", event.Payload)
+	}
+
+	unknown := []byte(`{"branch_id":"b1","counter_id":"c9"}`)
+	if event := r.Resolve(context.Background(), store.OutboxEvent{Payload: unknown}); string(event.Payload) != string(unknown) {
+		t.Fatalf("expected an unknown counter to be left alone, got %s", event.Payload)
+	}
+	if loader.loads != 1 {
+		t.Fatalf("expected the branch to be loaded once, got %d", loader.loads)
+	}
+}
@@ -0,0 +1,106 @@
+// Package pgnotify wakes outbox consumers when queue-service commits new
+// events. A notification is only a hint to poll now: consumers still read
+// by seq, so a missed or duplicate notification never loses or repeats an
+// event, it only delays one until the fallback poll. Session revocations
+// from auth-service arrive the same way, backed by session revalidation.
+package pgnotify
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// OutboxChannel is the channel queue-service notifies on every outbox insert.
+const OutboxChannel = "outbox_events"
+
+// SessionRevokedChannel is the channel auth-service notifies with the
+// session id when a session ends at logout.
+const SessionRevokedChannel = "session_revoked"
+
+type Listener struct {
+	pool    *pgxpool.Pool
+	channel string
+	wake    chan struct{}
+	handle  func(payload string)
+}
+
+func New(pool *pgxpool.Pool, channel string) *Listener {
+	return &Listener{pool: pool, channel: channel, wake: make(chan struct{}, 1)}
+}
+
+// NewHandler returns a listener that passes each notification's payload to
+// handle instead of waking C. Notifications sent while disconnected are
+// lost, so handle may only speed up what a poll would find later anyway.
+func NewHandler(pool *pgxpool.Pool, channel string, handle func(payload string)) *Listener {
+	l := New(pool, channel)
+	l.handle = handle
+	return l
+}
+
+// C receives once per burst of notifications; wake-ups that arrive while a
+// previous one is unread are coalesced.
+func (l *Listener) C() <-chan struct{} {
+	return l.wake
+}
+
+// Run listens until ctx is done, reconnecting with backoff when the
+// connection drops. After every (re)connect it wakes the consumer once,
+// since notifications sent while disconnected are lost.
+func (l *Listener) Run(ctx context.Context) {
+	backoff := time.Second
+	for {
+		connected, err := l.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			backoff = time.Second
+		}
+		log.Printf("pgnotify %s: %v; reconnecting in %s", l.channel, err, backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// listen holds a dedicated connection rather than a pooled one, so the
+// LISTEN never leaks into connections used for queries.
+func (l *Listener) listen(ctx context.Context) (bool, error) {
+	conn, err := pgx.ConnectConfig(ctx, l.pool.Config().ConnConfig.Copy())
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{l.channel}.Sanitize()); err != nil {
+		return false, err
+	}
+	l.notify()
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return true, err
+		}
+		if l.handle != nil {
+			l.handle(n.Payload)
+			continue
+		}
+		l.notify()
+	}
+}
+
+func (l *Listener) notify() {
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
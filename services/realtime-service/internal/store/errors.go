@@ -4,4 +4,5 @@ import "errors"
 
 var (
 	ErrSessionNotFound = errors.New("session not found")
+	ErrDeviceNotFound  = errors.New("device not found")
 )
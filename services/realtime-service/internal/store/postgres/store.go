@@ -19,17 +19,26 @@ func NewStore(pool *pgxpool.Pool) *Store {
 	return &Store{pool: pool}
 }
 
-func (s *Store) ListOutboxEvents(ctx context.Context, offset store.OutboxOffset, limit int) ([]store.OutboxEvent, error) {
+// outboxSequencerLock is the advisory lock queue-service and every outbox
+// consumer hold while numbering outbox events.
+const outboxSequencerLock = "outbox:sequencer"
+
+// ListOutboxEvents numbers committed events first: queue-service inserts
+// them without a seq and leaves numbering to the readers.
+func (s *Store) ListOutboxEvents(ctx context.Context, afterSeq int64, limit int) ([]store.OutboxEvent, error) {
 	if limit <= 0 {
 		limit = 100
 	}
+	if err := s.sequenceOutbox(ctx); err != nil {
+		return nil, err
+	}
 	rows, err := s.pool.Query(ctx, `
-		SELECT event_id, tenant_id, type, payload_json, created_at
+		SELECT seq, event_id, tenant_id, type, payload_json, created_at
 		FROM outbox_events
-		WHERE created_at > $1 OR (created_at = $1 AND event_id > $2)
-		ORDER BY created_at ASC, event_id ASC
-		LIMIT $3
-	`, offset.LastEventTime, offset.LastEventID, limit)
+		WHERE seq > $1
+		ORDER BY seq ASC
+		LIMIT $2
+	`, afterSeq, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -38,7 +47,7 @@ func (s *Store) ListOutboxEvents(ctx context.Context, offset store.OutboxOffset,
 	var events []store.OutboxEvent
 	for rows.Next() {
 		var event store.OutboxEvent
-		if err := rows.Scan(&event.EventID, &event.TenantID, &event.Type, &event.Payload, &event.CreatedAt); err != nil {
+		if err := rows.Scan(&event.Seq, &event.EventID, &event.TenantID, &event.Type, &event.Payload, &event.CreatedAt); err != nil {
 			return nil, err
 		}
 		events = append(events, event)
@@ -49,58 +58,152 @@ func (s *Store) ListOutboxEvents(ctx context.Context, offset store.OutboxOffset,
 	return events, nil
 }
 
-func (s *Store) GetOffset(ctx context.Context) (store.OutboxOffset, error) {
-	var offset store.OutboxOffset
-	row := s.pool.QueryRow(ctx, `
-		SELECT last_event_time, last_event_id
-		FROM realtime_offsets
-		WHERE id = 1
+func (s *Store) sequenceOutbox(ctx context.Context) (err error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+		}
+	}()
+	if _, err = tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, outboxSequencerLock); err != nil {
+		return err
+	}
+	if err = numberOutbox(ctx, tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// numberOutbox gives every outbox event tx can see that has no seq yet the
+// next values from outbox_sequence, in write order. The caller holds the
+// sequencer lock, so seq values become visible strictly in order.
+func numberOutbox(ctx context.Context, tx pgx.Tx) error {
+	tag, err := tx.Exec(ctx, `
+		UPDATE outbox_events o
+		SET seq = q.last_seq + p.n
+		FROM (
+			SELECT event_id, ROW_NUMBER() OVER (ORDER BY write_order ASC) AS n
+			FROM outbox_events
+			WHERE seq IS NULL
+		) p, outbox_sequence q
+		WHERE q.id = 1 AND o.event_id = p.event_id
 	`)
-	if err := row.Scan(&offset.LastEventTime, &offset.LastEventID); err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return store.OutboxOffset{}, nil
+	if err != nil || tag.RowsAffected() == 0 {
+		return err
+	}
+	_, err = tx.Exec(ctx, `UPDATE outbox_sequence SET last_seq = last_seq + $1 WHERE id = 1`, tag.RowsAffected())
+	return err
+}
+
+// snapshot runs read in one repeatable-read transaction together with the
+// outbox head: every event the snapshot can see is numbered at or below
+// head, and every event it cannot see will be numbered above it. The
+// sequencer lock is taken on the connection before the transaction starts,
+// so no other reader numbers events the snapshot cannot see.
+func (s *Store) snapshot(ctx context.Context, read func(tx pgx.Tx, head int64) error) (err error) {
+	conn, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock(hashtext($1))`, outboxSequencerLock); err != nil {
+		return err
+	}
+	defer func() {
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock(hashtext($1))`, outboxSequencerLock); err != nil {
+			// A lock left on a pooled connection would stall every reader,
+			// so the connection is closed and the pool drops it.
+			_ = conn.Conn().Close(context.Background())
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
 		}
-		return store.OutboxOffset{}, err
+	}()
+	if err = numberOutbox(ctx, tx); err != nil {
+		return err
+	}
+	var head int64
+	if err = tx.QueryRow(ctx, `SELECT last_seq FROM outbox_sequence WHERE id = 1`).Scan(&head); err != nil {
+		return err
 	}
-	return offset, nil
+	if err = read(tx, head); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
-func (s *Store) UpdateOffset(ctx context.Context, offset store.OutboxOffset) error {
+// RegisterConsumer adds name to the outbox consumer registry. A new
+// consumer starts before the oldest retained event.
+func (s *Store) RegisterConsumer(ctx context.Context, name string) error {
 	_, err := s.pool.Exec(ctx, `
-		INSERT INTO realtime_offsets (id, last_event_time, last_event_id)
-		VALUES (1, $1, $2)
-		ON CONFLICT (id) DO UPDATE SET last_event_time = EXCLUDED.last_event_time, last_event_id = EXCLUDED.last_event_id
-	`, offset.LastEventTime, offset.LastEventID)
+		INSERT INTO outbox_consumers (name, last_seq)
+		VALUES ($1, 0)
+		ON CONFLICT (name) DO NOTHING
+	`, name)
 	return err
 }
 
-func (s *Store) GetNotificationOffset(ctx context.Context) (time.Time, error) {
-	var value time.Time
+func (s *Store) GetOffset(ctx context.Context, name string) (int64, error) {
+	var seq int64
 	row := s.pool.QueryRow(ctx, `
-		SELECT last_event_time
-		FROM notification_offsets
-		WHERE id = 1
-	`)
-	if err := row.Scan(&value); err != nil {
+		SELECT last_seq
+		FROM outbox_consumers
+		WHERE name = $1
+	`, name)
+	if err := row.Scan(&seq); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return time.Time{}, nil
+			return 0, nil
 		}
-		return time.Time{}, err
+		return 0, err
 	}
-	return value, nil
+	return seq, nil
 }
 
-func (s *Store) CleanupOutbox(ctx context.Context, before time.Time) error {
-	if before.IsZero() {
-		return nil
-	}
+func (s *Store) UpdateOffset(ctx context.Context, name string, seq int64) error {
 	_, err := s.pool.Exec(ctx, `
-		DELETE FROM outbox_events
-		WHERE created_at < $1
-	`, before)
+		UPDATE outbox_consumers
+		SET last_seq = GREATEST(last_seq, $2), updated_at = NOW()
+		WHERE name = $1
+	`, name, seq)
 	return err
 }
 
+// CleanupOutbox removes events every registered consumer has acknowledged,
+// moving them to outbox_events_archive when archive is set. Nothing is
+// removed while no consumer is registered.
+func (s *Store) CleanupOutbox(ctx context.Context, archive bool) (int64, error) {
+	query := `
+		DELETE FROM outbox_events
+		WHERE seq <= (SELECT MIN(last_seq) FROM outbox_consumers)
+	`
+	if archive {
+		query = `
+			WITH moved AS (
+				DELETE FROM outbox_events
+				WHERE seq <= (SELECT MIN(last_seq) FROM outbox_consumers)
+				RETURNING seq, event_id, tenant_id, type, payload_json, created_at
+			)
+			INSERT INTO outbox_events_archive (seq, event_id, tenant_id, type, payload_json, created_at)
+			SELECT seq, event_id, tenant_id, type, payload_json, created_at FROM moved
+		`
+	}
+	tag, err := s.pool.Exec(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
 func (s *Store) GetSession(ctx context.Context, sessionID string) (store.Session, error) {
 	var session store.Session
 	row := s.pool.QueryRow(ctx, `
@@ -108,7 +211,7 @@ func (s *Store) GetSession(ctx context.Context, sessionID string) (store.Session
 		FROM sessions s
 		JOIN users u ON u.user_id = s.user_id
 		JOIN roles r ON r.role_id = u.role_id
-		WHERE s.session_id = $1 AND s.expires_at > NOW()
+		WHERE s.session_id = $1 AND s.expires_at > NOW() AND u.active = TRUE
 	`, sessionID)
 	if err := row.Scan(&session.SessionID, &session.UserID, &session.ExpiresAt, &session.TenantID, &session.Role); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -166,3 +269,217 @@ func (s *Store) GetAccess(ctx context.Context, userID string) ([]string, []strin
 
 	return branches, services, nil
 }
+
+func (s *Store) GetDevice(ctx context.Context, deviceID string) (store.Device, error) {
+	var device store.Device
+	var areaID, tokenHash *string
+	row := s.pool.QueryRow(ctx, `
+		SELECT device_id, tenant_id, branch_id, area_id, type, token_hash
+		FROM devices
+		WHERE device_id = $1
+	`, deviceID)
+	if err := row.Scan(&device.DeviceID, &device.TenantID, &device.BranchID, &areaID, &device.Type, &tokenHash); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return store.Device{}, store.ErrDeviceNotFound
+		}
+		return store.Device{}, err
+	}
+	if areaID != nil {
+		device.AreaID = *areaID
+	}
+	if tokenHash != nil {
+		device.TokenHash = *tokenHash
+	}
+	return device, nil
+}
+
+func (s *Store) SetDeviceOnline(ctx context.Context, deviceID string) (time.Time, error) {
+	var seen time.Time
+	err := s.pool.QueryRow(ctx, `
+		UPDATE devices
+		SET status = 'online', last_seen = NOW()
+		WHERE device_id = $1
+		RETURNING last_seen
+	`, deviceID).Scan(&seen)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, store.ErrDeviceNotFound
+	}
+	return seen, err
+}
+
+func (s *Store) SetDeviceOffline(ctx context.Context, deviceID string, seenAt time.Time) error {
+	_, err := s.pool.Exec(ctx, `
+		UPDATE devices
+		SET status = 'offline'
+		WHERE device_id = $1 AND last_seen <= $2
+	`, deviceID, seenAt)
+	return err
+}
+
+// LoadBoard reads a branch's board inputs in one repeatable-read snapshot
+// together with the outbox head, so the caller can tell which events the
+// snapshot already reflects.
+func (s *Store) LoadBoard(ctx context.Context, tenantID, branchID string, recent int) (store.BoardSnapshot, error) {
+	snapshot := store.BoardSnapshot{AvgServiceSeconds: map[string]float64{}, Routing: map[string]store.Routing{}}
+	err := s.snapshot(ctx, func(tx pgx.Tx, head int64) error {
+		snapshot.Seq = head
+		var err error
+		snapshot.Tickets, err = queryTickets(ctx, tx, ticketSelect+`
+			WHERE t.tenant_id = $1 AND t.branch_id = $2
+				AND t.status IN ('remote', 'waiting', 'held', 'called', 'serving')
+			ORDER BY t.queued_at ASC, t.created_at ASC
+		`, tenantID, branchID)
+		if err != nil {
+			return err
+		}
+		snapshot.Recent, err = queryTickets(ctx, tx, ticketSelect+`
+			WHERE t.tenant_id = $1 AND t.branch_id = $2 AND t.called_at IS NOT NULL
+			ORDER BY t.called_at DESC
+			LIMIT $3
+		`, tenantID, branchID, recent)
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(ctx, `
+			SELECT service_id, AVG(EXTRACT(EPOCH FROM (completed_at - served_at)) / party_size)::float8
+			FROM tickets
+			WHERE tenant_id = $1 AND branch_id = $2
+				AND served_at IS NOT NULL AND completed_at > NOW() - INTERVAL '4 hours'
+			GROUP BY service_id
+		`, tenantID, branchID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var serviceID string
+			var avg float64
+			if err := rows.Scan(&serviceID, &avg); err != nil {
+				return err
+			}
+			snapshot.AvgServiceSeconds[serviceID] = avg
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		policies, err := tx.Query(ctx, `
+			SELECT service_id, appointment_ratio_percent, appointment_boost_minutes
+			FROM service_policies
+			WHERE tenant_id = $1 AND branch_id = $2
+		`, tenantID, branchID)
+		if err != nil {
+			return err
+		}
+		defer policies.Close()
+		for policies.Next() {
+			var serviceID string
+			var routing store.Routing
+			if err := policies.Scan(&serviceID, &routing.AppointmentRatioPercent, &routing.AppointmentBoostMinutes); err != nil {
+				return err
+			}
+			snapshot.Routing[serviceID] = routing
+		}
+		return policies.Err()
+	})
+	if err != nil {
+		return store.BoardSnapshot{}, err
+	}
+	return snapshot, nil
+}
+
+// LoadTickets reads the open tickets in one repeatable-read snapshot
+// together with the outbox head, like LoadBoard.
+func (s *Store) LoadTickets(ctx context.Context, tenantID string, branchIDs []string, limit int) (store.TicketSnapshot, error) {
+	// A nil slice is sent as NULL, which matches every branch.
+	var branches []string
+	if len(branchIDs) > 0 {
+		branches = branchIDs
+	}
+	var snapshot store.TicketSnapshot
+	err := s.snapshot(ctx, func(tx pgx.Tx, head int64) error {
+		snapshot.Seq = head
+		var err error
+		snapshot.Tickets, err = queryTickets(ctx, tx, ticketSelect+`
+			WHERE t.tenant_id = $1 AND ($2::uuid[] IS NULL OR t.branch_id = ANY($2::uuid[]))
+				AND t.status IN ('remote', 'waiting', 'held', 'called', 'serving')
+			ORDER BY t.queued_at ASC, t.created_at ASC
+			LIMIT $3
+		`, tenantID, branches, limit+1)
+		return err
+	})
+	if err != nil {
+		return store.TicketSnapshot{}, err
+	}
+	if len(snapshot.Tickets) > limit {
+		snapshot.Tickets, snapshot.Truncated = snapshot.Tickets[:limit], true
+	}
+	return snapshot, nil
+}
+
+// ticketSelect is what queryTickets scans. Counter and service names come
+// along so snapshots show them without further lookups.
+const ticketSelect = `
+		SELECT t.ticket_id, t.ticket_number, t.status, t.branch_id, t.service_id, t.area_id, t.counter_id,
+			t.created_at, t.called_at, t.recall_count, COALESCE(c.name, ''), COALESCE(s.name, ''),
+			t.queued_at, t.priority_class, a.scheduled_at, t.party_size
+		FROM tickets t
+		LEFT JOIN counters c ON c.counter_id = t.counter_id
+		LEFT JOIN services s ON s.service_id = t.service_id
+		LEFT JOIN appointments a ON a.appointment_id = t.appointment_id`
+
+func queryTickets(ctx context.Context, tx pgx.Tx, query string, args ...any) ([]store.Ticket, error) {
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tickets []store.Ticket
+	for rows.Next() {
+		var ticket store.Ticket
+		var areaID, counterID *string
+		var calledAt *time.Time
+		if err := rows.Scan(&ticket.TicketID, &ticket.TicketNumber, &ticket.Status, &ticket.BranchID, &ticket.ServiceID, &areaID, &counterID, &ticket.CreatedAt, &calledAt, &ticket.RecallCount, &ticket.CounterName, &ticket.ServiceName,
+			&ticket.QueuedAt, &ticket.PriorityClass, &ticket.ScheduledAt, &ticket.PartySize); err != nil {
+			return nil, err
+		}
+		if areaID != nil {
+			ticket.AreaID = *areaID
+		}
+		if counterID != nil {
+			ticket.CounterID = *counterID
+		}
+		ticket.CalledAt = calledAt
+		tickets = append(tickets, ticket)
+	}
+	return tickets, rows.Err()
+}
+
+func (s *Store) LoadNames(ctx context.Context, branchID string) (store.Names, error) {
+	names := store.Names{Counters: map[string]string{}, Services: map[string]string{}}
+	if err := scanNames(ctx, s.pool, names.Counters, `SELECT counter_id, name FROM counters WHERE branch_id = $1`, branchID); err != nil {
+		return store.Names{}, err
+	}
+	if err := scanNames(ctx, s.pool, names.Services, `SELECT service_id, name FROM services WHERE branch_id = $1`, branchID); err != nil {
+		return store.Names{}, err
+	}
+	return names, nil
+}
+
+func scanNames(ctx context.Context, pool *pgxpool.Pool, into map[string]string, query string, args ...any) error {
+	rows, err := pool.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return err
+		}
+		into[id] = name
+	}
+	return rows.Err()
+}
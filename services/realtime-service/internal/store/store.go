@@ -6,6 +6,7 @@ import (
 )
 
 type OutboxEvent struct {
+	Seq       int64
 	EventID   string
 	TenantID  string
 	Type      string
@@ -13,11 +14,6 @@ type OutboxEvent struct {
 	CreatedAt time.Time
 }
 
-type OutboxOffset struct {
-	LastEventTime time.Time
-	LastEventID   string
-}
-
 type Session struct {
 	SessionID string
 	UserID    string
@@ -26,12 +22,95 @@ type Session struct {
 	ExpiresAt time.Time
 }
 
+// Device is a registered display or kiosk. TokenHash is the hex SHA-256 of
+// its token secret, empty until admin-service issues one.
+type Device struct {
+	DeviceID  string
+	TenantID  string
+	BranchID  string
+	AreaID    string
+	Type      string
+	TokenHash string
+}
+
+// Ticket is the part of a ticket realtime snapshots need.
+type Ticket struct {
+	TicketID     string
+	TicketNumber string
+	Status       string
+	BranchID     string
+	ServiceID    string
+	AreaID       string
+	CounterID    string
+	CreatedAt    time.Time
+	CalledAt     *time.Time
+	RecallCount  int
+	CounterName  string
+	ServiceName  string
+	// QueuedAt, PriorityClass and ScheduledAt order the queue as CallNext
+	// does. ScheduledAt is set for checked-in appointments.
+	QueuedAt      time.Time
+	PriorityClass string
+	ScheduledAt   *time.Time
+	PartySize     int
+}
+
+// Routing is the part of a service's policy that decides where its
+// appointments fall in the queue.
+type Routing struct {
+	AppointmentRatioPercent int
+	AppointmentBoostMinutes int
+}
+
+// BoardSnapshot is one branch's board inputs as of outbox Seq: events at or
+// before Seq are already reflected in it.
+type BoardSnapshot struct {
+	Seq int64
+	// Tickets are the branch's open tickets in queue order.
+	Tickets []Ticket
+	// Recent are the most recently called tickets, newest first.
+	Recent []Ticket
+	// AvgServiceSeconds is the recent average service time per person by
+	// service.
+	AvgServiceSeconds map[string]float64
+	// Routing is the appointment policy of each service that has one.
+	Routing map[string]Routing
+}
+
+// TicketSnapshot is a tenant's open tickets as of outbox Seq, in queue order.
+// Truncated is set when there were more than the limit.
+type TicketSnapshot struct {
+	Seq       int64
+	Tickets   []Ticket
+	Truncated bool
+}
+
+// Names maps a branch's counter and service ids to their display names.
+type Names struct {
+	Counters map[string]string
+	Services map[string]string
+}
+
 type Store interface {
-	ListOutboxEvents(ctx context.Context, offset OutboxOffset, limit int) ([]OutboxEvent, error)
-	GetOffset(ctx context.Context) (OutboxOffset, error)
-	UpdateOffset(ctx context.Context, offset OutboxOffset) error
-	GetNotificationOffset(ctx context.Context) (time.Time, error)
-	CleanupOutbox(ctx context.Context, before time.Time) error
+	ListOutboxEvents(ctx context.Context, afterSeq int64, limit int) ([]OutboxEvent, error)
+	RegisterConsumer(ctx context.Context, name string) error
+	GetOffset(ctx context.Context, name string) (int64, error)
+	UpdateOffset(ctx context.Context, name string, seq int64) error
+	CleanupOutbox(ctx context.Context, archive bool) (int64, error)
+	// GetSession returns ErrSessionNotFound once the session has expired,
+	// been deleted, or its user deactivated.
 	GetSession(ctx context.Context, sessionID string) (Session, error)
 	GetAccess(ctx context.Context, userID string) ([]string, []string, error)
+	GetDevice(ctx context.Context, deviceID string) (Device, error)
+	// SetDeviceOnline marks the device online and returns the last_seen it
+	// set.
+	SetDeviceOnline(ctx context.Context, deviceID string) (time.Time, error)
+	// SetDeviceOffline marks the device offline unless it has been seen
+	// after seenAt.
+	SetDeviceOffline(ctx context.Context, deviceID string, seenAt time.Time) error
+	LoadBoard(ctx context.Context, tenantID, branchID string, recent int) (BoardSnapshot, error)
+	// LoadTickets returns up to limit open tickets of the tenant, of
+	// branchIDs only when it is not empty.
+	LoadTickets(ctx context.Context, tenantID string, branchIDs []string, limit int) (TicketSnapshot, error)
+	LoadNames(ctx context.Context, branchID string) (Names, error)
 }